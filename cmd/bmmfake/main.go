@@ -0,0 +1,111 @@
+// Command bmmfake serves a fake NVIDIA BMM API for running the cloud controller manager locally
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+)
+
+// options are the flags of the bmmfake command
+type options struct {
+	listen  string
+	org     string
+	token   string
+	state   string
+	latency time.Duration
+}
+
+func main() {
+	if err := newCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// newCommand creates the bmmfake command
+func newCommand() *cobra.Command {
+	opts := &options{}
+
+	cmd := &cobra.Command{
+		Use:   "bmmfake",
+		Short: "Serve a fake NVIDIA BMM API",
+		Long: `Serve the subset of the NVIDIA BMM API used by the cloud provider from an in-memory state.
+
+The state, faults and request log are controlled through the /fake/ endpoints:
+  GET, PUT            /fake/state            dump or replace the state
+  PUT                 /fake/instances        add or replace an instance
+  DELETE              /fake/instances/{id}   delete an instance
+  GET, POST, DELETE   /fake/faults           list, add or clear faults
+  GET, DELETE         /fake/requests         dump or clear the request log`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.listen, "listen", "127.0.0.1:8080", "Address to serve the fake API on")
+	flags.StringVar(&opts.org, "org", "test-org", "NVIDIA BMM org served by the fake")
+	flags.StringVar(&opts.token, "token", "", "Bearer token required by the fake, none when empty")
+	flags.StringVar(&opts.state, "state", "", "JSON file with the initial state")
+	flags.DurationVar(&opts.latency, "latency", 0, "Latency added to every API request")
+	return cmd
+}
+
+// run serves the fake until interrupted
+func run(opts *options) error {
+	var serverOpts []bmmfake.Option
+	if opts.token != "" {
+		serverOpts = append(serverOpts, bmmfake.WithToken(opts.token))
+	}
+	fake := bmmfake.New(opts.org, serverOpts...)
+	defer fake.Close()
+
+	if opts.state != "" {
+		state, err := bmmfake.ReadStateFile(opts.state)
+		if err != nil {
+			return err
+		}
+		fake.Load(state)
+	}
+	if opts.latency > 0 {
+		if err := fake.AddFault(bmmfake.Slow("", opts.latency)); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: opts.listen, Handler: fake, ReadHeaderTimeout: 10 * time.Second}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+	klog.InfoS("Serving fake NVIDIA BMM API", "address", opts.listen, "org", opts.org)
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	fake.Close()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"maps"
+
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	"k8s.io/cloud-provider/app/config"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+	"k8s.io/klog/v2"
+
+	nvidiabmmprovider "github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/cloudprovider"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/migration"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/nodeipam"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/outofservice"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/poweraction"
+)
+
+func init() {
+	// Tainting nodes out of service force detaches their volumes, and power actions restart
+	// machines, so these controllers are opt-in
+	app.ControllersDisabledByDefault.Insert(outofservice.ControllerName, poweraction.ControllerName)
+}
+
+// controllerInitFuncConstructors returns the default cloud controllers and the NVIDIA BMM controllers
+func controllerInitFuncConstructors() map[string]app.ControllerInitFuncConstructor {
+	constructors := make(map[string]app.ControllerInitFuncConstructor, len(app.DefaultInitFuncConstructors)+4)
+	maps.Copy(constructors, app.DefaultInitFuncConstructors)
+	constructors[migration.ControllerName] = app.ControllerInitFuncConstructor{
+		InitContext: app.ControllerInitContext{ClientName: migration.ControllerName},
+		Constructor: startProviderIDMigrationControllerWrapper,
+	}
+	constructors[nodeipam.ControllerName] = app.ControllerInitFuncConstructor{
+		InitContext: app.ControllerInitContext{ClientName: nodeipam.ControllerName},
+		Constructor: startNodeIPAMControllerWrapper,
+	}
+	constructors[outofservice.ControllerName] = app.ControllerInitFuncConstructor{
+		InitContext: app.ControllerInitContext{ClientName: outofservice.ControllerName},
+		Constructor: startOutOfServiceControllerWrapper,
+	}
+	constructors[poweraction.ControllerName] = app.ControllerInitFuncConstructor{
+		InitContext: app.ControllerInitContext{ClientName: poweraction.ControllerName},
+		Constructor: startPowerActionControllerWrapper,
+	}
+	return constructors
+}
+
+// skipInDryRun reports whether a controller changing nodes must not be started, because the node
+// lifecycle dry run is enabled
+func skipInDryRun(cloud cloudprovider.Interface, controllerName string) bool {
+	bmmCloud, ok := cloud.(*nvidiabmmprovider.NvidiaBMMCloud)
+	if !ok || !bmmCloud.DryRun() {
+		return false
+	}
+	klog.InfoS("Node lifecycle dry run enabled, skipping controller", "controller", controllerName)
+	return true
+}
+
+// startProviderIDMigrationControllerWrapper starts the controller annotating nodes that have
+// legacy provider IDs with their canonical provider ID
+func startProviderIDMigrationControllerWrapper(
+	initContext app.ControllerInitContext, completedConfig *config.CompletedConfig, cloud cloudprovider.Interface,
+) app.InitFunc {
+	return func(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+		bmmCloud, ok := cloud.(*nvidiabmmprovider.NvidiaBMMCloud)
+		if !ok {
+			klog.InfoS("Provider ID migration controller requires the NVIDIA BMM cloud provider, skipping")
+			return nil, false, nil
+		}
+		if skipInDryRun(bmmCloud, migration.ControllerName) {
+			return nil, false, nil
+		}
+
+		migrationController, err := migration.NewController(
+			completedConfig.SharedInformers.Core().V1().Nodes(),
+			completedConfig.ClientBuilder.ClientOrDie(initContext.ClientName),
+			bmmCloud.TenantID(),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+
+		go migrationController.Run(ctx, 1)
+
+		return nil, true, nil
+	}
+}
+
+// startNodeIPAMControllerWrapper starts the controller allocating pod CIDRs from NVIDIA BMM prefixes
+// when --allocate-node-cidrs is set and --cidr-allocator-type is NvidiaBMM
+func startNodeIPAMControllerWrapper(
+	initContext app.ControllerInitContext, completedConfig *config.CompletedConfig, cloud cloudprovider.Interface,
+) app.InitFunc {
+	return func(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+		shared := completedConfig.ComponentConfig.KubeCloudShared
+		if !shared.AllocateNodeCIDRs || shared.CIDRAllocatorType != nodeipam.AllocatorType {
+			klog.V(2).InfoS("Node IPAM controller requires --allocate-node-cidrs and --cidr-allocator-type, skipping",
+				"cidrAllocatorType", nodeipam.AllocatorType)
+			return nil, false, nil
+		}
+		source, ok := cloud.(nodeipam.Source)
+		if !ok {
+			klog.InfoS("Node IPAM controller requires the NVIDIA BMM cloud provider, skipping")
+			return nil, false, nil
+		}
+		if skipInDryRun(cloud, nodeipam.ControllerName) {
+			return nil, false, nil
+		}
+
+		nodeIPAMController, err := nodeipam.NewController(
+			completedConfig.SharedInformers.Core().V1().Nodes(),
+			completedConfig.ClientBuilder.ClientOrDie(initContext.ClientName),
+			source,
+		)
+		if err != nil {
+			return nil, false, err
+		}
+
+		go nodeIPAMController.Run(ctx, 1)
+
+		return nil, true, nil
+	}
+}
+
+// startOutOfServiceControllerWrapper starts the controller tainting the nodes of shut down
+// instances out of service, when enabled with --controllers
+func startOutOfServiceControllerWrapper(
+	initContext app.ControllerInitContext, completedConfig *config.CompletedConfig, cloud cloudprovider.Interface,
+) app.InitFunc {
+	return func(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+		bmmCloud, ok := cloud.(*nvidiabmmprovider.NvidiaBMMCloud)
+		if !ok {
+			klog.InfoS("Out-of-service controller requires the NVIDIA BMM cloud provider, skipping")
+			return nil, false, nil
+		}
+		if skipInDryRun(bmmCloud, outofservice.ControllerName) {
+			return nil, false, nil
+		}
+
+		outOfServiceController, err := outofservice.NewController(
+			completedConfig.SharedInformers.Core().V1().Nodes(),
+			completedConfig.ClientBuilder.ClientOrDie(initContext.ClientName),
+			bmmCloud,
+			bmmCloud.OutOfServiceAfter(),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+
+		go outOfServiceController.Run(ctx, 1)
+
+		return nil, true, nil
+	}
+}
+
+// startPowerActionControllerWrapper starts the controller performing the power actions requested
+// with node annotations, when enabled with --controllers
+func startPowerActionControllerWrapper(
+	initContext app.ControllerInitContext, completedConfig *config.CompletedConfig, cloud cloudprovider.Interface,
+) app.InitFunc {
+	return func(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+		bmmCloud, ok := cloud.(*nvidiabmmprovider.NvidiaBMMCloud)
+		if !ok {
+			klog.InfoS("Power action controller requires the NVIDIA BMM cloud provider, skipping")
+			return nil, false, nil
+		}
+		if skipInDryRun(bmmCloud, poweraction.ControllerName) {
+			return nil, false, nil
+		}
+
+		powerActionController, err := poweraction.NewController(
+			completedConfig.SharedInformers.Core().V1().Nodes(),
+			completedConfig.ClientBuilder.ClientOrDie(initContext.ClientName),
+			bmmCloud,
+			bmmCloud.PowerActionLimits(),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+
+		go powerActionController.Run(ctx, 1)
+
+		return nil, true, nil
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/cloudprovider"
+)
+
+// doctorOptions are the flags of the doctor subcommand
+type doctorOptions struct {
+	cloudConfig string
+	kubeconfig  string
+	output      string
+}
+
+// newDoctorCommand creates the doctor subcommand, which diagnoses the cloud config, the
+// NVIDIA BMM API and the nodes of a cluster
+func newDoctorCommand() *cobra.Command {
+	opts := &doctorOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose the cloud config, the NVIDIA BMM API and the cluster nodes",
+		Long: `Diagnose why nodes are not initialized or updated by the cloud controller manager.
+
+The cloud config is loaded the way the cloud controller manager does, including the
+NVIDIA_BMM_* environment variables. doctor then checks that the NVIDIA BMM API is
+reachable and accepts the token, and that the site and tenant exist. Given a kubeconfig,
+it checks the provider ID of every node against the configuration, and the instance,
+status, addresses and zone of the node in NVIDIA BMM.
+
+doctor exits with an error when any check fails.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(cmd, opts)
+		},
+	}
+	defaults := &cobra.Command{}
+	cmd.SetUsageFunc(defaults.UsageFunc())
+	cmd.SetHelpFunc(defaults.HelpFunc())
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.cloudConfig, "cloud-config", "", "Path to the cloud config file")
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "Path to the kubeconfig, nodes are not checked when empty")
+	flags.StringVarP(&opts.output, "output", "o", "table", "Output format, table or json")
+	_ = cmd.MarkFlagRequired("cloud-config")
+
+	return cmd
+}
+
+// runDoctor diagnoses the cluster and prints the report
+func runDoctor(cmd *cobra.Command, opts *doctorOptions) error {
+	if opts.output != "table" && opts.output != "json" {
+		return fmt.Errorf("unknown output format %q, use table or json", opts.output)
+	}
+	config, err := os.Open(opts.cloudConfig)
+	if err != nil {
+		return fmt.Errorf("failed to open cloud config: %w", err)
+	}
+	defer config.Close()
+
+	ctx := commandContext(cmd)
+	var nodes []v1.Node
+	var kubeErr error
+	if opts.kubeconfig != "" {
+		nodes, kubeErr = listNodes(cmd, opts.kubeconfig)
+	}
+
+	report := cloudprovider.Diagnose(ctx, config, nodes)
+	if kubeErr != nil {
+		report.Findings = append(report.Findings, cloudprovider.Finding{
+			Check:    "kubernetes",
+			Severity: cloudprovider.SeverityError,
+			Message:  kubeErr.Error(),
+			Action:   "Check --kubeconfig and the permission to list nodes",
+		})
+	}
+
+	if opts.output == "json" {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else if err := writeDoctorReport(cmd.OutOrStdout(), report); err != nil {
+		return err
+	}
+
+	if failed := report.Errors(); failed > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("doctor found %d failed checks", failed)
+	}
+	return nil
+}
+
+// listNodes lists the nodes of the cluster of a kubeconfig
+func listNodes(cmd *cobra.Command, kubeconfig string) ([]v1.Node, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := client.CoreV1().Nodes().List(commandContext(cmd), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return nodes.Items, nil
+}
+
+// writeDoctorReport prints the checks, a node summary, then the actions of the failed checks
+func writeDoctorReport(out io.Writer, report *cloudprovider.DoctorReport) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tRESULT\tMESSAGE")
+	for _, finding := range report.Findings {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", finding.Check, finding.Severity, finding.Message)
+	}
+	if len(report.Nodes) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "NODE\tRESULT\tINSTANCE\tSTATUS\tADDRESSES\tZONE")
+		for _, node := range report.Nodes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", node.Node, node.Severity(), orNone(node.InstanceID),
+				orNone(node.Status), orNone(strings.Join(node.Addresses, ",")), orNone(node.Zone))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var findings []string
+	for _, finding := range report.Findings {
+		findings = append(findings, describeFinding("", finding)...)
+	}
+	for _, node := range report.Nodes {
+		for _, finding := range node.Findings {
+			findings = append(findings, describeFinding(node.Node, finding)...)
+		}
+	}
+	if len(findings) > 0 {
+		fmt.Fprintf(out, "\nFindings:\n%s\n", strings.Join(findings, "\n"))
+	}
+	return nil
+}
+
+// describeFinding returns the lines describing a warning or an error with its action
+func describeFinding(node string, finding cloudprovider.Finding) []string {
+	if finding.Severity == cloudprovider.SeverityOK {
+		return nil
+	}
+	subject := finding.Check
+	if node != "" {
+		subject = node + " " + subject
+	}
+	lines := []string{fmt.Sprintf("  [%s] %s: %s", finding.Severity, subject, finding.Message)}
+	if finding.Action != "" {
+		lines = append(lines, "      -> "+finding.Action)
+	}
+	return lines
+}
+
+// orNone returns the value, or a dash when it is empty
+func orNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/cloudprovider"
+)
+
+// dryRunOptions are the flags of the dry-run subcommand
+type dryRunOptions struct {
+	cloudConfig string
+	kubeconfig  string
+	output      string
+}
+
+// newDryRunCommand creates the dry-run subcommand, which reports the changes the cloud node
+// controllers would make to the nodes of a cluster
+func newDryRunCommand() *cobra.Command {
+	opts := &dryRunOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "dry-run",
+		Short: "Report the changes the cloud controller manager would make to the cluster nodes",
+		Long: `Report the changes the cloud controller manager would make to the cluster nodes, without
+making them.
+
+The cloud config is loaded the way the cloud controller manager does, including the
+NVIDIA_BMM_* environment variables. For every node, the provider answers InstanceExists,
+InstanceShutdown and InstanceMetadata, and the answers are compared with the Node object:
+NotReady nodes that would be deleted or tainted as shut down, and the provider ID, addresses
+and labels that would change.
+
+The cluster is only read. To run the cloud controller manager itself without changing the
+nodes, set nodeLifecycle.dryRun in the cloud config.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDryRun(cmd, opts)
+		},
+	}
+	defaults := &cobra.Command{}
+	cmd.SetUsageFunc(defaults.UsageFunc())
+	cmd.SetHelpFunc(defaults.HelpFunc())
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.cloudConfig, "cloud-config", "", "Path to the cloud config file")
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "Path to the kubeconfig of the cluster")
+	flags.StringVarP(&opts.output, "output", "o", "table", "Output format, table or json")
+	_ = cmd.MarkFlagRequired("cloud-config")
+	_ = cmd.MarkFlagRequired("kubeconfig")
+
+	return cmd
+}
+
+// runDryRun computes the node changes and prints them
+func runDryRun(cmd *cobra.Command, opts *dryRunOptions) error {
+	if opts.output != "table" && opts.output != "json" {
+		return fmt.Errorf("unknown output format %q, use table or json", opts.output)
+	}
+	config, err := os.Open(opts.cloudConfig)
+	if err != nil {
+		return fmt.Errorf("failed to open cloud config: %w", err)
+	}
+	defer config.Close()
+
+	nodes, err := listNodes(cmd, opts.kubeconfig)
+	if err != nil {
+		return err
+	}
+	changes, err := cloudprovider.PlanNodes(commandContext(cmd), config, nodes)
+	if err != nil {
+		return err
+	}
+
+	if opts.output == "json" {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(changes)
+	}
+	return writeNodeChanges(cmd.OutOrStdout(), changes, len(nodes))
+}
+
+// writeNodeChanges prints the node changes as a table
+func writeNodeChanges(out io.Writer, changes []cloudprovider.NodeChange, nodes int) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintf(out, "No changes to the %d nodes\n", nodes)
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tCHANGE\tFIELD\tCURRENT\tDESIRED")
+	for _, change := range changes {
+		desired := change.Desired
+		if change.Change == cloudprovider.ChangeError {
+			desired = change.Message
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", change.Node, change.Change, orNone(change.Field),
+			orNone(change.Current), orNone(desired))
+	}
+	return w.Flush()
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
-	"fmt"
 	"os"
 
+	"k8s.io/apimachinery/pkg/util/wait"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	"k8s.io/cloud-provider/app/config"
+	"k8s.io/cloud-provider/names"
+	"k8s.io/cloud-provider/options"
+	"k8s.io/component-base/cli"
+	cliflag "k8s.io/component-base/cli/flag"
+	_ "k8s.io/component-base/logs/json/register"          // register optional JSON log format
+	_ "k8s.io/component-base/metrics/prometheus/clientgo" // load all the prometheus client-go plugins
+	_ "k8s.io/component-base/metrics/prometheus/version"  // for version metric registration
 	"k8s.io/klog/v2"
 
 	// Import NVIDIA BMM cloud provider to register it
@@ -16,33 +26,41 @@ const (
 )
 
 func main() {
-	klog.InitFlags(nil)
-
-	fmt.Println("NVIDIA BMM Cloud Controller Manager")
-	fmt.Println("====================================")
-	fmt.Println()
-	fmt.Println("This is a cloud provider implementation for NVIDIA BMM.")
-	fmt.Println()
-	fmt.Println("To build and run a full cloud controller manager, you need to:")
-	fmt.Println("1. Ensure all k8s.io/* dependencies are aligned to the same version")
-	fmt.Println("2. Use k8s.io/cloud-provider/app.NewCloudControllerManagerCommand()")
-	fmt.Println("3. Integrate with your Kubernetes version's cloud controller framework")
-	fmt.Println()
-	fmt.Println("The cloud provider implementation is in pkg/cloudprovider/")
-	fmt.Println()
-	fmt.Println("For production use, integrate this with your Kubernetes distribution's")
-	fmt.Println("cloud controller manager framework, ensuring version compatibility.")
-
-	// TODO: Full implementation would use k8s.io/cloud-provider/app
-	// command := app.NewCloudControllerManagerCommand()
-	// if err := command.Execute(); err != nil {
-	// 	fmt.Fprintf(os.Stderr, "error: %v\n", err)
-	// 	os.Exit(1)
-	// }
-
-	klog.Info("Cloud provider 'nvidia-bmm' is registered and available")
-	klog.Info("Provider implements: InstancesV2, Zones")
-	klog.Info("Provider does not implement: LoadBalancer, Routes")
-
-	os.Exit(0)
+	ccmOptions, err := options.NewCloudControllerManagerOptions()
+	if err != nil {
+		klog.Fatalf("unable to initialize command options: %v", err)
+	}
+
+	fss := cliflag.NamedFlagSets{}
+	command := app.NewCloudControllerManagerCommand(
+		ccmOptions, cloudInitializer, controllerInitFuncConstructors(),
+		names.CCMControllerAliases(), fss, wait.NeverStop,
+	)
+	command.Use = ComponentName
+	command.AddCommand(newProviderIDCommand(), newMigrateCommand(), newDoctorCommand(), newDryRunCommand())
+
+	os.Exit(cli.Run(command))
+}
+
+// cloudInitializer creates the cloud provider selected with --cloud-provider and --cloud-config
+func cloudInitializer(config *config.CompletedConfig) cloudprovider.Interface {
+	cloudConfig := config.ComponentConfig.KubeCloudShared.CloudProvider
+
+	cloud, err := cloudprovider.InitCloudProvider(cloudConfig.Name, cloudConfig.CloudConfigFile)
+	if err != nil {
+		klog.Fatalf("Cloud provider could not be initialized: %v", err)
+	}
+	if cloud == nil {
+		klog.Fatalf("Cloud provider %q is not registered", cloudConfig.Name)
+	}
+
+	if !cloud.HasClusterID() {
+		if config.ComponentConfig.KubeCloudShared.AllowUntaggedCloud {
+			klog.Warning("detected a cluster without a ClusterID. A ClusterID will be required in the future.")
+		} else {
+			klog.Fatalf("no ClusterID found. A ClusterID is required for the cloud provider to function properly. " +
+				"This check can be bypassed by setting the allow-untagged-cloud option")
+		}
+	}
+	return cloud
 }
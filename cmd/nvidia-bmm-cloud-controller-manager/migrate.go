@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/migration"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+// migrateOptions are the flags shared by the migrate-providerid subcommands
+type migrateOptions struct {
+	kubeconfig string
+	tenant     string
+}
+
+// client creates a Kubernetes client from the kubeconfig, or the in-cluster configuration
+func (o *migrateOptions) client() (kubernetes.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// newMigrateCommand creates the migrate-providerid subcommand, used to move nodes with
+// legacy 3-segment provider IDs to the canonical 4-segment format
+func newMigrateCommand() *cobra.Command {
+	opts := &migrateOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "migrate-providerid",
+		Short: "Report and migrate nodes with legacy 3-segment provider IDs",
+		Long: `Report and migrate nodes with legacy 3-segment provider IDs (nvidia-bmm://org/site/id)
+to the canonical 4-segment format (nvidia-bmm://org/tenant/site/id).
+
+Since spec.providerID is immutable, each node is migrated by re-registering it:
+  1. migrate-providerid reregister <node> cordons and drains the node
+  2. on the host, stop the kubelet; the node is deleted once it stops reporting
+  3. on the host, remove the legacy --provider-id flag of the kubelet, configure the
+     canonical provider ID, for instance with a drop-in written by the providerid
+     subcommand, and start the kubelet
+  4. the kubelet registers the node again with the canonical provider ID`,
+	}
+	defaults := &cobra.Command{}
+	cmd.SetUsageFunc(defaults.UsageFunc())
+	cmd.SetHelpFunc(defaults.HelpFunc())
+
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "Path to the kubeconfig, the in-cluster configuration is used when empty")
+	flags.StringVar(&opts.tenant, "tenant", "", "NVIDIA BMM tenant of the canonical provider IDs")
+
+	cmd.AddCommand(
+		newMigrateReportCommand(opts),
+		newMigrateAnnotateCommand(opts),
+		newMigrateReregisterCommand(opts),
+	)
+	return cmd
+}
+
+// newMigrateReportCommand lists nodes with their provider ID migration status
+func newMigrateReportCommand(opts *migrateOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "report",
+		Short: "List nodes with their provider ID and migration status",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			nodes, err := client.CoreV1().Nodes().List(commandContext(cmd), metav1.ListOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to list nodes: %w", err)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NODE\tSTATUS\tPROVIDER ID\tCANONICAL PROVIDER ID")
+			for _, report := range migration.Report(nodes.Items, opts.tenant) {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", report.Node, report.Status, report.ProviderID, report.CanonicalProviderID)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+// newMigrateAnnotateCommand annotates nodes with legacy provider IDs with their canonical provider ID
+func newMigrateAnnotateCommand(opts *migrateOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "annotate",
+		Short: "Annotate nodes with legacy provider IDs with their canonical provider ID",
+		Long: fmt.Sprintf(`Annotate nodes with legacy provider IDs with %s and label them
+with %s=true. The provider ID migration controller of the cloud controller manager
+does the same continuously.`, migration.AnnotationCanonicalProviderID, migration.LabelLegacyProviderID),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.tenant == "" {
+				return fmt.Errorf("--tenant is required")
+			}
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			ctx := commandContext(cmd)
+			nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to list nodes: %w", err)
+			}
+			for i := range nodes.Items {
+				node := &nodes.Items[i]
+				patched, err := migration.AnnotateNode(ctx, client, node, opts.tenant)
+				if err != nil {
+					return err
+				}
+				if patched {
+					fmt.Fprintf(cmd.OutOrStdout(), "Updated node %s\n", node.Name)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// newMigrateReregisterCommand cordons, drains and deletes a node once its kubelet is stopped,
+// so it can re-register
+func newMigrateReregisterCommand(opts *migrateOptions) *cobra.Command {
+	r := &migration.Reregisterer{}
+
+	cmd := &cobra.Command{
+		Use:   "reregister NODE",
+		Short: "Cordon, drain and delete a node with a legacy provider ID once its kubelet is stopped, so it can re-register",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.tenant == "" {
+				return fmt.Errorf("--tenant is required")
+			}
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			r.Client = client
+			r.Tenant = opts.tenant
+			r.Out = cmd.OutOrStdout()
+
+			canonical, err := r.Reregister(commandContext(cmd), args[0])
+			if err != nil {
+				return err
+			}
+			pid, err := providerid.ParseProviderID(canonical)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), `Node %s was deleted. On the host, remove the legacy --provider-id flag of the kubelet,
+since it takes precedence over the kubelet drop-in, and configure the canonical provider ID,
+either with --provider-id=%s
+or with the kubelet drop-in written by:
+  nvidia-bmm-cloud-controller-manager providerid --org=%s --tenant=%s --site=%s
+Then start the kubelet.
+`, args[0], canonical, pid.OrgName, pid.TenantName, pid.SiteName)
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&r.DrainTimeout, "drain-timeout", migration.DefaultDrainTimeout,
+		"Time to wait for pods to be evicted and terminate")
+	cmd.Flags().DurationVar(&r.KubeletStopTimeout, "kubelet-stop-timeout", migration.DefaultKubeletStopTimeout,
+		"Time to wait for the kubelet to be stopped before the node is deleted")
+	return cmd
+}
+
+// commandContext returns the context of a command, or a background context
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid/discovery"
+)
+
+// providerIDOptions are the flags of the providerid subcommand
+type providerIDOptions struct {
+	orgName          string
+	tenantName       string
+	siteName         string
+	metadataURL      string
+	sources          []string
+	root             string
+	kubeletConfigDir string
+	print            bool
+}
+
+// newProviderIDCommand creates the providerid subcommand, run on a node during boot to
+// write a kubelet configuration drop-in with the provider ID of the host
+func newProviderIDCommand() *cobra.Command {
+	opts := &providerIDOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "providerid",
+		Short: "Discover the provider ID of this host and write a kubelet configuration drop-in",
+		Long: `Discover the NVIDIA BMM instance ID of this host from the BMM machine metadata
+service, the DMI system UUID or the cloud-init instance data, and write a kubelet
+configuration drop-in setting providerID to nvidia-bmm://<org>/<tenant>/<site>/<instance-id>.
+The kubelet must be started with --config-dir pointing at the drop-in directory.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProviderID(commandContext(cmd), cmd, opts)
+		},
+	}
+	// Do not inherit the cloud controller manager usage and help, which list its flag sets
+	defaults := &cobra.Command{}
+	cmd.SetUsageFunc(defaults.UsageFunc())
+	cmd.SetHelpFunc(defaults.HelpFunc())
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.orgName, "org", "", "NVIDIA BMM organization name")
+	flags.StringVar(&opts.tenantName, "tenant", "", "NVIDIA BMM tenant of the provider ID")
+	flags.StringVar(&opts.siteName, "site", "", "NVIDIA BMM site of the provider ID")
+	flags.StringVar(&opts.metadataURL, "metadata-url", discovery.DefaultMetadataURL,
+		"Base URL of the BMM machine metadata service")
+	flags.StringSliceVar(&opts.sources, "sources", sourceNames(discovery.DefaultSources),
+		"Instance ID sources to try, in order (metadata, dmi, cloud-init)")
+	flags.StringVar(&opts.root, "root", "/", "Filesystem root to read sysfs and cloud-init files from")
+	flags.StringVar(&opts.kubeletConfigDir, "kubelet-config-dir", discovery.DefaultKubeletConfigDir,
+		"Kubelet configuration drop-in directory")
+	flags.BoolVar(&opts.print, "print", false, "Print the drop-in instead of writing it")
+	for _, name := range []string{"org", "tenant", "site"} {
+		_ = cmd.MarkFlagRequired(name)
+	}
+
+	return cmd
+}
+
+// runProviderID discovers the provider ID of the host and writes or prints the kubelet drop-in
+func runProviderID(ctx context.Context, cmd *cobra.Command, opts *providerIDOptions) error {
+	d := discovery.NewDiscoverer()
+	d.Root = opts.root
+	d.MetadataURL = opts.metadataURL
+	d.Sources = nil
+	for _, source := range opts.sources {
+		d.Sources = append(d.Sources, discovery.Source(source))
+	}
+
+	providerID, source, err := d.ProviderID(ctx, opts.orgName, opts.tenantName, opts.siteName)
+	if err != nil {
+		return err
+	}
+	klog.InfoS("Discovered provider ID", "providerID", providerID.String(), "source", source)
+
+	if opts.print {
+		_, err := cmd.OutOrStdout().Write(discovery.KubeletDropIn(providerID))
+		return err
+	}
+
+	path, err := discovery.WriteKubeletDropIn(opts.kubeletConfigDir, providerID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Wrote provider ID %s to %s\n", providerID, path)
+	return nil
+}
+
+// sourceNames returns the names of the given sources
+func sourceNames(sources []discovery.Source) []string {
+	names := make([]string, 0, len(sources))
+	for _, source := range sources {
+		names = append(names, string(source))
+	}
+	return names
+}
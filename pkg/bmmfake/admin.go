@@ -0,0 +1,84 @@
+package bmmfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+// adminPrefix is the path prefix of the endpoints controlling the fake. They are neither
+// authenticated nor logged.
+const adminPrefix = "/fake/"
+
+// handleAdmin registers the endpoints used to change the state, faults and request log
+// of a standalone fake:
+//
+//	GET, PUT        /fake/state            dump or replace the state
+//	PUT             /fake/instances        add or replace an instance
+//	DELETE          /fake/instances/{id}   delete an instance
+//	GET, POST, DELETE /fake/faults         list, add or clear faults
+//	GET, DELETE     /fake/requests         dump or clear the request log
+func (s *Server) handleAdmin() {
+	s.mux.HandleFunc("GET /fake/state", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.State())
+	})
+	s.mux.HandleFunc("PUT /fake/state", func(w http.ResponseWriter, r *http.Request) {
+		state, err := ReadState(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.Load(state)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	s.mux.HandleFunc("PUT /fake/instances", func(w http.ResponseWriter, r *http.Request) {
+		var instance restclient.Instance
+		if err := json.NewDecoder(r.Body).Decode(&instance); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid instance: %v", err))
+			return
+		}
+		writeJSON(w, http.StatusOK, s.AddInstance(instance))
+	})
+	s.mux.HandleFunc("DELETE /fake/instances/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+		if !s.DeleteInstance(id) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("instance %s not found", id))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	s.mux.HandleFunc("GET /fake/faults", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Faults())
+	})
+	s.mux.HandleFunc("POST /fake/faults", func(w http.ResponseWriter, r *http.Request) {
+		var fault Fault
+		if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid fault: %v", err))
+			return
+		}
+		if err := s.AddFault(fault); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s.mux.HandleFunc("DELETE /fake/faults", func(w http.ResponseWriter, r *http.Request) {
+		s.ClearFaults()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	s.mux.HandleFunc("GET /fake/requests", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Requests())
+	})
+	s.mux.HandleFunc("DELETE /fake/requests", func(w http.ResponseWriter, r *http.Request) {
+		s.ResetRequests()
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
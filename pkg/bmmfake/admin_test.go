@@ -0,0 +1,54 @@
+package bmmfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAdminEndpoints(t *testing.T) {
+	s := New(testOrg)
+	instanceID := uuid.New()
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodPut, "/fake/state", `{"sites": [{"name": "test-site"}]}`, http.StatusNoContent},
+		{http.MethodPut, "/fake/state", `{"sites": 1}`, http.StatusBadRequest},
+		{http.MethodPut, "/fake/instances", `{"id": "` + instanceID.String() + `", "name": "node-1"}`, http.StatusOK},
+		{http.MethodPost, "/fake/faults", `{"operation": "GetInstance", "latency": "10ms", "times": 1}`, http.StatusNoContent},
+		{http.MethodPost, "/fake/faults", `{"operation": "GetInstance"}`, http.StatusBadRequest},
+		{http.MethodGet, "/v2/org/test-org/carbide/instance/" + instanceID.String(), "", http.StatusOK},
+		{http.MethodDelete, "/fake/instances/" + instanceID.String(), "", http.StatusNoContent},
+		{http.MethodDelete, "/fake/instances/" + instanceID.String(), "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.status {
+			t.Errorf("%s %s status = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.status, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fake/requests", nil))
+	var requests []Request
+	if err := json.Unmarshal(rec.Body.Bytes(), &requests); err != nil {
+		t.Fatalf("Failed to decode the request log: %v", err)
+	}
+	if len(requests) != 1 || requests[0].Operation != OpGetInstance || requests[0].Status != http.StatusOK {
+		t.Errorf("Expected only the API request in the request log, got %+v", requests)
+	}
+
+	state := s.State()
+	if len(state.Sites) != 1 || len(state.Instances) != 0 || len(s.Faults()) != 0 {
+		t.Errorf("Unexpected state after the admin requests: %+v, faults %+v", state, s.Faults())
+	}
+}
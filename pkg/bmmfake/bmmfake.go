@@ -0,0 +1,458 @@
+// Package bmmfake serves the subset of the NVIDIA BMM REST API used by the cloud provider
+// from an in-memory state, with fault injection and a request log. It backs the tests
+// that exercise the real HTTP client, and local development through cmd/bmmfake.
+package bmmfake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+const (
+	// Operations served by the fake, named after the client methods
+	OpGetInstance      = "GetInstance"
+	OpGetAllInstance   = "GetAllInstance"
+	OpUpdateInstance   = "UpdateInstance"
+	OpGetSite          = "GetSite"
+	OpGetAllSite       = "GetAllSite"
+	OpGetInstanceType  = "GetInstanceType"
+	OpGetCurrentTenant = "GetCurrentTenant"
+	OpGetSubnet        = "GetSubnet"
+	OpGetVpcPrefix     = "GetVpcPrefix"
+
+	// DefaultPageSize is the page size of list operations without a pageSize parameter
+	DefaultPageSize = 20
+
+	// MaxPageSize is the largest page size accepted by list operations
+	MaxPageSize = 100
+
+	// requestIDHeader is the response header carrying the ID of the request
+	requestIDHeader = "X-Request-Id"
+
+	// maxBodySize bounds the request bodies read by the fake
+	maxBodySize = 1 << 20
+)
+
+// Request is an entry of the request log
+type Request struct {
+	// ID is the request ID returned in the X-Request-Id header
+	ID string `json:"id"`
+
+	// Operation is the API operation, empty when the request matched none
+	Operation string `json:"operation,omitempty"`
+
+	Method string     `json:"method"`
+	Path   string     `json:"path"`
+	Query  url.Values `json:"query,omitempty"`
+	Body   string     `json:"body,omitempty"`
+
+	// Status is the response status code, zero when the client went away first
+	Status int `json:"status"`
+}
+
+// Option configures a server
+type Option func(*Server)
+
+// WithToken makes the server reject requests without the given bearer token
+func WithToken(token string) Option {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// Server is a fake NVIDIA BMM API for a single org
+type Server struct {
+	org   string
+	token string
+	mux   *http.ServeMux
+
+	mu       sync.Mutex
+	store    *store
+	faults   []*activeFault
+	requests []Request
+	nextID   int
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	server    *httptest.Server
+}
+
+// New creates a fake API for org with an empty state. It can be served with Start, or
+// as an http.Handler.
+func New(org string, opts ...Option) *Server {
+	s := &Server{
+		org:    org,
+		mux:    http.NewServeMux(),
+		store:  newStore(),
+		closed: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.handle("GET /v2/org/{org}/carbide/instance", OpGetAllInstance, s.getAllInstance)
+	s.handle("GET /v2/org/{org}/carbide/instance/{id}", OpGetInstance, s.getInstance)
+	s.handle("PATCH /v2/org/{org}/carbide/instance/{id}", OpUpdateInstance, s.updateInstance)
+	s.handle("GET /v2/org/{org}/carbide/instance/type/{id}", OpGetInstanceType, s.getInstanceType)
+	s.handle("GET /v2/org/{org}/carbide/site", OpGetAllSite, s.getAllSite)
+	s.handle("GET /v2/org/{org}/carbide/site/{id}", OpGetSite, s.getSite)
+	s.handle("GET /v2/org/{org}/carbide/tenant/current", OpGetCurrentTenant, s.getCurrentTenant)
+	s.handle("GET /v2/org/{org}/carbide/subnet/{id}", OpGetSubnet, s.getSubnet)
+	s.handle("GET /v2/org/{org}/carbide/vpc-prefix/{id}", OpGetVpcPrefix, s.getVpcPrefix)
+	s.handleAdmin()
+	return s
+}
+
+// NewServer creates a fake API for org and starts serving it on a local port
+func NewServer(org string, opts ...Option) *Server {
+	s := New(org, opts...)
+	s.Start()
+	return s
+}
+
+// Start serves the fake API on a local port, see URL
+func (s *Server) Start() {
+	s.server = httptest.NewServer(s)
+}
+
+// URL returns the base URL of the started server
+func (s *Server) URL() string {
+	if s.server == nil {
+		return ""
+	}
+	return s.server.URL
+}
+
+// Close releases the requests held by faults and stops the started server
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+	if s.server != nil {
+		s.server.Close()
+	}
+}
+
+// Client creates an API client for the started server
+func (s *Server) Client(opts ...restclient.ClientOption) (*restclient.ClientWithResponses, error) {
+	return restclient.NewClientWithAuth(s.URL(), s.token, opts...)
+}
+
+// Requests returns the request log, oldest first
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestCount returns the number of logged requests of an operation
+func (s *Server) RequestCount(operation string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, req := range s.requests {
+		if req.Operation == operation {
+			count++
+		}
+	}
+	return count
+}
+
+// ResetRequests clears the request log
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// requestEntryKey is the context key of the request log entry being served
+type requestEntryKey struct{}
+
+// ServeHTTP serves the fake API and logs the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, adminPrefix) {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	s.mu.Lock()
+	s.nextID++
+	entry := &Request{
+		ID:     fmt.Sprintf("bmmfake-%d", s.nextID),
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Body:   string(body),
+	}
+	s.mu.Unlock()
+	if query := r.URL.Query(); len(query) > 0 {
+		entry.Query = query
+	}
+
+	// The request is logged before the response reaches the client, so that clients see
+	// their requests in the log as soon as they get the response
+	w.Header().Set(requestIDHeader, entry.ID)
+	sw := &statusWriter{ResponseWriter: w, onStatus: func(status int) {
+		entry.Status = status
+		s.logRequest(*entry)
+	}}
+	s.mux.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), requestEntryKey{}, entry)))
+	if sw.status == 0 {
+		s.logRequest(*entry)
+	}
+}
+
+// logRequest appends a request to the request log
+func (s *Server) logRequest(entry Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, entry)
+}
+
+// handle registers the handler of an operation, behind authentication, org and fault checks
+func (s *Server) handle(pattern, operation string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if entry, ok := r.Context().Value(requestEntryKey{}).(*Request); ok {
+			entry.Operation = operation
+		}
+		if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+			writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		if r.PathValue("org") != s.org {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("no access to org %q", r.PathValue("org")))
+			return
+		}
+		if s.applyFault(w, r, operation) {
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func (s *Server) getInstance(w http.ResponseWriter, r *http.Request) {
+	serveObject(s, w, r, "instance", func(st *store) map[uuid.UUID]restclient.Instance { return st.instances })
+}
+
+func (s *Server) getSite(w http.ResponseWriter, r *http.Request) {
+	serveObject(s, w, r, "site", func(st *store) map[uuid.UUID]restclient.Site { return st.sites })
+}
+
+func (s *Server) getInstanceType(w http.ResponseWriter, r *http.Request) {
+	serveObject(s, w, r, "instance type", func(st *store) map[uuid.UUID]restclient.InstanceType { return st.instanceTypes })
+}
+
+func (s *Server) getSubnet(w http.ResponseWriter, r *http.Request) {
+	serveObject(s, w, r, "subnet", func(st *store) map[uuid.UUID]restclient.Subnet { return st.subnets })
+}
+
+func (s *Server) getVpcPrefix(w http.ResponseWriter, r *http.Request) {
+	serveObject(s, w, r, "VPC prefix", func(st *store) map[uuid.UUID]restclient.VpcPrefix { return st.vpcPrefixes })
+}
+
+func (s *Server) getCurrentTenant(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	tenant := s.store.tenant
+	s.mu.Unlock()
+	if tenant == nil {
+		writeError(w, http.StatusNotFound, "org has no tenant")
+		return
+	}
+	writeJSON(w, http.StatusOK, tenant)
+}
+
+func (s *Server) getAllInstance(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var siteID, tenantID *uuid.UUID
+	for name, id := range map[string]**uuid.UUID{"siteId": &siteID, "tenantId": &tenantID} {
+		if value := query.Get(name); value != "" {
+			parsed, err := uuid.Parse(value)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s %q", name, value))
+				return
+			}
+			*id = &parsed
+		}
+	}
+	s.mu.Lock()
+	instances := sortedValues(s.store.instances)
+	s.mu.Unlock()
+
+	matched := []restclient.Instance{}
+	for _, instance := range instances {
+		if siteID != nil && (instance.SiteId == nil || *instance.SiteId != *siteID) {
+			continue
+		}
+		if tenantID != nil && (instance.TenantId == nil || *instance.TenantId != *tenantID) {
+			continue
+		}
+		if !matchesQuery(instance.Name, query.Get("query")) {
+			continue
+		}
+		matched = append(matched, instance)
+	}
+	servePage(w, r, matched)
+}
+
+func (s *Server) getAllSite(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	sites := sortedValues(s.store.sites)
+	s.mu.Unlock()
+
+	matched := []restclient.Site{}
+	for _, site := range sites {
+		if matchesQuery(site.Name, r.URL.Query().Get("query")) {
+			matched = append(matched, site)
+		}
+	}
+	servePage(w, r, matched)
+}
+
+func (s *Server) updateInstance(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var update restclient.InstanceUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid instance update: %v", err))
+		return
+	}
+
+	// Reboots are only recorded in the request log, the instance keeps its status
+	now := time.Now().UTC()
+	updated := s.UpdateInstance(id, func(instance *restclient.Instance) {
+		if update.Name != nil {
+			instance.Name = update.Name
+		}
+		instance.Updated = &now
+	})
+	if !updated {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("instance %s not found", id))
+		return
+	}
+	instance, _ := s.Instance(id)
+	writeJSON(w, http.StatusOK, instance)
+}
+
+// serveObject writes the object whose ID is in the request path
+func serveObject[T any](s *Server, w http.ResponseWriter, r *http.Request, kind string, objects func(*store) map[uuid.UUID]T) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	object, found := objects(s.store)[id]
+	if found {
+		object = clone(object)
+	}
+	s.mu.Unlock()
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s not found", kind, id))
+		return
+	}
+	writeJSON(w, http.StatusOK, object)
+}
+
+// servePage writes the page of items selected by the pageNumber and pageSize parameters
+func servePage[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	pageNumber, err := intParam(r, "pageNumber", 1)
+	if err != nil || pageNumber < 1 {
+		writeError(w, http.StatusBadRequest, "invalid pageNumber")
+		return
+	}
+	pageSize, err := intParam(r, "pageSize", DefaultPageSize)
+	if err != nil || pageSize < 1 || pageSize > MaxPageSize {
+		writeError(w, http.StatusBadRequest, "invalid pageSize")
+		return
+	}
+
+	start := (pageNumber - 1) * pageSize
+	if start > len(items) {
+		start = len(items)
+	}
+	end := min(start+pageSize, len(items))
+	writeJSON(w, http.StatusOK, items[start:end])
+}
+
+// intParam returns an integer query parameter, or def when it is not set
+func intParam(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// pathID parses the ID in the request path, writing a 400 response when it is invalid
+func pathID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid ID %q", r.PathValue("id")))
+		return uuid.UUID{}, false
+	}
+	return id, true
+}
+
+// matchesQuery reports whether a name contains the query, ignoring case
+func matchesQuery(name *string, query string) bool {
+	if query == "" {
+		return true
+	}
+	return name != nil && strings.Contains(strings.ToLower(*name), strings.ToLower(query))
+}
+
+// errorResponse is the body of error responses
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Message: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// statusWriter records the status code of a response, calling onStatus before it is written
+type statusWriter struct {
+	http.ResponseWriter
+	status   int
+	onStatus func(status int)
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.onStatus(status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
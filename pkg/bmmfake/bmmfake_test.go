@@ -0,0 +1,243 @@
+package bmmfake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+const testOrg = "test-org"
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// newTestServer starts a fake and a client for it, both closed with the test
+func newTestServer(t *testing.T, opts ...Option) (*Server, *restclient.ClientWithResponses) {
+	t.Helper()
+	s := NewServer(testOrg, opts...)
+	t.Cleanup(s.Close)
+	client, err := s.Client()
+	if err != nil {
+		t.Fatalf("Client() failed: %v", err)
+	}
+	return s, client
+}
+
+func TestGetObjects(t *testing.T) {
+	s, client := newTestServer(t)
+	ctx := context.Background()
+
+	site := s.AddSite(restclient.Site{Name: ptr("test-site")})
+	instanceType := s.AddInstanceType(restclient.InstanceType{Name: ptr("gb200-nvl"), SiteId: site.Id})
+	subnet := s.AddSubnet(restclient.Subnet{Ipv4Prefix: ptr("10.128.0.0/16")})
+	vpcPrefix := s.AddVpcPrefix(restclient.VpcPrefix{Prefix: ptr("10.200.1.0"), PrefixLength: ptr(24)})
+	instance := s.AddInstance(restclient.Instance{
+		Name:           ptr("node-1"),
+		SiteId:         site.Id,
+		InstanceTypeId: instanceType.Id,
+		Status:         ptr(restclient.InstanceStatus("Ready")),
+		Interfaces:     &[]restclient.Interface{{SubnetId: subnet.Id, IpAddresses: &[]string{"10.128.0.5"}}},
+	})
+	tenant := s.SetTenant(restclient.Tenant{Org: ptr(testOrg)})
+
+	instanceResp, err := client.GetInstanceWithResponse(ctx, testOrg, *instance.Id, nil)
+	if err != nil {
+		t.Fatalf("GetInstance() failed: %v", err)
+	}
+	if instanceResp.StatusCode() != http.StatusOK || !reflect.DeepEqual(instanceResp.JSON200, &instance) {
+		t.Errorf("GetInstance() = %d %+v, want %+v", instanceResp.StatusCode(), instanceResp.JSON200, instance)
+	}
+	if instanceResp.HTTPResponse.Header.Get(requestIDHeader) == "" {
+		t.Errorf("Expected a %s header", requestIDHeader)
+	}
+
+	siteResp, err := client.GetSiteWithResponse(ctx, testOrg, *site.Id, nil)
+	if err != nil || !reflect.DeepEqual(siteResp.JSON200, &site) {
+		t.Errorf("GetSite() = %v, %v, want %+v", siteResp, err, site)
+	}
+	typeResp, err := client.GetInstanceTypeWithResponse(ctx, testOrg, *instanceType.Id, nil)
+	if err != nil || !reflect.DeepEqual(typeResp.JSON200, &instanceType) {
+		t.Errorf("GetInstanceType() = %v, %v, want %+v", typeResp, err, instanceType)
+	}
+	subnetResp, err := client.GetSubnetWithResponse(ctx, testOrg, *subnet.Id, nil)
+	if err != nil || !reflect.DeepEqual(subnetResp.JSON200, &subnet) {
+		t.Errorf("GetSubnet() = %v, %v, want %+v", subnetResp, err, subnet)
+	}
+	prefixResp, err := client.GetVpcPrefixWithResponse(ctx, testOrg, *vpcPrefix.Id, nil)
+	if err != nil || !reflect.DeepEqual(prefixResp.JSON200, &vpcPrefix) {
+		t.Errorf("GetVpcPrefix() = %v, %v, want %+v", prefixResp, err, vpcPrefix)
+	}
+	tenantResp, err := client.GetCurrentTenantWithResponse(ctx, testOrg)
+	if err != nil || !reflect.DeepEqual(tenantResp.JSON200, &tenant) {
+		t.Errorf("GetCurrentTenant() = %v, %v, want %+v", tenantResp, err, tenant)
+	}
+
+	missing, err := client.GetInstanceWithResponse(ctx, testOrg, uuid.New(), nil)
+	if err != nil {
+		t.Fatalf("GetInstance() failed: %v", err)
+	}
+	if missing.StatusCode() != http.StatusNotFound || missing.JSON200 != nil {
+		t.Errorf("Expected a 404 for a missing instance, got %d", missing.StatusCode())
+	}
+}
+
+func TestGetAllInstance(t *testing.T) {
+	s, client := newTestServer(t)
+	ctx := context.Background()
+
+	siteID, otherSiteID, tenantID := uuid.New(), uuid.New(), uuid.New()
+	for i := 0; i < 5; i++ {
+		s.AddInstance(restclient.Instance{Name: ptr(fmt.Sprintf("node-%d", i)), SiteId: &siteID, TenantId: &tenantID})
+	}
+	s.AddInstance(restclient.Instance{Name: ptr("gpu-node"), SiteId: &siteID})
+	s.AddInstance(restclient.Instance{Name: ptr("other-site-node"), SiteId: &otherSiteID, TenantId: &tenantID})
+
+	tests := []struct {
+		name   string
+		params *restclient.GetAllInstanceParams
+		want   int
+	}{
+		{name: "all", want: 7},
+		{name: "site", params: &restclient.GetAllInstanceParams{SiteId: &siteID}, want: 6},
+		{name: "site and tenant", params: &restclient.GetAllInstanceParams{SiteId: &siteID, TenantId: &tenantID}, want: 5},
+		{name: "query", params: &restclient.GetAllInstanceParams{Query: ptr("GPU")}, want: 1},
+		{name: "first page", params: &restclient.GetAllInstanceParams{PageSize: ptr(3)}, want: 3},
+		{name: "last page", params: &restclient.GetAllInstanceParams{PageSize: ptr(3), PageNumber: ptr(3)}, want: 1},
+		{name: "past the last page", params: &restclient.GetAllInstanceParams{PageSize: ptr(3), PageNumber: ptr(4)}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.GetAllInstanceWithResponse(ctx, testOrg, tt.params)
+			if err != nil {
+				t.Fatalf("GetAllInstance() failed: %v", err)
+			}
+			if resp.StatusCode() != http.StatusOK || resp.JSON200 == nil {
+				t.Fatalf("GetAllInstance() status = %d", resp.StatusCode())
+			}
+			if len(*resp.JSON200) != tt.want {
+				t.Errorf("GetAllInstance() returned %d instances, want %d", len(*resp.JSON200), tt.want)
+			}
+		})
+	}
+
+	resp, err := client.GetAllInstanceWithResponse(ctx, testOrg, &restclient.GetAllInstanceParams{PageSize: ptr(MaxPageSize + 1)})
+	if err != nil {
+		t.Fatalf("GetAllInstance() failed: %v", err)
+	}
+	if resp.StatusCode() != http.StatusBadRequest {
+		t.Errorf("Expected a 400 for a page size over the maximum, got %d", resp.StatusCode())
+	}
+}
+
+func TestGetAllSite(t *testing.T) {
+	s, client := newTestServer(t)
+	s.AddSite(restclient.Site{Name: ptr("site-a")})
+	s.AddSite(restclient.Site{Name: ptr("Site-B")})
+
+	resp, err := client.GetAllSiteWithResponse(context.Background(), testOrg, &restclient.GetAllSiteParams{Query: ptr("site-b")})
+	if err != nil {
+		t.Fatalf("GetAllSite() failed: %v", err)
+	}
+	if resp.JSON200 == nil || len(*resp.JSON200) != 1 || *(*resp.JSON200)[0].Name != "Site-B" {
+		t.Errorf("GetAllSite() = %+v, want Site-B only", resp.JSON200)
+	}
+}
+
+func TestUpdateInstance(t *testing.T) {
+	s, client := newTestServer(t)
+	instance := s.AddInstance(restclient.Instance{Name: ptr("node-1")})
+
+	resp, err := client.UpdateInstanceWithResponse(context.Background(), testOrg, *instance.Id,
+		restclient.InstanceUpdateRequest{Name: ptr("node-renamed"), TriggerReboot: ptr(true)})
+	if err != nil {
+		t.Fatalf("UpdateInstance() failed: %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK || resp.JSON200 == nil || *resp.JSON200.Name != "node-renamed" {
+		t.Fatalf("UpdateInstance() = %d %+v", resp.StatusCode(), resp.JSON200)
+	}
+	stored, _ := s.Instance(*instance.Id)
+	if *stored.Name != "node-renamed" || stored.Updated == nil {
+		t.Errorf("Expected the stored instance to be renamed and updated, got %+v", stored)
+	}
+
+	requests := s.Requests()
+	if len(requests) != 1 || requests[0].Operation != OpUpdateInstance || !strings.Contains(requests[0].Body, `"triggerReboot":true`) {
+		t.Errorf("Expected the update with its body in the request log, got %+v", requests)
+	}
+}
+
+func TestAuthenticationAndOrg(t *testing.T) {
+	s, client := newTestServer(t, WithToken("secret"))
+	instance := s.AddInstance(restclient.Instance{Name: ptr("node-1")})
+	ctx := context.Background()
+
+	resp, err := client.GetInstanceWithResponse(ctx, testOrg, *instance.Id, nil)
+	if err != nil || resp.StatusCode() != http.StatusOK {
+		t.Errorf("Expected the client with the token to be accepted, got %v, %v", resp, err)
+	}
+
+	anonymous, err := restclient.NewClientWithResponses(s.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = anonymous.GetInstanceWithResponse(ctx, testOrg, *instance.Id, nil)
+	if err != nil || resp.StatusCode() != http.StatusUnauthorized {
+		t.Errorf("Expected a 401 without token, got %v, %v", resp, err)
+	}
+
+	resp, err = client.GetInstanceWithResponse(ctx, "other-org", *instance.Id, nil)
+	if err != nil || resp.StatusCode() != http.StatusForbidden {
+		t.Errorf("Expected a 403 for another org, got %v, %v", resp, err)
+	}
+}
+
+func TestStateIsCopied(t *testing.T) {
+	s := New(testOrg)
+	labels := map[string]string{"a": "b"}
+	instance := restclient.Instance{Id: ptr(uuid.New()), Labels: &labels}
+	s.Load(State{Instances: []restclient.Instance{instance}})
+
+	labels["a"] = "changed"
+	got, ok := s.Instance(*instance.Id)
+	if !ok || (*got.Labels)["a"] != "b" {
+		t.Errorf("Expected the state to be isolated from the loaded objects, got %+v", got.Labels)
+	}
+	(*got.Labels)["a"] = "changed"
+	if state := s.State(); (*state.Instances[0].Labels)["a"] != "b" {
+		t.Errorf("Expected the state to be isolated from returned objects, got %+v", state.Instances[0].Labels)
+	}
+}
+
+func TestReadState(t *testing.T) {
+	siteID := uuid.New()
+	state, err := ReadState(strings.NewReader(fmt.Sprintf(`{
+		"tenant": {"org": "test-org"},
+		"sites": [{"id": %q, "name": "test-site"}],
+		"instances": [{"name": "node-1", "siteId": %q, "status": "Ready"}]
+	}`, siteID, siteID)))
+	if err != nil {
+		t.Fatalf("ReadState() failed: %v", err)
+	}
+	s := New(testOrg)
+	s.Load(state)
+	loaded := s.State()
+	if len(loaded.Sites) != 1 || *loaded.Sites[0].Id != siteID {
+		t.Errorf("Expected the site to keep its ID, got %+v", loaded.Sites)
+	}
+	if len(loaded.Instances) != 1 || loaded.Instances[0].Id == nil {
+		t.Errorf("Expected the instance to be given an ID, got %+v", loaded.Instances)
+	}
+
+	if _, err := ReadState(strings.NewReader(`{"machines": []}`)); err == nil {
+		t.Error("Expected unknown fields to be rejected")
+	}
+}
@@ -0,0 +1,193 @@
+package bmmfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Fault alters the responses of the API operations it matches
+type Fault struct {
+	// Operation is the operation the fault applies to, such as GetInstance. Empty matches all of them.
+	Operation string
+
+	// Latency delays the response
+	Latency time.Duration
+
+	// Status is returned instead of the normal response when not zero
+	Status int
+
+	// Hang holds the request until the client gives up or the server is closed
+	Hang bool
+
+	// Times is the number of requests the fault applies to, zero for all of them
+	Times int
+}
+
+// RateLimited returns a fault rejecting the next times requests of an operation with HTTP 429
+func RateLimited(operation string, times int) Fault {
+	return Fault{Operation: operation, Status: http.StatusTooManyRequests, Times: times}
+}
+
+// ServerError returns a fault failing the next times requests of an operation with HTTP 500
+func ServerError(operation string, times int) Fault {
+	return Fault{Operation: operation, Status: http.StatusInternalServerError, Times: times}
+}
+
+// Timeout returns a fault holding the next times requests of an operation until the client times out
+func Timeout(operation string, times int) Fault {
+	return Fault{Operation: operation, Hang: true, Times: times}
+}
+
+// Slow returns a fault delaying every request of an operation
+func Slow(operation string, latency time.Duration) Fault {
+	return Fault{Operation: operation, Latency: latency}
+}
+
+// faultJSON is the JSON form of a fault, with the latency as a duration string
+type faultJSON struct {
+	Operation string `json:"operation,omitempty"`
+	Latency   string `json:"latency,omitempty"`
+	Status    int    `json:"status,omitempty"`
+	Hang      bool   `json:"hang,omitempty"`
+	Times     int    `json:"times,omitempty"`
+}
+
+// MarshalJSON encodes the fault with its latency as a duration string
+func (f Fault) MarshalJSON() ([]byte, error) {
+	v := faultJSON{Operation: f.Operation, Status: f.Status, Hang: f.Hang, Times: f.Times}
+	if f.Latency != 0 {
+		v.Latency = f.Latency.String()
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a fault with its latency as a duration string such as "500ms"
+func (f *Fault) UnmarshalJSON(b []byte) error {
+	var v faultJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*f = Fault{Operation: v.Operation, Status: v.Status, Hang: v.Hang, Times: v.Times}
+	if v.Latency != "" {
+		latency, err := time.ParseDuration(v.Latency)
+		if err != nil {
+			return fmt.Errorf("invalid fault latency %q: %w", v.Latency, err)
+		}
+		f.Latency = latency
+	}
+	return nil
+}
+
+// validate checks that a fault does something and returns a valid status
+func (f Fault) validate() error {
+	if f.Status != 0 && (f.Status < 100 || f.Status > 599) {
+		return fmt.Errorf("invalid fault status %d", f.Status)
+	}
+	if f.Latency < 0 || f.Times < 0 {
+		return fmt.Errorf("fault latency and times must not be negative")
+	}
+	if f.Status == 0 && f.Latency == 0 && !f.Hang {
+		return fmt.Errorf("fault has no status, latency or hang")
+	}
+	return nil
+}
+
+// activeFault is a fault with the number of requests it still applies to
+type activeFault struct {
+	Fault
+	remaining int
+}
+
+// AddFault injects a fault. Faults are matched in the order they were added.
+func (s *Server) AddFault(fault Fault) error {
+	if err := fault.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &activeFault{Fault: fault, remaining: fault.Times})
+	return nil
+}
+
+// Faults returns the faults still active
+func (s *Server) Faults() []Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	faults := make([]Fault, 0, len(s.faults))
+	for _, fault := range s.faults {
+		f := fault.Fault
+		if f.Times > 0 {
+			f.Times = fault.remaining
+		}
+		faults = append(faults, f)
+	}
+	return faults
+}
+
+// ClearFaults removes all faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// takeFault returns the first fault matching an operation, consuming one of its times
+func (s *Server) takeFault(operation string) (Fault, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, fault := range s.faults {
+		if fault.Operation != "" && fault.Operation != operation {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.remaining--
+			if fault.remaining == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return fault.Fault, true
+	}
+	return Fault{}, false
+}
+
+// applyFault delays or fails a request according to the first matching fault and
+// reports whether the response was written
+func (s *Server) applyFault(w http.ResponseWriter, r *http.Request, operation string) bool {
+	fault, ok := s.takeFault(operation)
+	if !ok {
+		return false
+	}
+
+	if fault.Latency > 0 {
+		timer := time.NewTimer(fault.Latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return true
+		case <-s.closed:
+			writeError(w, http.StatusServiceUnavailable, "server is shutting down")
+			return true
+		}
+	}
+
+	if fault.Hang {
+		select {
+		case <-r.Context().Done():
+		case <-s.closed:
+			writeError(w, http.StatusServiceUnavailable, "server is shutting down")
+		}
+		return true
+	}
+
+	if fault.Status != 0 {
+		if fault.Status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeError(w, fault.Status, fmt.Sprintf("injected fault for %s", operation))
+		return true
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package bmmfake
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+func TestFaults(t *testing.T) {
+	s, client := newTestServer(t)
+	instance := s.AddInstance(restclient.Instance{Name: ptr("node-1")})
+	ctx := context.Background()
+
+	getInstance := func() int {
+		t.Helper()
+		resp, err := client.GetInstanceWithResponse(ctx, testOrg, *instance.Id, nil)
+		if err != nil {
+			t.Fatalf("GetInstance() failed: %v", err)
+		}
+		return resp.StatusCode()
+	}
+
+	if err := s.AddFault(RateLimited(OpGetInstance, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddFault(ServerError(OpGetSite, 0)); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK} {
+		if got := getInstance(); got != want {
+			t.Errorf("GetInstance() #%d status = %d, want %d", i, got, want)
+		}
+	}
+
+	siteResp, err := client.GetSiteWithResponse(ctx, testOrg, uuid.New(), nil)
+	if err != nil || siteResp.StatusCode() != http.StatusInternalServerError {
+		t.Errorf("Expected the server error fault to fail GetSite, got %v, %v", siteResp, err)
+	}
+	if faults := s.Faults(); len(faults) != 1 || faults[0].Operation != OpGetSite {
+		t.Errorf("Expected only the unlimited fault to remain, got %+v", faults)
+	}
+
+	s.ClearFaults()
+	if err := s.AddFault(Slow("", 50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if got := getInstance(); got != http.StatusOK {
+		t.Errorf("GetInstance() status = %d with latency, want 200", got)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the request to take at least 50ms, took %v", elapsed)
+	}
+
+	var statuses []int
+	for _, req := range s.Requests() {
+		if req.Operation == OpGetInstance {
+			statuses = append(statuses, req.Status)
+		}
+	}
+	if want := []int{429, 429, 200, 200}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Expected logged statuses %v, got %v", want, statuses)
+	}
+}
+
+func TestTimeoutFault(t *testing.T) {
+	s, client := newTestServer(t)
+	instance := s.AddInstance(restclient.Instance{Name: ptr("node-1")})
+	if err := s.AddFault(Timeout(OpGetInstance, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetInstanceWithResponse(ctx, testOrg, *instance.Id, nil); err == nil {
+		t.Fatal("Expected the request to time out")
+	}
+
+	resp, err := client.GetInstanceWithResponse(context.Background(), testOrg, *instance.Id, nil)
+	if err != nil || resp.StatusCode() != http.StatusOK {
+		t.Errorf("Expected the next request to succeed, got %v, %v", resp, err)
+	}
+}
+
+func TestCloseReleasesHungRequests(t *testing.T) {
+	s := NewServer(testOrg)
+	client, err := s.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddFault(Timeout("", 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = client.GetInstanceWithResponse(context.Background(), testOrg, uuid.New(), nil)
+	}()
+	// The fault is consumed once the request is held
+	for len(s.Faults()) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() did not release the hung request")
+	}
+}
+
+func TestFaultValidationAndJSON(t *testing.T) {
+	s := New(testOrg)
+	for _, fault := range []Fault{{}, {Status: 42}, {Latency: -time.Second}} {
+		if err := s.AddFault(fault); err == nil {
+			t.Errorf("AddFault(%+v) succeeded, expected an error", fault)
+		}
+	}
+
+	fault := Fault{Operation: OpGetInstance, Latency: 1500 * time.Millisecond, Status: 503, Times: 2}
+	b, err := json.Marshal(fault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"operation":"GetInstance","latency":"1.5s","status":503,"times":2}` {
+		t.Errorf("Unexpected fault JSON %s", b)
+	}
+	var decoded Fault
+	if err := json.Unmarshal(b, &decoded); err != nil || decoded != fault {
+		t.Errorf("Fault JSON round trip = %+v, %v, want %+v", decoded, err, fault)
+	}
+}
@@ -0,0 +1,256 @@
+package bmmfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/google/uuid"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+// State is the content of the fake API, as loaded from and dumped to JSON
+type State struct {
+	Tenant        *restclient.Tenant        `json:"tenant,omitempty"`
+	Sites         []restclient.Site         `json:"sites,omitempty"`
+	InstanceTypes []restclient.InstanceType `json:"instanceTypes,omitempty"`
+	Instances     []restclient.Instance     `json:"instances,omitempty"`
+	Subnets       []restclient.Subnet       `json:"subnets,omitempty"`
+	VpcPrefixes   []restclient.VpcPrefix    `json:"vpcPrefixes,omitempty"`
+}
+
+// ReadState decodes a state from JSON
+func ReadState(r io.Reader) (State, error) {
+	var state State
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&state); err != nil {
+		return State{}, fmt.Errorf("failed to decode state: %w", err)
+	}
+	return state, nil
+}
+
+// ReadStateFile decodes a state from a JSON file
+func ReadStateFile(path string) (State, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return State{}, fmt.Errorf("failed to open state file: %w", err)
+	}
+	defer f.Close()
+	return ReadState(f)
+}
+
+// store holds the objects served by the fake, keyed by ID
+type store struct {
+	tenant        *restclient.Tenant
+	sites         map[uuid.UUID]restclient.Site
+	instanceTypes map[uuid.UUID]restclient.InstanceType
+	instances     map[uuid.UUID]restclient.Instance
+	subnets       map[uuid.UUID]restclient.Subnet
+	vpcPrefixes   map[uuid.UUID]restclient.VpcPrefix
+}
+
+func newStore() *store {
+	return &store{
+		sites:         make(map[uuid.UUID]restclient.Site),
+		instanceTypes: make(map[uuid.UUID]restclient.InstanceType),
+		instances:     make(map[uuid.UUID]restclient.Instance),
+		subnets:       make(map[uuid.UUID]restclient.Subnet),
+		vpcPrefixes:   make(map[uuid.UUID]restclient.VpcPrefix),
+	}
+}
+
+// Load replaces the state of the server. Objects without an ID are given a random one.
+func (s *Server) Load(state State) {
+	st := newStore()
+	if state.Tenant != nil {
+		tenant := clone(*state.Tenant)
+		st.tenant = &tenant
+	}
+	for _, site := range state.Sites {
+		site = clone(site)
+		st.sites[ensureID(&site.Id)] = site
+	}
+	for _, instanceType := range state.InstanceTypes {
+		instanceType = clone(instanceType)
+		st.instanceTypes[ensureID(&instanceType.Id)] = instanceType
+	}
+	for _, instance := range state.Instances {
+		instance = clone(instance)
+		st.instances[ensureID(&instance.Id)] = instance
+	}
+	for _, subnet := range state.Subnets {
+		subnet = clone(subnet)
+		st.subnets[ensureID(&subnet.Id)] = subnet
+	}
+	for _, vpcPrefix := range state.VpcPrefixes {
+		vpcPrefix = clone(vpcPrefix)
+		st.vpcPrefixes[ensureID(&vpcPrefix.Id)] = vpcPrefix
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = st
+}
+
+// State returns a copy of the state of the server, with objects sorted by ID
+func (s *Server) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var state State
+	if s.store.tenant != nil {
+		tenant := clone(*s.store.tenant)
+		state.Tenant = &tenant
+	}
+	state.Sites = sortedValues(s.store.sites)
+	state.InstanceTypes = sortedValues(s.store.instanceTypes)
+	state.Instances = sortedValues(s.store.instances)
+	state.Subnets = sortedValues(s.store.subnets)
+	state.VpcPrefixes = sortedValues(s.store.vpcPrefixes)
+	return state
+}
+
+// SetTenant sets the tenant returned for the current tenant of the org
+func (s *Server) SetTenant(tenant restclient.Tenant) restclient.Tenant {
+	tenant = clone(tenant)
+	ensureID(&tenant.Id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := clone(tenant)
+	s.store.tenant = &stored
+	return tenant
+}
+
+// AddSite adds or replaces a site and returns it with its ID
+func (s *Server) AddSite(site restclient.Site) restclient.Site {
+	site = clone(site)
+	id := ensureID(&site.Id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store.sites[id] = clone(site)
+	return site
+}
+
+// AddInstanceType adds or replaces an instance type and returns it with its ID
+func (s *Server) AddInstanceType(instanceType restclient.InstanceType) restclient.InstanceType {
+	instanceType = clone(instanceType)
+	id := ensureID(&instanceType.Id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store.instanceTypes[id] = clone(instanceType)
+	return instanceType
+}
+
+// AddInstance adds or replaces an instance and returns it with its ID
+func (s *Server) AddInstance(instance restclient.Instance) restclient.Instance {
+	instance = clone(instance)
+	id := ensureID(&instance.Id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store.instances[id] = clone(instance)
+	return instance
+}
+
+// AddSubnet adds or replaces a subnet and returns it with its ID
+func (s *Server) AddSubnet(subnet restclient.Subnet) restclient.Subnet {
+	subnet = clone(subnet)
+	id := ensureID(&subnet.Id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store.subnets[id] = clone(subnet)
+	return subnet
+}
+
+// AddVpcPrefix adds or replaces a VPC prefix and returns it with its ID
+func (s *Server) AddVpcPrefix(vpcPrefix restclient.VpcPrefix) restclient.VpcPrefix {
+	vpcPrefix = clone(vpcPrefix)
+	id := ensureID(&vpcPrefix.Id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store.vpcPrefixes[id] = clone(vpcPrefix)
+	return vpcPrefix
+}
+
+// Instance returns a copy of an instance
+func (s *Server) Instance(id uuid.UUID) (restclient.Instance, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	instance, ok := s.store.instances[id]
+	if !ok {
+		return restclient.Instance{}, false
+	}
+	return clone(instance), true
+}
+
+// UpdateInstance applies fn to an instance and reports whether the instance exists
+func (s *Server) UpdateInstance(id uuid.UUID, fn func(instance *restclient.Instance)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	instance, ok := s.store.instances[id]
+	if !ok {
+		return false
+	}
+	instance = clone(instance)
+	fn(&instance)
+	instance.Id = &id
+	s.store.instances[id] = clone(instance)
+	return true
+}
+
+// SetInstanceStatus sets the status of an instance and reports whether the instance exists
+func (s *Server) SetInstanceStatus(id uuid.UUID, status restclient.InstanceStatus) bool {
+	return s.UpdateInstance(id, func(instance *restclient.Instance) {
+		instance.Status = &status
+	})
+}
+
+// DeleteInstance removes an instance and reports whether it existed
+func (s *Server) DeleteInstance(id uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.store.instances[id]
+	delete(s.store.instances, id)
+	return ok
+}
+
+// ensureID sets a random ID when id is nil and returns it
+func ensureID(id **uuid.UUID) uuid.UUID {
+	if *id == nil {
+		newID := uuid.New()
+		*id = &newID
+	}
+	return **id
+}
+
+// clone deep copies an API object through JSON, so that the server and its callers
+// never share pointers
+func clone[T any](v T) T {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("bmmfake: failed to copy %T: %v", v, err))
+	}
+	var c T
+	if err := json.Unmarshal(b, &c); err != nil {
+		panic(fmt.Sprintf("bmmfake: failed to copy %T: %v", v, err))
+	}
+	return c
+}
+
+// sortedValues returns copies of the values of m sorted by ID
+func sortedValues[T any](m map[uuid.UUID]T) []T {
+	ids := make([]uuid.UUID, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+
+	values := make([]T, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, clone(m[id]))
+	}
+	return values
+}
@@ -0,0 +1,119 @@
+// Package bmmrecord records NVIDIA BMM API interactions into golden files, with tokens and
+// IP addresses redacted, and replays them offline. Recordings taken against a real site
+// keep the tests honest about the payload shapes the API actually returns.
+package bmmrecord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Cassette is the content of a golden file
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request with its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the part of a request used to match it on replay
+type RecordedRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Body   Body   `json:"body,omitempty"`
+}
+
+// RecordedResponse is a recorded response
+type RecordedResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    Body        `json:"body,omitempty"`
+}
+
+// Body is a request or response body, embedded in golden files when it is a JSON object or
+// array and kept as a string otherwise, so that golden files stay readable and diffable
+type Body []byte
+
+// MarshalJSON embeds JSON object and array bodies and quotes the others
+func (b Body) MarshalJSON() ([]byte, error) {
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		var out bytes.Buffer
+		if err := json.Compact(&out, b); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	}
+	return json.Marshal(string(b))
+}
+
+// UnmarshalJSON reads embedded JSON bodies and quoted ones
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var out bytes.Buffer
+	if err := json.Compact(&out, data); err != nil {
+		return err
+	}
+	*b = out.Bytes()
+	return nil
+}
+
+// key identifies the requests an interaction replays for
+func (r RecordedRequest) key() string {
+	return r.Method + " " + r.Path + "?" + r.Query
+}
+
+// canonicalQuery sorts the query parameters so that their order does not matter on replay
+func canonicalQuery(query url.Values) string {
+	return query.Encode()
+}
+
+// Load reads a golden file
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read golden file: %w", err)
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("failed to decode golden file %s: %w", path, err)
+	}
+	return &cassette, nil
+}
+
+// Save writes the cassette to a golden file, creating its directory if needed
+func (c *Cassette) Save(path string) error {
+	// Queries keep their & unescaped, so that golden files stay readable
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(c); err != nil {
+		return fmt.Errorf("failed to encode golden file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create golden file directory: %w", err)
+	}
+	// Write then rename, so that a crash never leaves a truncated golden file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write golden file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write golden file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package bmmrecord
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// DefaultMaxInteractions bounds the interactions a recorder records, since record mode is meant
+// for short capture sessions and the golden file is rewritten after every interaction
+const DefaultMaxInteractions = 1000
+
+// recordedHeaders are the response headers kept in golden files. Others, such as dates and
+// request IDs, change on every call and would only make golden files noisy.
+var recordedHeaders = []string{"Content-Type", "Retry-After"}
+
+// Recorder is an HTTP transport recording the interactions it carries into a golden file,
+// with the secrets and IP addresses redacted. Request headers, including the Authorization
+// header, are never recorded. Once MaxInteractions are recorded, requests are still sent but
+// no longer recorded.
+type Recorder struct {
+	// MaxInteractions bounds the recorded interactions, DefaultMaxInteractions when zero
+	MaxInteractions int
+
+	path     string
+	base     http.RoundTripper
+	redactor *Redactor
+
+	mu       sync.Mutex
+	cassette Cassette
+	full     bool
+}
+
+// NewRecorder creates a recorder writing to the golden file at path, sending requests through
+// base, or http.DefaultTransport when nil, and redacting the given secrets
+func NewRecorder(path string, base http.RoundTripper, secrets ...string) *Recorder {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Recorder{
+		path:     path,
+		base:     base,
+		redactor: NewRedactor(secrets...),
+	}
+}
+
+// RoundTrip sends the request and records it with its response. The golden file is saved after
+// every interaction, so that it is complete whenever the process stops, until the recording is
+// full.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if req.Body != nil {
+		var err error
+		requestBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Query:  r.redactor.String(canonicalQuery(req.URL.Query())),
+			Body:   r.redactor.Body(requestBody),
+		},
+		Response: RecordedResponse{
+			Status:  resp.StatusCode,
+			Headers: r.headers(resp.Header),
+			Body:    r.redactor.Body(responseBody),
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.full {
+		return resp, nil
+	}
+	if len(r.cassette.Interactions) >= r.maxInteractions() {
+		r.full = true
+		klog.InfoS("Stopped recording NVIDIA BMM API interactions, the recording is full",
+			"path", r.path, "interactions", len(r.cassette.Interactions))
+		return resp, nil
+	}
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	if err := r.cassette.Save(r.path); err != nil {
+		// Recording is a debugging aid, it must not fail the API calls
+		klog.ErrorS(err, "Failed to save NVIDIA BMM API recording", "path", r.path)
+	}
+	return resp, nil
+}
+
+// maxInteractions returns the bound on the recorded interactions
+func (r *Recorder) maxInteractions() int {
+	if r.MaxInteractions > 0 {
+		return r.MaxInteractions
+	}
+	return DefaultMaxInteractions
+}
+
+// Cassette returns a copy of the interactions recorded so far
+func (r *Recorder) Cassette() Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+// headers returns the recorded response headers, redacted
+func (r *Recorder) headers(headers http.Header) http.Header {
+	recorded := http.Header{}
+	for _, name := range recordedHeaders {
+		for _, value := range headers.Values(name) {
+			recorded.Add(name, r.redactor.String(value))
+		}
+	}
+	if len(recorded) == 0 {
+		return nil
+	}
+	return recorded
+}
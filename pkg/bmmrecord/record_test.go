@@ -0,0 +1,152 @@
+package bmmrecord
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+)
+
+const (
+	testOrg   = "test-org"
+	testToken = "test-secret-token"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestRecorder(t *testing.T) {
+	fake := bmmfake.NewServer(testOrg, bmmfake.WithToken(testToken))
+	t.Cleanup(fake.Close)
+	site := fake.AddSite(restclient.Site{Name: ptr("test-site")})
+	instance := fake.AddInstance(restclient.Instance{
+		Name:       ptr("node-1"),
+		SiteId:     site.Id,
+		Status:     ptr(restclient.InstanceStatus("Ready")),
+		Interfaces: &[]restclient.Interface{{IpAddresses: &[]string{"10.0.0.5", "fd00::5"}}},
+	})
+	if err := fake.AddFault(bmmfake.RateLimited(bmmfake.OpGetAllInstance, 1)); err != nil {
+		t.Fatalf("AddFault() failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "golden", "recording.json")
+	recorder := NewRecorder(path, nil, testToken)
+	client, err := restclient.NewClientWithAuth(fake.URL(), testToken,
+		restclient.WithHTTPClient(&http.Client{Transport: recorder}))
+	if err != nil {
+		t.Fatalf("NewClientWithAuth() failed: %v", err)
+	}
+
+	ctx := context.Background()
+	resp, err := client.GetInstanceWithResponse(ctx, testOrg, *instance.Id, nil)
+	if err != nil || resp.JSON200 == nil {
+		t.Fatalf("GetInstance() = %v, %v", resp, err)
+	}
+	// The client still sees the real addresses, only the recording is redacted
+	if got := (*(*resp.JSON200.Interfaces)[0].IpAddresses)[0]; got != "10.0.0.5" {
+		t.Errorf("GetInstance() address = %s, want 10.0.0.5", got)
+	}
+	params := &restclient.GetAllInstanceParams{SiteId: site.Id, Query: ptr("node-1")}
+	for range 2 {
+		if _, err := client.GetAllInstanceWithResponse(ctx, testOrg, params); err != nil {
+			t.Fatalf("GetAllInstance() failed: %v", err)
+		}
+	}
+	if _, err := client.UpdateInstanceWithResponse(ctx, testOrg, *instance.Id,
+		restclient.UpdateInstanceJSONRequestBody{Name: ptr("node-1-renamed")}); err != nil {
+		t.Fatalf("UpdateInstance() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read the golden file: %v", err)
+	}
+	for _, secret := range []string{testToken, "10.0.0.5", "fd00::5", "Bearer"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Golden file contains %q:\n%s", secret, data)
+		}
+	}
+
+	cassette, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(cassette.Interactions) != 4 {
+		t.Fatalf("Recorded %d interactions, want 4", len(cassette.Interactions))
+	}
+	get, rateLimited, list, update := cassette.Interactions[0], cassette.Interactions[1], cassette.Interactions[2], cassette.Interactions[3]
+	if get.Request.Method != http.MethodGet || get.Request.Path != "/v2/org/test-org/carbide/instance/"+instance.Id.String() {
+		t.Errorf("Recorded request %s %s", get.Request.Method, get.Request.Path)
+	}
+	if !strings.Contains(string(get.Response.Body), `"ipAddresses":["198.18.0.1","2001:db8::1"]`) {
+		t.Errorf("Recorded response body %s, want redacted addresses", get.Response.Body)
+	}
+	if got := get.Response.Headers.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Recorded Content-Type %q, want application/json", got)
+	}
+	if get.Response.Headers.Get("X-Request-Id") != "" {
+		t.Error("Recorded the X-Request-Id header, it changes on every call")
+	}
+	if rateLimited.Response.Status != http.StatusTooManyRequests || rateLimited.Response.Headers.Get("Retry-After") == "" {
+		t.Errorf("Recorded %d %v, want a rate limited response", rateLimited.Response.Status, rateLimited.Response.Headers)
+	}
+	wantQuery := "query=node-1&siteId=" + site.Id.String()
+	if list.Request.Query != wantQuery || list.Response.Status != http.StatusOK {
+		t.Errorf("Recorded query %q with status %d, want %q with 200", list.Request.Query, list.Response.Status, wantQuery)
+	}
+	if update.Request.Method != http.MethodPatch || string(update.Request.Body) != `{"name":"node-1-renamed"}` {
+		t.Errorf("Recorded request %s with body %s", update.Request.Method, update.Request.Body)
+	}
+	if len(recorder.Cassette().Interactions) != 4 {
+		t.Errorf("Cassette() has %d interactions, want 4", len(recorder.Cassette().Interactions))
+	}
+}
+
+func TestRecorderTransportError(t *testing.T) {
+	recorder := NewRecorder(filepath.Join(t.TempDir(), "recording.json"), nil)
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:1/v2/org/test-org/carbide/site", nil)
+	if _, err := recorder.RoundTrip(req); err == nil {
+		t.Error("RoundTrip() succeeded against a closed port")
+	}
+	if len(recorder.Cassette().Interactions) != 0 {
+		t.Error("Recorded an interaction without response")
+	}
+}
+
+func TestRecorderMaxInteractions(t *testing.T) {
+	fake := bmmfake.NewServer(testOrg, bmmfake.WithToken(testToken))
+	t.Cleanup(fake.Close)
+	site := fake.AddSite(restclient.Site{Name: ptr("test-site")})
+
+	path := filepath.Join(t.TempDir(), "recording.json")
+	recorder := NewRecorder(path, nil, testToken)
+	recorder.MaxInteractions = 2
+	client, err := restclient.NewClientWithAuth(fake.URL(), testToken,
+		restclient.WithHTTPClient(&http.Client{Transport: recorder}))
+	if err != nil {
+		t.Fatalf("NewClientWithAuth() failed: %v", err)
+	}
+
+	for range 3 {
+		resp, err := client.GetSiteWithResponse(context.Background(), testOrg, *site.Id, nil)
+		if err != nil || resp.JSON200 == nil {
+			t.Fatalf("GetSite() = %v, %v", resp, err)
+		}
+	}
+	if got := len(recorder.Cassette().Interactions); got != 2 {
+		t.Errorf("Cassette() has %d interactions, want 2", got)
+	}
+	cassette, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(cassette.Interactions) != 2 {
+		t.Errorf("Golden file has %d interactions, want 2", len(cassette.Interactions))
+	}
+}
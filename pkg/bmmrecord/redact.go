@@ -0,0 +1,160 @@
+package bmmrecord
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets in recordings
+const Redacted = "REDACTED"
+
+// ipv4Pattern finds IPv4 addresses, with an optional prefix length, inside free text
+var ipv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?:/\d{1,2})?\b`)
+
+// redactionRange selects the range addresses or prefixes of a family are redacted into
+type redactionRange struct {
+	is6      bool
+	isPrefix bool
+}
+
+// redactionRanges are in the benchmarking and documentation ranges, so that redacted values
+// never look like real ones
+var redactionRanges = map[redactionRange]netip.Prefix{
+	{is6: false, isPrefix: false}: netip.MustParsePrefix("198.18.0.0/16"),
+	{is6: false, isPrefix: true}:  netip.MustParsePrefix("198.19.0.0/16"),
+	{is6: true, isPrefix: false}:  netip.MustParsePrefix("2001:db8::/48"),
+	{is6: true, isPrefix: true}:   netip.MustParsePrefix("2001:db8:1::/48"),
+}
+
+// Redactor replaces secrets and IP addresses in recordings. The same address is always
+// replaced by the same one, so that recordings stay consistent, for instance an instance
+// address shows up with the same value in every response.
+type Redactor struct {
+	secrets []string
+
+	mu       sync.Mutex
+	replaced map[string]string
+	next     map[redactionRange]uint64
+}
+
+// NewRedactor creates a redactor replacing the given secrets, such as API tokens
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{
+		replaced: make(map[string]string),
+		next:     make(map[redactionRange]uint64),
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+	return r
+}
+
+// Body redacts a body, walking the values of JSON documents and the text of other bodies
+func (r *Redactor) Body(body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	if json.Valid(body) {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var v interface{}
+		if err := decoder.Decode(&v); err == nil {
+			if redacted, err := json.Marshal(r.value(v)); err == nil {
+				return redacted
+			}
+		}
+	}
+	return []byte(r.String(string(body)))
+}
+
+// String redacts the secrets and IP addresses in a string
+func (r *Redactor) String(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	if redacted, ok := r.address(s); ok {
+		return redacted
+	}
+	return ipv4Pattern.ReplaceAllStringFunc(s, func(match string) string {
+		if redacted, ok := r.address(match); ok {
+			return redacted
+		}
+		return match
+	})
+}
+
+// value redacts a decoded JSON value
+func (r *Redactor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = r.value(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = r.value(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// address redacts a string that is an IP address or prefix as a whole
+func (r *Redactor) address(s string) (string, bool) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return r.replace(s, netip.PrefixFrom(addr, addr.BitLen()), false), true
+	}
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return r.replace(s, prefix, true), true
+	}
+	return "", false
+}
+
+// replace returns the redacted form of an address or prefix: the next address, or the next
+// block of the prefix size, of the redacted range of its family
+func (r *Redactor) replace(original string, prefix netip.Prefix, isPrefix bool) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if redacted, ok := r.replaced[original]; ok {
+		return redacted
+	}
+
+	is6 := prefix.Addr().Is6()
+	key := redactionRange{is6: is6, isPrefix: isPrefix}
+	base := redactionRanges[key]
+	bits := max(prefix.Bits(), base.Bits())
+	n := r.next[key]
+	r.next[key]++
+
+	var result string
+	if isPrefix {
+		result = netip.PrefixFrom(nthBlock(base, bits, n), bits).String()
+	} else {
+		// Addresses start at 1 to avoid redacting to the network address
+		result = nthBlock(base, bits, n+1).String()
+	}
+	r.replaced[original] = result
+	return result
+}
+
+// nthBlock returns the first address of the n-th block of the given prefix length in base,
+// wrapping around at the end of base
+func nthBlock(base netip.Prefix, bits int, n uint64) netip.Addr {
+	addrBits := base.Addr().BitLen()
+	offset := new(big.Int).Lsh(new(big.Int).SetUint64(n), uint(addrBits-bits))
+	offset.Mod(offset, new(big.Int).Lsh(big.NewInt(1), uint(addrBits-base.Bits())))
+	sum := new(big.Int).Add(new(big.Int).SetBytes(base.Addr().AsSlice()), offset)
+	addr, _ := netip.AddrFromSlice(sum.FillBytes(make([]byte, addrBits/8)))
+	return addr
+}
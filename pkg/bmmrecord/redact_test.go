@@ -0,0 +1,101 @@
+package bmmrecord
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestRedactorString(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "plain text", input: "node-1", want: "node-1"},
+		{name: "secret", input: "Bearer secret-token", want: "Bearer REDACTED"},
+		{name: "IPv4 address", input: "10.0.0.5", want: "198.18.0.1"},
+		{name: "IPv6 address", input: "fd00::5", want: "2001:db8::1"},
+		{name: "IPv4 prefix", input: "10.128.0.0/16", want: "198.19.0.0/16"},
+		{name: "IPv6 prefix", input: "fd00:1::/64", want: "2001:db8:1::/64"},
+		{name: "prefix larger than the redacted range", input: "10.0.0.0/8", want: "198.19.0.0/16"},
+		{name: "IPv4 address in text", input: "ssh to 10.0.0.5 and 10.0.0.6", want: "ssh to 198.18.0.1 and 198.18.0.2"},
+		{name: "version-like text", input: "v1.2.3", want: "v1.2.3"},
+		{name: "UUID", input: "550e8400-e29b-41d4-a716-446655440000", want: "550e8400-e29b-41d4-a716-446655440000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRedactor("secret-token")
+			if got := r.String(tt.input); got != tt.want {
+				t.Errorf("String(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorConsistent(t *testing.T) {
+	r := NewRedactor()
+	first := r.String("10.0.0.5")
+	second := r.String("10.0.0.6")
+	if first == second {
+		t.Errorf("Different addresses redacted to the same %s", first)
+	}
+	if got := r.String("10.0.0.5"); got != first {
+		t.Errorf("String() = %s on the second call, want %s", got, first)
+	}
+	if got := r.String("host 10.0.0.5"); got != "host "+first {
+		t.Errorf("String() = %q in text, want %q", got, "host "+first)
+	}
+	// Addresses and prefixes are redacted in distinct ranges, so they never collide
+	if got := r.String("10.0.0.0/24"); got != "198.19.0.0/24" {
+		t.Errorf("String() = %s for a prefix, want 198.19.0.0/24", got)
+	}
+	if got := r.String("10.0.1.0/24"); got != "198.19.1.0/24" {
+		t.Errorf("String() = %s for the second prefix, want 198.19.1.0/24", got)
+	}
+}
+
+func TestRedactorBody(t *testing.T) {
+	r := NewRedactor("secret-token")
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "empty", input: "", want: ""},
+		{
+			name:  "JSON document",
+			input: `{"name":"node-1","count":12345678901234567890,"interfaces":[{"ipAddresses":["10.0.0.5"]}],"token":"secret-token"}`,
+			want:  `{"count":12345678901234567890,"interfaces":[{"ipAddresses":["198.18.0.1"]}],"name":"node-1","token":"REDACTED"}`,
+		},
+		{name: "text", input: "upstream 10.0.0.5 unavailable", want: "upstream 198.18.0.1 unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(r.Body([]byte(tt.input))); got != tt.want {
+				t.Errorf("Body() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNthBlock(t *testing.T) {
+	tests := []struct {
+		base string
+		bits int
+		n    uint64
+		want string
+	}{
+		{base: "198.18.0.0/16", bits: 32, n: 0, want: "198.18.0.0"},
+		{base: "198.18.0.0/16", bits: 32, n: 256, want: "198.18.1.0"},
+		{base: "198.18.0.0/16", bits: 32, n: 65537, want: "198.18.0.1"},
+		{base: "198.19.0.0/16", bits: 24, n: 255, want: "198.19.255.0"},
+		{base: "198.19.0.0/16", bits: 24, n: 256, want: "198.19.0.0"},
+		{base: "2001:db8:1::/48", bits: 64, n: 2, want: "2001:db8:1:2::"},
+		{base: "2001:db8::/48", bits: 128, n: 1 << 40, want: "2001:db8::100:0:0"},
+	}
+	for _, tt := range tests {
+		if got := nthBlock(netip.MustParsePrefix(tt.base), tt.bits, tt.n); got.String() != tt.want {
+			t.Errorf("nthBlock(%s, %d, %d) = %s, want %s", tt.base, tt.bits, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package bmmrecord
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Replayer is an HTTP transport answering requests from a golden file, without network access.
+// Requests match interactions on their method, path and query. Interactions recorded for the
+// same request are replayed in order, and the last one is repeated once they are exhausted.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions map[string][]Interaction
+	served       map[string]int
+}
+
+// NewReplayer creates a replayer for the interactions of a cassette
+func NewReplayer(cassette *Cassette) *Replayer {
+	r := &Replayer{
+		interactions: make(map[string][]Interaction),
+		served:       make(map[string]int),
+	}
+	for _, interaction := range cassette.Interactions {
+		key := interaction.Request.key()
+		r.interactions[key] = append(r.interactions[key], interaction)
+	}
+	return r
+}
+
+// LoadReplayer creates a replayer for the golden file at path
+func LoadReplayer(path string) (*Replayer, error) {
+	cassette, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(cassette), nil
+}
+
+// RoundTrip answers the request with the recorded response, or fails when none was recorded
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+
+	key := RecordedRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  canonicalQuery(req.URL.Query()),
+	}.key()
+
+	r.mu.Lock()
+	interactions := r.interactions[key]
+	if len(interactions) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("no recorded NVIDIA BMM API interaction for %s", key)
+	}
+	served := r.served[key]
+	r.served[key]++
+	r.mu.Unlock()
+
+	response := interactions[min(served, len(interactions)-1)].Response
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", response.Status, http.StatusText(response.Status)),
+		StatusCode:    response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        response.Headers.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(response.Body)),
+		ContentLength: int64(len(response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Unused returns the keys of the requests whose interactions were never replayed, so that tests
+// can check a golden file does not go stale
+func (r *Replayer) Unused() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []string
+	for key := range r.interactions {
+		if r.served[key] == 0 {
+			unused = append(unused, key)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
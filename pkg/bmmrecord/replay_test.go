@@ -0,0 +1,138 @@
+package bmmrecord
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+)
+
+func TestReplayRecording(t *testing.T) {
+	fake := bmmfake.NewServer(testOrg, bmmfake.WithToken(testToken))
+	site := fake.AddSite(restclient.Site{Name: ptr("test-site")})
+	instance := fake.AddInstance(restclient.Instance{
+		Name:       ptr("node-1"),
+		SiteId:     site.Id,
+		Interfaces: &[]restclient.Interface{{IpAddresses: &[]string{"10.0.0.5"}}},
+	})
+
+	path := filepath.Join(t.TempDir(), "recording.json")
+	recording, err := restclient.NewClientWithAuth(fake.URL(), testToken,
+		restclient.WithHTTPClient(&http.Client{Transport: NewRecorder(path, nil, testToken)}))
+	if err != nil {
+		t.Fatalf("NewClientWithAuth() failed: %v", err)
+	}
+	ctx := context.Background()
+	recorded, err := recording.GetInstanceWithResponse(ctx, testOrg, *instance.Id, nil)
+	if err != nil {
+		t.Fatalf("GetInstance() failed: %v", err)
+	}
+	// Replay works without the server
+	fake.Close()
+
+	replayer, err := LoadReplayer(path)
+	if err != nil {
+		t.Fatalf("LoadReplayer() failed: %v", err)
+	}
+	replaying, err := restclient.NewClientWithAuth("https://bmm.invalid", "other-token",
+		restclient.WithHTTPClient(&http.Client{Transport: replayer}))
+	if err != nil {
+		t.Fatalf("NewClientWithAuth() failed: %v", err)
+	}
+	replayed, err := replaying.GetInstanceWithResponse(ctx, testOrg, *instance.Id, nil)
+	if err != nil {
+		t.Fatalf("GetInstance() replay failed: %v", err)
+	}
+	if replayed.JSON200 == nil {
+		t.Fatalf("GetInstance() replay returned %d without instance", replayed.StatusCode())
+	}
+	want := *recorded.JSON200
+	want.Interfaces = &[]restclient.Interface{{IpAddresses: &[]string{"198.18.0.1"}}}
+	if !reflect.DeepEqual(*replayed.JSON200, want) {
+		t.Errorf("GetInstance() replay = %+v, want %+v", *replayed.JSON200, want)
+	}
+
+	if _, err := replaying.GetInstanceWithResponse(ctx, testOrg, uuid.New(), nil); err == nil ||
+		!strings.Contains(err.Error(), "no recorded NVIDIA BMM API interaction") {
+		t.Errorf("GetInstance() of an unrecorded instance error = %v", err)
+	}
+}
+
+func TestReplayerOrder(t *testing.T) {
+	request := RecordedRequest{Method: http.MethodGet, Path: "/v2/org/test-org/carbide/site", Query: "pageNumber=1&pageSize=20"}
+	replayer := NewReplayer(&Cassette{Interactions: []Interaction{
+		{Request: request, Response: RecordedResponse{Status: http.StatusTooManyRequests}},
+		{Request: request, Response: RecordedResponse{Status: http.StatusOK, Body: Body(`[]`)}},
+		{
+			Request:  RecordedRequest{Method: http.MethodGet, Path: "/v2/org/test-org/carbide/tenant/current"},
+			Response: RecordedResponse{Status: http.StatusOK},
+		},
+	}})
+
+	// The query matches regardless of the order of its parameters
+	want := []int{http.StatusTooManyRequests, http.StatusOK, http.StatusOK}
+	for i, status := range want {
+		req, _ := http.NewRequest(http.MethodGet, "http://bmm.invalid/v2/org/test-org/carbide/site?pageSize=20&pageNumber=1", nil)
+		resp, err := replayer.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip() #%d failed: %v", i, err)
+		}
+		if resp.StatusCode != status {
+			t.Errorf("RoundTrip() #%d status = %d, want %d", i, resp.StatusCode, status)
+		}
+	}
+
+	if got := replayer.Unused(); !reflect.DeepEqual(got, []string{"GET /v2/org/test-org/carbide/tenant/current?"}) {
+		t.Errorf("Unused() = %v", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://bmm.invalid/v2/org/test-org/carbide/site?pageSize=20&pageNumber=1", nil)
+	if _, err := replayer.RoundTrip(req); err == nil {
+		t.Error("RoundTrip() replayed a request with another method")
+	}
+}
+
+func TestBodyJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   Body
+		stored string
+		loaded string
+	}{
+		{name: "object", body: Body(`{ "name": "node-1" }`), stored: `{"name":"node-1"}`, loaded: `{"name":"node-1"}`},
+		{name: "array", body: Body(`[1, 2]`), stored: `[1,2]`, loaded: `[1,2]`},
+		{name: "text", body: Body("rate limited\n"), stored: `"rate limited\n"`, loaded: "rate limited\n"},
+		{name: "JSON string", body: Body(`"quoted"`), stored: `"\"quoted\""`, loaded: `"quoted"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := tt.body.MarshalJSON()
+			if err != nil {
+				t.Fatalf("MarshalJSON() failed: %v", err)
+			}
+			if string(stored) != tt.stored {
+				t.Errorf("MarshalJSON() = %s, want %s", stored, tt.stored)
+			}
+
+			cassette := Cassette{Interactions: []Interaction{{Response: RecordedResponse{Body: tt.body}}}}
+			path := filepath.Join(t.TempDir(), "body.json")
+			if err := cassette.Save(path); err != nil {
+				t.Fatalf("Save() failed: %v", err)
+			}
+			loaded, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() failed: %v", err)
+			}
+			if got := string(loaded.Interactions[0].Response.Body); got != tt.loaded {
+				t.Errorf("Loaded body = %q, want %q", got, tt.loaded)
+			}
+		})
+	}
+}
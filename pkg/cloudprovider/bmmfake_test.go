@@ -0,0 +1,179 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+)
+
+// newFakeAPICloud creates a provider from a cloud config pointing to a fake NVIDIA BMM API,
+// so that calls go through the HTTP client
+func newFakeAPICloud(t *testing.T, fake *bmmfake.Server, requestTimeout string) *NvidiaBMMCloud {
+	t.Helper()
+	config := fmt.Sprintf(`apiVersion: bmm.nvidia.com/v1alpha1
+kind: CloudConfig
+api:
+  endpoint: %q
+  orgName: test-org
+  token: test-token
+  requestTimeout: %s
+cluster:
+  siteId: test-site
+  tenantId: test-tenant
+`, fake.URL(), requestTimeout)
+
+	cloud, err := NewNvidiaBMMCloud(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("NewNvidiaBMMCloud() failed: %v", err)
+	}
+	return cloud.(*NvidiaBMMCloud)
+}
+
+func TestFakeAPI_InstanceLifecycle(t *testing.T) {
+	fake := bmmfake.NewServer("test-org", bmmfake.WithToken("test-token"))
+	defer fake.Close()
+	site := fake.AddSite(restclient.Site{Id: &testSiteID, Name: ptr("test-site")})
+	instance := fake.AddInstance(restclient.Instance{
+		Name:       ptr("test-node"),
+		SiteId:     site.Id,
+		Status:     ptr(restclient.InstanceStatus("Ready")),
+		Interfaces: &[]restclient.Interface{{IpAddresses: &[]string{"10.0.0.5"}}},
+	})
+
+	cloud := newFakeAPICloud(t, fake, "5s")
+	ctx := context.Background()
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Spec:       v1.NodeSpec{ProviderID: "nvidia-bmm://test-org/test-tenant/test-site/" + instance.Id.String()},
+	}
+
+	exists, err := cloud.InstanceExists(ctx, node)
+	if err != nil || !exists {
+		t.Fatalf("InstanceExists() = %v, %v, want true", exists, err)
+	}
+	metadata, err := cloud.InstanceMetadata(ctx, node)
+	if err != nil {
+		t.Fatalf("InstanceMetadata() failed: %v", err)
+	}
+	if want := "nvidia-bmm-zone-" + testSiteID.String(); metadata.Zone != want {
+		t.Errorf("Expected zone %s, got %s", want, metadata.Zone)
+	}
+	if len(metadata.NodeAddresses) == 0 || metadata.NodeAddresses[0].Address != "10.0.0.5" {
+		t.Errorf("Expected the instance address first, got %v", metadata.NodeAddresses)
+	}
+
+	fake.SetInstanceStatus(*instance.Id, "Terminating")
+	shutdown, err := cloud.InstanceShutdown(ctx, node)
+	if err != nil || !shutdown {
+		t.Errorf("InstanceShutdown() = %v, %v, want true", shutdown, err)
+	}
+
+	fake.DeleteInstance(*instance.Id)
+	exists, err = cloud.InstanceExists(ctx, node)
+	if err != nil || exists {
+		t.Errorf("InstanceExists() = %v, %v after deletion, want false", exists, err)
+	}
+
+	// The site name is resolved once and cached
+	if got := fake.RequestCount(bmmfake.OpGetAllSite); got != 1 {
+		t.Errorf("Expected 1 site lookup, got %d", got)
+	}
+}
+
+func TestFakeAPI_SecondarySiteZone(t *testing.T) {
+	fake := bmmfake.NewServer("test-org", bmmfake.WithToken("test-token"))
+	defer fake.Close()
+	fake.AddSite(restclient.Site{Id: &testSiteID, Name: ptr("test-site")})
+	otherSiteID := uuid.MustParse("3f1e2d4c-5b6a-4789-8abc-def012345678")
+	fake.AddSite(restclient.Site{Id: &otherSiteID, Name: ptr("other-site")})
+	instance := fake.AddInstance(restclient.Instance{Name: ptr("test-node"), SiteId: &otherSiteID})
+
+	cloud := newFakeAPICloud(t, fake, "5s")
+	cloud.providerIDConfig.Sites = []string{"other-site"}
+	recorder := record.NewFakeRecorder(10)
+	cloud.eventRecorder = recorder
+	ctx := context.Background()
+	want := "nvidia-bmm-zone-" + otherSiteID.String()
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node", Labels: map[string]string{v1.LabelTopologyZone: want}},
+		Spec:       v1.NodeSpec{ProviderID: "nvidia-bmm://test-org/test-tenant/other-site/" + instance.Id.String()},
+	}
+
+	metadata, err := cloud.InstanceMetadata(ctx, node)
+	if err != nil {
+		t.Fatalf("InstanceMetadata() failed: %v", err)
+	}
+	zone, err := cloud.GetZoneByProviderID(ctx, node.Spec.ProviderID)
+	if err != nil {
+		t.Fatalf("GetZoneByProviderID() failed: %v", err)
+	}
+	if metadata.Zone != want || zone.FailureDomain != want {
+		t.Errorf("Expected zone %s, got %s from InstanceMetadata and %s from GetZoneByProviderID",
+			want, metadata.Zone, zone.FailureDomain)
+	}
+	if metadata.Region != zone.Region {
+		t.Errorf("Expected the same region, got %s and %s", metadata.Region, zone.Region)
+	}
+	close(recorder.Events)
+	for event := range recorder.Events {
+		if strings.Contains(event, EventReasonZoneMismatch) {
+			t.Errorf("Expected no zone mismatch event, got %s", event)
+		}
+	}
+}
+
+func TestFakeAPI_Faults(t *testing.T) {
+	fake := bmmfake.NewServer("test-org", bmmfake.WithToken("test-token"))
+	defer fake.Close()
+	fake.AddSite(restclient.Site{Id: &testSiteID, Name: ptr("test-site")})
+	instance := fake.AddInstance(restclient.Instance{Name: ptr("test-node"), SiteId: &testSiteID})
+
+	cloud := newFakeAPICloud(t, fake, "200ms")
+	ctx := context.Background()
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Spec:       v1.NodeSpec{ProviderID: "nvidia-bmm://test-org/test-tenant/test-site/" + instance.Id.String()},
+	}
+
+	tests := []struct {
+		name      string
+		fault     bmmfake.Fault
+		wantErr   bool
+		wantCalls int
+	}{
+		{name: "rate limited", fault: bmmfake.RateLimited(bmmfake.OpGetInstance, 1), wantErr: true, wantCalls: 1},
+		{name: "server error", fault: bmmfake.ServerError(bmmfake.OpGetInstance, 1), wantErr: true, wantCalls: 1},
+		{name: "timeout", fault: bmmfake.Timeout(bmmfake.OpGetInstance, 1), wantErr: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.ClearFaults()
+			fake.ResetRequests()
+			if err := fake.AddFault(tt.fault); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := cloud.InstanceMetadata(ctx, node)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("InstanceMetadata() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// The timed out request is logged once the client goes away
+			if tt.fault.Hang {
+				return
+			}
+			if got := fake.RequestCount(bmmfake.OpGetInstance); got != tt.wantCalls {
+				t.Errorf("Expected %d GetInstance requests, got %d", tt.wantCalls, got)
+			}
+		})
+	}
+}
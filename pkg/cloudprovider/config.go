@@ -0,0 +1,592 @@
+package cloudprovider
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ConfigAPIVersion is the API version of the versioned cloud config
+	ConfigAPIVersion = "bmm.nvidia.com/v1alpha1"
+
+	// ConfigKind is the kind of the versioned cloud config
+	ConfigKind = "CloudConfig"
+
+	// DefaultRequestTimeout bounds every NVIDIA BMM API call made by the provider
+	DefaultRequestTimeout = 30 * time.Second
+
+	// DefaultNodeMaskSize is the prefix length of the pod CIDRs carved out of pod subnets
+	DefaultNodeMaskSize = 24
+
+	// DefaultDeletionGuardWindow is the window over which the deletion guard counts nodes whose
+	// instance was not found
+	DefaultDeletionGuardWindow = 10 * time.Minute
+
+	// DefaultOutOfServiceAfter is how long an instance stays shut down before the out-of-service
+	// controller taints its node
+	DefaultOutOfServiceAfter = 5 * time.Minute
+
+	// DefaultPowerActionMinInterval is the minimum time between two power actions on a node
+	DefaultPowerActionMinInterval = 30 * time.Minute
+
+	// DefaultPowerActionsPerHour is the number of power actions allowed on all nodes within an hour
+	DefaultPowerActionsPerHour = 10
+
+	// redactedValue replaces secrets in reported configuration
+	redactedValue = "REDACTED"
+)
+
+// ProviderIDPolicy is the action taken when a node provider ID does not match the configuration
+type ProviderIDPolicy string
+
+const (
+	// ProviderIDPolicyReject fails provider calls for the node
+	ProviderIDPolicyReject ProviderIDPolicy = "reject"
+
+	// ProviderIDPolicyWarn logs and records an event, then looks the instance up under the configured org
+	ProviderIDPolicyWarn ProviderIDPolicy = "warn"
+
+	// ProviderIDPolicyUseProviderIDOrg looks the instance up under the org of the provider ID.
+	// Tenant and site mismatches are handled as with ProviderIDPolicyWarn.
+	ProviderIDPolicyUseProviderIDOrg ProviderIDPolicy = "useProviderIDOrg"
+
+	// ProviderIDPolicyAccept accepts legacy provider IDs silently
+	ProviderIDPolicyAccept ProviderIDPolicy = "accept"
+)
+
+// Config holds the NVIDIA BMM cloud provider configuration.
+//
+// The versioned format looks like:
+//
+//	apiVersion: bmm.nvidia.com/v1alpha1
+//	kind: CloudConfig
+//	api:
+//	  endpoint: https://api.carbide.nvidia.com
+//	  orgName: my-org
+//	  token: my-token
+//	cluster:
+//	  siteId: 550e8400-e29b-41d4-a716-446655440000
+//	  tenantId: 660e8400-e29b-41d4-a716-446655440001
+//
+// Configuration without apiVersion and kind is read as the legacy flat format
+// and converted, so existing secrets keep working.
+type Config struct {
+	// APIVersion is the version of the configuration schema
+	APIVersion string `yaml:"apiVersion" json:"apiVersion"`
+
+	// Kind is the type of the configuration object
+	Kind string `yaml:"kind" json:"kind"`
+
+	// API holds the NVIDIA BMM API connection settings
+	API APIConfig `yaml:"api" json:"api"`
+
+	// Cluster identifies where the cluster runs in NVIDIA BMM
+	Cluster ClusterConfig `yaml:"cluster" json:"cluster"`
+
+	// Tracing configures OpenTelemetry tracing, disabled when nil
+	Tracing *TracingConfig `yaml:"tracing,omitempty" json:"tracing,omitempty"`
+
+	// ProviderID configures how node provider IDs are checked against the configuration
+	ProviderID ProviderIDConfig `yaml:"providerID" json:"providerID"`
+
+	// NodeIPAM configures where the node IPAM controller allocates pod CIDRs from
+	NodeIPAM NodeIPAMConfig `yaml:"nodeIPAM" json:"nodeIPAM"`
+
+	// NodeLifecycle configures how the provider answers the node lifecycle and node controllers
+	NodeLifecycle NodeLifecycleConfig `yaml:"nodeLifecycle" json:"nodeLifecycle"`
+
+	// PowerActions configures the power action controller, when enabled with --controllers
+	PowerActions PowerActionsConfig `yaml:"powerActions" json:"powerActions"`
+}
+
+// APIConfig holds the NVIDIA BMM API connection settings
+type APIConfig struct {
+	// Endpoint is the NVIDIA BMM API endpoint URL
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+
+	// OrgName is the NVIDIA BMM organization name
+	OrgName string `yaml:"orgName" json:"orgName"`
+
+	// Token is the NVIDIA BMM API authentication token
+	Token string `yaml:"token" json:"token"`
+
+	// RequestTimeout bounds each NVIDIA BMM API call
+	RequestTimeout time.Duration `yaml:"requestTimeout" json:"requestTimeout"`
+}
+
+// ClusterConfig identifies where the cluster runs in NVIDIA BMM
+type ClusterConfig struct {
+	// SiteID is the NVIDIA BMM site UUID or name, names are resolved through the site API
+	SiteID string `yaml:"siteId" json:"siteId"`
+
+	// TenantID is the NVIDIA BMM tenant UUID
+	TenantID string `yaml:"tenantId" json:"tenantId"`
+}
+
+// TracingConfig configures export of OpenTelemetry traces over OTLP/gRPC
+type TracingConfig struct {
+	// Endpoint is the OTLP/gRPC collector endpoint, tracing is disabled when empty
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+
+	// SamplingRatePerMillion is the number of traces sampled per million.
+	// When zero, only requests whose parent span is sampled are traced.
+	SamplingRatePerMillion int32 `yaml:"samplingRatePerMillion" json:"samplingRatePerMillion"`
+}
+
+// ProviderIDConfig configures how node provider IDs are checked against the configured
+// org, tenant and sites
+type ProviderIDConfig struct {
+	// MismatchPolicy is applied when the org, tenant or site of a provider ID does not match:
+	// reject, warn or useProviderIDOrg
+	MismatchPolicy ProviderIDPolicy `yaml:"mismatchPolicy" json:"mismatchPolicy"`
+
+	// LegacyPolicy is applied to legacy 3-segment provider IDs without a tenant: accept, warn or reject
+	LegacyPolicy ProviderIDPolicy `yaml:"legacyPolicy" json:"legacyPolicy"`
+
+	// Tenants are accepted in the tenant segment in addition to cluster.tenantId, e.g. the tenant name
+	Tenants []string `yaml:"tenants,omitempty" json:"tenants,omitempty"`
+
+	// Sites are accepted in the site segment in addition to cluster.siteId, by UUID or name
+	Sites []string `yaml:"sites,omitempty" json:"sites,omitempty"`
+}
+
+// NodeIPAMConfig configures where the node IPAM controller allocates pod CIDRs from.
+// A pod VPC prefix attached to an instance interface is used as the pod CIDR of its node as is.
+// Nodes without one get a block of NodeMaskSize carved out of the pod subnets.
+type NodeIPAMConfig struct {
+	// PodVPCPrefixes are the UUIDs of NVIDIA BMM VPC prefixes set aside for the pods of the
+	// instance they are attached to. Other VPC prefixes, which interfaces take their IPs from
+	// and instances share, are never used for pods.
+	PodVPCPrefixes []string `yaml:"podVpcPrefixes,omitempty" json:"podVpcPrefixes,omitempty"`
+
+	// PodSubnets are the UUIDs of NVIDIA BMM subnets reserved for pods
+	PodSubnets []string `yaml:"podSubnets,omitempty" json:"podSubnets,omitempty"`
+
+	// NodeMaskSize is the prefix length of the IPv4 pod CIDRs carved out of the pod subnets
+	NodeMaskSize int `yaml:"nodeMaskSize" json:"nodeMaskSize"`
+}
+
+// NodeLifecycleConfig configures how the provider answers the node lifecycle and node controllers
+type NodeLifecycleConfig struct {
+	// DryRun reports the nodes that would be deleted or tainted and the addresses and labels
+	// that would change, and answers with values that leave the nodes untouched
+	DryRun bool `yaml:"dryRun" json:"dryRun"`
+
+	// DeletionGuard stops node deletions when the instances of many nodes are not found at once
+	DeletionGuard DeletionGuardConfig `yaml:"deletionGuard" json:"deletionGuard"`
+
+	// DeletionGracePeriod delays reporting an instance as not found until it was not found
+	// several times over a minimum duration
+	DeletionGracePeriod DeletionGracePeriodConfig `yaml:"deletionGracePeriod" json:"deletionGracePeriod"`
+
+	// OutOfService configures the out-of-service controller, when enabled with --controllers
+	OutOfService OutOfServiceConfig `yaml:"outOfService" json:"outOfService"`
+}
+
+// OutOfServiceConfig configures when the out-of-service controller taints the nodes of
+// shut down instances with node.kubernetes.io/out-of-service
+type OutOfServiceConfig struct {
+	// After is how long an instance must stay shut down before its NotReady node is tainted
+	After time.Duration `yaml:"after" json:"after"`
+}
+
+// DeletionGracePeriodConfig configures how long an instance must be consecutively not found
+// before InstanceExists reports it as not found, and its node is deleted. It is disabled when
+// both Observations and MinDuration are zero.
+type DeletionGracePeriodConfig struct {
+	// Observations is the number of consecutive not found observations of an instance
+	Observations int `yaml:"observations" json:"observations"`
+
+	// MinDuration is the minimum time since the first of these observations
+	MinDuration time.Duration `yaml:"minDuration" json:"minDuration"`
+
+	// PersistInAnnotation records the observations in an annotation of the node, so that
+	// they survive restarts of the cloud controller manager
+	PersistInAnnotation bool `yaml:"persistInAnnotation" json:"persistInAnnotation"`
+}
+
+// DeletionGuardConfig configures the guard against mass node deletion. When more nodes than
+// allowed have their instance reported not found within the window, InstanceExists returns
+// errors instead of false until the count is back within the limits.
+type DeletionGuardConfig struct {
+	// MaxNotFound is the number of nodes that can be reported not found within the window,
+	// no limit when zero
+	MaxNotFound int `yaml:"maxNotFound" json:"maxNotFound"`
+
+	// MaxNotFoundPercent is the percentage of the cluster nodes that can be reported not found
+	// within the window, no limit when zero
+	MaxNotFoundPercent int `yaml:"maxNotFoundPercent" json:"maxNotFoundPercent"`
+
+	// Window is how long a node reported not found is counted
+	Window time.Duration `yaml:"window" json:"window"`
+}
+
+// PowerActionsConfig configures how often the power action controller performs the power
+// actions requested with the bmm.nvidia.com/power-action node annotation
+type PowerActionsConfig struct {
+	// MinInterval is the minimum time between two power actions on the same node
+	MinInterval time.Duration `yaml:"minInterval" json:"minInterval"`
+
+	// MaxPerHour is the number of power actions allowed on all nodes within an hour
+	MaxPerHour int `yaml:"maxPerHour" json:"maxPerHour"`
+}
+
+// legacyConfig is the original unversioned, flat configuration format
+type legacyConfig struct {
+	Endpoint string `yaml:"endpoint"`
+	OrgName  string `yaml:"orgName"`
+	Token    string `yaml:"token"`
+	SiteID   string `yaml:"siteId"`
+	TenantID string `yaml:"tenantId"`
+}
+
+// typeMeta is used to detect the format of a configuration document
+type typeMeta struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+}
+
+// SetDefaults fills in default values for unset fields
+func (c *Config) SetDefaults() {
+	if c.APIVersion == "" {
+		c.APIVersion = ConfigAPIVersion
+	}
+	if c.Kind == "" {
+		c.Kind = ConfigKind
+	}
+	if c.API.RequestTimeout == 0 {
+		c.API.RequestTimeout = DefaultRequestTimeout
+	}
+	if c.ProviderID.MismatchPolicy == "" {
+		c.ProviderID.MismatchPolicy = ProviderIDPolicyWarn
+	}
+	if c.ProviderID.LegacyPolicy == "" {
+		c.ProviderID.LegacyPolicy = ProviderIDPolicyWarn
+	}
+	if c.NodeIPAM.NodeMaskSize == 0 {
+		c.NodeIPAM.NodeMaskSize = DefaultNodeMaskSize
+	}
+	if c.NodeLifecycle.DeletionGuard.Window == 0 {
+		c.NodeLifecycle.DeletionGuard.Window = DefaultDeletionGuardWindow
+	}
+	if c.NodeLifecycle.OutOfService.After == 0 {
+		c.NodeLifecycle.OutOfService.After = DefaultOutOfServiceAfter
+	}
+	if c.PowerActions.MinInterval == 0 {
+		c.PowerActions.MinInterval = DefaultPowerActionMinInterval
+	}
+	if c.PowerActions.MaxPerHour == 0 {
+		c.PowerActions.MaxPerHour = DefaultPowerActionsPerHour
+	}
+}
+
+// Validate checks if the configuration is valid
+func (c *Config) Validate() error {
+	if c.APIVersion != ConfigAPIVersion {
+		return fmt.Errorf("unsupported apiVersion %q, expected %q", c.APIVersion, ConfigAPIVersion)
+	}
+	if c.Kind != ConfigKind {
+		return fmt.Errorf("unsupported kind %q, expected %q", c.Kind, ConfigKind)
+	}
+	if c.API.Endpoint == "" {
+		return fmt.Errorf("endpoint is required")
+	}
+	if c.API.OrgName == "" {
+		return fmt.Errorf("orgName is required")
+	}
+	if c.API.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if c.API.RequestTimeout < 0 {
+		return fmt.Errorf("requestTimeout must not be negative")
+	}
+	if c.Cluster.SiteID == "" {
+		return fmt.Errorf("siteId is required")
+	}
+	if c.Cluster.TenantID == "" {
+		return fmt.Errorf("tenantId is required")
+	}
+	if c.Tracing != nil {
+		if c.Tracing.SamplingRatePerMillion < 0 || c.Tracing.SamplingRatePerMillion > 1000000 {
+			return fmt.Errorf("tracing.samplingRatePerMillion must be between 0 and 1000000")
+		}
+	}
+	switch c.ProviderID.MismatchPolicy {
+	case ProviderIDPolicyReject, ProviderIDPolicyWarn, ProviderIDPolicyUseProviderIDOrg:
+	default:
+		return fmt.Errorf("unsupported providerID.mismatchPolicy %q, expected %s, %s or %s", c.ProviderID.MismatchPolicy,
+			ProviderIDPolicyReject, ProviderIDPolicyWarn, ProviderIDPolicyUseProviderIDOrg)
+	}
+	switch c.ProviderID.LegacyPolicy {
+	case ProviderIDPolicyAccept, ProviderIDPolicyWarn, ProviderIDPolicyReject:
+	default:
+		return fmt.Errorf("unsupported providerID.legacyPolicy %q, expected %s, %s or %s", c.ProviderID.LegacyPolicy,
+			ProviderIDPolicyAccept, ProviderIDPolicyWarn, ProviderIDPolicyReject)
+	}
+	for _, prefix := range c.NodeIPAM.PodVPCPrefixes {
+		if _, err := uuid.Parse(prefix); err != nil {
+			return fmt.Errorf("nodeIPAM.podVpcPrefixes: invalid VPC prefix UUID %q", prefix)
+		}
+	}
+	for _, subnet := range c.NodeIPAM.PodSubnets {
+		if _, err := uuid.Parse(subnet); err != nil {
+			return fmt.Errorf("nodeIPAM.podSubnets: invalid subnet UUID %q", subnet)
+		}
+	}
+	if c.NodeIPAM.NodeMaskSize < 1 || c.NodeIPAM.NodeMaskSize > 32 {
+		return fmt.Errorf("nodeIPAM.nodeMaskSize must be between 1 and 32")
+	}
+	guard := c.NodeLifecycle.DeletionGuard
+	if guard.MaxNotFound < 0 {
+		return fmt.Errorf("nodeLifecycle.deletionGuard.maxNotFound must not be negative")
+	}
+	if guard.MaxNotFoundPercent < 0 || guard.MaxNotFoundPercent > 100 {
+		return fmt.Errorf("nodeLifecycle.deletionGuard.maxNotFoundPercent must be between 0 and 100")
+	}
+	if guard.Window < 0 {
+		return fmt.Errorf("nodeLifecycle.deletionGuard.window must not be negative")
+	}
+	grace := c.NodeLifecycle.DeletionGracePeriod
+	if grace.Observations < 0 {
+		return fmt.Errorf("nodeLifecycle.deletionGracePeriod.observations must not be negative")
+	}
+	if grace.MinDuration < 0 {
+		return fmt.Errorf("nodeLifecycle.deletionGracePeriod.minDuration must not be negative")
+	}
+	if c.NodeLifecycle.OutOfService.After < 0 {
+		return fmt.Errorf("nodeLifecycle.outOfService.after must not be negative")
+	}
+	if c.PowerActions.MinInterval < 0 {
+		return fmt.Errorf("powerActions.minInterval must not be negative")
+	}
+	if c.PowerActions.MaxPerHour < 0 {
+		return fmt.Errorf("powerActions.maxPerHour must not be negative")
+	}
+	return nil
+}
+
+// convertLegacyConfig converts the legacy flat format to the versioned format.
+// The apiVersion and kind are left for SetDefaults to fill in.
+func convertLegacyConfig(legacy *legacyConfig) *Config {
+	return &Config{
+		API: APIConfig{
+			Endpoint: legacy.Endpoint,
+			OrgName:  legacy.OrgName,
+			Token:    legacy.Token,
+		},
+		Cluster: ClusterConfig{
+			SiteID:   legacy.SiteID,
+			TenantID: legacy.TenantID,
+		},
+	}
+}
+
+// decodeConfig decodes a configuration document in either the versioned or the legacy format
+func decodeConfig(data []byte) (*Config, error) {
+	meta := &typeMeta{}
+	if err := yaml.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal YAML config: %w", err)
+	}
+
+	if meta.APIVersion == "" && meta.Kind == "" {
+		legacy := &legacyConfig{}
+		if err := yaml.Unmarshal(data, legacy); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal YAML config: %w", err)
+		}
+		klog.V(4).InfoS("Converted legacy flat configuration", "apiVersion", ConfigAPIVersion)
+		return convertLegacyConfig(legacy), nil
+	}
+
+	if meta.APIVersion != ConfigAPIVersion || meta.Kind != ConfigKind {
+		return nil, fmt.Errorf("unsupported config apiVersion %q and kind %q", meta.APIVersion, meta.Kind)
+	}
+
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal YAML config: %w", err)
+	}
+	return cfg, nil
+}
+
+// fieldValues returns the string form of every configuration field keyed by its YAML path
+func (c *Config) fieldValues() map[string]string {
+	timeout := ""
+	if c.API.RequestTimeout != 0 {
+		timeout = c.API.RequestTimeout.String()
+	}
+	nodeMaskSize := ""
+	if c.NodeIPAM.NodeMaskSize != 0 {
+		nodeMaskSize = strconv.Itoa(c.NodeIPAM.NodeMaskSize)
+	}
+	dryRun := ""
+	if c.NodeLifecycle.DryRun {
+		dryRun = "true"
+	}
+	guard := c.NodeLifecycle.DeletionGuard
+	maxNotFound, maxNotFoundPercent, guardWindow := "", "", ""
+	if guard.MaxNotFound != 0 {
+		maxNotFound = strconv.Itoa(guard.MaxNotFound)
+	}
+	if guard.MaxNotFoundPercent != 0 {
+		maxNotFoundPercent = strconv.Itoa(guard.MaxNotFoundPercent)
+	}
+	if guard.Window != 0 {
+		guardWindow = guard.Window.String()
+	}
+	grace := c.NodeLifecycle.DeletionGracePeriod
+	graceObservations, graceMinDuration, graceAnnotation := "", "", ""
+	if grace.Observations != 0 {
+		graceObservations = strconv.Itoa(grace.Observations)
+	}
+	if grace.MinDuration != 0 {
+		graceMinDuration = grace.MinDuration.String()
+	}
+	if grace.PersistInAnnotation {
+		graceAnnotation = "true"
+	}
+	outOfServiceAfter := ""
+	if c.NodeLifecycle.OutOfService.After != 0 {
+		outOfServiceAfter = c.NodeLifecycle.OutOfService.After.String()
+	}
+	powerActionInterval, powerActionsPerHour := "", ""
+	if c.PowerActions.MinInterval != 0 {
+		powerActionInterval = c.PowerActions.MinInterval.String()
+	}
+	if c.PowerActions.MaxPerHour != 0 {
+		powerActionsPerHour = strconv.Itoa(c.PowerActions.MaxPerHour)
+	}
+	tracingEndpoint, samplingRate := "", ""
+	if c.Tracing != nil {
+		tracingEndpoint = c.Tracing.Endpoint
+		samplingRate = strconv.Itoa(int(c.Tracing.SamplingRatePerMillion))
+	}
+	return map[string]string{
+		"apiVersion":         c.APIVersion,
+		"kind":               c.Kind,
+		"api.endpoint":       c.API.Endpoint,
+		"api.orgName":        c.API.OrgName,
+		"api.token":          c.API.Token,
+		"api.requestTimeout": timeout,
+		"cluster.siteId":     c.Cluster.SiteID,
+		"cluster.tenantId":   c.Cluster.TenantID,
+
+		"tracing.endpoint":               tracingEndpoint,
+		"tracing.samplingRatePerMillion": samplingRate,
+
+		"providerID.mismatchPolicy": string(c.ProviderID.MismatchPolicy),
+		"providerID.legacyPolicy":   string(c.ProviderID.LegacyPolicy),
+		"providerID.tenants":        strings.Join(c.ProviderID.Tenants, ","),
+		"providerID.sites":          strings.Join(c.ProviderID.Sites, ","),
+
+		"nodeIPAM.podVpcPrefixes": strings.Join(c.NodeIPAM.PodVPCPrefixes, ","),
+		"nodeIPAM.podSubnets":     strings.Join(c.NodeIPAM.PodSubnets, ","),
+		"nodeIPAM.nodeMaskSize":   nodeMaskSize,
+
+		"nodeLifecycle.dryRun":                           dryRun,
+		"nodeLifecycle.deletionGuard.maxNotFound":        maxNotFound,
+		"nodeLifecycle.deletionGuard.maxNotFoundPercent": maxNotFoundPercent,
+		"nodeLifecycle.deletionGuard.window":             guardWindow,
+
+		"nodeLifecycle.deletionGracePeriod.observations":        graceObservations,
+		"nodeLifecycle.deletionGracePeriod.minDuration":         graceMinDuration,
+		"nodeLifecycle.deletionGracePeriod.persistInAnnotation": graceAnnotation,
+
+		"nodeLifecycle.outOfService.after": outOfServiceAfter,
+
+		"powerActions.minInterval": powerActionInterval,
+		"powerActions.maxPerHour":  powerActionsPerHour,
+	}
+}
+
+// Redacted returns a copy of the configuration with secrets masked
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	if redacted.API.Token != "" {
+		redacted.API.Token = redactedValue
+	}
+	return &redacted
+}
+
+// parseConfig parses the cloud provider configuration from YAML or environment variables
+// and records where each effective value came from
+func parseConfig(config io.Reader) (*Config, *configMetadata, error) {
+	cfg := &Config{}
+	metadata := &configMetadata{
+		Sources:  map[string]ConfigSource{},
+		LoadTime: time.Now(),
+	}
+
+	// First, try to parse from config file (YAML)
+	if config != nil {
+		data, err := io.ReadAll(config)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read config: %w", err)
+		}
+
+		if len(data) > 0 {
+			cfg, err = decodeConfig(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			metadata.FileHash = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+			klog.V(4).InfoS("Loaded configuration from YAML file")
+		}
+	}
+
+	for field, value := range cfg.fieldValues() {
+		if value != "" {
+			metadata.Sources[field] = ConfigSourceFile
+		}
+	}
+
+	// Override with environment variables if present
+	if endpoint := os.Getenv(EnvEndpoint); endpoint != "" {
+		cfg.API.Endpoint = endpoint
+		metadata.Sources["api.endpoint"] = ConfigSourceEnv
+		klog.V(4).InfoS("Using endpoint from environment", "endpoint", endpoint)
+	}
+	if orgName := os.Getenv(EnvOrgName); orgName != "" {
+		cfg.API.OrgName = orgName
+		metadata.Sources["api.orgName"] = ConfigSourceEnv
+		klog.V(4).InfoS("Using orgName from environment", "orgName", orgName)
+	}
+	if token := os.Getenv(EnvToken); token != "" {
+		cfg.API.Token = token
+		metadata.Sources["api.token"] = ConfigSourceEnv
+		klog.V(4).InfoS("Using token from environment")
+	}
+	if siteID := os.Getenv(EnvSiteID); siteID != "" {
+		cfg.Cluster.SiteID = siteID
+		metadata.Sources["cluster.siteId"] = ConfigSourceEnv
+		klog.V(4).InfoS("Using siteID from environment", "siteID", siteID)
+	}
+	if tenantID := os.Getenv(EnvTenantID); tenantID != "" {
+		cfg.Cluster.TenantID = tenantID
+		metadata.Sources["cluster.tenantId"] = ConfigSourceEnv
+		klog.V(4).InfoS("Using tenantID from environment", "tenantID", tenantID)
+	}
+
+	cfg.SetDefaults()
+
+	for field, value := range cfg.fieldValues() {
+		if _, ok := metadata.Sources[field]; ok {
+			continue
+		}
+		if value != "" {
+			metadata.Sources[field] = ConfigSourceDefault
+		} else {
+			metadata.Sources[field] = ConfigSourceUnset
+		}
+	}
+
+	return cfg, metadata, nil
+}
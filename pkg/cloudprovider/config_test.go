@@ -0,0 +1,372 @@
+package cloudprovider
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() *Config {
+	return &Config{
+		APIVersion: ConfigAPIVersion,
+		Kind:       ConfigKind,
+		API: APIConfig{
+			Endpoint: "https://api.carbide.test",
+			OrgName:  "test-org",
+			Token:    "test-token",
+		},
+		Cluster: ClusterConfig{
+			SiteID:   "test-site",
+			TenantID: "test-tenant",
+		},
+		ProviderID: ProviderIDConfig{
+			MismatchPolicy: ProviderIDPolicyWarn,
+			LegacyPolicy:   ProviderIDPolicyWarn,
+		},
+		NodeIPAM: NodeIPAMConfig{
+			NodeMaskSize: DefaultNodeMaskSize,
+		},
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *Config)
+		wantErr bool
+	}{
+		{
+			name:    "valid config",
+			mutate:  func(c *Config) {},
+			wantErr: false,
+		},
+		{
+			name:    "missing endpoint",
+			mutate:  func(c *Config) { c.API.Endpoint = "" },
+			wantErr: true,
+		},
+		{
+			name:    "missing orgName",
+			mutate:  func(c *Config) { c.API.OrgName = "" },
+			wantErr: true,
+		},
+		{
+			name:    "missing token",
+			mutate:  func(c *Config) { c.API.Token = "" },
+			wantErr: true,
+		},
+		{
+			name:    "missing siteId",
+			mutate:  func(c *Config) { c.Cluster.SiteID = "" },
+			wantErr: true,
+		},
+		{
+			name:    "missing tenantId",
+			mutate:  func(c *Config) { c.Cluster.TenantID = "" },
+			wantErr: true,
+		},
+		{
+			name:    "unsupported apiVersion",
+			mutate:  func(c *Config) { c.APIVersion = "bmm.nvidia.com/v2" },
+			wantErr: true,
+		},
+		{
+			name:    "negative request timeout",
+			mutate:  func(c *Config) { c.API.RequestTimeout = -time.Second },
+			wantErr: true,
+		},
+		{
+			name:    "useProviderIDOrg mismatch policy",
+			mutate:  func(c *Config) { c.ProviderID.MismatchPolicy = ProviderIDPolicyUseProviderIDOrg },
+			wantErr: false,
+		},
+		{
+			name:    "unsupported mismatch policy",
+			mutate:  func(c *Config) { c.ProviderID.MismatchPolicy = ProviderIDPolicyAccept },
+			wantErr: true,
+		},
+		{
+			name:    "pod subnets",
+			mutate:  func(c *Config) { c.NodeIPAM.PodSubnets = []string{"550e8400-e29b-41d4-a716-446655440000"} },
+			wantErr: false,
+		},
+		{
+			name:    "invalid pod subnet",
+			mutate:  func(c *Config) { c.NodeIPAM.PodSubnets = []string{"pods"} },
+			wantErr: true,
+		},
+		{
+			name:    "pod VPC prefixes",
+			mutate:  func(c *Config) { c.NodeIPAM.PodVPCPrefixes = []string{"550e8400-e29b-41d4-a716-446655440000"} },
+			wantErr: false,
+		},
+		{
+			name:    "invalid pod VPC prefix",
+			mutate:  func(c *Config) { c.NodeIPAM.PodVPCPrefixes = []string{"pods"} },
+			wantErr: true,
+		},
+		{
+			name:    "node mask size out of range",
+			mutate:  func(c *Config) { c.NodeIPAM.NodeMaskSize = 33 },
+			wantErr: true,
+		},
+		{
+			name: "deletion guard",
+			mutate: func(c *Config) {
+				c.NodeLifecycle.DeletionGuard = DeletionGuardConfig{MaxNotFound: 3, MaxNotFoundPercent: 10}
+			},
+			wantErr: false,
+		},
+		{
+			name:    "negative deletion guard count",
+			mutate:  func(c *Config) { c.NodeLifecycle.DeletionGuard.MaxNotFound = -1 },
+			wantErr: true,
+		},
+		{
+			name:    "deletion guard percentage out of range",
+			mutate:  func(c *Config) { c.NodeLifecycle.DeletionGuard.MaxNotFoundPercent = 101 },
+			wantErr: true,
+		},
+		{
+			name:    "negative deletion guard window",
+			mutate:  func(c *Config) { c.NodeLifecycle.DeletionGuard.Window = -time.Minute },
+			wantErr: true,
+		},
+		{
+			name: "deletion grace period",
+			mutate: func(c *Config) {
+				c.NodeLifecycle.DeletionGracePeriod = DeletionGracePeriodConfig{Observations: 3, MinDuration: 5 * time.Minute}
+			},
+			wantErr: false,
+		},
+		{
+			name:    "negative deletion grace period observations",
+			mutate:  func(c *Config) { c.NodeLifecycle.DeletionGracePeriod.Observations = -1 },
+			wantErr: true,
+		},
+		{
+			name:    "negative deletion grace period duration",
+			mutate:  func(c *Config) { c.NodeLifecycle.DeletionGracePeriod.MinDuration = -time.Minute },
+			wantErr: true,
+		},
+		{
+			name:    "negative out-of-service delay",
+			mutate:  func(c *Config) { c.NodeLifecycle.OutOfService.After = -time.Minute },
+			wantErr: true,
+		},
+		{
+			name:    "negative power action interval",
+			mutate:  func(c *Config) { c.PowerActions.MinInterval = -time.Minute },
+			wantErr: true,
+		},
+		{
+			name:    "negative power actions per hour",
+			mutate:  func(c *Config) { c.PowerActions.MaxPerHour = -1 },
+			wantErr: true,
+		},
+		{
+			name:    "unsupported legacy policy",
+			mutate:  func(c *Config) { c.ProviderID.LegacyPolicy = ProviderIDPolicyUseProviderIDOrg },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			tt.mutate(config)
+			err := config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseConfig_YAML(t *testing.T) {
+	yamlConfig := `
+endpoint: "https://api.carbide.test"
+orgName: "test-org"
+token: "test-token"
+siteId: "test-site"
+tenantId: "test-tenant"
+`
+
+	config, _, err := parseConfig(strings.NewReader(yamlConfig))
+	if err != nil {
+		t.Fatalf("parseConfig() failed: %v", err)
+	}
+
+	if config.API.Endpoint != "https://api.carbide.test" {
+		t.Errorf("Expected endpoint=https://api.carbide.test, got %s", config.API.Endpoint)
+	}
+	if config.API.OrgName != "test-org" {
+		t.Errorf("Expected orgName=test-org, got %s", config.API.OrgName)
+	}
+	if config.API.Token != "test-token" {
+		t.Errorf("Expected token=test-token, got %s", config.API.Token)
+	}
+	if config.Cluster.SiteID != "test-site" {
+		t.Errorf("Expected siteId=test-site, got %s", config.Cluster.SiteID)
+	}
+	if config.Cluster.TenantID != "test-tenant" {
+		t.Errorf("Expected tenantId=test-tenant, got %s", config.Cluster.TenantID)
+	}
+
+	// The legacy format is converted and defaulted to the versioned format
+	if config.APIVersion != ConfigAPIVersion || config.Kind != ConfigKind {
+		t.Errorf("Expected %s/%s, got %s/%s", ConfigAPIVersion, ConfigKind, config.APIVersion, config.Kind)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Converted legacy config is invalid: %v", err)
+	}
+}
+
+func TestParseConfig_Versioned(t *testing.T) {
+	yamlConfig := `
+apiVersion: bmm.nvidia.com/v1alpha1
+kind: CloudConfig
+api:
+  endpoint: "https://api.carbide.test"
+  orgName: "test-org"
+  token: "test-token"
+  requestTimeout: 10s
+cluster:
+  siteId: "test-site"
+  tenantId: "test-tenant"
+`
+
+	config, _, err := parseConfig(strings.NewReader(yamlConfig))
+	if err != nil {
+		t.Fatalf("parseConfig() failed: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+
+	if config.API.Endpoint != "https://api.carbide.test" {
+		t.Errorf("Expected endpoint=https://api.carbide.test, got %s", config.API.Endpoint)
+	}
+	if config.API.RequestTimeout != 10*time.Second {
+		t.Errorf("Expected requestTimeout=10s, got %s", config.API.RequestTimeout)
+	}
+	if config.Cluster.SiteID != "test-site" {
+		t.Errorf("Expected siteId=test-site, got %s", config.Cluster.SiteID)
+	}
+}
+
+func TestParseConfig_UnsupportedVersion(t *testing.T) {
+	yamlConfig := `
+apiVersion: bmm.nvidia.com/v9
+kind: CloudConfig
+`
+
+	if _, _, err := parseConfig(strings.NewReader(yamlConfig)); err == nil {
+		t.Error("Expected error for unsupported apiVersion")
+	}
+}
+
+func TestParseConfig_EnvOverride(t *testing.T) {
+	t.Setenv(EnvEndpoint, "https://env.carbide.test")
+	t.Setenv(EnvSiteID, "env-site")
+
+	config, _, err := parseConfig(strings.NewReader(`
+apiVersion: bmm.nvidia.com/v1alpha1
+kind: CloudConfig
+api:
+  endpoint: "https://api.carbide.test"
+cluster:
+  siteId: "test-site"
+`))
+	if err != nil {
+		t.Fatalf("parseConfig() failed: %v", err)
+	}
+
+	if config.API.Endpoint != "https://env.carbide.test" {
+		t.Errorf("Expected endpoint from environment, got %s", config.API.Endpoint)
+	}
+	if config.Cluster.SiteID != "env-site" {
+		t.Errorf("Expected siteId from environment, got %s", config.Cluster.SiteID)
+	}
+}
+
+func TestConfigSetDefaults(t *testing.T) {
+	config := &Config{}
+	config.SetDefaults()
+
+	if config.APIVersion != ConfigAPIVersion {
+		t.Errorf("Expected apiVersion=%s, got %s", ConfigAPIVersion, config.APIVersion)
+	}
+	if config.Kind != ConfigKind {
+		t.Errorf("Expected kind=%s, got %s", ConfigKind, config.Kind)
+	}
+	if config.API.RequestTimeout != DefaultRequestTimeout {
+		t.Errorf("Expected requestTimeout=%s, got %s", DefaultRequestTimeout, config.API.RequestTimeout)
+	}
+	if config.NodeLifecycle.DeletionGuard.Window != DefaultDeletionGuardWindow {
+		t.Errorf("Expected deletionGuard.window=%s, got %s", DefaultDeletionGuardWindow, config.NodeLifecycle.DeletionGuard.Window)
+	}
+
+	// Explicit values are preserved
+	config.API.RequestTimeout = time.Minute
+	config.SetDefaults()
+	if config.API.RequestTimeout != time.Minute {
+		t.Errorf("Expected requestTimeout=1m, got %s", config.API.RequestTimeout)
+	}
+}
+
+func TestParseConfig_Sources(t *testing.T) {
+	t.Setenv(EnvSiteID, "env-site")
+
+	config, metadata, err := parseConfig(strings.NewReader(`
+apiVersion: bmm.nvidia.com/v1alpha1
+kind: CloudConfig
+api:
+  endpoint: "https://api.carbide.test"
+  token: "test-token"
+cluster:
+  siteId: "test-site"
+nodeLifecycle:
+  dryRun: true
+`))
+	if err != nil {
+		t.Fatalf("parseConfig() failed: %v", err)
+	}
+	if !config.NodeLifecycle.DryRun {
+		t.Error("Expected nodeLifecycle.dryRun to be true")
+	}
+
+	want := map[string]ConfigSource{
+		"apiVersion":         ConfigSourceFile,
+		"kind":               ConfigSourceFile,
+		"api.endpoint":       ConfigSourceFile,
+		"api.orgName":        ConfigSourceUnset,
+		"api.token":          ConfigSourceFile,
+		"api.requestTimeout": ConfigSourceDefault,
+		"cluster.siteId":     ConfigSourceEnv,
+		"cluster.tenantId":   ConfigSourceUnset,
+
+		"nodeLifecycle.dryRun":             ConfigSourceFile,
+		"nodeLifecycle.outOfService.after": ConfigSourceDefault,
+	}
+	for field, source := range want {
+		if got := metadata.Sources[field]; got != source {
+			t.Errorf("Expected source of %s to be %s, got %s", field, source, got)
+		}
+	}
+
+	if !strings.HasPrefix(metadata.FileHash, "sha256:") {
+		t.Errorf("Expected a sha256 file hash, got %q", metadata.FileHash)
+	}
+	if metadata.LoadTime.IsZero() {
+		t.Error("Expected load time to be set")
+	}
+
+	effective := newEffectiveConfig(config, metadata)
+	if effective.Config.API.Token != redactedValue {
+		t.Errorf("Expected token to be redacted, got %q", effective.Config.API.Token)
+	}
+	if config.API.Token != "test-token" {
+		t.Error("Redaction must not modify the effective configuration")
+	}
+}
@@ -0,0 +1,73 @@
+package cloudprovider
+
+import (
+	"time"
+
+	"k8s.io/component-base/configz"
+	"k8s.io/klog/v2"
+)
+
+// ConfigSource identifies where an effective configuration value came from
+type ConfigSource string
+
+const (
+	// ConfigSourceFile means the value was read from the cloud config file
+	ConfigSourceFile ConfigSource = "file"
+
+	// ConfigSourceEnv means the value was overridden by an NVIDIA_BMM_* environment variable
+	ConfigSourceEnv ConfigSource = "env"
+
+	// ConfigSourceDefault means the value was filled in by SetDefaults
+	ConfigSourceDefault ConfigSource = "default"
+
+	// ConfigSourceUnset means no value was provided
+	ConfigSourceUnset ConfigSource = "unset"
+)
+
+// configMetadata describes how the effective configuration was loaded
+type configMetadata struct {
+	// Sources maps each field, keyed by its YAML path, to where its value came from
+	Sources map[string]ConfigSource
+
+	// FileHash is the SHA-256 of the cloud config file, empty if no file was read
+	FileHash string
+
+	// LoadTime is when the configuration was loaded
+	LoadTime time.Time
+}
+
+// EffectiveConfig is the provider configuration reported on the /configz debug endpoint
+type EffectiveConfig struct {
+	// Config is the effective configuration with secrets redacted
+	Config *Config `json:"config"`
+
+	// Sources maps each field, keyed by its YAML path, to where its value came from
+	Sources map[string]ConfigSource `json:"sources"`
+
+	// FileHash is the SHA-256 of the cloud config file
+	FileHash string `json:"fileHash,omitempty"`
+
+	// LoadTime is when the configuration was loaded
+	LoadTime time.Time `json:"loadTime"`
+}
+
+// newEffectiveConfig builds the debug view of a loaded configuration
+func newEffectiveConfig(cfg *Config, metadata *configMetadata) *EffectiveConfig {
+	return &EffectiveConfig{
+		Config:   cfg.Redacted(),
+		Sources:  metadata.Sources,
+		FileHash: metadata.FileHash,
+		LoadTime: metadata.LoadTime,
+	}
+}
+
+// registerConfigz publishes the effective configuration on the /configz endpoint
+// that the cloud controller manager serves on its secure port
+func registerConfigz(effective *EffectiveConfig) {
+	cz, err := configz.New(ProviderName)
+	if err != nil {
+		klog.ErrorS(err, "Unable to register configz", "provider", ProviderName)
+		return
+	}
+	cz.Set(effective)
+}
@@ -0,0 +1,186 @@
+// Package conformance checks that the NVIDIA BMM cloud provider keeps the same behavior on
+// top of any NvidiaBMMClientInterface implementation. Each scenario sets up NVIDIA BMM
+// content, builds a client for it with a ClientFactory and checks every provider entry point.
+package conformance
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/cloudprovider"
+)
+
+const (
+	// Org is the NVIDIA BMM org of the scenarios
+	Org = "conformance-org"
+
+	// SiteName is the name of the configured site
+	SiteName = "conformance-site"
+
+	// TenantID is the configured tenant
+	TenantID = "5e1d0bd4-3f4b-4a3c-9a53-1c1c4d3b7f20"
+
+	// NodeName is the name of the node of the scenarios
+	NodeName = "conformance-node"
+
+	// token is the bearer token of the fake API
+	token = "conformance-token"
+)
+
+// SiteID is the UUID of the configured site
+var SiteID = uuid.MustParse("2b7a9f4e-8c1d-4e6f-a0b3-5d9c7e1f3a24")
+
+// Setup is the NVIDIA BMM content a scenario runs against
+type Setup struct {
+	State  bmmfake.State
+	Faults []bmmfake.Fault
+}
+
+// ClientFactory returns a client serving the content of a setup
+type ClientFactory func(t *testing.T, setup Setup) cloudprovider.NvidiaBMMClientInterface
+
+// HTTPClient returns a factory serving setups from a fake NVIDIA BMM API, with clients created
+// by newClient for the server URL and token. It checks clients speaking the BMM REST API.
+func HTTPClient(newClient func(server, token string) (cloudprovider.NvidiaBMMClientInterface, error)) ClientFactory {
+	return func(t *testing.T, setup Setup) cloudprovider.NvidiaBMMClientInterface {
+		t.Helper()
+		fake := bmmfake.NewServer(Org, bmmfake.WithToken(token))
+		t.Cleanup(fake.Close)
+		fake.Load(setup.State)
+		for _, fault := range setup.Faults {
+			if err := fake.AddFault(fault); err != nil {
+				t.Fatalf("Failed to add fault %+v: %v", fault, err)
+			}
+		}
+
+		client, err := newClient(fake.URL(), token)
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		return client
+	}
+}
+
+// FakeAPIClient serves setups from a fake NVIDIA BMM API, with the generated REST client
+var FakeAPIClient = HTTPClient(func(server, token string) (cloudprovider.NvidiaBMMClientInterface, error) {
+	return restclient.NewClientWithAuth(server, token)
+})
+
+// Run runs every scenario against the clients of newClient
+func Run(t *testing.T, newClient ClientFactory) {
+	for _, scenario := range Scenarios() {
+		t.Run(scenario.Name, func(t *testing.T) {
+			RunScenario(t, newClient, scenario)
+		})
+	}
+}
+
+// RunScenario checks the provider entry points in a single scenario
+func RunScenario(t *testing.T, newClient ClientFactory, scenario Scenario) {
+	instanceID := uuid.New()
+	setup := Setup{
+		State: bmmfake.State{
+			Sites: []restclient.Site{{Id: &SiteID, Name: ptr(SiteName), Org: ptr(Org)}},
+		},
+		Faults: scenario.Faults,
+	}
+	if scenario.Instance != nil {
+		instance := *scenario.Instance
+		instance.Id = &instanceID
+		setup.State.Instances = []restclient.Instance{instance}
+	}
+
+	client := newClient(t, setup)
+	provider := cloudprovider.NewNvidiaBMMCloudWithClient(client, Org, SiteName, TenantID)
+	instances, ok := provider.InstancesV2()
+	if !ok {
+		t.Fatal("InstancesV2() is not supported")
+	}
+	zones, ok := provider.Zones()
+	if !ok {
+		t.Fatal("Zones() is not supported")
+	}
+
+	ctx := context.Background()
+	providerID := scenario.providerID(instanceID)
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: NodeName},
+		Spec:       v1.NodeSpec{ProviderID: providerID},
+	}
+	want := scenario.Want
+	zone, region := Zone(SiteID), Region(SiteID)
+
+	exists, err := instances.InstanceExists(ctx, node)
+	if (err != nil) != want.ExistsErr || (err == nil && exists != want.Exists) {
+		t.Errorf("InstanceExists() = %v, %v, want %v with error %v", exists, err, want.Exists, want.ExistsErr)
+	}
+
+	shutdown, err := instances.InstanceShutdown(ctx, node)
+	if (err != nil) != want.ShutdownErr || (err == nil && shutdown != want.Shutdown) {
+		t.Errorf("InstanceShutdown() = %v, %v, want %v with error %v", shutdown, err, want.Shutdown, want.ShutdownErr)
+	}
+
+	metadata, err := instances.InstanceMetadata(ctx, node)
+	switch {
+	case (err != nil) != want.MetadataErr:
+		t.Errorf("InstanceMetadata() error = %v, want error %v", err, want.MetadataErr)
+	case err == nil:
+		addresses := []v1.NodeAddress{}
+		for _, address := range want.Addresses {
+			addresses = append(addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: address})
+		}
+		addresses = append(addresses, v1.NodeAddress{Type: v1.NodeHostName, Address: NodeName})
+		if !reflect.DeepEqual(metadata.NodeAddresses, addresses) {
+			t.Errorf("InstanceMetadata() addresses = %v, want %v", metadata.NodeAddresses, addresses)
+		}
+		if metadata.ProviderID != providerID {
+			t.Errorf("InstanceMetadata() provider ID = %q, want %q", metadata.ProviderID, providerID)
+		}
+		if metadata.Zone != zone || metadata.Region != region {
+			t.Errorf("InstanceMetadata() zone = %q/%q, want %q/%q", metadata.Zone, metadata.Region, zone, region)
+		}
+		if metadata.InstanceType == "" {
+			t.Error("InstanceMetadata() has no instance type")
+		}
+	}
+
+	got, err := zones.GetZone(ctx)
+	if (err != nil) != want.ZoneErr || (err == nil && (got.FailureDomain != zone || got.Region != region)) {
+		t.Errorf("GetZone() = %+v, %v, want %s/%s with error %v", got, err, zone, region, want.ZoneErr)
+	}
+	got, err = zones.GetZoneByNodeName(ctx, types.NodeName(NodeName))
+	if (err != nil) != want.ZoneErr || (err == nil && (got.FailureDomain != zone || got.Region != region)) {
+		t.Errorf("GetZoneByNodeName() = %+v, %v, want %s/%s with error %v", got, err, zone, region, want.ZoneErr)
+	}
+	got, err = zones.GetZoneByProviderID(ctx, providerID)
+	if (err != nil) != want.ProviderIDZoneErr || (err == nil && (got.FailureDomain != zone || got.Region != region)) {
+		t.Errorf("GetZoneByProviderID() = %+v, %v, want %s/%s with error %v", got, err, zone, region, want.ProviderIDZoneErr)
+	}
+
+	if _, ok := provider.LoadBalancer(); ok {
+		t.Error("LoadBalancer() is supported, the conformance scenarios do not cover it")
+	}
+}
+
+// Zone returns the zone of nodes in a site
+func Zone(siteID uuid.UUID) string {
+	return "nvidia-bmm-zone-" + siteID.String()
+}
+
+// Region returns the region of nodes in a site
+func Region(siteID uuid.UUID) string {
+	return "nvidia-bmm-region-" + strings.Split(siteID.String(), "-")[0]
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,9 @@
+package conformance
+
+import (
+	"testing"
+)
+
+func TestFakeAPIClient(t *testing.T) {
+	Run(t, FakeAPIClient)
+}
@@ -0,0 +1,214 @@
+package conformance
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/google/uuid"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+)
+
+// InstanceStatuses are the NVIDIA BMM instance statuses, with whether the provider reports
+// instances in that status as shut down
+var InstanceStatuses = map[restclient.InstanceStatus]bool{
+	"Pending":      false,
+	"Provisioning": false,
+	"Configuring":  false,
+	"Ready":        false,
+	"Updating":     false,
+	"Rebooting":    false,
+	"Terminating":  true,
+	"Terminated":   true,
+	"Error":        true,
+}
+
+// Scenario is a state of the node instance with the expected provider behavior
+type Scenario struct {
+	Name string
+
+	// Instance is the instance of the node, nil when it does not exist. Its ID is generated.
+	Instance *restclient.Instance
+
+	// Faults are injected in the NVIDIA BMM API
+	Faults []bmmfake.Fault
+
+	// ProviderID formats the provider ID of the node from the instance ID. It defaults
+	// to the canonical provider ID in the configured org, tenant and site.
+	ProviderID func(instanceID uuid.UUID) string
+
+	Want Want
+}
+
+// Want is the expected behavior of the provider entry points
+type Want struct {
+	Exists      bool
+	ExistsErr   bool
+	Shutdown    bool
+	ShutdownErr bool
+	MetadataErr bool
+
+	// Addresses are the expected internal IPs, the node hostname follows them
+	Addresses []string
+
+	// ZoneErr applies to GetZone and GetZoneByNodeName
+	ZoneErr           bool
+	ProviderIDZoneErr bool
+}
+
+// providerID returns the provider ID of the scenario node
+func (s Scenario) providerID(instanceID uuid.UUID) string {
+	if s.ProviderID != nil {
+		return s.ProviderID(instanceID)
+	}
+	return fmt.Sprintf("nvidia-bmm://%s/%s/%s/%s", Org, TenantID, SiteName, instanceID)
+}
+
+// readyInstance returns an instance of the configured site with one address
+func readyInstance() *restclient.Instance {
+	status := restclient.InstanceStatus("Ready")
+	return &restclient.Instance{
+		Name:   ptr(NodeName),
+		SiteId: &SiteID,
+		Status: &status,
+		Interfaces: &[]restclient.Interface{
+			{IpAddresses: &[]string{"10.0.0.10"}},
+		},
+	}
+}
+
+// Scenarios returns the conformance scenarios
+func Scenarios() []Scenario {
+	var scenarios []Scenario
+
+	statuses := make([]restclient.InstanceStatus, 0, len(InstanceStatuses))
+	for status := range InstanceStatuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i] < statuses[j] })
+	for _, status := range statuses {
+		instance := readyInstance()
+		instance.Status = ptr(status)
+		scenarios = append(scenarios, Scenario{
+			Name:     fmt.Sprintf("status %s", status),
+			Instance: instance,
+			Want:     Want{Exists: true, Shutdown: InstanceStatuses[status], Addresses: []string{"10.0.0.10"}},
+		})
+	}
+
+	unknownStatus := readyInstance()
+	unknownStatus.Status = ptr(restclient.InstanceStatus("Hibernating"))
+	nilStatus := readyInstance()
+	nilStatus.Status = nil
+	noInterfaces := readyInstance()
+	noInterfaces.Interfaces = nil
+	emptyInterfaces := readyInstance()
+	emptyInterfaces.Interfaces = &[]restclient.Interface{}
+	noAddresses := readyInstance()
+	noAddresses.Interfaces = &[]restclient.Interface{{IpAddresses: nil}, {IpAddresses: &[]string{}}}
+	multipleAddresses := readyInstance()
+	multipleAddresses.Interfaces = &[]restclient.Interface{
+		{IpAddresses: &[]string{"10.0.0.10", "fd00::10"}},
+		{IpAddresses: nil},
+		{IpAddresses: &[]string{"10.0.1.10"}},
+	}
+
+	scenarios = append(scenarios,
+		Scenario{
+			Name:     "unknown status",
+			Instance: unknownStatus,
+			Want:     Want{Exists: true, Addresses: []string{"10.0.0.10"}},
+		},
+		Scenario{
+			Name:     "nil status",
+			Instance: nilStatus,
+			Want:     Want{Exists: true, Addresses: []string{"10.0.0.10"}},
+		},
+		Scenario{
+			Name:     "nil interfaces",
+			Instance: noInterfaces,
+			Want:     Want{Exists: true},
+		},
+		Scenario{
+			Name:     "empty interfaces",
+			Instance: emptyInterfaces,
+			Want:     Want{Exists: true},
+		},
+		Scenario{
+			Name:     "interfaces without addresses",
+			Instance: noAddresses,
+			Want:     Want{Exists: true},
+		},
+		Scenario{
+			Name:     "addresses of several interfaces in order",
+			Instance: multipleAddresses,
+			Want:     Want{Exists: true, Addresses: []string{"10.0.0.10", "fd00::10", "10.0.1.10"}},
+		},
+		Scenario{
+			Name:     "instance with only an ID",
+			Instance: &restclient.Instance{},
+			Want:     Want{Exists: true},
+		},
+		Scenario{
+			Name: "instance not found",
+			Want: Want{Exists: false, ShutdownErr: true, MetadataErr: true},
+		},
+		Scenario{
+			Name:       "legacy provider ID",
+			Instance:   readyInstance(),
+			ProviderID: func(id uuid.UUID) string { return fmt.Sprintf("nvidia-bmm://%s/%s/%s", Org, SiteName, id) },
+			Want:       Want{Exists: true, Addresses: []string{"10.0.0.10"}},
+		},
+		Scenario{
+			Name:     "provider ID with the site UUID",
+			Instance: readyInstance(),
+			ProviderID: func(id uuid.UUID) string {
+				return fmt.Sprintf("nvidia-bmm://%s/%s/%s/%s", Org, TenantID, SiteID, id)
+			},
+			Want: Want{Exists: true, Addresses: []string{"10.0.0.10"}},
+		},
+		Scenario{
+			Name:     "provider ID in other case",
+			Instance: readyInstance(),
+			ProviderID: func(id uuid.UUID) string {
+				return fmt.Sprintf("nvidia-bmm://CONFORMANCE-ORG/%s/Conformance-Site/%s", TenantID, id)
+			},
+			Want: Want{Exists: true, Addresses: []string{"10.0.0.10"}},
+		},
+		Scenario{
+			Name:       "invalid provider ID",
+			Instance:   readyInstance(),
+			ProviderID: func(id uuid.UUID) string { return "aws:///us-east-1a/" + id.String() },
+			Want:       Want{ExistsErr: true, ShutdownErr: true, MetadataErr: true, ProviderIDZoneErr: true},
+		},
+		Scenario{
+			Name:     "instance API rate limited",
+			Instance: readyInstance(),
+			Faults:   []bmmfake.Fault{bmmfake.RateLimited(bmmfake.OpGetInstance, 0)},
+			Want:     Want{Exists: false, ShutdownErr: true, MetadataErr: true},
+		},
+		Scenario{
+			Name:     "instance API server error",
+			Instance: readyInstance(),
+			Faults:   []bmmfake.Fault{bmmfake.ServerError(bmmfake.OpGetInstance, 0)},
+			Want:     Want{Exists: false, ShutdownErr: true, MetadataErr: true},
+		},
+		Scenario{
+			Name:     "instance API forbidden",
+			Instance: readyInstance(),
+			Faults:   []bmmfake.Fault{{Operation: bmmfake.OpGetInstance, Status: http.StatusForbidden}},
+			Want:     Want{Exists: false, ShutdownErr: true, MetadataErr: true},
+		},
+		Scenario{
+			Name:     "site API server error",
+			Instance: readyInstance(),
+			Faults:   []bmmfake.Fault{bmmfake.ServerError(bmmfake.OpGetAllSite, 0)},
+			Want: Want{
+				Exists: true, MetadataErr: true, ZoneErr: true, ProviderIDZoneErr: true,
+			},
+		},
+	)
+	return scenarios
+}
@@ -0,0 +1,167 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AnnotationInstanceNotFound records on a node the not found observations of its instance
+// during the deletion grace period
+const AnnotationInstanceNotFound = "bmm.nvidia.com/instance-not-found"
+
+// deletionGraceExpiry is the minimum time after which the observations of an instance that is
+// no longer checked, e.g. because its node was deleted, are forgotten
+const deletionGraceExpiry = 10 * time.Minute
+
+// notFoundObservations are the consecutive not found observations of an instance
+type notFoundObservations struct {
+	InstanceID string      `json:"instanceID"`
+	Count      int         `json:"count"`
+	Since      metav1.Time `json:"since"`
+}
+
+// deletionGracePeriod tracks the consecutive not found observations of instances, so that an
+// instance that briefly looks gone, e.g. during a reprovisioning, does not get its node deleted
+type deletionGracePeriod struct {
+	mu           sync.Mutex
+	observations int
+	minDuration  time.Duration
+	persist      bool
+	now          func() time.Time
+	notFound     map[string]notFoundObservations
+	lastObserved map[string]time.Time
+}
+
+// newDeletionGracePeriod creates the deletion grace period of a configuration, or nil when it
+// is disabled
+func newDeletionGracePeriod(cfg DeletionGracePeriodConfig) *deletionGracePeriod {
+	if cfg.Observations == 0 && cfg.MinDuration == 0 {
+		return nil
+	}
+	return &deletionGracePeriod{
+		observations: cfg.Observations,
+		minDuration:  cfg.MinDuration,
+		persist:      cfg.PersistInAnnotation,
+		now:          time.Now,
+		notFound:     make(map[string]notFoundObservations),
+		lastObserved: make(map[string]time.Time),
+	}
+}
+
+// observe records that the instance of a node was not found, and returns the observations and
+// whether the grace period is over. Observations persisted on the node are picked up when none
+// are tracked, e.g. after a restart.
+func (g *deletionGracePeriod) observe(node *v1.Node, instanceID string) (notFoundObservations, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.expire(now)
+	observed, ok := g.notFound[instanceID]
+	if !ok {
+		observed = notFoundObservations{InstanceID: instanceID, Since: metav1.NewTime(now)}
+		if persisted, ok := persistedObservations(node); ok && persisted.InstanceID == instanceID {
+			observed = persisted
+		}
+	}
+	// Once the grace period is over, the count no longer changes and the annotation is not patched again
+	if observed.Count < max(g.observations, 1) {
+		observed.Count++
+	}
+	g.notFound[instanceID] = observed
+	g.lastObserved[instanceID] = now
+
+	over := observed.Count >= g.observations && now.Sub(observed.Since.Time) >= g.minDuration
+	return observed, over
+}
+
+// found forgets the observations of an instance that was found again
+func (g *deletionGracePeriod) found(instanceID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.notFound, instanceID)
+	delete(g.lastObserved, instanceID)
+}
+
+// expire forgets the observations of instances not observed for longer than the grace period,
+// and at least deletionGraceExpiry. It must be called with the lock held.
+func (g *deletionGracePeriod) expire(now time.Time) {
+	expiry := max(g.minDuration, deletionGraceExpiry)
+	for instanceID, last := range g.lastObserved {
+		if now.Sub(last) > expiry {
+			delete(g.notFound, instanceID)
+			delete(g.lastObserved, instanceID)
+		}
+	}
+}
+
+// persistedObservations returns the observations persisted in the annotation of a node
+func persistedObservations(node *v1.Node) (notFoundObservations, bool) {
+	value, ok := node.Annotations[AnnotationInstanceNotFound]
+	if !ok {
+		return notFoundObservations{}, false
+	}
+	var observed notFoundObservations
+	if err := json.Unmarshal([]byte(value), &observed); err != nil || observed.Since.IsZero() {
+		return notFoundObservations{}, false
+	}
+	return observed, true
+}
+
+// notFoundConfirmed applies the deletion grace period to a node whose instance was not found,
+// and reports whether the instance has been not found long enough to be reported as such.
+// Observations are keyed on the instance of the node, from its provider ID or discovered.
+func (c *NvidiaBMMCloud) notFoundConfirmed(ctx context.Context, node *v1.Node, instanceID uuid.UUID) bool {
+	if c.deletionGracePeriod == nil {
+		return true
+	}
+	logger := c.nodeLogger(ctx, node).WithValues("instanceID", instanceID)
+
+	observed, over := c.deletionGracePeriod.observe(node, instanceID.String())
+	if c.deletionGracePeriod.persist {
+		if err := c.annotateNotFound(ctx, node, &observed); err != nil {
+			logger.Error(err, "Failed to persist the instance not found observations")
+		}
+	}
+	if !over {
+		logger.Info("Instance not found, waiting for the deletion grace period",
+			"count", observed.Count, "since", observed.Since)
+	}
+	return over
+}
+
+// instanceFound forgets the not found observations of the instance of a node
+func (c *NvidiaBMMCloud) instanceFound(ctx context.Context, node *v1.Node, instanceID uuid.UUID) {
+	if c.deletionGracePeriod == nil {
+		return
+	}
+	c.deletionGracePeriod.found(instanceID.String())
+	if _, ok := node.Annotations[AnnotationInstanceNotFound]; ok {
+		if err := c.annotateNotFound(ctx, node, nil); err != nil {
+			c.nodeLogger(ctx, node).Error(err, "Failed to remove the instance not found observations")
+		}
+	}
+}
+
+// annotateNotFound sets the not found observations annotation of a node, or removes it when
+// observed is nil. Nodes are left untouched when the annotation is up to date.
+func (c *NvidiaBMMCloud) annotateNotFound(ctx context.Context, node *v1.Node, observed *notFoundObservations) error {
+	var value interface{}
+	if observed != nil {
+		data, err := json.Marshal(observed)
+		if err != nil {
+			return err
+		}
+		if node.Annotations[AnnotationInstanceNotFound] == string(data) {
+			return nil
+		}
+		value = string(data)
+	}
+	return c.patchNodeAnnotations(ctx, node, map[string]interface{}{AnnotationInstanceNotFound: value})
+}
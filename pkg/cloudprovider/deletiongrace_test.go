@@ -0,0 +1,248 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+func TestDeletionGracePeriod_Observe(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	persisted := func(instanceID string, count int, since time.Time) map[string]string {
+		data, _ := json.Marshal(notFoundObservations{InstanceID: instanceID, Count: count, Since: metav1.NewTime(since)})
+		return map[string]string{AnnotationInstanceNotFound: string(data)}
+	}
+
+	tests := []struct {
+		name        string
+		config      DeletionGracePeriodConfig
+		annotations map[string]string
+		// observations are the offsets from start of the not found observations
+		observations []time.Duration
+		wantCount    int
+		wantOver     bool
+	}{
+		{
+			name:         "too few observations",
+			config:       DeletionGracePeriodConfig{Observations: 3, MinDuration: 5 * time.Minute},
+			observations: []time.Duration{0, 10 * time.Minute},
+			wantCount:    2,
+		},
+		{
+			name:         "too short",
+			config:       DeletionGracePeriodConfig{Observations: 3, MinDuration: 5 * time.Minute},
+			observations: []time.Duration{0, time.Minute, 2 * time.Minute},
+			wantCount:    3,
+		},
+		{
+			name:         "over",
+			config:       DeletionGracePeriodConfig{Observations: 3, MinDuration: 5 * time.Minute},
+			observations: []time.Duration{0, time.Minute, 2 * time.Minute, 6 * time.Minute},
+			wantCount:    3,
+			wantOver:     true,
+		},
+		{
+			name:         "observations only",
+			config:       DeletionGracePeriodConfig{Observations: 2},
+			observations: []time.Duration{0, time.Second},
+			wantCount:    2,
+			wantOver:     true,
+		},
+		{
+			name:         "duration only",
+			config:       DeletionGracePeriodConfig{MinDuration: time.Minute},
+			observations: []time.Duration{0, 30 * time.Second, time.Minute},
+			wantCount:    1,
+			wantOver:     true,
+		},
+		{
+			name:         "persisted observations",
+			config:       DeletionGracePeriodConfig{Observations: 3, MinDuration: 5 * time.Minute},
+			annotations:  persisted("instance-1", 2, start.Add(-10*time.Minute)),
+			observations: []time.Duration{0},
+			wantCount:    3,
+			wantOver:     true,
+		},
+		{
+			name:         "persisted observations of another instance",
+			config:       DeletionGracePeriodConfig{Observations: 3, MinDuration: 5 * time.Minute},
+			annotations:  persisted("instance-2", 2, start.Add(-10*time.Minute)),
+			observations: []time.Duration{0},
+			wantCount:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grace := newDeletionGracePeriod(tt.config)
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", Annotations: tt.annotations}}
+
+			var observed notFoundObservations
+			var over bool
+			for _, offset := range tt.observations {
+				grace.now = func() time.Time { return start.Add(offset) }
+				observed, over = grace.observe(node, "instance-1")
+			}
+			if observed.Count != tt.wantCount || over != tt.wantOver {
+				t.Errorf("observe() = %d, %v, want %d, %v", observed.Count, over, tt.wantCount, tt.wantOver)
+			}
+		})
+	}
+}
+
+func TestDeletionGracePeriod_FoundResets(t *testing.T) {
+	grace := newDeletionGracePeriod(DeletionGracePeriodConfig{Observations: 2})
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+
+	grace.observe(node, "instance-1")
+	grace.found("instance-1")
+	if observed, over := grace.observe(node, "instance-1"); observed.Count != 1 || over {
+		t.Errorf("Expected observations to restart after the instance was found, got %d, %v", observed.Count, over)
+	}
+}
+
+func TestDeletionGracePeriod_Expires(t *testing.T) {
+	grace := newDeletionGracePeriod(DeletionGracePeriodConfig{Observations: 3, MinDuration: 20 * time.Minute})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	grace.now = func() time.Time { return now }
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	deleted := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "deleted-node"}}
+
+	grace.observe(node, "instance-1")
+	grace.observe(deleted, "instance-2")
+
+	// The instance of the deleted node is no longer observed and is forgotten after the grace period
+	now = now.Add(15 * time.Minute)
+	grace.observe(node, "instance-1")
+	if _, ok := grace.notFound["instance-2"]; !ok {
+		t.Error("Expected the observations to be kept within the grace period")
+	}
+	now = now.Add(10 * time.Minute)
+	grace.observe(node, "instance-1")
+	if _, ok := grace.notFound["instance-2"]; ok {
+		t.Error("Expected the observations of an instance no longer observed to expire")
+	}
+	if observed := grace.notFound["instance-1"]; observed.Count != 3 {
+		t.Errorf("Expected the observations of an observed instance to be kept, got %d", observed.Count)
+	}
+	if len(grace.lastObserved) != 1 {
+		t.Errorf("Expected a single tracked instance, got %v", grace.lastObserved)
+	}
+}
+
+func TestInstanceExists_DeletionGracePeriod(t *testing.T) {
+	instanceID := uuid.New()
+	pid := providerid.NewProviderID("test-org", "test-tenant", "test-site", instanceID)
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Spec:       v1.NodeSpec{ProviderID: pid.String()},
+	}
+	kubeClient := fake.NewClientset(node.DeepCopy())
+
+	found := false
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient: &mockNvidiaBMMClient{
+			getInstance: func(
+				ctx context.Context, org string, instanceId uuid.UUID,
+				params *restclient.GetInstanceParams,
+				reqEditors ...restclient.RequestEditorFn,
+			) (*restclient.GetInstanceResponse, error) {
+				if found {
+					return &restclient.GetInstanceResponse{
+						HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+						JSON200:      &restclient.Instance{Id: &instanceID},
+					}, nil
+				}
+				return &restclient.GetInstanceResponse{
+					HTTPResponse: &http.Response{StatusCode: http.StatusNotFound},
+				}, nil
+			},
+		},
+		orgName:  "test-org",
+		siteID:   "test-site",
+		tenantID: "test-tenant",
+		deletionGracePeriod: newDeletionGracePeriod(DeletionGracePeriodConfig{
+			Observations:        2,
+			PersistInAnnotation: true,
+		}),
+		kubeClient: kubeClient,
+	}
+	ctx := context.Background()
+	getNode := func() *v1.Node {
+		t.Helper()
+		current, err := kubeClient.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Failed to get node: %v", err)
+		}
+		return current
+	}
+
+	// The first observation is persisted and the instance reported as existing
+	exists, err := cloud.InstanceExists(ctx, node)
+	if err != nil || !exists {
+		t.Fatalf("InstanceExists() = %v, %v during the grace period, want true", exists, err)
+	}
+	observed, ok := persistedObservations(getNode())
+	if !ok || observed.InstanceID != instanceID.String() || observed.Count != 1 {
+		t.Fatalf("Expected 1 persisted observation of %s, got %+v", instanceID, observed)
+	}
+
+	// After a restart, the persisted observation counts towards the grace period
+	cloud.deletionGracePeriod = newDeletionGracePeriod(DeletionGracePeriodConfig{Observations: 2, PersistInAnnotation: true})
+	exists, err = cloud.InstanceExists(ctx, getNode())
+	if err != nil || exists {
+		t.Fatalf("InstanceExists() = %v, %v after the grace period, want false", exists, err)
+	}
+
+	// The annotation is removed once the instance is found again
+	found = true
+	exists, err = cloud.InstanceExists(ctx, getNode())
+	if err != nil || !exists {
+		t.Fatalf("InstanceExists() = %v, %v, want true", exists, err)
+	}
+	if _, ok := getNode().Annotations[AnnotationInstanceNotFound]; ok {
+		t.Errorf("Expected the %s annotation to be removed", AnnotationInstanceNotFound)
+	}
+}
+
+func TestInstanceExists_DeletionGracePeriodDiscoveredNode(t *testing.T) {
+	instanceID := uuid.New()
+	client := listInstancesClient(testInstance(instanceID, "worker-1"))
+	client.getInstance = func(
+		ctx context.Context, org string, instanceId uuid.UUID,
+		params *restclient.GetInstanceParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetInstanceResponse, error) {
+		return &restclient.GetInstanceResponse{
+			HTTPResponse: &http.Response{StatusCode: http.StatusNotFound},
+		}, nil
+	}
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient:     client,
+		orgName:             "test-org",
+		siteID:              testSiteID.String(),
+		tenantID:            "test-tenant",
+		deletionGracePeriod: newDeletionGracePeriod(DeletionGracePeriodConfig{Observations: 2}),
+	}
+	// The node has no provider ID, its instance is discovered by name
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+	ctx := context.Background()
+
+	exists, err := cloud.InstanceExists(ctx, node)
+	if err != nil || !exists {
+		t.Fatalf("InstanceExists() = %v, %v during the grace period, want true", exists, err)
+	}
+	exists, err = cloud.InstanceExists(ctx, node)
+	if err != nil || exists {
+		t.Fatalf("InstanceExists() = %v, %v after the grace period, want false", exists, err)
+	}
+}
@@ -0,0 +1,179 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// deletionGuardRefreshPeriod is how often the deletion guard forgets expired observations, so
+// that it resets once nodes are no longer checked, e.g. after they were deleted by hand
+const deletionGuardRefreshPeriod = time.Minute
+
+// deletionGuard counts the nodes whose instance was reported not found within a window. When
+// more nodes than allowed are not found, it trips and blocks their deletion until the count is
+// back within the limits, either because instances are found again or because the observations
+// of nodes no longer checked expire.
+type deletionGuard struct {
+	mu          sync.Mutex
+	maxNotFound int
+	maxPercent  int
+	window      time.Duration
+	now         func() time.Time
+
+	// nodeCount returns the number of nodes in the cluster, the percentage limit blocks every
+	// deletion while it is unknown
+	nodeCount func() (int, error)
+
+	notFound map[string]time.Time
+	tripped  bool
+
+	// startOnce starts the node counter and the refresh loop once, however many times the
+	// provider is initialized
+	startOnce sync.Once
+}
+
+// newDeletionGuard creates the deletion guard of a configuration, or nil when it sets no limit
+func newDeletionGuard(cfg DeletionGuardConfig) *deletionGuard {
+	if cfg.MaxNotFound == 0 && cfg.MaxNotFoundPercent == 0 {
+		return nil
+	}
+	window := cfg.Window
+	if window == 0 {
+		window = DefaultDeletionGuardWindow
+	}
+	return &deletionGuard{
+		maxNotFound: cfg.MaxNotFound,
+		maxPercent:  cfg.MaxNotFoundPercent,
+		window:      window,
+		now:         time.Now,
+		notFound:    make(map[string]time.Time),
+	}
+}
+
+// notFoundAllowed records that the instance of a node was not found and returns an error when
+// the guard is tripped. A nil guard allows every deletion.
+func (g *deletionGuard) notFoundAllowed(node string) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.notFound[node] = g.now()
+	if reason := g.update(); reason != "" {
+		deletionGuardBlocked.Inc()
+		return fmt.Errorf("node deletion blocked by the deletion guard: %s", reason)
+	}
+	return nil
+}
+
+// found forgets a node whose instance was found. A nil guard does nothing.
+func (g *deletionGuard) found(node string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.notFound[node]; ok {
+		delete(g.notFound, node)
+		g.update()
+	}
+}
+
+// start counts the cluster nodes for the percentage limit and refreshes the guard periodically
+// until stop is closed. Only the first call has an effect.
+func (g *deletionGuard) start(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
+	g.startOnce.Do(func() {
+		if g.maxPercent > 0 {
+			g.mu.Lock()
+			if g.nodeCount == nil {
+				g.nodeCount = newNodeCounter(clientBuilder, stop)
+			}
+			g.mu.Unlock()
+		}
+		go wait.Until(g.refresh, deletionGuardRefreshPeriod, stop)
+	})
+}
+
+// refresh forgets expired observations and resets the guard when they are back within the limits
+func (g *deletionGuard) refresh() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.update()
+}
+
+// update forgets expired observations, trips or resets the guard, and returns why it is
+// tripped, or an empty string. It must be called with the lock held.
+func (g *deletionGuard) update() string {
+	now := g.now()
+	for node, seen := range g.notFound {
+		if now.Sub(seen) > g.window {
+			delete(g.notFound, node)
+		}
+	}
+
+	reason := g.exceeded(len(g.notFound))
+	switch {
+	case reason != "" && !g.tripped:
+		klog.InfoS("Node deletion guard tripped, nodes will not be deleted", "reason", reason)
+		g.tripped = true
+		deletionGuardTripped.Set(1)
+	case reason == "" && g.tripped:
+		klog.InfoS("Node deletion guard reset", "notFound", len(g.notFound))
+		g.tripped = false
+		deletionGuardTripped.Set(0)
+	}
+	return reason
+}
+
+// exceeded returns why a number of nodes not found exceeds the limits, or an empty string
+func (g *deletionGuard) exceeded(notFound int) string {
+	if g.maxNotFound > 0 && notFound > g.maxNotFound {
+		return fmt.Sprintf("%d nodes not found within %s, more than the maximum of %d",
+			notFound, g.window, g.maxNotFound)
+	}
+	if g.maxPercent == 0 || notFound == 0 {
+		return ""
+	}
+	if g.nodeCount == nil {
+		return "the number of nodes is unknown"
+	}
+	nodes, err := g.nodeCount()
+	if err != nil {
+		return fmt.Sprintf("the number of nodes is unknown: %v", err)
+	}
+	if nodes == 0 || notFound*100 > g.maxPercent*nodes {
+		return fmt.Sprintf("%d of %d nodes not found within %s, more than the maximum of %d%%",
+			notFound, nodes, g.window, g.maxPercent)
+	}
+	return ""
+}
+
+// newNodeCounter returns a function counting the nodes of the cluster from a node informer
+// running until stop is closed
+func newNodeCounter(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) func() (int, error) {
+	client, err := clientBuilder.Client(eventClientName)
+	if err != nil {
+		klog.ErrorS(err, "Unable to create client for the deletion guard, node deletions are blocked")
+		return func() (int, error) { return 0, err }
+	}
+
+	factory := informers.NewSharedInformerFactory(client, 0)
+	nodes := factory.Core().V1().Nodes()
+	lister, synced := nodes.Lister(), nodes.Informer().HasSynced
+	factory.Start(stop)
+
+	return func() (int, error) {
+		if !synced() {
+			return 0, fmt.Errorf("node informer not synced")
+		}
+		list, err := lister.List(labels.Everything())
+		return len(list), err
+	}
+}
@@ -0,0 +1,224 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/component-base/metrics/testutil"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+// newTestDeletionGuard creates a deletion guard whose clock is advanced by the returned function
+func newTestDeletionGuard(cfg DeletionGuardConfig) (*deletionGuard, func(time.Duration)) {
+	guard := newDeletionGuard(cfg)
+	now := time.Now()
+	guard.now = func() time.Time { return now }
+	return guard, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestDeletionGuard_MaxNotFound(t *testing.T) {
+	registerMetrics()
+	guard, advance := newTestDeletionGuard(DeletionGuardConfig{MaxNotFound: 2, Window: 10 * time.Minute})
+
+	for _, node := range []string{"node-a", "node-b"} {
+		if err := guard.notFoundAllowed(node); err != nil {
+			t.Fatalf("Expected %s to be allowed, got %v", node, err)
+		}
+	}
+	if err := guard.notFoundAllowed("node-c"); err == nil {
+		t.Fatal("Expected node-c to be blocked")
+	}
+	// Once tripped, nodes allowed before are blocked too
+	if err := guard.notFoundAllowed("node-a"); err == nil {
+		t.Error("Expected node-a to be blocked while the guard is tripped")
+	}
+	expectGauge(t, 1)
+
+	// The guard resets when an instance is found again
+	guard.found("node-c")
+	expectGauge(t, 0)
+	if err := guard.notFoundAllowed("node-a"); err != nil {
+		t.Errorf("Expected node-a to be allowed after the reset, got %v", err)
+	}
+
+	// Or when the observations of nodes no longer checked expire
+	if err := guard.notFoundAllowed("node-d"); err == nil {
+		t.Fatal("Expected node-d to be blocked")
+	}
+	expectGauge(t, 1)
+	advance(11 * time.Minute)
+	guard.refresh()
+	expectGauge(t, 0)
+	if len(guard.notFound) != 0 {
+		t.Errorf("Expected expired observations to be forgotten, got %v", guard.notFound)
+	}
+}
+
+func TestDeletionGuard_MaxNotFoundPercent(t *testing.T) {
+	tests := []struct {
+		name      string
+		nodeCount func() (int, error)
+		notFound  int
+		wantErr   bool
+	}{
+		{
+			name:      "within the limit",
+			nodeCount: func() (int, error) { return 10, nil },
+			notFound:  2,
+		},
+		{
+			name:      "above the limit",
+			nodeCount: func() (int, error) { return 10, nil },
+			notFound:  3,
+			wantErr:   true,
+		},
+		{
+			name:      "unknown node count",
+			nodeCount: func() (int, error) { return 0, errors.New("node informer not synced") },
+			notFound:  1,
+			wantErr:   true,
+		},
+		{
+			name:     "no node counter",
+			notFound: 1,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, _ := newTestDeletionGuard(DeletionGuardConfig{MaxNotFoundPercent: 20})
+			guard.nodeCount = tt.nodeCount
+
+			var err error
+			for i := 0; i < tt.notFound; i++ {
+				err = guard.notFoundAllowed(fmt.Sprintf("node-%d", i))
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("notFoundAllowed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeletionGuard_Disabled(t *testing.T) {
+	guard := newDeletionGuard(DeletionGuardConfig{Window: time.Minute})
+	if guard != nil {
+		t.Fatalf("Expected no guard without limits, got %+v", guard)
+	}
+	for i := 0; i < 100; i++ {
+		if err := guard.notFoundAllowed(fmt.Sprintf("node-%d", i)); err != nil {
+			t.Fatalf("Expected a nil guard to allow deletions, got %v", err)
+		}
+	}
+	guard.found("node-0")
+}
+
+// countingClientBuilder counts the clients built for the provider
+type countingClientBuilder struct {
+	cloudprovider.ControllerClientBuilder
+	clients int
+}
+
+func (b *countingClientBuilder) Client(name string) (kubernetes.Interface, error) {
+	b.clients++
+	return fake.NewClientset(), nil
+}
+
+func TestDeletionGuard_StartsOnce(t *testing.T) {
+	guard := newDeletionGuard(DeletionGuardConfig{MaxNotFoundPercent: 10})
+	builder := &countingClientBuilder{}
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// The provider may be initialized multiple times
+	guard.start(builder, stop)
+	guard.start(builder, stop)
+	if builder.clients != 1 {
+		t.Errorf("Expected the node counter to be started once, got %d clients", builder.clients)
+	}
+	if guard.nodeCount == nil {
+		t.Error("Expected the node counter to be set")
+	}
+}
+
+func TestInstanceExists_DeletionGuard(t *testing.T) {
+	registerMetrics()
+	recorder := record.NewFakeRecorder(10)
+	guard, _ := newTestDeletionGuard(DeletionGuardConfig{MaxNotFound: 1})
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient: &mockNvidiaBMMClient{
+			getInstance: func(
+				ctx context.Context, org string, instanceId uuid.UUID,
+				params *restclient.GetInstanceParams,
+				reqEditors ...restclient.RequestEditorFn,
+			) (*restclient.GetInstanceResponse, error) {
+				return &restclient.GetInstanceResponse{
+					HTTPResponse: &http.Response{StatusCode: http.StatusNotFound},
+				}, nil
+			},
+		},
+		orgName:       "test-org",
+		siteID:        "test-site",
+		tenantID:      "test-tenant",
+		eventRecorder: recorder,
+		deletionGuard: guard,
+	}
+	node := func(name string) *v1.Node {
+		pid := providerid.NewProviderID("test-org", "test-tenant", "test-site", uuid.New())
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       v1.NodeSpec{ProviderID: pid.String()},
+		}
+	}
+
+	before, err := testutil.GetCounterMetricValue(deletionGuardBlocked)
+	if err != nil {
+		t.Fatalf("Failed to read counter: %v", err)
+	}
+	exists, err := cloud.InstanceExists(context.Background(), node("node-a"))
+	if err != nil || exists {
+		t.Fatalf("InstanceExists() = %v, %v, want false", exists, err)
+	}
+	exists, err = cloud.InstanceExists(context.Background(), node("node-b"))
+	if err == nil || exists {
+		t.Fatalf("InstanceExists() = %v, %v, want an error from the deletion guard", exists, err)
+	}
+	expectCounter(t, deletionGuardBlocked, before+1)
+
+	close(recorder.Events)
+	var blocked []string
+	for event := range recorder.Events {
+		if strings.HasPrefix(event, "Warning "+EventReasonNodeDeletionBlocked) {
+			blocked = append(blocked, event)
+		}
+	}
+	if len(blocked) != 1 {
+		t.Errorf("Expected 1 %s event, got %v", EventReasonNodeDeletionBlocked, blocked)
+	}
+}
+
+// expectGauge checks the value of the deletion guard tripped gauge
+func expectGauge(t *testing.T, want float64) {
+	t.Helper()
+	got, err := testutil.GetGaugeMetricValue(deletionGuardTripped)
+	if err != nil {
+		t.Fatalf("Failed to read gauge: %v", err)
+	}
+	if got != want {
+		t.Errorf("Expected deletion guard tripped %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,257 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"k8s.io/klog/v2"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+const (
+	// instanceListPageSize is the page size used when listing instances
+	instanceListPageSize = 100
+
+	// maxInstanceListPages bounds the number of pages read when listing instances
+	maxInstanceListPages = 100
+
+	// instanceListCacheTTL is how long a listing of the site instances is reused for discovery
+	instanceListCacheTTL = 30 * time.Second
+
+	// cacheInstanceList labels the instance list cache in the cache lookup metrics
+	cacheInstanceList = "instance-list"
+)
+
+// instanceListCache keeps the last listing of the site instances, so nodes registering together
+// without a provider ID share a single listing
+type instanceListCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	now       func() time.Time
+	instances []restclient.Instance
+	expires   time.Time
+}
+
+// newInstanceListCache creates an instance list cache whose listing expires after ttl
+func newInstanceListCache(ttl time.Duration) *instanceListCache {
+	return &instanceListCache{ttl: ttl, now: time.Now}
+}
+
+// get returns the cached listing. A nil cache never hits.
+func (l *instanceListCache) get() ([]restclient.Instance, bool) {
+	if l == nil {
+		return nil, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.instances == nil || l.now().After(l.expires) {
+		return nil, false
+	}
+	return l.instances, true
+}
+
+// set caches a listing. A nil cache stores nothing.
+func (l *instanceListCache) set(instances []restclient.Instance) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if instances == nil {
+		instances = []restclient.Instance{}
+	}
+	l.instances = instances
+	l.expires = l.now().Add(l.ttl)
+}
+
+// discoverInstance finds the NVIDIA BMM instance of a node that registered without a provider ID.
+// The node name is matched against instance names first, then the node IPs against instance
+// interface IPs. A node matching several instances is an error rather than a guess. A recent
+// listing of the site instances is reused, and listed again when the node matches none of it.
+func (c *NvidiaBMMCloud) discoverInstance(ctx context.Context, node *v1.Node) (*restclient.Instance, error) {
+	if instances, ok := c.instanceList.get(); ok {
+		cacheLookups.WithLabelValues(cacheInstanceList, "hit").Inc()
+		if instance, err := matchInstance(instances, node); instance != nil || err != nil {
+			return instance, err
+		}
+		// The instance may have been created since the listing
+		klog.FromContext(ctx).V(4).Info("Node matches no cached NVIDIA BMM instance, listing instances again", "node", node.Name)
+	} else {
+		cacheLookups.WithLabelValues(cacheInstanceList, "miss").Inc()
+	}
+
+	instances, err := c.listInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.instanceList.set(instances)
+	instance, err := matchInstance(instances, node)
+	if instance == nil && err == nil {
+		return nil, fmt.Errorf("no NVIDIA BMM instance matches node %s by name or IP", node.Name)
+	}
+	return instance, err
+}
+
+// matchInstance returns the instance of a node by name, then by IP, nil if none matches, or an
+// error if several do
+func matchInstance(instances []restclient.Instance, node *v1.Node) (*restclient.Instance, error) {
+	byName := filterInstances(instances, func(instance *restclient.Instance) bool {
+		return instance.Name != nil && hostnameMatches(*instance.Name, node.Name)
+	})
+	if instance, err := singleInstance(byName, node, "name"); instance != nil || err != nil {
+		return instance, err
+	}
+
+	ips := nodeIPs(node)
+	if len(ips) > 0 {
+		byIP := filterInstances(instances, func(instance *restclient.Instance) bool {
+			return hasInterfaceIP(instance, ips)
+		})
+		if instance, err := singleInstance(byIP, node, "IP"); instance != nil || err != nil {
+			return instance, err
+		}
+	}
+	return nil, nil
+}
+
+// listInstances lists the instances of the configured site and tenant, one page at a time
+func (c *NvidiaBMMCloud) listInstances(ctx context.Context) ([]restclient.Instance, error) {
+	siteID, err := c.resolveSite(ctx, c.siteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve site %q: %w", c.siteID, err)
+	}
+	params := &restclient.GetAllInstanceParams{SiteId: &siteID}
+	if tenantID, err := uuid.Parse(c.tenantID); err == nil {
+		params.TenantId = &tenantID
+	}
+	pageSize := instanceListPageSize
+	params.PageSize = &pageSize
+
+	var instances []restclient.Instance
+	for page := 1; page <= maxInstanceListPages; page++ {
+		pageNumber := page
+		params.PageNumber = &pageNumber
+
+		resp, err := c.getInstancePage(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, resp...)
+		if len(resp) < instanceListPageSize {
+			return instances, nil
+		}
+	}
+
+	klog.FromContext(ctx).Info("Stopped listing NVIDIA BMM instances at the page limit",
+		"pages", maxInstanceListPages, "instances", len(instances))
+	return instances, nil
+}
+
+// getInstancePage fetches a single page of instances
+func (c *NvidiaBMMCloud) getInstancePage(
+	ctx context.Context, params *restclient.GetAllInstanceParams,
+) ([]restclient.Instance, error) {
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetAllInstanceWithResponse(apiCtx, c.orgName, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+	if statusCodeOf(resp) != http.StatusOK || resp.JSON200 == nil {
+		return nil, fmt.Errorf("failed to list instances, status %d", statusCodeOf(resp))
+	}
+	return *resp.JSON200, nil
+}
+
+// filterInstances returns pointers to the instances accepted by match
+func filterInstances(instances []restclient.Instance, match func(*restclient.Instance) bool) []*restclient.Instance {
+	var matched []*restclient.Instance
+	for i := range instances {
+		if match(&instances[i]) {
+			matched = append(matched, &instances[i])
+		}
+	}
+	return matched
+}
+
+// singleInstance returns the only matched instance, nil if none matched, or an error if several did
+func singleInstance(matched []*restclient.Instance, node *v1.Node, by string) (*restclient.Instance, error) {
+	switch len(matched) {
+	case 0:
+		return nil, nil
+	case 1:
+		if matched[0].Id == nil {
+			return nil, fmt.Errorf("NVIDIA BMM instance matching node %s by %s has no ID", node.Name, by)
+		}
+		return matched[0], nil
+	default:
+		return nil, fmt.Errorf("node %s matches %d NVIDIA BMM instances by %s", node.Name, len(matched), by)
+	}
+}
+
+// hostnameMatches reports whether an instance name and a node name refer to the same host,
+// either exactly or as the short name and fully qualified name of the host
+func hostnameMatches(instanceName, nodeName string) bool {
+	if strings.EqualFold(instanceName, nodeName) {
+		return true
+	}
+	isShortNameOf := func(short, fqdn string) bool {
+		return len(fqdn) > len(short) && fqdn[len(short)] == '.' && strings.EqualFold(fqdn[:len(short)], short)
+	}
+	return isShortNameOf(instanceName, nodeName) || isShortNameOf(nodeName, instanceName)
+}
+
+// nodeIPs returns the InternalIPs of a node and the IPs passed to the kubelet with --node-ip
+func nodeIPs(node *v1.Node) []net.IP {
+	var ips []net.IP
+	for _, addr := range node.Status.Addresses {
+		if addr.Type != v1.NodeInternalIP {
+			continue
+		}
+		if ip := net.ParseIP(addr.Address); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	if provided, ok := node.Annotations[cloudproviderapi.AnnotationAlphaProvidedIPAddr]; ok {
+		for _, addr := range strings.Split(provided, ",") {
+			if ip := net.ParseIP(strings.TrimSpace(addr)); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips
+}
+
+// hasInterfaceIP reports whether one of the instance interfaces has one of the given IPs
+func hasInterfaceIP(instance *restclient.Instance, ips []net.IP) bool {
+	if instance.Interfaces == nil {
+		return false
+	}
+	for _, iface := range *instance.Interfaces {
+		if iface.IpAddresses == nil {
+			continue
+		}
+		for _, addr := range *iface.IpAddresses {
+			ifaceIP := net.ParseIP(addr)
+			if ifaceIP == nil {
+				// Interface addresses may be reported in CIDR notation
+				ifaceIP, _, _ = net.ParseCIDR(addr)
+			}
+			for _, ip := range ips {
+				if ip.Equal(ifaceIP) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
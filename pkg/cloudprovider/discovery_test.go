@@ -0,0 +1,289 @@
+package cloudprovider
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+func listInstancesClient(instances ...restclient.Instance) *mockNvidiaBMMClient {
+	return &mockNvidiaBMMClient{
+		getAllInstance: func(
+			ctx context.Context, org string,
+			params *restclient.GetAllInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetAllInstanceResponse, error) {
+			return &restclient.GetAllInstanceResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &instances,
+			}, nil
+		},
+	}
+}
+
+func testInstance(id uuid.UUID, name string, ips ...string) restclient.Instance {
+	return restclient.Instance{
+		Id:         &id,
+		Name:       &name,
+		Interfaces: &[]restclient.Interface{{IpAddresses: &ips}},
+	}
+}
+
+func TestDiscoverInstance(t *testing.T) {
+	id1, id2 := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name    string
+		node    *v1.Node
+		client  *mockNvidiaBMMClient
+		want    uuid.UUID
+		wantErr string
+	}{
+		{
+			name:   "match by name",
+			node:   &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}},
+			client: listInstancesClient(testInstance(id1, "worker-1"), testInstance(id2, "worker-2")),
+			want:   id1,
+		},
+		{
+			name:   "match FQDN node name to short instance name",
+			node:   &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-2.example.com"}},
+			client: listInstancesClient(testInstance(id1, "worker-1"), testInstance(id2, "worker-2")),
+			want:   id2,
+		},
+		{
+			name: "match by InternalIP",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+				Status: v1.NodeStatus{
+					Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.2"}},
+				},
+			},
+			client: listInstancesClient(testInstance(id1, "worker-1", "10.0.0.1"), testInstance(id2, "worker-2", "10.0.0.2")),
+			want:   id2,
+		},
+		{
+			name: "match by provided node IP annotation",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "node-a",
+					Annotations: map[string]string{cloudproviderapi.AnnotationAlphaProvidedIPAddr: "10.0.0.1"},
+				},
+			},
+			client: listInstancesClient(testInstance(id1, "worker-1", "10.0.0.1/24"), testInstance(id2, "worker-2")),
+			want:   id1,
+		},
+		{
+			name:    "ambiguous name",
+			node:    &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}},
+			client:  listInstancesClient(testInstance(id1, "worker-1"), testInstance(id2, "worker-1")),
+			wantErr: "matches 2 NVIDIA BMM instances by name",
+		},
+		{
+			name:    "no match",
+			node:    &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-3"}},
+			client:  listInstancesClient(testInstance(id1, "worker-1", "10.0.0.1")),
+			wantErr: "no NVIDIA BMM instance matches node worker-3",
+		},
+		{
+			name: "list failure",
+			node: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}},
+			client: &mockNvidiaBMMClient{
+				getAllInstance: func(
+					ctx context.Context, org string,
+					params *restclient.GetAllInstanceParams,
+					reqEditors ...restclient.RequestEditorFn,
+				) (*restclient.GetAllInstanceResponse, error) {
+					return &restclient.GetAllInstanceResponse{
+						HTTPResponse: &http.Response{StatusCode: http.StatusInternalServerError},
+					}, nil
+				},
+			},
+			wantErr: "failed to list instances, status 500",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloud := &NvidiaBMMCloud{nvidiaBmmClient: tt.client, orgName: "test-org", siteID: "test-site"}
+
+			got, err := cloud.discoverInstance(context.Background(), tt.node)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("discoverInstance() failed: %v", err)
+			}
+			if *got.Id != tt.want {
+				t.Errorf("Expected instance %s, got %s", tt.want, *got.Id)
+			}
+		})
+	}
+}
+
+func TestListInstances_Paginates(t *testing.T) {
+	siteID, tenantID := uuid.New(), uuid.New()
+	var pages []int
+	client := &mockNvidiaBMMClient{
+		getAllInstance: func(
+			ctx context.Context, org string,
+			params *restclient.GetAllInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetAllInstanceResponse, error) {
+			if params.SiteId == nil || *params.SiteId != siteID || params.TenantId == nil || *params.TenantId != tenantID {
+				t.Errorf("Expected site and tenant filters, got %+v", params)
+			}
+			pages = append(pages, *params.PageNumber)
+			count := instanceListPageSize
+			if *params.PageNumber == 2 {
+				count = 1
+			}
+			instances := make([]restclient.Instance, count)
+			return &restclient.GetAllInstanceResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &instances,
+			}, nil
+		},
+	}
+
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient: client,
+		orgName:         "test-org",
+		siteID:          siteID.String(),
+		tenantID:        tenantID.String(),
+	}
+	instances, err := cloud.listInstances(context.Background())
+	if err != nil {
+		t.Fatalf("listInstances() failed: %v", err)
+	}
+	if len(instances) != instanceListPageSize+1 {
+		t.Errorf("Expected %d instances, got %d", instanceListPageSize+1, len(instances))
+	}
+	if len(pages) != 2 || pages[0] != 1 || pages[1] != 2 {
+		t.Errorf("Expected pages [1 2], got %v", pages)
+	}
+}
+
+func TestDiscoverInstance_CachesInstanceList(t *testing.T) {
+	cacheLookups.Reset()
+	now := time.Now()
+	var calls int
+	instances := []restclient.Instance{testInstance(uuid.New(), "worker-1"), testInstance(uuid.New(), "worker-2")}
+	client := &mockNvidiaBMMClient{
+		getAllInstance: func(
+			ctx context.Context, org string,
+			params *restclient.GetAllInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetAllInstanceResponse, error) {
+			calls++
+			listed := append([]restclient.Instance(nil), instances...)
+			return &restclient.GetAllInstanceResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &listed,
+			}, nil
+		},
+	}
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient: client,
+		orgName:         "test-org",
+		siteID:          testSiteID.String(),
+		instanceList:    newInstanceListCache(time.Minute),
+	}
+	cloud.instanceList.now = func() time.Time { return now }
+	discover := func(name string) {
+		t.Helper()
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if _, err := cloud.discoverInstance(context.Background(), node); err != nil {
+			t.Fatalf("discoverInstance(%s) failed: %v", name, err)
+		}
+	}
+
+	// Nodes registering together share a listing
+	discover("worker-1")
+	discover("worker-2")
+	discover("worker-1")
+	if calls != 1 {
+		t.Errorf("Expected a single instance list call, got %d", calls)
+	}
+	expectCounter(t, cacheLookups.WithLabelValues(cacheInstanceList, "hit"), 2)
+	expectCounter(t, cacheLookups.WithLabelValues(cacheInstanceList, "miss"), 1)
+
+	// Instances created since the listing are found by listing again
+	instances = append(instances, testInstance(uuid.New(), "worker-3"))
+	discover("worker-3")
+	if calls != 2 {
+		t.Errorf("Expected instances to be listed again for an unknown node, got %d calls", calls)
+	}
+
+	// Expired listings are not reused
+	now = now.Add(2 * time.Minute)
+	discover("worker-1")
+	if calls != 3 {
+		t.Errorf("Expected instances to be listed again once expired, got %d calls", calls)
+	}
+}
+
+func TestInstanceMetadata_DiscoversProviderID(t *testing.T) {
+	instanceID := uuid.New()
+	client := listInstancesClient(testInstance(instanceID, "worker-1", "10.0.0.1"))
+	client.getInstance = func(
+		ctx context.Context, org string, instanceId uuid.UUID,
+		params *restclient.GetInstanceParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetInstanceResponse, error) {
+		instance := testInstance(instanceId, "worker-1", "10.0.0.1")
+		return &restclient.GetInstanceResponse{
+			HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+			JSON200:      &instance,
+		}, nil
+	}
+
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient: client,
+		orgName:         "test-org",
+		siteID:          "test-site",
+		tenantID:        "test-tenant",
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+
+	metadata, err := cloud.InstanceMetadata(context.Background(), node)
+	if err != nil {
+		t.Fatalf("InstanceMetadata() failed: %v", err)
+	}
+	want := "nvidia-bmm://test-org/test-tenant/test-site/" + instanceID.String()
+	if metadata.ProviderID != want {
+		t.Errorf("Expected provider ID %s, got %s", want, metadata.ProviderID)
+	}
+}
+
+func TestHostnameMatches(t *testing.T) {
+	tests := []struct {
+		instanceName, nodeName string
+		want                   bool
+	}{
+		{"worker-1", "worker-1", true},
+		{"Worker-1", "worker-1", true},
+		{"worker-1", "worker-1.example.com", true},
+		{"worker-1.example.com", "worker-1", true},
+		{"worker-1", "worker-10", false},
+		{"worker-1.a.com", "worker-1.b.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := hostnameMatches(tt.instanceName, tt.nodeName); got != tt.want {
+			t.Errorf("hostnameMatches(%q, %q) = %v, want %v", tt.instanceName, tt.nodeName, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+// Severity is the severity of a doctor finding
+type Severity string
+
+const (
+	SeverityOK      Severity = "ok"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// Doctor checks, in the order they run
+const (
+	CheckConfig      = "config"
+	CheckAPI         = "api"
+	CheckSite        = "site"
+	CheckTenant      = "tenant"
+	CheckInitialized = "initialized"
+	CheckProviderID  = "providerID"
+	CheckInstance    = "instance"
+	CheckStatus      = "status"
+	CheckIdentity    = "identity"
+	CheckAddresses   = "addresses"
+	CheckZone        = "zone"
+)
+
+// Finding is the result of a doctor check
+type Finding struct {
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+
+	// Action tells how to fix a warning or an error
+	Action string `json:"action,omitempty"`
+}
+
+// NodeReport is the diagnosis of a node and of its NVIDIA BMM instance
+type NodeReport struct {
+	Node       string    `json:"node"`
+	ProviderID string    `json:"providerID,omitempty"`
+	InstanceID string    `json:"instanceID,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Addresses  []string  `json:"addresses,omitempty"`
+	Zone       string    `json:"zone,omitempty"`
+	Findings   []Finding `json:"findings"`
+}
+
+// DoctorReport is the diagnosis of the cloud config, the NVIDIA BMM API and the cluster nodes
+type DoctorReport struct {
+	Findings []Finding    `json:"findings"`
+	Nodes    []NodeReport `json:"nodes,omitempty"`
+}
+
+// Errors returns the number of findings with the error severity
+func (r *DoctorReport) Errors() int {
+	count := 0
+	for _, finding := range r.Findings {
+		if finding.Severity == SeverityError {
+			count++
+		}
+	}
+	for _, node := range r.Nodes {
+		count += node.Errors()
+	}
+	return count
+}
+
+// Errors returns the number of node findings with the error severity
+func (r *NodeReport) Errors() int {
+	count := 0
+	for _, finding := range r.Findings {
+		if finding.Severity == SeverityError {
+			count++
+		}
+	}
+	return count
+}
+
+// Severity returns the highest severity of the node findings
+func (r *NodeReport) Severity() Severity {
+	severity := SeverityOK
+	for _, finding := range r.Findings {
+		switch finding.Severity {
+		case SeverityError:
+			return SeverityError
+		case SeverityWarning:
+			severity = SeverityWarning
+		}
+	}
+	return severity
+}
+
+// add records a finding
+func (r *DoctorReport) add(check string, severity Severity, action, messageFmt string, args ...interface{}) {
+	r.Findings = append(r.Findings, Finding{
+		Check: check, Severity: severity, Message: fmt.Sprintf(messageFmt, args...), Action: action,
+	})
+}
+
+// add records a node finding
+func (r *NodeReport) add(check string, severity Severity, action, messageFmt string, args ...interface{}) {
+	r.Findings = append(r.Findings, Finding{
+		Check: check, Severity: severity, Message: fmt.Sprintf(messageFmt, args...), Action: action,
+	})
+}
+
+// Diagnose loads a cloud config the way the cloud provider does, checks that the NVIDIA BMM
+// API is reachable and accepts the token, that the site and tenant exist, and checks the
+// provider ID, instance, status, addresses and zone of each node. Problems are reported as
+// findings rather than errors, so that a single run reports all of them.
+func Diagnose(ctx context.Context, config io.Reader, nodes []v1.Node) *DoctorReport {
+	report := &DoctorReport{}
+
+	cfg, metadata, err := parseConfig(config)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		report.add(CheckConfig, SeverityError,
+			"Fix the cloud config file or the NVIDIA_BMM_* environment variables",
+			"Invalid cloud config: %v", err)
+		return report
+	}
+	report.add(CheckConfig, SeverityOK, "", "Endpoint %s, org %s, site %s, tenant %s (%s)",
+		cfg.API.Endpoint, cfg.API.OrgName, cfg.Cluster.SiteID, cfg.Cluster.TenantID, describeSources(metadata))
+
+	cloud, err := newCloudFromConfig(cfg)
+	if err != nil {
+		report.add(CheckConfig, SeverityError, "Fix the api section of the cloud config",
+			"Failed to create the NVIDIA BMM client: %v", err)
+		return report
+	}
+
+	// Without the API, nothing else can be checked
+	if !cloud.diagnoseAPI(ctx, report, cfg.API.Endpoint) {
+		return report
+	}
+	siteID, siteOK := cloud.diagnoseSite(ctx, report)
+	cloud.diagnoseTenant(ctx, report)
+
+	sorted := slices.Clone(nodes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for i := range sorted {
+		report.Nodes = append(report.Nodes, cloud.diagnoseNode(ctx, &sorted[i], siteID, siteOK))
+	}
+	return report
+}
+
+// describeSources summarizes where the configuration values come from
+func describeSources(metadata *configMetadata) string {
+	env := []string{}
+	for field, source := range metadata.Sources {
+		if source == ConfigSourceEnv {
+			env = append(env, field)
+		}
+	}
+	if len(env) == 0 {
+		return "from the config file"
+	}
+	sort.Strings(env)
+	return "environment overrides " + strings.Join(env, ", ")
+}
+
+// diagnoseAPI checks that the API is reachable and accepts the token for the org
+func (c *NvidiaBMMCloud) diagnoseAPI(ctx context.Context, report *DoctorReport, endpoint string) bool {
+	pageSize := 1
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetAllSiteWithResponse(apiCtx, c.orgName, &restclient.GetAllSiteParams{PageSize: &pageSize})
+	switch status := statusCodeOf(resp); {
+	case err != nil:
+		report.add(CheckAPI, SeverityError,
+			"Check api.endpoint, DNS, proxies and network policies between the cloud controller manager and the endpoint",
+			"NVIDIA BMM API at %s is unreachable: %v", endpoint, err)
+		return false
+	case status == http.StatusUnauthorized:
+		report.add(CheckAPI, SeverityError, "Check api.token or NVIDIA_BMM_TOKEN, the token may have expired",
+			"NVIDIA BMM API rejected the token")
+		return false
+	case status == http.StatusForbidden:
+		report.add(CheckAPI, SeverityError, "Check api.orgName and the permissions of the token",
+			"NVIDIA BMM API denied access to org %s", c.orgName)
+		return false
+	case status != http.StatusOK:
+		report.add(CheckAPI, SeverityError, "Check the NVIDIA BMM API status and the cloud controller manager logs",
+			"NVIDIA BMM API returned status %d listing sites", status)
+		return false
+	}
+	report.add(CheckAPI, SeverityOK, "", "NVIDIA BMM API at %s accepted the token for org %s", endpoint, c.orgName)
+	return true
+}
+
+// diagnoseSite checks that the configured site exists and returns its UUID
+func (c *NvidiaBMMCloud) diagnoseSite(ctx context.Context, report *DoctorReport) (uuid.UUID, bool) {
+	siteID, err := c.resolveSite(ctx, c.siteID)
+	if err != nil {
+		report.add(CheckSite, SeverityError, "Set cluster.siteId to the name or UUID of an NVIDIA BMM site of the org",
+			"Site %q not found: %v", c.siteID, err)
+		return uuid.UUID{}, false
+	}
+
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetSiteWithResponse(apiCtx, c.orgName, siteID, nil)
+	switch status := statusCodeOf(resp); {
+	case err != nil:
+		report.add(CheckSite, SeverityError, "Check the NVIDIA BMM API status", "Failed to get site %s: %v", siteID, err)
+		return uuid.UUID{}, false
+	case status == http.StatusNotFound:
+		report.add(CheckSite, SeverityError, "Set cluster.siteId to the name or UUID of an NVIDIA BMM site of the org",
+			"Site %s does not exist in org %s", siteID, c.orgName)
+		return uuid.UUID{}, false
+	case status != http.StatusOK:
+		report.add(CheckSite, SeverityError, "Check the NVIDIA BMM API status",
+			"Failed to get site %s, status %d", siteID, status)
+		return uuid.UUID{}, false
+	}
+	report.add(CheckSite, SeverityOK, "", "Site %s is zone %s in region %s",
+		siteID, c.getZoneFromSiteID(siteID.String()), c.getRegionFromSiteID(siteID.String()))
+	return siteID, true
+}
+
+// diagnoseTenant checks that the configured tenant is the tenant of the token
+func (c *NvidiaBMMCloud) diagnoseTenant(ctx context.Context, report *DoctorReport) {
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetCurrentTenantWithResponse(apiCtx, c.orgName)
+	switch status := statusCodeOf(resp); {
+	case err != nil:
+		report.add(CheckTenant, SeverityError, "Check the NVIDIA BMM API status", "Failed to get the tenant: %v", err)
+		return
+	case status == http.StatusNotFound:
+		report.add(CheckTenant, SeverityError, "Use a token of a tenant of the org",
+			"The token has no tenant in org %s", c.orgName)
+		return
+	case status != http.StatusOK || resp.JSON200 == nil || resp.JSON200.Id == nil:
+		report.add(CheckTenant, SeverityError, "Check the NVIDIA BMM API status",
+			"Failed to get the tenant, status %d", status)
+		return
+	}
+
+	tenantID := *resp.JSON200.Id
+	configured, err := uuid.Parse(c.tenantID)
+	switch {
+	case err != nil:
+		report.add(CheckTenant, SeverityWarning, fmt.Sprintf("Set cluster.tenantId to %s", tenantID),
+			"Tenant %q is not a UUID, the token belongs to tenant %s", c.tenantID, tenantID)
+	case configured != tenantID:
+		report.add(CheckTenant, SeverityError,
+			fmt.Sprintf("Set cluster.tenantId to %s, or use a token of tenant %s", tenantID, configured),
+			"The token belongs to tenant %s, not to the configured tenant %s", tenantID, configured)
+	default:
+		report.add(CheckTenant, SeverityOK, "", "The token belongs to tenant %s", tenantID)
+	}
+}
+
+// diagnoseNode checks a node and its instance the way the cloud node controllers see them
+func (c *NvidiaBMMCloud) diagnoseNode(ctx context.Context, node *v1.Node, siteID uuid.UUID, siteOK bool) NodeReport {
+	report := NodeReport{Node: node.Name, ProviderID: node.Spec.ProviderID}
+
+	if hasTaint(node, cloudproviderapi.TaintExternalCloudProvider) {
+		report.add(CheckInitialized, SeverityWarning, "Fix the other findings of the node, then check the cloud controller manager logs",
+			"Node still has the %s taint", cloudproviderapi.TaintExternalCloudProvider)
+	}
+
+	orgName, instanceID, ok := c.diagnoseProviderID(ctx, node, &report)
+	if !ok {
+		return report
+	}
+	report.InstanceID = instanceID.String()
+
+	instance, err := c.getInstance(ctx, orgName, instanceID)
+	switch {
+	case errors.Is(err, ErrInstanceNotFound):
+		report.add(CheckInstance, SeverityError,
+			"Check that the instance was not released, the node lifecycle controller deletes nodes without an instance",
+			"Instance %s not found in org %s", instanceID, orgName)
+		return report
+	case err != nil:
+		report.add(CheckInstance, SeverityError, "Check the NVIDIA BMM API status", "%v", err)
+		return report
+	}
+	report.add(CheckInstance, SeverityOK, "", "Instance %s found in org %s", instanceID, orgName)
+
+	switch {
+	case instance.Status == nil:
+		report.add(CheckStatus, SeverityWarning, "Check the instance in NVIDIA BMM", "Instance has no status")
+	case isShutdownStatus(*instance.Status):
+		report.Status = string(*instance.Status)
+		report.add(CheckStatus, SeverityWarning, "Check the instance in NVIDIA BMM, the node is tainted as shut down",
+			"Instance status is %s", report.Status)
+	default:
+		report.Status = string(*instance.Status)
+		report.add(CheckStatus, SeverityOK, "", "Instance status is %s", report.Status)
+	}
+
+	if mismatch := identityMismatch(node, instance); mismatch != "" {
+		report.add(CheckIdentity, SeverityError,
+			"The machine was reprovisioned and the node is reported as shut down, drain and delete the node",
+			"Instance was reprovisioned, %s", mismatch)
+	}
+
+	diagnoseAddresses(node, instanceAddresses(instance), &report)
+	c.diagnoseZone(ctx, node, instance, siteID, siteOK, &report)
+	return report
+}
+
+// diagnoseProviderID checks the provider ID of a node against the configuration, or finds the
+// instance of a node without one, and returns the org and instance to look up
+func (c *NvidiaBMMCloud) diagnoseProviderID(ctx context.Context, node *v1.Node, report *NodeReport) (string, uuid.UUID, bool) {
+	if node.Spec.ProviderID == "" {
+		instance, err := c.discoverInstance(ctx, node)
+		if err != nil {
+			report.add(CheckProviderID, SeverityError,
+				"Start the kubelet with --provider-id, for instance with the drop-in written by the providerid subcommand",
+				"Node has no provider ID and no instance matches it: %v", err)
+			return "", uuid.UUID{}, false
+		}
+		report.add(CheckProviderID, SeverityWarning,
+			"Start the kubelet with --provider-id, for instance with the drop-in written by the providerid subcommand",
+			"Node has no provider ID, it matches instance %s by name or IP", *instance.Id)
+		return c.orgName, *instance.Id, true
+	}
+
+	pid, err := providerid.ParseProviderID(node.Spec.ProviderID)
+	if err != nil {
+		report.add(CheckProviderID, SeverityError,
+			"Re-register the node with a provider ID of the form nvidia-bmm://<org>/<tenant>/<site>/<instance-id>",
+			"Invalid provider ID: %v", err)
+		return "", uuid.UUID{}, false
+	}
+
+	found := false
+	if pid.TenantName == "" {
+		canonical := providerid.NewProviderID(pid.OrgName, c.tenantID, pid.SiteName, pid.InstanceID)
+		severity := SeverityWarning
+		switch c.providerIDConfig.LegacyPolicy {
+		case ProviderIDPolicyAccept:
+			severity = SeverityOK
+		case ProviderIDPolicyReject:
+			severity = SeverityError
+		}
+		report.add(CheckProviderID, severity, "Migrate the node with the migrate-providerid subcommand",
+			"Legacy provider ID without a tenant, the canonical provider ID is %s", canonical)
+		if severity == SeverityError {
+			return "", uuid.UUID{}, false
+		}
+		found = true
+	}
+
+	org := c.orgName
+	policy := c.providerIDConfig.MismatchPolicy
+	for _, m := range c.providerIDMismatches(ctx, pid) {
+		found = true
+		switch {
+		case policy == ProviderIDPolicyReject:
+			report.add(CheckProviderID, SeverityError,
+				"Re-register the node with a provider ID matching the configuration, or allow it in providerID.tenants or providerID.sites",
+				"Provider ID is rejected, %s", m.message)
+			return "", uuid.UUID{}, false
+		case m.segment == segmentOrg && policy == ProviderIDPolicyUseProviderIDOrg:
+			org = pid.OrgName
+			report.add(CheckProviderID, SeverityOK, "", "Provider ID %s, looked up under its org", m.message)
+		default:
+			report.add(CheckProviderID, SeverityWarning,
+				"Re-register the node with a provider ID matching the configuration, or allow it in providerID.tenants or providerID.sites",
+				"Provider ID %s", m.message)
+		}
+	}
+	if !found {
+		report.add(CheckProviderID, SeverityOK, "", "Provider ID matches the configuration")
+	}
+	return org, pid.InstanceID, true
+}
+
+// diagnoseAddresses checks the instance has addresses, and that the node has them
+func diagnoseAddresses(node *v1.Node, addresses []v1.NodeAddress, report *NodeReport) {
+	for _, address := range addresses {
+		report.Addresses = append(report.Addresses, address.Address)
+	}
+	if len(addresses) == 0 {
+		report.add(CheckAddresses, SeverityError, "Check the interfaces of the instance in NVIDIA BMM",
+			"Instance has no IP address, the node only gets its hostname")
+		return
+	}
+
+	var nodeIPs []string
+	for _, address := range node.Status.Addresses {
+		if address.Type == v1.NodeInternalIP {
+			nodeIPs = append(nodeIPs, address.Address)
+		}
+	}
+	if !slices.Equal(nodeIPs, report.Addresses) {
+		report.add(CheckAddresses, SeverityWarning, "Wait for the next node status update, or check the cloud controller manager logs",
+			"Node internal IPs %v differ from the instance addresses %v", nodeIPs, report.Addresses)
+		return
+	}
+	report.add(CheckAddresses, SeverityOK, "", "Node internal IPs match the instance addresses")
+}
+
+// diagnoseZone checks the zone computed for the node against its instance site and zone label
+func (c *NvidiaBMMCloud) diagnoseZone(
+	ctx context.Context, node *v1.Node, instance *restclient.Instance, siteID uuid.UUID, siteOK bool, report *NodeReport,
+) {
+	if !siteOK {
+		report.add(CheckZone, SeverityError, "Fix the site finding", "Zone cannot be computed without the configured site")
+		return
+	}
+	// Nodes get the zone of their provider ID site, which may be another allowed site
+	if pid, err := providerid.ParseProviderID(node.Spec.ProviderID); err == nil {
+		if resolved, err := c.resolveSite(ctx, pid.SiteName); err == nil {
+			siteID = resolved
+		}
+	}
+	report.Zone = c.getZoneFromSiteID(siteID.String())
+
+	if instance.SiteId != nil && *instance.SiteId != siteID {
+		report.add(CheckZone, SeverityWarning, "Check the site of the node provider ID, nodes get the zone of that site",
+			"Instance runs in site %s, not in site %s of the provider ID", *instance.SiteId, siteID)
+		return
+	}
+	current, ok := node.Labels[v1.LabelTopologyZone]
+	switch {
+	case !ok:
+		report.add(CheckZone, SeverityWarning, "Wait for the node to be initialized by the cloud controller manager",
+			"Node has no %s label, the computed zone is %s", v1.LabelTopologyZone, report.Zone)
+	case current != report.Zone:
+		report.add(CheckZone, SeverityWarning, "Check the node labels, the cloud controller manager sets the zone label when it initializes the node",
+			"Node %s label %q does not match the computed zone %s", v1.LabelTopologyZone, current, report.Zone)
+	default:
+		report.add(CheckZone, SeverityOK, "", "Node zone is %s", report.Zone)
+	}
+}
@@ -0,0 +1,268 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+)
+
+var testTenantUUID = uuid.MustParse("b013708a-99f0-47b2-a630-cabb4ae1d3df")
+
+// doctorConfig returns a cloud config for the fake API
+func doctorConfig(endpoint, token, site, tenant string) string {
+	return fmt.Sprintf(`apiVersion: bmm.nvidia.com/v1alpha1
+kind: CloudConfig
+api:
+  endpoint: %q
+  orgName: test-org
+  token: %s
+  requestTimeout: 5s
+cluster:
+  siteId: %s
+  tenantId: %s
+`, endpoint, token, site, tenant)
+}
+
+// findingsOf returns the check:severity pairs of findings
+func findingsOf(findings []Finding) []string {
+	var got []string
+	for _, finding := range findings {
+		got = append(got, finding.Check+":"+string(finding.Severity))
+	}
+	return got
+}
+
+func TestDiagnose_Cluster(t *testing.T) {
+	fake := bmmfake.NewServer("test-org", bmmfake.WithToken("test-token"))
+	defer fake.Close()
+	fake.AddSite(restclient.Site{Id: &testSiteID, Name: ptr("test-site")})
+	fake.SetTenant(restclient.Tenant{Id: &testTenantUUID, Org: ptr("test-org")})
+	closed := bmmfake.NewServer("test-org")
+	closed.Close()
+
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name:   "healthy",
+			config: doctorConfig(fake.URL(), "test-token", "test-site", testTenantUUID.String()),
+			want:   []string{"config:ok", "api:ok", "site:ok", "tenant:ok"},
+		},
+		{
+			name:   "site UUID",
+			config: doctorConfig(fake.URL(), "test-token", testSiteID.String(), testTenantUUID.String()),
+			want:   []string{"config:ok", "api:ok", "site:ok", "tenant:ok"},
+		},
+		{
+			name:   "invalid config",
+			config: "apiVersion: bmm.nvidia.com/v1alpha1\nkind: CloudConfig\n",
+			want:   []string{"config:error"},
+		},
+		{
+			name:   "unreachable endpoint",
+			config: doctorConfig(closed.URL(), "test-token", "test-site", testTenantUUID.String()),
+			want:   []string{"config:ok", "api:error"},
+		},
+		{
+			name:   "wrong token",
+			config: doctorConfig(fake.URL(), "wrong-token", "test-site", testTenantUUID.String()),
+			want:   []string{"config:ok", "api:error"},
+		},
+		{
+			name:   "unknown site name",
+			config: doctorConfig(fake.URL(), "test-token", "other-site", testTenantUUID.String()),
+			want:   []string{"config:ok", "api:ok", "site:error", "tenant:ok"},
+		},
+		{
+			name:   "unknown site UUID",
+			config: doctorConfig(fake.URL(), "test-token", uuid.New().String(), testTenantUUID.String()),
+			want:   []string{"config:ok", "api:ok", "site:error", "tenant:ok"},
+		},
+		{
+			name:   "other tenant",
+			config: doctorConfig(fake.URL(), "test-token", "test-site", uuid.New().String()),
+			want:   []string{"config:ok", "api:ok", "site:ok", "tenant:error"},
+		},
+		{
+			name:   "tenant name",
+			config: doctorConfig(fake.URL(), "test-token", "test-site", "test-tenant"),
+			want:   []string{"config:ok", "api:ok", "site:ok", "tenant:warning"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Diagnose(context.Background(), strings.NewReader(tt.config), nil)
+			if got := findingsOf(report.Findings); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Expected findings %v, got %+v", tt.want, report.Findings)
+			}
+			for _, finding := range report.Findings {
+				if finding.Severity != SeverityOK && finding.Action == "" {
+					t.Errorf("Finding %+v has no action", finding)
+				}
+			}
+		})
+	}
+}
+
+func TestDiagnose_Nodes(t *testing.T) {
+	fake := bmmfake.NewServer("test-org", bmmfake.WithToken("test-token"))
+	defer fake.Close()
+	site := fake.AddSite(restclient.Site{Id: &testSiteID, Name: ptr("test-site")})
+	fake.SetTenant(restclient.Tenant{Id: &testTenantUUID, Org: ptr("test-org")})
+	otherSite := fake.AddSite(restclient.Site{Name: ptr("other-site")})
+
+	addInstance := func(name, status string, addresses ...string) uuid.UUID {
+		instance := restclient.Instance{
+			Name:       ptr(name),
+			SiteId:     site.Id,
+			TenantId:   &testTenantUUID,
+			Status:     ptr(restclient.InstanceStatus(status)),
+			Interfaces: &[]restclient.Interface{{IpAddresses: &addresses}},
+		}
+		return *fake.AddInstance(instance).Id
+	}
+	zone := "nvidia-bmm-zone-" + testSiteID.String()
+	providerID := func(id uuid.UUID) string {
+		return fmt.Sprintf("nvidia-bmm://test-org/%s/test-site/%s", testTenantUUID, id)
+	}
+	node := func(name, providerID, zoneLabel string, addresses ...string) v1.Node {
+		node := v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+			Spec:       v1.NodeSpec{ProviderID: providerID},
+		}
+		if zoneLabel != "" {
+			node.Labels[v1.LabelTopologyZone] = zoneLabel
+		}
+		for _, address := range addresses {
+			node.Status.Addresses = append(node.Status.Addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: address})
+		}
+		return node
+	}
+
+	healthy := addInstance("healthy", "Ready", "10.0.0.1")
+	shutdown := addInstance("shutdown", "Terminating", "10.0.0.2")
+	noAddresses := addInstance("no-addresses", "Ready")
+	discovered := addInstance("discovered", "Ready", "10.0.0.4")
+	otherSiteInstance := *fake.AddInstance(restclient.Instance{
+		Name:       ptr("other-site-node"),
+		SiteId:     otherSite.Id,
+		Status:     ptr(restclient.InstanceStatus("Ready")),
+		Interfaces: &[]restclient.Interface{{IpAddresses: &[]string{"10.0.0.5"}}},
+	}).Id
+	reprovisioned := addInstance("reprovisioned", "Ready", "10.0.0.6")
+	fake.UpdateInstance(reprovisioned, func(instance *restclient.Instance) { instance.MachineId = ptr("machine-2") })
+	reprovisionedNode := node("k-reprovisioned", providerID(reprovisioned), zone, "10.0.0.6")
+	reprovisionedNode.Annotations = map[string]string{AnnotationMachineID: "machine-1"}
+	uninitialized := node("uninitialized", providerID(healthy), "")
+	uninitialized.Spec.Taints = []v1.Taint{{Key: cloudproviderapi.TaintExternalCloudProvider, Effect: v1.TaintEffectNoSchedule}}
+
+	tests := []struct {
+		node v1.Node
+		want []string
+	}{
+		{
+			node: node("a-healthy", providerID(healthy), zone, "10.0.0.1"),
+			want: []string{"providerID:ok", "instance:ok", "status:ok", "addresses:ok", "zone:ok"},
+		},
+		{
+			node: uninitialized,
+			want: []string{"initialized:warning", "providerID:ok", "instance:ok", "status:ok", "addresses:warning", "zone:warning"},
+		},
+		{
+			node: node("b-shutdown", providerID(shutdown), zone, "10.0.0.2"),
+			want: []string{"providerID:ok", "instance:ok", "status:warning", "addresses:ok", "zone:ok"},
+		},
+		{
+			node: node("c-no-addresses", providerID(noAddresses), zone),
+			want: []string{"providerID:ok", "instance:ok", "status:ok", "addresses:error", "zone:ok"},
+		},
+		{
+			node: node("d-not-found", providerID(uuid.New()), zone),
+			want: []string{"providerID:ok", "instance:error"},
+		},
+		{
+			node: node("e-invalid", "aws:///us-east-1a/i-0123", ""),
+			want: []string{"providerID:error"},
+		},
+		{
+			node: node("f-legacy", fmt.Sprintf("nvidia-bmm://test-org/test-site/%s", healthy), zone, "10.0.0.1"),
+			want: []string{"providerID:warning", "instance:ok", "status:ok", "addresses:ok", "zone:ok"},
+		},
+		{
+			node: node("g-other-tenant", fmt.Sprintf("nvidia-bmm://test-org/other-tenant/test-site/%s", healthy), zone, "10.0.0.1"),
+			want: []string{"providerID:warning", "instance:ok", "status:ok", "addresses:ok", "zone:ok"},
+		},
+		{
+			node: node("discovered", "", zone, "10.0.0.4"),
+			want: []string{"providerID:warning", "instance:ok", "status:ok", "addresses:ok", "zone:ok"},
+		},
+		{
+			node: node("h-unknown", "", ""),
+			want: []string{"providerID:error"},
+		},
+		{
+			node: node("i-wrong-zone", providerID(healthy), "some-zone", "10.0.0.1"),
+			want: []string{"providerID:ok", "instance:ok", "status:ok", "addresses:ok", "zone:warning"},
+		},
+		{
+			node: node("j-other-site", providerID(otherSiteInstance), zone, "10.0.0.5"),
+			want: []string{"providerID:ok", "instance:ok", "status:ok", "addresses:ok", "zone:warning"},
+		},
+		{
+			node: reprovisionedNode,
+			want: []string{"providerID:ok", "instance:ok", "status:ok", "identity:error", "addresses:ok", "zone:ok"},
+		},
+	}
+
+	var nodes []v1.Node
+	for _, tt := range tests {
+		nodes = append(nodes, tt.node)
+	}
+	config := doctorConfig(fake.URL(), "test-token", "test-site", testTenantUUID.String())
+	report := Diagnose(context.Background(), strings.NewReader(config), nodes)
+	if len(report.Nodes) != len(tests) {
+		t.Fatalf("Expected %d node reports, got %d", len(tests), len(report.Nodes))
+	}
+	reports := map[string]NodeReport{}
+	for i, nodeReport := range report.Nodes {
+		if i > 0 && report.Nodes[i-1].Node > nodeReport.Node {
+			t.Errorf("Node reports are not sorted: %s before %s", report.Nodes[i-1].Node, nodeReport.Node)
+		}
+		reports[nodeReport.Node] = nodeReport
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.node.Name, func(t *testing.T) {
+			nodeReport := reports[tt.node.Name]
+			if got := findingsOf(nodeReport.Findings); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Expected findings %v, got %+v", tt.want, nodeReport.Findings)
+			}
+		})
+	}
+
+	if got := reports["a-healthy"]; got.InstanceID != healthy.String() || got.Status != "Ready" ||
+		got.Zone != zone || strings.Join(got.Addresses, ",") != "10.0.0.1" || got.Severity() != SeverityOK {
+		t.Errorf("Unexpected healthy node report %+v", got)
+	}
+	if got := reports["discovered"]; got.InstanceID != discovered.String() {
+		t.Errorf("Expected discovered instance %s, got %s", discovered, got.InstanceID)
+	}
+	if notFound := reports["d-not-found"]; notFound.Severity() != SeverityError {
+		t.Errorf("Expected error severity, got %s", notFound.Severity())
+	}
+	// Instance not found, no addresses, invalid and unknown provider IDs, reprovisioned instance
+	if got := report.Errors(); got != 5 {
+		t.Errorf("Expected 5 errors, got %d", got)
+	}
+}
@@ -0,0 +1,231 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"k8s.io/klog/v2"
+)
+
+// Node changes reported in dry-run mode
+const (
+	ChangeDelete        = "delete"
+	ChangeShutdownTaint = "shutdownTaint"
+	ChangeProviderID    = "providerID"
+	ChangeAddresses     = "addresses"
+	ChangeLabel         = "label"
+	ChangeError         = "error"
+)
+
+// NodeChange is a change the cloud node controllers would make to a node from the answers of
+// the provider
+type NodeChange struct {
+	Node   string `json:"node"`
+	Change string `json:"change"`
+
+	// Field is the label or taint key of the change
+	Field string `json:"field,omitempty"`
+
+	Current string `json:"current,omitempty"`
+	Desired string `json:"desired,omitempty"`
+
+	// Message explains an error change, a node the provider could not answer for
+	Message string `json:"message,omitempty"`
+}
+
+// dryRunReporter logs and counts the node changes not applied in dry-run mode. The controllers
+// ask about every node on each sync, so a change is only reported again when it differs.
+type dryRunReporter struct {
+	mu       sync.Mutex
+	reported map[string]string
+}
+
+// newDryRunReporter creates a dry-run reporter
+func newDryRunReporter() *dryRunReporter {
+	return &dryRunReporter{reported: map[string]string{}}
+}
+
+// report logs and counts the changes not reported yet
+func (r *dryRunReporter) report(ctx context.Context, changes []NodeChange) {
+	logger := klog.FromContext(ctx)
+	for _, change := range changes {
+		key := change.Node + "/" + change.Change + "/" + change.Field
+		value := change.Current + "\x00" + change.Desired
+
+		r.mu.Lock()
+		previous, ok := r.reported[key]
+		r.reported[key] = value
+		r.mu.Unlock()
+		if ok && previous == value {
+			continue
+		}
+
+		logger.Info("Dry run, not applying node change", "node", change.Node, "change", change.Change,
+			"field", change.Field, "current", change.Current, "desired", change.Desired)
+		dryRunChanges.WithLabelValues(change.Change).Inc()
+	}
+}
+
+// shutdownTaintChanges returns the shutdown taint change of a node, if it is not tainted yet
+func shutdownTaintChanges(node *v1.Node) []NodeChange {
+	if hasTaint(node, cloudproviderapi.TaintNodeShutdown) {
+		return nil
+	}
+	return []NodeChange{{
+		Node:    node.Name,
+		Change:  ChangeShutdownTaint,
+		Field:   cloudproviderapi.TaintNodeShutdown,
+		Desired: string(v1.TaintEffectNoSchedule),
+	}}
+}
+
+// metadataChanges returns the changes the cloud node controller makes to a node from its
+// instance metadata. Addresses are updated on every sync, the provider ID and the labels only
+// when the node is initialized.
+func metadataChanges(node *v1.Node, metadata *cloudprovider.InstanceMetadata) []NodeChange {
+	var changes []NodeChange
+	if len(metadata.NodeAddresses) > 0 && !sameAddresses(node.Status.Addresses, metadata.NodeAddresses) {
+		changes = append(changes, NodeChange{
+			Node:    node.Name,
+			Change:  ChangeAddresses,
+			Current: formatAddresses(node.Status.Addresses),
+			Desired: formatAddresses(metadata.NodeAddresses),
+		})
+	}
+
+	if !hasTaint(node, cloudproviderapi.TaintExternalCloudProvider) {
+		return changes
+	}
+	if node.Spec.ProviderID == "" && metadata.ProviderID != "" {
+		changes = append(changes, NodeChange{Node: node.Name, Change: ChangeProviderID, Desired: metadata.ProviderID})
+	}
+	labels := []struct{ key, value string }{
+		{v1.LabelInstanceTypeStable, metadata.InstanceType},
+		{v1.LabelInstanceType, metadata.InstanceType},
+		{v1.LabelTopologyZone, metadata.Zone},
+		{v1.LabelFailureDomainBetaZone, metadata.Zone},
+		{v1.LabelTopologyRegion, metadata.Region},
+		{v1.LabelFailureDomainBetaRegion, metadata.Region},
+	}
+	for _, label := range labels {
+		if label.value == "" || node.Labels[label.key] == label.value {
+			continue
+		}
+		changes = append(changes, NodeChange{
+			Node:    node.Name,
+			Change:  ChangeLabel,
+			Field:   label.key,
+			Current: node.Labels[label.key],
+			Desired: label.value,
+		})
+	}
+	return changes
+}
+
+// currentMetadata returns the instance metadata already on a node, so that the cloud node
+// controller leaves it untouched. Nodes not initialized yet are kept uninitialized.
+func currentMetadata(node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
+	if hasTaint(node, cloudproviderapi.TaintExternalCloudProvider) {
+		return nil, fmt.Errorf("node %s is not initialized in dry-run mode", node.Name)
+	}
+	return &cloudprovider.InstanceMetadata{
+		ProviderID:    node.Spec.ProviderID,
+		InstanceType:  node.Labels[v1.LabelInstanceTypeStable],
+		NodeAddresses: node.Status.Addresses,
+		Zone:          node.Labels[v1.LabelTopologyZone],
+		Region:        node.Labels[v1.LabelTopologyRegion],
+	}, nil
+}
+
+// PlanNodes loads a cloud config the way the cloud provider does and returns the changes the
+// cloud node lifecycle and cloud node controllers would make to the nodes, without making them.
+// NotReady nodes are deleted or tainted as shut down, and every node gets its metadata updated.
+func PlanNodes(ctx context.Context, config io.Reader, nodes []v1.Node) ([]NodeChange, error) {
+	cfg, _, err := parseConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	cloud, err := newCloudFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := slices.Clone(nodes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	changes := []NodeChange{}
+	for i := range sorted {
+		changes = append(changes, cloud.planNode(ctx, &sorted[i])...)
+	}
+	return changes, nil
+}
+
+// planNode returns the changes the cloud node controllers would make to a node
+func (c *NvidiaBMMCloud) planNode(ctx context.Context, node *v1.Node) []NodeChange {
+	errorChange := func(err error) []NodeChange {
+		return []NodeChange{{Node: node.Name, Change: ChangeError, Message: err.Error()}}
+	}
+
+	if !isNodeReady(node) {
+		exists, _, err := c.instanceExists(ctx, node)
+		if err != nil {
+			return errorChange(err)
+		}
+		if !exists {
+			return []NodeChange{{Node: node.Name, Change: ChangeDelete}}
+		}
+	}
+
+	var changes []NodeChange
+	if !isNodeReady(node) {
+		shutdown, err := c.instanceShutdown(ctx, node)
+		if err != nil {
+			return errorChange(err)
+		}
+		if shutdown {
+			changes = append(changes, shutdownTaintChanges(node)...)
+		}
+	}
+
+	metadata, err := c.instanceMetadata(ctx, node)
+	if err != nil {
+		return append(changes, errorChange(err)...)
+	}
+	return append(changes, metadataChanges(node, metadata)...)
+}
+
+// isNodeReady reports whether the Ready condition of a node is true
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// hasTaint reports whether a node has a taint with the given key
+func hasTaint(node *v1.Node, key string) bool {
+	return slices.ContainsFunc(node.Spec.Taints, func(taint v1.Taint) bool {
+		return taint.Key == key
+	})
+}
+
+// formatAddresses returns the addresses of a node as type=address pairs
+func formatAddresses(addresses []v1.NodeAddress) string {
+	formatted := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		formatted = append(formatted, string(address.Type)+"="+address.Address)
+	}
+	return strings.Join(formatted, ",")
+}
@@ -0,0 +1,248 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	cloudprovider "k8s.io/cloud-provider"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+)
+
+// changesOf returns the node:change:field triples of node changes
+func changesOf(changes []NodeChange) []string {
+	var got []string
+	for _, change := range changes {
+		got = append(got, change.Node+":"+change.Change+":"+change.Field)
+	}
+	return got
+}
+
+func TestDryRun_KeepsNodes(t *testing.T) {
+	fake := bmmfake.NewServer("test-org", bmmfake.WithToken("test-token"))
+	defer fake.Close()
+	site := fake.AddSite(restclient.Site{Id: &testSiteID, Name: ptr("test-site")})
+	instance := fake.AddInstance(restclient.Instance{
+		Name:       ptr("test-node"),
+		SiteId:     site.Id,
+		Status:     ptr(restclient.InstanceStatus("Terminating")),
+		Interfaces: &[]restclient.Interface{{IpAddresses: &[]string{"10.0.0.5"}}},
+	})
+
+	cloud := newFakeAPICloud(t, fake, "5s")
+	cloud.dryRun = newDryRunReporter()
+	recorder := record.NewFakeRecorder(10)
+	cloud.eventRecorder = recorder
+	ctx := context.Background()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node", Labels: map[string]string{
+			v1.LabelTopologyZone: "old-zone",
+		}},
+		Spec: v1.NodeSpec{ProviderID: "nvidia-bmm://test-org/test-tenant/test-site/" + instance.Id.String()},
+		Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+			{Type: v1.NodeInternalIP, Address: "10.0.0.1"},
+		}},
+	}
+
+	shutdown, err := cloud.InstanceShutdown(ctx, node)
+	if err != nil || shutdown {
+		t.Errorf("InstanceShutdown() = %v, %v, want false", shutdown, err)
+	}
+	metadata, err := cloud.InstanceMetadata(ctx, node)
+	if err != nil {
+		t.Fatalf("InstanceMetadata() failed: %v", err)
+	}
+	if !sameAddresses(metadata.NodeAddresses, node.Status.Addresses) || metadata.Zone != "old-zone" ||
+		metadata.ProviderID != node.Spec.ProviderID {
+		t.Errorf("Expected the metadata of the node, got %+v", metadata)
+	}
+
+	uninitialized := node.DeepCopy()
+	uninitialized.Spec.Taints = []v1.Taint{{Key: cloudproviderapi.TaintExternalCloudProvider, Effect: v1.TaintEffectNoSchedule}}
+	if _, err := cloud.InstanceMetadata(ctx, uninitialized); err == nil {
+		t.Errorf("Expected an error keeping the node uninitialized")
+	}
+
+	fake.DeleteInstance(*instance.Id)
+	exists, err := cloud.InstanceExists(ctx, node)
+	if err != nil || !exists {
+		t.Errorf("InstanceExists() = %v, %v after deletion, want true", exists, err)
+	}
+
+	if len(recorder.Events) != 0 {
+		t.Errorf("Expected no events in dry-run mode, got %d", len(recorder.Events))
+	}
+	// Shutdown taint, addresses, the 6 labels of the uninitialized node and delete
+	if got := len(cloud.dryRun.reported); got != 9 {
+		t.Errorf("Expected 9 reported changes, got %d: %v", got, cloud.dryRun.reported)
+	}
+}
+
+func TestDryRunReporter_Deduplicates(t *testing.T) {
+	reporter := newDryRunReporter()
+	ctx := context.Background()
+	change := NodeChange{Node: "node-1", Change: ChangeAddresses, Current: "InternalIP=10.0.0.1", Desired: "InternalIP=10.0.0.2"}
+
+	registerMetrics()
+	dryRunChanges.Reset()
+
+	// A repeated change is counted once, a different one again
+	reporter.report(ctx, []NodeChange{change})
+	reporter.report(ctx, []NodeChange{change})
+	expectCounter(t, dryRunChanges.WithLabelValues(ChangeAddresses), 1)
+
+	change.Desired = "InternalIP=10.0.0.3"
+	reporter.report(ctx, []NodeChange{change})
+	expectCounter(t, dryRunChanges.WithLabelValues(ChangeAddresses), 2)
+}
+
+func TestMetadataChanges(t *testing.T) {
+	metadata := &cloudprovider.InstanceMetadata{
+		ProviderID:    "nvidia-bmm://org/tenant/site/instance",
+		InstanceType:  "nvidia-bmm-instance",
+		NodeAddresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}},
+		Zone:          "zone-a",
+		Region:        "region-a",
+	}
+	initializedLabels := map[string]string{
+		v1.LabelInstanceTypeStable:      "nvidia-bmm-instance",
+		v1.LabelInstanceType:            "nvidia-bmm-instance",
+		v1.LabelTopologyZone:            "zone-a",
+		v1.LabelFailureDomainBetaZone:   "zone-a",
+		v1.LabelTopologyRegion:          "region-a",
+		v1.LabelFailureDomainBetaRegion: "region-a",
+	}
+	uninitialized := []v1.Taint{{Key: cloudproviderapi.TaintExternalCloudProvider, Effect: v1.TaintEffectNoSchedule}}
+
+	tests := []struct {
+		name      string
+		labels    map[string]string
+		addresses []string
+		taints    []v1.Taint
+		want      []string
+	}{
+		{
+			name:      "unchanged",
+			labels:    initializedLabels,
+			addresses: []string{"10.0.0.1"},
+		},
+		{
+			name:      "addresses changed",
+			labels:    initializedLabels,
+			addresses: []string{"10.0.0.2"},
+			want:      []string{"node:addresses:"},
+		},
+		{
+			name:      "labels of initialized nodes are not updated",
+			labels:    map[string]string{v1.LabelTopologyZone: "zone-b"},
+			addresses: []string{"10.0.0.1"},
+		},
+		{
+			name:   "uninitialized",
+			labels: map[string]string{v1.LabelTopologyZone: "zone-a"},
+			taints: uninitialized,
+			want: []string{
+				"node:addresses:",
+				"node:providerID:",
+				"node:label:" + v1.LabelInstanceTypeStable,
+				"node:label:" + v1.LabelInstanceType,
+				"node:label:" + v1.LabelFailureDomainBetaZone,
+				"node:label:" + v1.LabelTopologyRegion,
+				"node:label:" + v1.LabelFailureDomainBetaRegion,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node", Labels: tt.labels},
+				Spec:       v1.NodeSpec{Taints: tt.taints},
+			}
+			for _, address := range tt.addresses {
+				node.Status.Addresses = append(node.Status.Addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: address})
+			}
+			got := changesOf(metadataChanges(node, metadata))
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Expected changes %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPlanNodes(t *testing.T) {
+	fake := bmmfake.NewServer("test-org", bmmfake.WithToken("test-token"))
+	defer fake.Close()
+	site := fake.AddSite(restclient.Site{Id: &testSiteID, Name: ptr("test-site")})
+
+	addInstance := func(name, status string, addresses ...string) uuid.UUID {
+		return *fake.AddInstance(restclient.Instance{
+			Name:       ptr(name),
+			SiteId:     site.Id,
+			TenantId:   &testTenantUUID,
+			Status:     ptr(restclient.InstanceStatus(status)),
+			Interfaces: &[]restclient.Interface{{IpAddresses: &addresses}},
+		}).Id
+	}
+	node := func(name string, instance uuid.UUID, ready bool, addresses ...string) v1.Node {
+		status := v1.ConditionFalse
+		if ready {
+			status = v1.ConditionTrue
+		}
+		node := v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1.NodeSpec{
+				ProviderID: fmt.Sprintf("nvidia-bmm://test-org/%s/test-site/%s", testTenantUUID, instance),
+			},
+			Status: v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}}},
+		}
+		node.Status.Addresses = []v1.NodeAddress{{Type: v1.NodeHostName, Address: name}}
+		for _, address := range addresses {
+			node.Status.Addresses = append(node.Status.Addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: address})
+		}
+		return node
+	}
+
+	shutdownTainted := node("e-shutdown-tainted", addInstance("e", "Terminated", "10.0.0.5"), false, "10.0.0.5")
+	shutdownTainted.Spec.Taints = []v1.Taint{{Key: cloudproviderapi.TaintNodeShutdown, Effect: v1.TaintEffectNoSchedule}}
+	nodes := []v1.Node{
+		node("a-unchanged", addInstance("a", "Ready", "10.0.0.1"), true, "10.0.0.1"),
+		node("b-moved", addInstance("b", "Ready", "10.0.0.2"), true, "10.0.0.9"),
+		node("c-deleted", uuid.New(), false),
+		node("d-shutdown", addInstance("d", "Terminating", "10.0.0.4"), false, "10.0.0.4"),
+		shutdownTainted,
+		// Ready nodes are not deleted by the node lifecycle controller
+		node("f-ready-not-found", uuid.New(), true),
+	}
+
+	config := doctorConfig(fake.URL(), "test-token", "test-site", testTenantUUID.String())
+	changes, err := PlanNodes(context.Background(), strings.NewReader(config), nodes)
+	if err != nil {
+		t.Fatalf("PlanNodes() failed: %v", err)
+	}
+	want := []string{
+		"b-moved:addresses:",
+		"c-deleted:delete:",
+		"d-shutdown:shutdownTaint:" + cloudproviderapi.TaintNodeShutdown,
+		"f-ready-not-found:error:",
+	}
+	if got := changesOf(changes); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected changes %v, got %v", want, got)
+	}
+	if changes[0].Current != "Hostname=b-moved,InternalIP=10.0.0.9" ||
+		changes[0].Desired != "InternalIP=10.0.0.2,Hostname=b-moved" {
+		t.Errorf("Unexpected address change %+v", changes[0])
+	}
+
+	if _, err := PlanNodes(context.Background(), strings.NewReader("apiVersion: bmm.nvidia.com/v1alpha1\nkind: CloudConfig\n"), nodes); err == nil {
+		t.Errorf("Expected an error for an invalid config")
+	}
+}
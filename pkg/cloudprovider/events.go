@@ -0,0 +1,91 @@
+package cloudprovider
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// eventClientName is the client and event source name used by the provider
+	eventClientName = "nvidia-bmm-cloud-provider"
+
+	// Event reasons emitted on Node objects
+	EventReasonInstanceShutdown      = "InstanceShutdown"
+	EventReasonInstanceNotFound      = "InstanceNotFound"
+	EventReasonNodeAddressesChanged  = "NodeAddressesChanged"
+	EventReasonZoneMismatch          = "ZoneMismatch"
+	EventReasonProviderIDMismatch    = "ProviderIDMismatch"
+	EventReasonLegacyProviderID      = "LegacyProviderID"
+	EventReasonNodeDeletionBlocked   = "NodeDeletionBlocked"
+	EventReasonInstanceReprovisioned = "InstanceReprovisioned"
+)
+
+// newEventRecorder creates an event recorder that writes Events through the controller client builder
+func newEventRecorder(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) record.EventRecorder {
+	client, err := clientBuilder.Client(eventClientName)
+	if err != nil {
+		klog.ErrorS(err, "Unable to create client for events, Node events are disabled")
+		return nil
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartStructuredLogging(4)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	go func() {
+		<-stop
+		broadcaster.Shutdown()
+	}()
+
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventClientName})
+}
+
+// nodeEventf emits an Event on the given node if an event recorder is available. No events are
+// emitted in dry-run mode, where the decisions they describe are not applied.
+func (c *NvidiaBMMCloud) nodeEventf(node *v1.Node, eventType, reason, messageFmt string, args ...interface{}) {
+	if c.eventRecorder == nil || node == nil || c.dryRun != nil {
+		return
+	}
+	ref := &v1.ObjectReference{
+		Kind:      "Node",
+		Name:      node.Name,
+		UID:       node.UID,
+		Namespace: "",
+	}
+	c.eventRecorder.Eventf(ref, eventType, reason, messageFmt, args...)
+}
+
+// addressesChanged reports whether the node already has addresses that differ from the given ones
+func addressesChanged(current, desired []v1.NodeAddress) bool {
+	if len(current) == 0 {
+		return false
+	}
+	return !sameAddresses(current, desired)
+}
+
+// sameAddresses compares two address sets regardless of order
+func sameAddresses(a, b []v1.NodeAddress) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	key := func(addrs []v1.NodeAddress) []string {
+		keys := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			keys = append(keys, string(addr.Type)+"/"+addr.Address)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	ak, bk := key(a), key(b)
+	for i := range ak {
+		if ak[i] != bk[i] {
+			return false
+		}
+	}
+	return true
+}
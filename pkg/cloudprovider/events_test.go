@@ -0,0 +1,161 @@
+package cloudprovider
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+func TestNodeEvents(t *testing.T) {
+	instanceID := uuid.New()
+	pid := providerid.NewProviderID("test-org", "test-tenant", "test-site", instanceID)
+
+	instanceResponse := func(status string, ips ...string) *mockNvidiaBMMClient {
+		return &mockNvidiaBMMClient{
+			getInstance: func(
+				ctx context.Context, org string, instanceId uuid.UUID,
+				params *restclient.GetInstanceParams,
+				reqEditors ...restclient.RequestEditorFn,
+			) (*restclient.GetInstanceResponse, error) {
+				instanceStatus := restclient.InstanceStatus(status)
+				return &restclient.GetInstanceResponse{
+					HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+					JSON200: &restclient.Instance{
+						Id:         &instanceID,
+						Status:     &instanceStatus,
+						Interfaces: &[]restclient.Interface{{IpAddresses: &ips}},
+					},
+				}, nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		node       *v1.Node
+		mockClient *mockNvidiaBMMClient
+		call       func(c *NvidiaBMMCloud, node *v1.Node) error
+		wantEvents []string
+	}{
+		{
+			name: "shutdown detected",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+				Spec:       v1.NodeSpec{ProviderID: pid.String()},
+			},
+			mockClient: instanceResponse("Error"),
+			call: func(c *NvidiaBMMCloud, node *v1.Node) error {
+				_, err := c.InstanceShutdown(context.Background(), node)
+				return err
+			},
+			wantEvents: []string{"Warning InstanceShutdown Instance " + instanceID.String() + " is shut down, NVIDIA BMM status Error"},
+		},
+		{
+			name: "instance not found",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+				Spec:       v1.NodeSpec{ProviderID: pid.String()},
+			},
+			mockClient: &mockNvidiaBMMClient{
+				getInstance: func(
+					ctx context.Context, org string, instanceId uuid.UUID,
+					params *restclient.GetInstanceParams,
+					reqEditors ...restclient.RequestEditorFn,
+				) (*restclient.GetInstanceResponse, error) {
+					return &restclient.GetInstanceResponse{
+						HTTPResponse: &http.Response{StatusCode: http.StatusNotFound},
+					}, nil
+				},
+			},
+			call: func(c *NvidiaBMMCloud, node *v1.Node) error {
+				_, err := c.InstanceExists(context.Background(), node)
+				return err
+			},
+			wantEvents: []string{"Warning InstanceNotFound Instance " + instanceID.String() + " not found in NVIDIA BMM, status 404"},
+		},
+		{
+			name: "address and zone changes",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "test-node",
+					Labels: map[string]string{v1.LabelTopologyZone: "some-other-zone"},
+				},
+				Spec: v1.NodeSpec{ProviderID: pid.String()},
+				Status: v1.NodeStatus{
+					Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}},
+				},
+			},
+			mockClient: instanceResponse("Ready", "10.0.0.2"),
+			call: func(c *NvidiaBMMCloud, node *v1.Node) error {
+				_, err := c.InstanceMetadata(context.Background(), node)
+				return err
+			},
+			wantEvents: []string{
+				"Normal NodeAddressesChanged",
+				"Warning ZoneMismatch Node zone label \"some-other-zone\" does not match zone \"nvidia-bmm-zone-8a880c71-fe4b-4e43-9e24-ebfcb8a84c5f\"",
+			},
+		},
+		{
+			name: "no events for a healthy, unchanged node",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "test-node",
+					Labels: map[string]string{v1.LabelTopologyZone: "nvidia-bmm-zone-8a880c71-fe4b-4e43-9e24-ebfcb8a84c5f"},
+				},
+				Spec: v1.NodeSpec{ProviderID: pid.String()},
+				Status: v1.NodeStatus{
+					Addresses: []v1.NodeAddress{
+						{Type: v1.NodeHostName, Address: "test-node"},
+						{Type: v1.NodeInternalIP, Address: "10.0.0.2"},
+					},
+				},
+			},
+			mockClient: instanceResponse("Ready", "10.0.0.2"),
+			call: func(c *NvidiaBMMCloud, node *v1.Node) error {
+				_, err := c.InstanceMetadata(context.Background(), node)
+				return err
+			},
+			wantEvents: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			cloud := &NvidiaBMMCloud{
+				nvidiaBmmClient: tt.mockClient,
+				orgName:         "test-org",
+				siteID:          "test-site",
+				tenantID:        "test-tenant",
+				eventRecorder:   recorder,
+			}
+
+			if err := tt.call(cloud, tt.node); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			close(recorder.Events)
+			var got []string
+			for event := range recorder.Events {
+				got = append(got, event)
+			}
+			if len(got) != len(tt.wantEvents) {
+				t.Fatalf("Expected %d events, got %d: %v", len(tt.wantEvents), len(got), got)
+			}
+			for i, want := range tt.wantEvents {
+				if !strings.HasPrefix(got[i], want) {
+					t.Errorf("Expected event %q to start with %q", got[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package cloudprovider
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmrecord"
+)
+
+// TestGolden_Replay runs the provider offline against the recorded NVIDIA BMM API responses
+// of testdata/bmm-api.json. Re-record it against a site with NVIDIA_BMM_RECORD_FILE when the
+// API changes, and update the expectations below with the recorded instance.
+func TestGolden_Replay(t *testing.T) {
+	replayer, err := bmmrecord.LoadReplayer(filepath.Join("testdata", "bmm-api.json"))
+	if err != nil {
+		t.Fatalf("LoadReplayer() failed: %v", err)
+	}
+	client, err := restclient.NewClientWithAuth("https://bmm.invalid", "test-token",
+		restclient.WithHTTPClient(&http.Client{Transport: replayer}))
+	if err != nil {
+		t.Fatalf("NewClientWithAuth() failed: %v", err)
+	}
+	cloud := NewNvidiaBMMCloudWithClient(client, "test-org", "test-site", "test-tenant").(*NvidiaBMMCloud)
+
+	ctx := context.Background()
+	providerID := "nvidia-bmm://test-org/test-tenant/test-site/d4c3b2a1-6f5e-4d3c-9b8a-7e6f5d4c3b2a"
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu-node-07"},
+		Spec:       v1.NodeSpec{ProviderID: providerID},
+	}
+
+	exists, err := cloud.InstanceExists(ctx, node)
+	if err != nil || !exists {
+		t.Errorf("InstanceExists() = %v, %v, want true", exists, err)
+	}
+	shutdown, err := cloud.InstanceShutdown(ctx, node)
+	if err != nil || shutdown {
+		t.Errorf("InstanceShutdown() = %v, %v, want false", shutdown, err)
+	}
+	metadata, err := cloud.InstanceMetadata(ctx, node)
+	if err != nil {
+		t.Fatalf("InstanceMetadata() failed: %v", err)
+	}
+	wantAddresses := []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "198.18.0.1"},
+		{Type: v1.NodeInternalIP, Address: "2001:db8::1"},
+		{Type: v1.NodeInternalIP, Address: "198.18.0.2"},
+		{Type: v1.NodeHostName, Address: "gpu-node-07"},
+	}
+	if !reflect.DeepEqual(metadata.NodeAddresses, wantAddresses) {
+		t.Errorf("Expected addresses %v, got %v", wantAddresses, metadata.NodeAddresses)
+	}
+	if metadata.ProviderID != providerID {
+		t.Errorf("Expected provider ID %s, got %s", providerID, metadata.ProviderID)
+	}
+	if want := "nvidia-bmm-zone-" + testSiteID.String(); metadata.Zone != want {
+		t.Errorf("Expected zone %s, got %s", want, metadata.Zone)
+	}
+	if metadata.InstanceType == "" {
+		t.Error("Expected an instance type")
+	}
+
+	// Interactions nothing replays are stale, re-record the golden file
+	if unused := replayer.Unused(); len(unused) > 0 {
+		t.Errorf("Golden file interactions not replayed: %v", unused)
+	}
+}
+
+func TestGolden_RecordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.json")
+	t.Setenv(EnvRecordFile, path)
+
+	fake := bmmfake.NewServer("test-org", bmmfake.WithToken("test-token"))
+	defer fake.Close()
+	site := fake.AddSite(restclient.Site{Id: &testSiteID, Name: ptr("test-site")})
+	instance := fake.AddInstance(restclient.Instance{
+		Name:       ptr("test-node"),
+		SiteId:     site.Id,
+		Interfaces: &[]restclient.Interface{{IpAddresses: &[]string{"10.0.0.5"}}},
+	})
+
+	cloud := newFakeAPICloud(t, fake, "5s")
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Spec:       v1.NodeSpec{ProviderID: "nvidia-bmm://test-org/test-tenant/test-site/" + instance.Id.String()},
+	}
+	// The provider still sees the real addresses
+	metadata, err := cloud.InstanceMetadata(context.Background(), node)
+	if err != nil {
+		t.Fatalf("InstanceMetadata() failed: %v", err)
+	}
+	if metadata.NodeAddresses[0].Address != "10.0.0.5" {
+		t.Errorf("Expected address 10.0.0.5, got %v", metadata.NodeAddresses)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected a recording: %v", err)
+	}
+	for _, secret := range []string{"test-token", "10.0.0.5"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Recording contains %q", secret)
+		}
+	}
+	cassette, err := bmmrecord.Load(path)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(cassette.Interactions) == 0 {
+		t.Error("Expected recorded interactions")
+	}
+}
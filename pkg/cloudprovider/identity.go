@@ -0,0 +1,88 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+// Annotations recording on a node the identity of its instance, to detect a machine that was
+// reprovisioned while the kubelet of its previous OS kept running
+const (
+	AnnotationMachineID       = "bmm.nvidia.com/machine-id"
+	AnnotationInstanceCreated = "bmm.nvidia.com/instance-created"
+)
+
+// instanceIdentity returns the identity annotations of an instance, without the values it does not report
+func instanceIdentity(instance *restclient.Instance) map[string]string {
+	identity := map[string]string{}
+	if instance.MachineId != nil && *instance.MachineId != "" {
+		identity[AnnotationMachineID] = *instance.MachineId
+	}
+	if instance.Created != nil && !instance.Created.IsZero() {
+		identity[AnnotationInstanceCreated] = instance.Created.UTC().Format(time.RFC3339)
+	}
+	return identity
+}
+
+// identityMismatch describes how an instance differs from the identity recorded on its node, or
+// returns an empty string. Values not recorded on the node or not reported by NVIDIA BMM are not compared.
+func identityMismatch(node *v1.Node, instance *restclient.Instance) string {
+	var mismatches []string
+	for key, value := range instanceIdentity(instance) {
+		recorded, ok := node.Annotations[key]
+		if ok && recorded != value {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %q, recorded %q", key, value, recorded))
+		}
+	}
+	sort.Strings(mismatches)
+	return strings.Join(mismatches, ", ")
+}
+
+// recordIdentity records on a node the identity values of its instance not recorded yet, which
+// happens at initialization, for nodes initialized by earlier provider versions, and for values
+// NVIDIA BMM reports later than others. Recorded values are never overwritten.
+func (c *NvidiaBMMCloud) recordIdentity(ctx context.Context, node *v1.Node, instance *restclient.Instance) error {
+	annotations := map[string]interface{}{}
+	for key, value := range instanceIdentity(instance) {
+		if _, ok := node.Annotations[key]; !ok {
+			annotations[key] = value
+		}
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+	return c.patchNodeAnnotations(ctx, node, annotations)
+}
+
+// patchNodeAnnotations sets annotations of a node, and removes those set to nil. Nodes are left
+// untouched without a Kubernetes client and in dry-run mode.
+func (c *NvidiaBMMCloud) patchNodeAnnotations(ctx context.Context, node *v1.Node, annotations map[string]interface{}) error {
+	if c.kubeClient == nil || c.dryRun != nil {
+		return nil
+	}
+
+	// A JSON merge patch removes keys set to null
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	if _, err := c.kubeClient.CoreV1().Nodes().Patch(apiCtx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to patch node %s: %w", node.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package cloudprovider
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+)
+
+func TestIdentityMismatch(t *testing.T) {
+	created := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	instance := &restclient.Instance{MachineId: ptr("machine-1"), Created: &created}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		instance    *restclient.Instance
+		want        string
+	}{
+		{
+			name:     "nothing recorded",
+			instance: instance,
+		},
+		{
+			name: "same identity",
+			annotations: map[string]string{
+				AnnotationMachineID:       "machine-1",
+				AnnotationInstanceCreated: "2026-01-01T12:00:00Z",
+			},
+			instance: instance,
+		},
+		{
+			name:        "other machine",
+			annotations: map[string]string{AnnotationMachineID: "machine-2"},
+			instance:    instance,
+			want:        `bmm.nvidia.com/machine-id is "machine-1", recorded "machine-2"`,
+		},
+		{
+			name: "recreated instance",
+			annotations: map[string]string{
+				AnnotationMachineID:       "machine-2",
+				AnnotationInstanceCreated: "2025-06-01T00:00:00Z",
+			},
+			instance: instance,
+			want: `bmm.nvidia.com/instance-created is "2026-01-01T12:00:00Z", recorded "2025-06-01T00:00:00Z", ` +
+				`bmm.nvidia.com/machine-id is "machine-1", recorded "machine-2"`,
+		},
+		{
+			name:        "identity not reported",
+			annotations: map[string]string{AnnotationMachineID: "machine-2"},
+			instance:    &restclient.Instance{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", Annotations: tt.annotations}}
+			if got := identityMismatch(node, tt.instance); got != tt.want {
+				t.Errorf("identityMismatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstanceIdentity_Reprovisioned(t *testing.T) {
+	bmm := bmmfake.NewServer("test-org", bmmfake.WithToken("test-token"))
+	defer bmm.Close()
+	bmm.AddSite(restclient.Site{Id: &testSiteID, Name: ptr("test-site")})
+	created := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	instance := bmm.AddInstance(restclient.Instance{
+		Name:      ptr("test-node"),
+		SiteId:    &testSiteID,
+		MachineId: ptr("machine-1"),
+		Created:   &created,
+		Status:    ptr(restclient.InstanceStatus("Ready")),
+	})
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Spec:       v1.NodeSpec{ProviderID: "nvidia-bmm://test-org/test-tenant/test-site/" + instance.Id.String()},
+	}
+	kubeClient := fake.NewClientset(node.DeepCopy())
+	recorder := record.NewFakeRecorder(10)
+	cloud := newFakeAPICloud(t, bmm, "5s")
+	cloud.kubeClient = kubeClient
+	cloud.eventRecorder = recorder
+	ctx := context.Background()
+	getNode := func() *v1.Node {
+		t.Helper()
+		current, err := kubeClient.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Failed to get node: %v", err)
+		}
+		return current
+	}
+
+	// The identity is recorded on the node by the metadata lookup
+	if _, err := cloud.InstanceMetadata(ctx, node); err != nil {
+		t.Fatalf("InstanceMetadata() failed: %v", err)
+	}
+	annotations := getNode().Annotations
+	if annotations[AnnotationMachineID] != "machine-1" || annotations[AnnotationInstanceCreated] != "2026-01-01T12:00:00Z" {
+		t.Fatalf("Expected the instance identity to be recorded, got %v", annotations)
+	}
+	shutdown, err := cloud.InstanceShutdown(ctx, getNode())
+	if err != nil || shutdown {
+		t.Fatalf("InstanceShutdown() = %v, %v, want false", shutdown, err)
+	}
+
+	// The machine is reprovisioned behind the same instance
+	bmm.UpdateInstance(*instance.Id, func(instance *restclient.Instance) {
+		instance.MachineId = ptr("machine-2")
+	})
+	shutdown, err = cloud.InstanceShutdown(ctx, getNode())
+	if err != nil || !shutdown {
+		t.Fatalf("InstanceShutdown() = %v, %v for a reprovisioned instance, want true", shutdown, err)
+	}
+	// The recorded identity is kept so that the node stays reported as shut down
+	if _, err := cloud.InstanceMetadata(ctx, getNode()); err != nil {
+		t.Fatalf("InstanceMetadata() failed: %v", err)
+	}
+	if got := getNode().Annotations[AnnotationMachineID]; got != "machine-1" {
+		t.Errorf("Expected the recorded machine ID to be kept, got %q", got)
+	}
+
+	close(recorder.Events)
+	var reprovisioned []string
+	for event := range recorder.Events {
+		if strings.HasPrefix(event, "Warning "+EventReasonInstanceReprovisioned) {
+			reprovisioned = append(reprovisioned, event)
+		}
+	}
+	if len(reprovisioned) != 2 {
+		t.Errorf("Expected 2 %s events, got %v", EventReasonInstanceReprovisioned, reprovisioned)
+	}
+}
+
+func TestRecordIdentity(t *testing.T) {
+	created := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		instance    *restclient.Instance
+		want        map[string]string
+	}{
+		{
+			name:     "identity recorded",
+			instance: &restclient.Instance{MachineId: ptr("machine-1"), Created: &created},
+			want:     map[string]string{AnnotationMachineID: "machine-1", AnnotationInstanceCreated: "2026-01-01T12:00:00Z"},
+		},
+		{
+			name:        "value reported later",
+			annotations: map[string]string{AnnotationInstanceCreated: "2026-01-01T12:00:00Z"},
+			instance:    &restclient.Instance{MachineId: ptr("machine-1"), Created: &created},
+			want:        map[string]string{AnnotationMachineID: "machine-1", AnnotationInstanceCreated: "2026-01-01T12:00:00Z"},
+		},
+		{
+			name:        "recorded values kept",
+			annotations: map[string]string{AnnotationMachineID: "machine-1"},
+			instance:    &restclient.Instance{MachineId: ptr("machine-2")},
+			want:        map[string]string{AnnotationMachineID: "machine-1"},
+		},
+		{
+			name:     "values not reported",
+			instance: &restclient.Instance{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", Annotations: tt.annotations}}
+			kubeClient := fake.NewClientset(node.DeepCopy())
+			cloud := &NvidiaBMMCloud{kubeClient: kubeClient}
+
+			if err := cloud.recordIdentity(context.Background(), node, tt.instance); err != nil {
+				t.Fatalf("recordIdentity() failed: %v", err)
+			}
+			got, err := kubeClient.CoreV1().Nodes().Get(context.Background(), "node", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Annotations) != len(tt.want) {
+				t.Errorf("Expected annotations %v, got %v", tt.want, got.Annotations)
+			}
+			for key, value := range tt.want {
+				if got.Annotations[key] != value {
+					t.Errorf("Expected %s to be %q, got %q", key, value, got.Annotations[key])
+				}
+			}
+		})
+	}
+}
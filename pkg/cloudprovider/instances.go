@@ -4,127 +4,226 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 	v1 "k8s.io/api/core/v1"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 
 	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
 )
 
-// InstanceExists checks if the instance exists for the given node
+// InstanceExists checks if the instance exists for the given node. Instances not found are
+// reported as existing during the deletion grace period, and nodes without an instance are
+// reported with an error while the deletion guard is tripped, and are reported and kept in
+// dry-run mode.
 func (c *NvidiaBMMCloud) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
-	providerID := node.Spec.ProviderID
-	if providerID == "" {
-		return false, fmt.Errorf("node %s has no provider ID", node.Name)
+	exists, instanceUUID, err := c.instanceExists(ctx, node)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		c.instanceFound(ctx, node, instanceUUID)
+		c.deletionGuard.found(node.Name)
+		return true, nil
 	}
+	if !c.notFoundConfirmed(ctx, node, instanceUUID) {
+		return true, nil
+	}
+	if err := c.deletionGuard.notFoundAllowed(node.Name); err != nil {
+		c.nodeLogger(ctx, node).Info("Instance not found, node deletion blocked", "err", err)
+		c.nodeEventf(node, v1.EventTypeWarning, EventReasonNodeDeletionBlocked, "Instance not found in NVIDIA BMM, %v", err)
+		return false, err
+	}
+	if c.dryRun != nil {
+		c.dryRun.report(ctx, []NodeChange{{Node: node.Name, Change: ChangeDelete}})
+		return true, nil
+	}
+	return false, nil
+}
 
-	instanceUUID, err := parseProviderID(providerID)
+// instanceExists checks if the instance exists for the given node, and returns the instance
+// of the node, from its provider ID or discovered
+func (c *NvidiaBMMCloud) instanceExists(ctx context.Context, node *v1.Node) (bool, uuid.UUID, error) {
+	ctx, span := c.startSpan(ctx, "InstanceExists", nodeSpanAttributes(node)...)
+	defer span.End()
+	logger := c.nodeLogger(ctx, node)
+
+	orgName, instanceUUID, err := c.instanceForNode(ctx, node)
 	if err != nil {
-		return false, fmt.Errorf("failed to parse provider ID: %w", err)
+		return false, uuid.UUID{}, err
 	}
 
 	// Check if instance exists in NVIDIA BMM
-	resp, err := c.nvidiaBmmClient.GetInstanceWithResponse(ctx, c.orgName, instanceUUID, nil)
+	// Pass the logger down so the BMM client logs with the same keys
+	logger = logger.WithValues("instanceID", instanceUUID)
+	apiCtx, cancel := c.apiContext(klog.NewContext(ctx, logger))
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetInstanceWithResponse(apiCtx, orgName, instanceUUID, nil)
 	if err != nil {
-		klog.Warningf("Instance %s not found: %v", instanceUUID, err)
-		return false, nil
+		logger.Info("Instance could not be retrieved from NVIDIA BMM, reporting it as not found", "err", err)
+		recordInstanceDecision(decisionInstanceNotFound, "error")
+		c.nodeEventf(node, v1.EventTypeWarning, EventReasonInstanceNotFound,
+			"Instance %s could not be retrieved from NVIDIA BMM: %v", instanceUUID, err)
+		return false, instanceUUID, nil
 	}
 
 	if resp.StatusCode() != http.StatusOK || resp.JSON200 == nil {
-		klog.Warningf("Instance %s not found, status %d", instanceUUID, resp.StatusCode())
-		return false, nil
+		logger.Info("Instance not found in NVIDIA BMM", responseKeysAndValues(resp.HTTPResponse)...)
+		recordInstanceDecision(decisionInstanceNotFound, strconv.Itoa(resp.StatusCode()))
+		c.nodeEventf(node, v1.EventTypeWarning, EventReasonInstanceNotFound,
+			"Instance %s not found in NVIDIA BMM, status %d", instanceUUID, resp.StatusCode())
+		return false, instanceUUID, nil
 	}
 
-	return true, nil
+	return true, instanceUUID, nil
 }
 
-// InstanceShutdown checks if the instance is shutdown
+// InstanceShutdown checks if the instance is shutdown. In dry-run mode, shut down instances
+// are reported and their node is not tainted.
 func (c *NvidiaBMMCloud) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
-	providerID := node.Spec.ProviderID
-	if providerID == "" {
-		return false, fmt.Errorf("node %s has no provider ID", node.Name)
+	shutdown, err := c.instanceShutdown(ctx, node)
+	if c.dryRun != nil && err == nil && shutdown {
+		c.dryRun.report(ctx, shutdownTaintChanges(node))
+		return false, nil
 	}
+	return shutdown, err
+}
+
+// instanceShutdown checks if the instance is shutdown
+func (c *NvidiaBMMCloud) instanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
+	ctx, span := c.startSpan(ctx, "InstanceShutdown", nodeSpanAttributes(node)...)
+	defer span.End()
+	logger := c.nodeLogger(ctx, node)
 
-	instanceUUID, err := parseProviderID(providerID)
+	orgName, instanceUUID, err := c.instanceForNode(ctx, node)
 	if err != nil {
-		return false, fmt.Errorf("failed to parse provider ID: %w", err)
+		return false, err
 	}
 
 	// Get instance status from NVIDIA BMM
-	resp, err := c.nvidiaBmmClient.GetInstanceWithResponse(ctx, c.orgName, instanceUUID, nil)
+	// Pass the logger down so the BMM client logs with the same keys
+	logger = logger.WithValues("instanceID", instanceUUID)
+	apiCtx, cancel := c.apiContext(klog.NewContext(ctx, logger))
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetInstanceWithResponse(apiCtx, orgName, instanceUUID, nil)
 	if err != nil {
 		return false, fmt.Errorf("failed to get instance: %w", err)
 	}
 
 	if resp.StatusCode() != http.StatusOK || resp.JSON200 == nil {
+		logger.V(2).Info("Failed to get instance from NVIDIA BMM", responseKeysAndValues(resp.HTTPResponse)...)
 		return false, fmt.Errorf("failed to get instance, status %d", resp.StatusCode())
 	}
 
 	instance := resp.JSON200
 
+	// A machine reprovisioned since the node was initialized must not keep the node identity
+	if mismatch := identityMismatch(node, instance); mismatch != "" {
+		logger.Info("Instance does not match the identity recorded on the node, reporting it as shut down",
+			append(responseKeysAndValues(resp.HTTPResponse), "mismatch", mismatch)...)
+		recordInstanceDecision(decisionInstanceShutdown, "reprovisioned")
+		c.nodeEventf(node, v1.EventTypeWarning, EventReasonInstanceReprovisioned,
+			"Instance %s was reprovisioned, %s", instanceUUID, mismatch)
+		return true, nil
+	}
+
 	// Check if instance is in a shutdown or terminating state
-	if instance.Status != nil {
-		switch *instance.Status {
-		case "Terminating", "Terminated", "Error":
-			return true, nil
-		default:
-			return false, nil
-		}
+	if instance.Status != nil && isShutdownStatus(*instance.Status) {
+		logger.Info("Instance is shut down", append(responseKeysAndValues(resp.HTTPResponse),
+			"bmmStatus", *instance.Status)...)
+		recordInstanceDecision(decisionInstanceShutdown, string(*instance.Status))
+		c.nodeEventf(node, v1.EventTypeWarning, EventReasonInstanceShutdown,
+			"Instance %s is shut down, NVIDIA BMM status %s", instanceUUID, *instance.Status)
+		return true, nil
 	}
 
 	return false, nil
 }
 
-// InstanceMetadata returns metadata for the instance
+// InstanceMetadata returns metadata for the instance. In dry-run mode, the changes the metadata
+// would make to the node are reported, and the metadata already on the node is returned.
 func (c *NvidiaBMMCloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
-	providerID := node.Spec.ProviderID
-	if providerID == "" {
-		return nil, fmt.Errorf("node %s has no provider ID", node.Name)
+	metadata, err := c.instanceMetadata(ctx, node)
+	if c.dryRun == nil || err != nil {
+		return metadata, err
 	}
+	c.dryRun.report(ctx, metadataChanges(node, metadata))
+	return currentMetadata(node)
+}
+
+// instanceMetadata returns metadata for the instance
+func (c *NvidiaBMMCloud) instanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
+	ctx, span := c.startSpan(ctx, "InstanceMetadata", nodeSpanAttributes(node)...)
+	defer span.End()
+	logger := c.nodeLogger(ctx, node)
 
-	instanceUUID, err := parseProviderID(providerID)
+	orgName, instanceUUID, err := c.instanceForNode(ctx, node)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse provider ID: %w", err)
+		return nil, err
 	}
 
 	// Get instance details from NVIDIA BMM
-	resp, err := c.nvidiaBmmClient.GetInstanceWithResponse(ctx, c.orgName, instanceUUID, nil)
+	// Pass the logger down so the BMM client logs with the same keys
+	logger = logger.WithValues("instanceID", instanceUUID)
+	apiCtx, cancel := c.apiContext(klog.NewContext(ctx, logger))
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetInstanceWithResponse(apiCtx, orgName, instanceUUID, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get instance: %w", err)
 	}
 
 	if resp.StatusCode() != http.StatusOK || resp.JSON200 == nil {
+		logger.V(2).Info("Failed to get instance from NVIDIA BMM", responseKeysAndValues(resp.HTTPResponse)...)
 		return nil, fmt.Errorf("failed to get instance, status %d", resp.StatusCode())
 	}
 
 	instance := resp.JSON200
 
-	// Extract node addresses from instance interfaces
-	addresses := []v1.NodeAddress{}
-	if instance.Interfaces != nil {
-		for _, iface := range *instance.Interfaces {
-			if iface.IpAddresses != nil {
-				for _, ipAddr := range *iface.IpAddresses {
-					addresses = append(addresses, v1.NodeAddress{
-						Type:    v1.NodeInternalIP,
-						Address: ipAddr,
-					})
-				}
-			}
-		}
+	if mismatch := identityMismatch(node, instance); mismatch != "" {
+		c.nodeEventf(node, v1.EventTypeWarning, EventReasonInstanceReprovisioned,
+			"Instance %s was reprovisioned, %s", instanceUUID, mismatch)
+	} else if err := c.recordIdentity(ctx, node, instance); err != nil {
+		logger.Error(err, "Failed to record the instance identity on the node")
 	}
 
+	// Extract node addresses from instance interfaces
+	addresses := instanceAddresses(instance)
+
 	// Add hostname
 	addresses = append(addresses, v1.NodeAddress{
 		Type:    v1.NodeHostName,
 		Address: node.Name,
 	})
 
-	// Determine zone from site ID
-	zone := c.getZoneFromSiteID(c.siteID)
+	if addressesChanged(node.Status.Addresses, addresses) {
+		c.nodeEventf(node, v1.EventTypeNormal, EventReasonNodeAddressesChanged,
+			"Node addresses changed from %v to %v", node.Status.Addresses, addresses)
+	}
+
+	// Nodes registered without a provider ID get one from their discovered instance
+	providerID := node.Spec.ProviderID
+	if providerID == "" {
+		providerID = providerid.NewProviderID(c.orgName, c.tenantID, c.siteID, instanceUUID).String()
+		logger.Info("Discovered provider ID for node", "discoveredProviderID", providerID)
+	}
+
+	// Determine zone from the provider ID site, like GetZoneByProviderID
+	siteZone, err := c.zoneForProviderID(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	zone := siteZone.FailureDomain
+
+	if current, ok := node.Labels[v1.LabelTopologyZone]; ok && current != zone {
+		c.nodeEventf(node, v1.EventTypeWarning, EventReasonZoneMismatch,
+			"Node zone label %q does not match zone %q computed from NVIDIA BMM", current, zone)
+	}
 
 	// Determine instance type
 	instanceType := "unknown"
@@ -137,14 +236,74 @@ func (c *NvidiaBMMCloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*
 		InstanceType:  instanceType,
 		NodeAddresses: addresses,
 		Zone:          zone,
-		Region:        c.getRegionFromSiteID(c.siteID),
+		Region:        siteZone.Region,
 	}
 
-	klog.V(4).Infof("Instance metadata for %s: %+v", node.Name, metadata)
+	logger.V(4).Info("Instance metadata", append(responseKeysAndValues(resp.HTTPResponse),
+		"zone", metadata.Zone, "region", metadata.Region, "addresses", metadata.NodeAddresses)...)
 
 	return metadata, nil
 }
 
+// instanceForNode returns the org and instance ID to look a node's instance up with. They come
+// from the node provider ID, checked against the configuration, or when the node registered
+// without one, from the NVIDIA BMM instance matching its name or IPs.
+func (c *NvidiaBMMCloud) instanceForNode(ctx context.Context, node *v1.Node) (string, uuid.UUID, error) {
+	if node.Spec.ProviderID != "" {
+		pid, err := providerid.ParseProviderID(node.Spec.ProviderID)
+		if err != nil {
+			return "", uuid.UUID{}, fmt.Errorf("failed to parse provider ID: %w", err)
+		}
+		orgName, err := c.checkProviderID(ctx, node, node.Spec.ProviderID, pid)
+		if err != nil {
+			return "", uuid.UUID{}, err
+		}
+		return orgName, pid.InstanceID, nil
+	}
+
+	instance, err := c.discoverInstance(ctx, node)
+	if err != nil {
+		return "", uuid.UUID{}, fmt.Errorf("node %s has no provider ID: %w", node.Name, err)
+	}
+	return c.orgName, *instance.Id, nil
+}
+
+// isShutdownStatus reports whether an NVIDIA BMM instance status means the instance is shut down
+func isShutdownStatus(status restclient.InstanceStatus) bool {
+	switch status {
+	case "Terminating", "Terminated", "Error":
+		return true
+	default:
+		return false
+	}
+}
+
+// instanceAddresses returns the internal IPs of the instance interfaces
+func instanceAddresses(instance *restclient.Instance) []v1.NodeAddress {
+	addresses := []v1.NodeAddress{}
+	if instance.Interfaces != nil {
+		for _, iface := range *instance.Interfaces {
+			if iface.IpAddresses != nil {
+				for _, ipAddr := range *iface.IpAddresses {
+					addresses = append(addresses, v1.NodeAddress{
+						Type:    v1.NodeInternalIP,
+						Address: ipAddr,
+					})
+				}
+			}
+		}
+	}
+	return addresses
+}
+
+// nodeSpanAttributes returns the span attributes identifying a node
+func nodeSpanAttributes(node *v1.Node) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("node", node.Name),
+		attribute.String("providerID", node.Spec.ProviderID),
+	}
+}
+
 // parseProviderID extracts the instance ID UUID from the provider ID format
 // Format: nvidia-bmm://org/tenant/site/instance-id
 func parseProviderID(providerIDStr string) (uuid.UUID, error) {
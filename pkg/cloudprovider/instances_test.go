@@ -20,8 +20,50 @@ type mockNvidiaBMMClient struct {
 		params *restclient.GetInstanceParams,
 		reqEditors ...restclient.RequestEditorFn,
 	) (*restclient.GetInstanceResponse, error)
+	getAllInstance func(
+		ctx context.Context, org string,
+		params *restclient.GetAllInstanceParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetAllInstanceResponse, error)
+	getAllSite func(
+		ctx context.Context, org string,
+		params *restclient.GetAllSiteParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetAllSiteResponse, error)
+	getInstanceType func(
+		ctx context.Context, org string, instanceTypeId uuid.UUID,
+		params *restclient.GetInstanceTypeParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetInstanceTypeResponse, error)
+	getSubnet func(
+		ctx context.Context, org string, subnetId uuid.UUID,
+		params *restclient.GetSubnetParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetSubnetResponse, error)
+	getVpcPrefix func(
+		ctx context.Context, org string, vpcPrefixId uuid.UUID,
+		params *restclient.GetVpcPrefixParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetVpcPrefixResponse, error)
+	getSite func(
+		ctx context.Context, org string, siteId uuid.UUID,
+		params *restclient.GetSiteParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetSiteResponse, error)
+	getCurrentTenant func(
+		ctx context.Context, org string,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetCurrentTenantResponse, error)
+	updateInstance func(
+		ctx context.Context, org string, instanceId uuid.UUID,
+		body restclient.UpdateInstanceJSONRequestBody,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.UpdateInstanceResponse, error)
 }
 
+// testSiteID is the UUID of the "test-site" site returned by the mock client by default
+var testSiteID = uuid.MustParse("8a880c71-fe4b-4e43-9e24-ebfcb8a84c5f")
+
 func (m *mockNvidiaBMMClient) GetInstanceWithResponse(
 	ctx context.Context, org string, instanceId uuid.UUID,
 	params *restclient.GetInstanceParams,
@@ -33,6 +75,96 @@ func (m *mockNvidiaBMMClient) GetInstanceWithResponse(
 	return nil, nil
 }
 
+func (m *mockNvidiaBMMClient) GetAllInstanceWithResponse(
+	ctx context.Context, org string,
+	params *restclient.GetAllInstanceParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetAllInstanceResponse, error) {
+	if m.getAllInstance != nil {
+		return m.getAllInstance(ctx, org, params, reqEditors...)
+	}
+	return nil, nil
+}
+
+func (m *mockNvidiaBMMClient) GetAllSiteWithResponse(
+	ctx context.Context, org string,
+	params *restclient.GetAllSiteParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetAllSiteResponse, error) {
+	if m.getAllSite != nil {
+		return m.getAllSite(ctx, org, params, reqEditors...)
+	}
+	return &restclient.GetAllSiteResponse{
+		HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+		JSON200:      &[]restclient.Site{{Id: &testSiteID, Name: ptr("test-site")}},
+	}, nil
+}
+
+func (m *mockNvidiaBMMClient) GetInstanceTypeWithResponse(
+	ctx context.Context, org string, instanceTypeId uuid.UUID,
+	params *restclient.GetInstanceTypeParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetInstanceTypeResponse, error) {
+	if m.getInstanceType != nil {
+		return m.getInstanceType(ctx, org, instanceTypeId, params, reqEditors...)
+	}
+	return nil, nil
+}
+
+func (m *mockNvidiaBMMClient) GetSubnetWithResponse(
+	ctx context.Context, org string, subnetId uuid.UUID,
+	params *restclient.GetSubnetParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetSubnetResponse, error) {
+	if m.getSubnet != nil {
+		return m.getSubnet(ctx, org, subnetId, params, reqEditors...)
+	}
+	return nil, nil
+}
+
+func (m *mockNvidiaBMMClient) GetVpcPrefixWithResponse(
+	ctx context.Context, org string, vpcPrefixId uuid.UUID,
+	params *restclient.GetVpcPrefixParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetVpcPrefixResponse, error) {
+	if m.getVpcPrefix != nil {
+		return m.getVpcPrefix(ctx, org, vpcPrefixId, params, reqEditors...)
+	}
+	return nil, nil
+}
+
+func (m *mockNvidiaBMMClient) GetSiteWithResponse(
+	ctx context.Context, org string, siteId uuid.UUID,
+	params *restclient.GetSiteParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetSiteResponse, error) {
+	if m.getSite != nil {
+		return m.getSite(ctx, org, siteId, params, reqEditors...)
+	}
+	return nil, nil
+}
+
+func (m *mockNvidiaBMMClient) GetCurrentTenantWithResponse(
+	ctx context.Context, org string,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetCurrentTenantResponse, error) {
+	if m.getCurrentTenant != nil {
+		return m.getCurrentTenant(ctx, org, reqEditors...)
+	}
+	return nil, nil
+}
+
+func (m *mockNvidiaBMMClient) UpdateInstanceWithResponse(
+	ctx context.Context, org string, instanceId uuid.UUID,
+	body restclient.UpdateInstanceJSONRequestBody,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.UpdateInstanceResponse, error) {
+	if m.updateInstance != nil {
+		return m.updateInstance(ctx, org, instanceId, body, reqEditors...)
+	}
+	return nil, nil
+}
+
 func TestInstanceExists(t *testing.T) {
 	instanceID := uuid.New()
 	pid := providerid.NewProviderID("test-org", "test-tenant", "test-site", instanceID)
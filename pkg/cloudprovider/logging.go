@@ -0,0 +1,34 @@
+package cloudprovider
+
+import (
+	"context"
+	"net/http"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// requestIDHeader is the BMM API response header carrying the server-side request ID
+const requestIDHeader = "X-Request-Id"
+
+// nodeLogger returns the contextual logger for a provider call on the given node,
+// carrying the node, providerID and site keys
+func (c *NvidiaBMMCloud) nodeLogger(ctx context.Context, node *v1.Node) klog.Logger {
+	return klog.FromContext(ctx).WithValues(
+		"node", klog.KObj(node),
+		"providerID", node.Spec.ProviderID,
+		"site", c.siteID,
+	)
+}
+
+// responseKeysAndValues returns the httpStatus and requestID log keys of a BMM API response
+func responseKeysAndValues(resp *http.Response) []interface{} {
+	if resp == nil {
+		return nil
+	}
+	kv := []interface{}{"httpStatus", resp.StatusCode}
+	if requestID := resp.Header.Get(requestIDHeader); requestID != "" {
+		kv = append(kv, "requestID", requestID)
+	}
+	return kv
+}
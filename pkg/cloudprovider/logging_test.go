@@ -0,0 +1,93 @@
+package cloudprovider
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+func TestContextualLogging(t *testing.T) {
+	instanceID := uuid.New()
+	pid := providerid.NewProviderID("test-org", "test-tenant", "test-site", instanceID).String()
+
+	mock := &mockNvidiaBMMClient{
+		getInstance: func(
+			ctx context.Context, org string, instanceId uuid.UUID,
+			params *restclient.GetInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetInstanceResponse, error) {
+			status := restclient.InstanceStatus("Terminated")
+			return &restclient.GetInstanceResponse{
+				HTTPResponse: &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{requestIDHeader: []string{"req-1234"}},
+				},
+				JSON200: &restclient.Instance{Id: &instanceID, Status: &status},
+			}, nil
+		},
+	}
+
+	logger := ktesting.NewLogger(t, ktesting.NewConfig(ktesting.BufferLogs(true)))
+	ctx := klog.NewContext(context.Background(), logger)
+
+	cloud := NewNvidiaBMMCloudWithClient(mock, "test-org", "test-site", "test-tenant").(*NvidiaBMMCloud)
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Spec:       v1.NodeSpec{ProviderID: pid},
+	}
+
+	shutdown, err := cloud.InstanceShutdown(ctx, node)
+	if err != nil || !shutdown {
+		t.Fatalf("InstanceShutdown() = %v, %v, want true, nil", shutdown, err)
+	}
+
+	logs := logger.GetSink().(ktesting.Underlier).GetBuffer().String()
+	for _, want := range []string{
+		"Instance is shut down",
+		`node="test-node"`,
+		`providerID="` + pid + `"`,
+		`instanceID="` + instanceID.String() + `"`,
+		`site="test-site"`,
+		`bmmStatus="Terminated"`,
+		`httpStatus=200`,
+		`requestID="req-1234"`,
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("Expected logs to contain %s, got:\n%s", want, logs)
+		}
+	}
+}
+
+func TestResponseKeysAndValues(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *http.Response
+		want int
+	}{
+		{name: "nil response", resp: nil, want: 0},
+		{name: "no request ID", resp: &http.Response{StatusCode: http.StatusNotFound}, want: 2},
+		{
+			name: "with request ID",
+			resp: &http.Response{StatusCode: http.StatusOK, Header: http.Header{requestIDHeader: []string{"abc"}}},
+			want: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := responseKeysAndValues(tt.resp); len(got) != tt.want {
+				t.Errorf("Expected %d keys and values, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+const (
+	metricsSubsystem = "nvidia_bmm"
+
+	// apiRetryWindow is how long after a failed BMM request the same request counts as a retry
+	apiRetryWindow = 10 * time.Minute
+
+	// Decisions recorded by the instance decision counter
+	decisionInstanceNotFound = "instance_not_found"
+	decisionInstanceShutdown = "instance_shutdown"
+)
+
+var (
+	apiRequests = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "api_requests_total",
+			Help:           "Number of NVIDIA BMM API requests by operation and HTTP status code.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation", "code"},
+	)
+
+	apiRequestDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "api_request_duration_seconds",
+			Help:           "Latency of NVIDIA BMM API requests by operation and HTTP status code.",
+			Buckets:        metrics.ExponentialBuckets(0.01, 2, 12),
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation", "code"},
+	)
+
+	apiRateLimited = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "api_rate_limited_total",
+			Help:           "Number of NVIDIA BMM API requests rejected with HTTP 429.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation"},
+	)
+
+	apiRetries = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "api_retries_total",
+			Help:           "Number of NVIDIA BMM API requests repeating a request that failed with an error, HTTP 429 or 5xx, e.g. when a controller requeues a node.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation"},
+	)
+
+	cacheLookups = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "cache_lookups_total",
+			Help:           "Number of provider cache lookups by cache and result (hit or miss).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"cache", "result"},
+	)
+
+	instanceDecisions = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "instance_decisions_total",
+			Help:           "Number of InstanceExists=false and InstanceShutdown=true decisions by reason.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"decision", "reason"},
+	)
+
+	providerIDMismatches = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "provider_id_mismatches_total",
+			Help:           "Number of node provider IDs not matching the configured org, tenant or sites, or in the legacy format, by segment and applied policy.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"segment", "policy"},
+	)
+
+	dryRunChanges = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "dry_run_changes_total",
+			Help:           "Number of distinct node changes reported and not applied in node lifecycle dry-run mode, by change.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"change"},
+	)
+
+	deletionGuardTripped = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "deletion_guard_tripped",
+			Help:           "Whether the node deletion guard is tripped and blocks node deletions (1) or not (0).",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	deletionGuardBlocked = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "deletion_guard_blocked_total",
+			Help:           "Number of InstanceExists calls answered with an error instead of false by the tripped node deletion guard.",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	powerActions = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      metricsSubsystem,
+			Name:           "power_actions_total",
+			Help:           "Number of power actions requested on instances by action and result (succeeded, failed or unsupported).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"action", "result"},
+	)
+
+	registerMetricsOnce sync.Once
+)
+
+// registerMetrics registers the provider metrics with the legacy registry served on /metrics
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		legacyregistry.MustRegister(
+			apiRequests,
+			apiRequestDuration,
+			apiRateLimited,
+			apiRetries,
+			cacheLookups,
+			instanceDecisions,
+			providerIDMismatches,
+			dryRunChanges,
+			deletionGuardTripped,
+			deletionGuardBlocked,
+			powerActions,
+		)
+	})
+}
+
+// recordInstanceDecision counts a decision that can lead to a node being deleted or tainted
+func recordInstanceDecision(decision, reason string) {
+	instanceDecisions.WithLabelValues(decision, reason).Inc()
+}
+
+// recordProviderIDMismatch counts a provider ID segment that did not match the configuration
+func recordProviderIDMismatch(segment string, policy ProviderIDPolicy) {
+	providerIDMismatches.WithLabelValues(segment, string(policy)).Inc()
+}
+
+// statusCodeOf returns the HTTP status code of a generated client response, or 0 for a nil response
+func statusCodeOf[R any, P interface {
+	*R
+	StatusCode() int
+}](resp P) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode()
+}
+
+// instrumentedClient wraps an NVIDIA BMM client to record metrics and a client span
+// for every call. Calls are not retried, the controllers calling the provider retry them, and
+// a request repeating one that failed is counted as a retry.
+type instrumentedClient struct {
+	next   NvidiaBMMClientInterface
+	tracer trace.Tracer
+	now    func() time.Time
+
+	// failed holds the time of the last failure of the requests that have not succeeded since
+	mu     sync.Mutex
+	failed map[string]time.Time
+}
+
+// newInstrumentedClient wraps the given client with metrics and tracing
+func newInstrumentedClient(next NvidiaBMMClientInterface, tp trace.TracerProvider) *instrumentedClient {
+	registerMetrics()
+	return &instrumentedClient{
+		next:   next,
+		tracer: tracerFrom(tp),
+		now:    time.Now,
+		failed: make(map[string]time.Time),
+	}
+}
+
+// GetInstanceWithResponse implements NvidiaBMMClientInterface
+func (c *instrumentedClient) GetInstanceWithResponse(
+	ctx context.Context, org string, instanceId uuid.UUID,
+	params *restclient.GetInstanceParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetInstanceResponse, error) {
+	var resp *restclient.GetInstanceResponse
+	editors := withTraceContext(reqEditors)
+	err := c.call(ctx, "GetInstance", requestKey(org, instanceId), func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.next.GetInstanceWithResponse(ctx, org, instanceId, params, editors...)
+		return statusCodeOf(resp), err
+	})
+	return resp, err
+}
+
+// GetAllInstanceWithResponse implements NvidiaBMMClientInterface
+func (c *instrumentedClient) GetAllInstanceWithResponse(
+	ctx context.Context, org string,
+	params *restclient.GetAllInstanceParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetAllInstanceResponse, error) {
+	var resp *restclient.GetAllInstanceResponse
+	editors := withTraceContext(reqEditors)
+	err := c.call(ctx, "GetAllInstance", instanceListKey(org, params), func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.next.GetAllInstanceWithResponse(ctx, org, params, editors...)
+		return statusCodeOf(resp), err
+	})
+	return resp, err
+}
+
+// GetAllSiteWithResponse implements NvidiaBMMClientInterface
+func (c *instrumentedClient) GetAllSiteWithResponse(
+	ctx context.Context, org string,
+	params *restclient.GetAllSiteParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetAllSiteResponse, error) {
+	var resp *restclient.GetAllSiteResponse
+	editors := withTraceContext(reqEditors)
+	err := c.call(ctx, "GetAllSite", siteListKey(org, params), func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.next.GetAllSiteWithResponse(ctx, org, params, editors...)
+		return statusCodeOf(resp), err
+	})
+	return resp, err
+}
+
+// GetInstanceTypeWithResponse implements NvidiaBMMClientInterface
+func (c *instrumentedClient) GetInstanceTypeWithResponse(
+	ctx context.Context, org string, instanceTypeId uuid.UUID,
+	params *restclient.GetInstanceTypeParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetInstanceTypeResponse, error) {
+	var resp *restclient.GetInstanceTypeResponse
+	editors := withTraceContext(reqEditors)
+	err := c.call(ctx, "GetInstanceType", requestKey(org, instanceTypeId), func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.next.GetInstanceTypeWithResponse(ctx, org, instanceTypeId, params, editors...)
+		return statusCodeOf(resp), err
+	})
+	return resp, err
+}
+
+// GetSubnetWithResponse implements NvidiaBMMClientInterface
+func (c *instrumentedClient) GetSubnetWithResponse(
+	ctx context.Context, org string, subnetId uuid.UUID,
+	params *restclient.GetSubnetParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetSubnetResponse, error) {
+	var resp *restclient.GetSubnetResponse
+	editors := withTraceContext(reqEditors)
+	err := c.call(ctx, "GetSubnet", requestKey(org, subnetId), func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.next.GetSubnetWithResponse(ctx, org, subnetId, params, editors...)
+		return statusCodeOf(resp), err
+	})
+	return resp, err
+}
+
+// GetSiteWithResponse implements NvidiaBMMClientInterface
+func (c *instrumentedClient) GetSiteWithResponse(
+	ctx context.Context, org string, siteId uuid.UUID,
+	params *restclient.GetSiteParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetSiteResponse, error) {
+	var resp *restclient.GetSiteResponse
+	editors := withTraceContext(reqEditors)
+	err := c.call(ctx, "GetSite", requestKey(org, siteId), func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.next.GetSiteWithResponse(ctx, org, siteId, params, editors...)
+		return statusCodeOf(resp), err
+	})
+	return resp, err
+}
+
+// GetCurrentTenantWithResponse implements NvidiaBMMClientInterface
+func (c *instrumentedClient) GetCurrentTenantWithResponse(
+	ctx context.Context, org string,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetCurrentTenantResponse, error) {
+	var resp *restclient.GetCurrentTenantResponse
+	editors := withTraceContext(reqEditors)
+	err := c.call(ctx, "GetCurrentTenant", requestKey(org), func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.next.GetCurrentTenantWithResponse(ctx, org, editors...)
+		return statusCodeOf(resp), err
+	})
+	return resp, err
+}
+
+// GetVpcPrefixWithResponse implements NvidiaBMMClientInterface
+func (c *instrumentedClient) GetVpcPrefixWithResponse(
+	ctx context.Context, org string, vpcPrefixId uuid.UUID,
+	params *restclient.GetVpcPrefixParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetVpcPrefixResponse, error) {
+	var resp *restclient.GetVpcPrefixResponse
+	editors := withTraceContext(reqEditors)
+	err := c.call(ctx, "GetVpcPrefix", requestKey(org, vpcPrefixId), func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.next.GetVpcPrefixWithResponse(ctx, org, vpcPrefixId, params, editors...)
+		return statusCodeOf(resp), err
+	})
+	return resp, err
+}
+
+// UpdateInstanceWithResponse implements NvidiaBMMClientInterface
+func (c *instrumentedClient) UpdateInstanceWithResponse(
+	ctx context.Context, org string, instanceId uuid.UUID,
+	body restclient.UpdateInstanceJSONRequestBody,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.UpdateInstanceResponse, error) {
+	var resp *restclient.UpdateInstanceResponse
+	editors := withTraceContext(reqEditors)
+	err := c.call(ctx, "UpdateInstance", requestKey(org, instanceId), func(ctx context.Context) (int, error) {
+		var err error
+		resp, err = c.next.UpdateInstanceWithResponse(ctx, org, instanceId, body, editors...)
+		return statusCodeOf(resp), err
+	})
+	return resp, err
+}
+
+// call runs a single BMM operation, recording its latency, status code, rate limiting and
+// whether it retries a failed request with the same key
+func (c *instrumentedClient) call(ctx context.Context, operation, key string, do func(context.Context) (int, error)) error {
+	start := time.Now()
+	spanCtx, span := c.tracer.Start(ctx, "BMM "+operation, trace.WithSpanKind(trace.SpanKindClient))
+	statusCode, err := do(spanCtx)
+
+	code := strconv.Itoa(statusCode)
+	if err != nil {
+		code = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+		if statusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, http.StatusText(statusCode))
+		}
+	}
+	span.End()
+	apiRequests.WithLabelValues(operation, code).Inc()
+	apiRequestDuration.WithLabelValues(operation, code).Observe(time.Since(start).Seconds())
+
+	if err == nil && statusCode == http.StatusTooManyRequests {
+		apiRateLimited.WithLabelValues(operation).Inc()
+	}
+	failed := err != nil || statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+	if c.trackRetry(operation+"/"+key, failed) {
+		apiRetries.WithLabelValues(operation).Inc()
+	}
+	return err
+}
+
+// trackRetry records the outcome of a request, and reports whether it repeats a request that
+// failed within apiRetryWindow
+func (c *instrumentedClient) trackRetry(key string, failed bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, last := range c.failed {
+		if now.Sub(last) > apiRetryWindow {
+			delete(c.failed, k)
+		}
+	}
+	_, retry := c.failed[key]
+	if failed {
+		c.failed[key] = now
+	} else {
+		delete(c.failed, key)
+	}
+	return retry
+}
+
+// requestKey identifies the requests of an operation, so that repeated requests can be told apart
+func requestKey(values ...interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		parts = append(parts, fmt.Sprint(value))
+	}
+	return strings.Join(parts, "/")
+}
+
+// instanceListKey identifies an instance list request by its filters and page
+func instanceListKey(org string, params *restclient.GetAllInstanceParams) string {
+	if params == nil {
+		return requestKey(org)
+	}
+	return requestKey(org, deref(params.SiteId), deref(params.TenantId), deref(params.Query), deref(params.PageNumber))
+}
+
+// siteListKey identifies a site list request by its query and page
+func siteListKey(org string, params *restclient.GetAllSiteParams) string {
+	if params == nil {
+		return requestKey(org)
+	}
+	return requestKey(org, deref(params.Query), deref(params.PageNumber))
+}
+
+// deref returns the value of an optional request parameter, or its zero value when unset
+func deref[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
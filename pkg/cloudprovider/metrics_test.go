@@ -0,0 +1,184 @@
+package cloudprovider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/testutil"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+func TestInstrumentedClient_CountsRateLimited(t *testing.T) {
+	registerMetrics()
+	apiRequests.Reset()
+	apiRequestDuration.Reset()
+	apiRateLimited.Reset()
+	apiRetries.Reset()
+
+	instanceID := uuid.New()
+	statuses := []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK}
+	calls := 0
+	client := newInstrumentedClient(&mockNvidiaBMMClient{
+		getInstance: func(
+			ctx context.Context, org string, instanceId uuid.UUID,
+			params *restclient.GetInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetInstanceResponse, error) {
+			status := statuses[calls]
+			calls++
+			return &restclient.GetInstanceResponse{
+				HTTPResponse: &http.Response{StatusCode: status},
+				JSON200:      &restclient.Instance{Id: &instanceID},
+			}, nil
+		},
+	}, nil)
+
+	// Rate-limited and unavailable responses are returned as is, without retries
+	for _, want := range statuses {
+		resp, err := client.GetInstanceWithResponse(context.Background(), "test-org", instanceID, nil)
+		if err != nil {
+			t.Fatalf("GetInstanceWithResponse() failed: %v", err)
+		}
+		if resp.StatusCode() != want {
+			t.Errorf("Expected status %d, got %d", want, resp.StatusCode())
+		}
+	}
+	if calls != len(statuses) {
+		t.Errorf("Expected %d calls, got %d", len(statuses), calls)
+	}
+
+	expectCounter(t, apiRequests.WithLabelValues("GetInstance", "429"), 1)
+	expectCounter(t, apiRequests.WithLabelValues("GetInstance", "503"), 1)
+	expectCounter(t, apiRequests.WithLabelValues("GetInstance", "200"), 1)
+	expectCounter(t, apiRateLimited.WithLabelValues("GetInstance"), 1)
+	// The requests following the rate-limited and unavailable responses retry them
+	expectCounter(t, apiRetries.WithLabelValues("GetInstance"), 2)
+
+	count, err := testutil.GetHistogramMetricCount(apiRequestDuration.WithLabelValues("GetInstance", "200"))
+	if err != nil {
+		t.Fatalf("Failed to read latency histogram: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 latency observation, got %d", count)
+	}
+}
+
+func TestInstrumentedClient_CountsRetries(t *testing.T) {
+	registerMetrics()
+	apiRetries.Reset()
+
+	failing := map[uuid.UUID]bool{}
+	client := newInstrumentedClient(&mockNvidiaBMMClient{
+		getInstance: func(
+			ctx context.Context, org string, instanceId uuid.UUID,
+			params *restclient.GetInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetInstanceResponse, error) {
+			status := http.StatusOK
+			if failing[instanceId] {
+				status = http.StatusInternalServerError
+			}
+			return &restclient.GetInstanceResponse{HTTPResponse: &http.Response{StatusCode: status}}, nil
+		},
+	}, nil)
+	now := time.Now()
+	client.now = func() time.Time { return now }
+	get := func(instanceID uuid.UUID) {
+		t.Helper()
+		if _, err := client.GetInstanceWithResponse(context.Background(), "test-org", instanceID, nil); err != nil {
+			t.Fatalf("GetInstanceWithResponse() failed: %v", err)
+		}
+	}
+
+	// Requests following a successful one or failed requests of other instances are not retries
+	instance1, instance2 := uuid.New(), uuid.New()
+	get(instance1)
+	get(instance1)
+	failing[instance2] = true
+	get(instance2)
+	get(instance1)
+	expectCounter(t, apiRetries.WithLabelValues("GetInstance"), 0)
+
+	// A requeued node repeats the failed request
+	get(instance2)
+	failing[instance2] = false
+	get(instance2)
+	get(instance2)
+	expectCounter(t, apiRetries.WithLabelValues("GetInstance"), 2)
+
+	// Failures are forgotten after the retry window
+	failing[instance2] = true
+	get(instance2)
+	now = now.Add(apiRetryWindow + time.Minute)
+	get(instance2)
+	expectCounter(t, apiRetries.WithLabelValues("GetInstance"), 2)
+}
+
+func TestInstanceDecisionMetrics(t *testing.T) {
+	registerMetrics()
+	instanceDecisions.Reset()
+
+	instanceID := uuid.New()
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Spec: v1.NodeSpec{
+			ProviderID: providerid.NewProviderID("test-org", "test-tenant", "test-site", instanceID).String(),
+		},
+	}
+
+	status := restclient.InstanceStatus("Terminated")
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient: &mockNvidiaBMMClient{
+			getInstance: func(
+				ctx context.Context, org string, instanceId uuid.UUID,
+				params *restclient.GetInstanceParams,
+				reqEditors ...restclient.RequestEditorFn,
+			) (*restclient.GetInstanceResponse, error) {
+				return &restclient.GetInstanceResponse{
+					HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+					JSON200:      &restclient.Instance{Id: &instanceID, Status: &status},
+				}, nil
+			},
+		},
+		orgName: "test-org",
+	}
+	if shutdown, err := cloud.InstanceShutdown(context.Background(), node); err != nil || !shutdown {
+		t.Fatalf("InstanceShutdown() = %v, %v, want true", shutdown, err)
+	}
+	expectCounter(t, instanceDecisions.WithLabelValues(decisionInstanceShutdown, "Terminated"), 1)
+
+	cloud.nvidiaBmmClient = &mockNvidiaBMMClient{
+		getInstance: func(
+			ctx context.Context, org string, instanceId uuid.UUID,
+			params *restclient.GetInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetInstanceResponse, error) {
+			return &restclient.GetInstanceResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusNotFound},
+			}, nil
+		},
+	}
+	if exists, err := cloud.InstanceExists(context.Background(), node); err != nil || exists {
+		t.Fatalf("InstanceExists() = %v, %v, want false", exists, err)
+	}
+	expectCounter(t, instanceDecisions.WithLabelValues(decisionInstanceNotFound, "404"), 1)
+}
+
+func expectCounter(t *testing.T, counter metrics.CounterMetric, want float64) {
+	t.Helper()
+	got, err := testutil.GetCounterMetricValue(counter)
+	if err != nil {
+		t.Fatalf("Failed to read counter: %v", err)
+	}
+	if got != want {
+		t.Errorf("Expected counter value %v, got %v", want, got)
+	}
+}
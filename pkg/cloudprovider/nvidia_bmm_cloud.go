@@ -4,14 +4,21 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
-	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/component-base/tracing"
 	"k8s.io/klog/v2"
 
 	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmrecord"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/poweraction"
 )
 
 const (
@@ -24,6 +31,10 @@ const (
 	EnvToken    = "NVIDIA_BMM_TOKEN"
 	EnvSiteID   = "NVIDIA_BMM_SITE_ID"
 	EnvTenantID = "NVIDIA_BMM_TENANT_ID"
+
+	// EnvRecordFile records the NVIDIA BMM API interactions, redacted, into a golden file,
+	// up to bmmrecord.DefaultMaxInteractions. It is meant for short capture sessions.
+	EnvRecordFile = "NVIDIA_BMM_RECORD_FILE"
 )
 
 // NvidiaBMMClientInterface defines the methods we need from the NVIDIA BMM REST client
@@ -33,14 +44,67 @@ type NvidiaBMMClientInterface interface {
 		params *restclient.GetInstanceParams,
 		reqEditors ...restclient.RequestEditorFn,
 	) (*restclient.GetInstanceResponse, error)
+	GetAllInstanceWithResponse(
+		ctx context.Context, org string,
+		params *restclient.GetAllInstanceParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetAllInstanceResponse, error)
+	GetSiteWithResponse(
+		ctx context.Context, org string, siteId uuid.UUID,
+		params *restclient.GetSiteParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetSiteResponse, error)
+	GetAllSiteWithResponse(
+		ctx context.Context, org string,
+		params *restclient.GetAllSiteParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetAllSiteResponse, error)
+	GetCurrentTenantWithResponse(
+		ctx context.Context, org string,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetCurrentTenantResponse, error)
+	GetInstanceTypeWithResponse(
+		ctx context.Context, org string, instanceTypeId uuid.UUID,
+		params *restclient.GetInstanceTypeParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetInstanceTypeResponse, error)
+	GetSubnetWithResponse(
+		ctx context.Context, org string, subnetId uuid.UUID,
+		params *restclient.GetSubnetParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetSubnetResponse, error)
+	GetVpcPrefixWithResponse(
+		ctx context.Context, org string, vpcPrefixId uuid.UUID,
+		params *restclient.GetVpcPrefixParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetVpcPrefixResponse, error)
+	UpdateInstanceWithResponse(
+		ctx context.Context, org string, instanceId uuid.UUID,
+		body restclient.UpdateInstanceJSONRequestBody,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.UpdateInstanceResponse, error)
 }
 
 // NvidiaBMMCloud implements the Kubernetes cloud provider interface for NVIDIA BMM
 type NvidiaBMMCloud struct {
-	nvidiaBmmClient NvidiaBMMClientInterface
-	orgName         string
-	siteID          string
-	tenantID        string
+	nvidiaBmmClient     NvidiaBMMClientInterface
+	orgName             string
+	siteID              string
+	tenantID            string
+	requestTimeout      time.Duration
+	providerIDConfig    ProviderIDConfig
+	nodeIPAMConfig      NodeIPAMConfig
+	outOfService        OutOfServiceConfig
+	powerActions        PowerActionsConfig
+	dryRun              *dryRunReporter
+	deletionGuard       *deletionGuard
+	sites               *siteCache
+	instanceList        *instanceListCache
+	eventRecorder       record.EventRecorder
+	tracerProvider      tracing.TracerProvider
+	deletionGracePeriod *deletionGracePeriod
+	kubeClient          kubernetes.Interface
+	providerIDWarnings  sync.Map
 }
 
 func init() {
@@ -52,7 +116,7 @@ func init() {
 // NewNvidiaBMMCloud creates a new NVIDIA BMM cloud provider instance
 func NewNvidiaBMMCloud(config io.Reader) (cloudprovider.Interface, error) {
 	// Parse configuration
-	cfg, err := parseConfig(config)
+	cfg, metadata, err := parseConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
@@ -62,23 +126,64 @@ func NewNvidiaBMMCloud(config io.Reader) (cloudprovider.Interface, error) {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
+	cloud, err := newCloudFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Report the effective configuration on /configz
+	registerConfigz(newEffectiveConfig(cfg, metadata))
+
+	klog.InfoS("NVIDIA BMM cloud provider initialized", "org", cfg.API.OrgName, "site", cfg.Cluster.SiteID)
+
+	return cloud, nil
+}
+
+// newCloudFromConfig creates the cloud provider of a validated configuration
+func newCloudFromConfig(cfg *Config) (*NvidiaBMMCloud, error) {
 	// Create NVIDIA BMM API client
+	var clientOpts []restclient.ClientOption
+	if recordFile := os.Getenv(EnvRecordFile); recordFile != "" {
+		klog.InfoS("Recording NVIDIA BMM API interactions", "path", recordFile,
+			"maxInteractions", bmmrecord.DefaultMaxInteractions)
+		recorder := bmmrecord.NewRecorder(recordFile, nil, cfg.API.Token)
+		clientOpts = append(clientOpts, restclient.WithHTTPClient(&http.Client{Transport: recorder}))
+	}
 	nvidiaBmmClient, err := restclient.NewClientWithAuth(
-		cfg.Endpoint,
-		cfg.Token,
+		cfg.API.Endpoint,
+		cfg.API.Token,
+		clientOpts...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create NVIDIA BMM client: %w", err)
 	}
 
-	klog.Infof("NVIDIA BMM cloud provider initialized for org=%s, site=%s", cfg.OrgName, cfg.SiteID)
+	tracerProvider, err := newTracerProvider(cfg.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracer provider: %w", err)
+	}
 
-	return &NvidiaBMMCloud{
-		nvidiaBmmClient: nvidiaBmmClient,
-		orgName:         cfg.OrgName,
-		siteID:          cfg.SiteID,
-		tenantID:        cfg.TenantID,
-	}, nil
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient:     newInstrumentedClient(nvidiaBmmClient, tracerProvider),
+		orgName:             cfg.API.OrgName,
+		siteID:              cfg.Cluster.SiteID,
+		tenantID:            cfg.Cluster.TenantID,
+		requestTimeout:      cfg.API.RequestTimeout,
+		providerIDConfig:    cfg.ProviderID,
+		nodeIPAMConfig:      cfg.NodeIPAM,
+		outOfService:        cfg.NodeLifecycle.OutOfService,
+		powerActions:        cfg.PowerActions,
+		sites:               newSiteCache(siteCacheTTL),
+		instanceList:        newInstanceListCache(instanceListCacheTTL),
+		tracerProvider:      tracerProvider,
+		deletionGuard:       newDeletionGuard(cfg.NodeLifecycle.DeletionGuard),
+		deletionGracePeriod: newDeletionGracePeriod(cfg.NodeLifecycle.DeletionGracePeriod),
+	}
+	if cfg.NodeLifecycle.DryRun {
+		klog.InfoS("Node lifecycle dry run enabled, nodes will not be deleted, tainted or updated")
+		cloud.dryRun = newDryRunReporter()
+	}
+	return cloud, nil
 }
 
 // NewNvidiaBMMCloudWithClient creates a new NVIDIA BMM cloud provider with injected client (for testing)
@@ -86,16 +191,77 @@ func NewNvidiaBMMCloudWithClient(
 	client NvidiaBMMClientInterface, orgName, siteID, tenantID string,
 ) cloudprovider.Interface {
 	return &NvidiaBMMCloud{
-		nvidiaBmmClient: client,
+		nvidiaBmmClient: newInstrumentedClient(client, nil),
 		orgName:         orgName,
 		siteID:          siteID,
 		tenantID:        tenantID,
+		requestTimeout:  DefaultRequestTimeout,
+		providerIDConfig: ProviderIDConfig{
+			MismatchPolicy: ProviderIDPolicyWarn,
+			LegacyPolicy:   ProviderIDPolicyWarn,
+		},
+		nodeIPAMConfig: NodeIPAMConfig{NodeMaskSize: DefaultNodeMaskSize},
+		outOfService:   OutOfServiceConfig{After: DefaultOutOfServiceAfter},
+		powerActions:   PowerActionsConfig{MinInterval: DefaultPowerActionMinInterval, MaxPerHour: DefaultPowerActionsPerHour},
+		sites:          newSiteCache(siteCacheTTL),
+		instanceList:   newInstanceListCache(instanceListCacheTTL),
 	}
 }
 
 // Initialize provides the cloud provider with the client builder and may be called multiple times
 func (c *NvidiaBMMCloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
-	klog.Info("Initializing NVIDIA BMM cloud provider")
+	klog.InfoS("Initializing NVIDIA BMM cloud provider", "site", c.siteID)
+
+	if c.eventRecorder == nil {
+		c.eventRecorder = newEventRecorder(clientBuilder, stop)
+	}
+
+	if c.kubeClient == nil {
+		client, err := clientBuilder.Client(eventClientName)
+		if err != nil {
+			klog.ErrorS(err, "Unable to create client, node annotations are disabled")
+		} else {
+			c.kubeClient = client
+		}
+	}
+
+	if c.deletionGuard != nil {
+		c.deletionGuard.start(clientBuilder, stop)
+	}
+
+	if c.tracerProvider != nil {
+		go func() {
+			<-stop
+			if err := c.tracerProvider.Shutdown(context.Background()); err != nil {
+				klog.ErrorS(err, "Failed to shut down tracer provider")
+			}
+		}()
+	}
+}
+
+// TenantID returns the configured NVIDIA BMM tenant ID
+func (c *NvidiaBMMCloud) TenantID() string {
+	return c.tenantID
+}
+
+// DryRun reports whether the node lifecycle dry run is enabled, in which case the NVIDIA BMM
+// controllers must not change the nodes either
+func (c *NvidiaBMMCloud) DryRun() bool {
+	return c.dryRun != nil
+}
+
+// OutOfServiceAfter returns how long an instance stays shut down before the out-of-service
+// controller taints its node
+func (c *NvidiaBMMCloud) OutOfServiceAfter() time.Duration {
+	return c.outOfService.After
+}
+
+// PowerActionLimits returns the limits of the power action controller
+func (c *NvidiaBMMCloud) PowerActionLimits() poweraction.Limits {
+	return poweraction.Limits{
+		MinInterval: c.powerActions.MinInterval,
+		MaxPerHour:  c.powerActions.MaxPerHour,
+	}
 }
 
 // LoadBalancer returns a LoadBalancer interface
@@ -140,84 +306,10 @@ func (c *NvidiaBMMCloud) HasClusterID() bool {
 	return true
 }
 
-// Config holds the NVIDIA BMM cloud provider configuration
-type Config struct {
-	// Endpoint is the NVIDIA BMM API endpoint URL
-	Endpoint string `yaml:"endpoint"`
-
-	// OrgName is the NVIDIA BMM organization name
-	OrgName string `yaml:"orgName"`
-
-	// Token is the NVIDIA BMM API authentication token
-	Token string `yaml:"token"`
-
-	// SiteID is the NVIDIA BMM site UUID
-	SiteID string `yaml:"siteId"`
-
-	// TenantID is the NVIDIA BMM tenant UUID
-	TenantID string `yaml:"tenantId"`
-}
-
-// Validate checks if the configuration is valid
-func (c *Config) Validate() error {
-	if c.Endpoint == "" {
-		return fmt.Errorf("endpoint is required")
-	}
-	if c.OrgName == "" {
-		return fmt.Errorf("orgName is required")
-	}
-	if c.Token == "" {
-		return fmt.Errorf("token is required")
-	}
-	if c.SiteID == "" {
-		return fmt.Errorf("siteId is required")
-	}
-	if c.TenantID == "" {
-		return fmt.Errorf("tenantId is required")
-	}
-	return nil
-}
-
-// parseConfig parses the cloud provider configuration from YAML or environment variables
-func parseConfig(config io.Reader) (*Config, error) {
-	cfg := &Config{}
-
-	// First, try to parse from config file (YAML)
-	if config != nil {
-		data, err := io.ReadAll(config)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read config: %w", err)
-		}
-
-		if len(data) > 0 {
-			if err := yaml.Unmarshal(data, cfg); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal YAML config: %w", err)
-			}
-			klog.V(4).Info("Loaded configuration from YAML file")
-		}
-	}
-
-	// Override with environment variables if present
-	if endpoint := os.Getenv(EnvEndpoint); endpoint != "" {
-		cfg.Endpoint = endpoint
-		klog.V(4).Infof("Using endpoint from environment: %s", endpoint)
-	}
-	if orgName := os.Getenv(EnvOrgName); orgName != "" {
-		cfg.OrgName = orgName
-		klog.V(4).Infof("Using orgName from environment: %s", orgName)
+// apiContext bounds a single NVIDIA BMM API call with the configured request timeout
+func (c *NvidiaBMMCloud) apiContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
-	if token := os.Getenv(EnvToken); token != "" {
-		cfg.Token = token
-		klog.V(4).Info("Using token from environment")
-	}
-	if siteID := os.Getenv(EnvSiteID); siteID != "" {
-		cfg.SiteID = siteID
-		klog.V(4).Infof("Using siteID from environment: %s", siteID)
-	}
-	if tenantID := os.Getenv(EnvTenantID); tenantID != "" {
-		cfg.TenantID = tenantID
-		klog.V(4).Infof("Using tenantID from environment: %s", tenantID)
-	}
-
-	return cfg, nil
+	return context.WithTimeout(ctx, c.requestTimeout)
 }
@@ -1,94 +1,9 @@
 package cloudprovider
 
 import (
-	"strings"
 	"testing"
 )
 
-func TestConfigValidation(t *testing.T) {
-	tests := []struct {
-		name    string
-		config  *Config
-		wantErr bool
-	}{
-		{
-			name: "valid config",
-			config: &Config{
-				Endpoint: "https://api.carbide.test",
-				OrgName:  "test-org",
-				Token:    "test-token",
-				SiteID:   "test-site",
-				TenantID: "test-tenant",
-			},
-			wantErr: false,
-		},
-		{
-			name: "missing endpoint",
-			config: &Config{
-				OrgName:  "test-org",
-				Token:    "test-token",
-				SiteID:   "test-site",
-				TenantID: "test-tenant",
-			},
-			wantErr: true,
-		},
-		{
-			name: "missing orgName",
-			config: &Config{
-				Endpoint: "https://api.carbide.test",
-				Token:    "test-token",
-				SiteID:   "test-site",
-				TenantID: "test-tenant",
-			},
-			wantErr: true,
-		},
-		{
-			name: "missing token",
-			config: &Config{
-				Endpoint: "https://api.carbide.test",
-				OrgName:  "test-org",
-				SiteID:   "test-site",
-				TenantID: "test-tenant",
-			},
-			wantErr: true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := tt.config.Validate()
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func TestParseConfig_YAML(t *testing.T) {
-	yamlConfig := `
-endpoint: "https://api.carbide.test"
-orgName: "test-org"
-token: "test-token"
-siteId: "test-site"
-tenantId: "test-tenant"
-`
-
-	config, err := parseConfig(strings.NewReader(yamlConfig))
-	if err != nil {
-		t.Fatalf("parseConfig() failed: %v", err)
-	}
-
-	if config.Endpoint != "https://api.carbide.test" {
-		t.Errorf("Expected endpoint=https://api.carbide.test, got %s", config.Endpoint)
-	}
-	if config.OrgName != "test-org" {
-		t.Errorf("Expected orgName=test-org, got %s", config.OrgName)
-	}
-	if config.Token != "test-token" {
-		t.Errorf("Expected token=test-token, got %s", config.Token)
-	}
-}
-
 func TestProviderName(t *testing.T) {
 	cloud := &NvidiaBMMCloud{}
 	if cloud.ProviderName() != ProviderName {
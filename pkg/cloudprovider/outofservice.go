@@ -0,0 +1,41 @@
+package cloudprovider
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/outofservice"
+)
+
+// runningStatus is the status of an instance that is up
+const runningStatus = "Ready"
+
+// InstancePowerState implements outofservice.Source. Instances in a shutdown status are off,
+// ready instances are running, and instances in any other status are transitioning.
+func (c *NvidiaBMMCloud) InstancePowerState(ctx context.Context, node *v1.Node) (outofservice.PowerState, string, error) {
+	ctx, span := c.startSpan(ctx, "InstancePowerState", nodeSpanAttributes(node)...)
+	defer span.End()
+
+	orgName, instanceUUID, err := c.instanceForNode(ctx, node)
+	if err != nil {
+		return "", "", err
+	}
+	instance, err := c.getInstance(ctx, orgName, instanceUUID)
+	if err != nil {
+		return "", "", err
+	}
+	if instance.Status == nil {
+		return outofservice.PowerStateTransitioning, "", nil
+	}
+
+	status := *instance.Status
+	switch {
+	case isShutdownStatus(status):
+		return outofservice.PowerStateOff, string(status), nil
+	case status == runningStatus:
+		return outofservice.PowerStateRunning, string(status), nil
+	default:
+		return outofservice.PowerStateTransitioning, string(status), nil
+	}
+}
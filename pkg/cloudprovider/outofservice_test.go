@@ -0,0 +1,53 @@
+package cloudprovider
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/outofservice"
+)
+
+func TestInstancePowerState(t *testing.T) {
+	fake := bmmfake.NewServer("test-org", bmmfake.WithToken("test-token"))
+	defer fake.Close()
+	fake.AddSite(restclient.Site{Id: &testSiteID, Name: ptr("test-site")})
+	instance := fake.AddInstance(restclient.Instance{Name: ptr("test-node"), SiteId: &testSiteID})
+	cloud := newFakeAPICloud(t, fake, "5s")
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Spec:       v1.NodeSpec{ProviderID: "nvidia-bmm://test-org/test-tenant/test-site/" + instance.Id.String()},
+	}
+
+	tests := []struct {
+		status restclient.InstanceStatus
+		want   outofservice.PowerState
+	}{
+		{status: "Ready", want: outofservice.PowerStateRunning},
+		{status: "Terminating", want: outofservice.PowerStateOff},
+		{status: "Error", want: outofservice.PowerStateOff},
+		{status: "Rebooting", want: outofservice.PowerStateTransitioning},
+		{status: "Provisioning", want: outofservice.PowerStateTransitioning},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			fake.SetInstanceStatus(*instance.Id, tt.status)
+			state, status, err := cloud.InstancePowerState(context.Background(), node)
+			if err != nil {
+				t.Fatalf("InstancePowerState() failed: %v", err)
+			}
+			if state != tt.want || status != string(tt.status) {
+				t.Errorf("InstancePowerState() = %s, %s, want %s, %s", state, status, tt.want, tt.status)
+			}
+		})
+	}
+
+	fake.DeleteInstance(*instance.Id)
+	if _, _, err := cloud.InstancePowerState(context.Background(), node); err == nil {
+		t.Error("Expected an error for a deleted instance")
+	}
+}
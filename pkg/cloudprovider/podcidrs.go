@@ -0,0 +1,141 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/nodeipam"
+)
+
+// NodePrefixes implements nodeipam.Source. The pod VPC prefixes attached to the interfaces of
+// the node instance are routed to it and reserved for its pods. Other VPC prefixes are the
+// networks interfaces take their IPs from, shared by instances, and are never used. Nodes
+// without a pod VPC prefix share the configured pod subnets, carved into blocks of the node
+// mask size.
+func (c *NvidiaBMMCloud) NodePrefixes(ctx context.Context, node *v1.Node) ([]nodeipam.Prefix, error) {
+	ctx, span := c.startSpan(ctx, "NodePrefixes", nodeSpanAttributes(node)...)
+	defer span.End()
+	logger := c.nodeLogger(ctx, node)
+
+	orgName, instanceUUID, err := c.instanceForNode(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	logger = logger.WithValues("instanceID", instanceUUID)
+	ctx = klog.NewContext(ctx, logger)
+
+	instance, err := c.getInstance(ctx, orgName, instanceUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	var prefixes []nodeipam.Prefix
+	if instance.Interfaces != nil {
+		for _, iface := range *instance.Interfaces {
+			if iface.VpcPrefixId == nil || !c.isPodVPCPrefix(*iface.VpcPrefixId) {
+				continue
+			}
+			prefix, err := c.getVpcPrefix(ctx, orgName, *iface.VpcPrefixId)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, nodeipam.Prefix{CIDR: prefix})
+		}
+	}
+	if len(prefixes) > 0 {
+		logger.V(4).Info("Using the pod VPC prefixes of the instance for pod CIDRs", "prefixes", prefixes)
+		return prefixes, nil
+	}
+
+	for _, subnet := range c.nodeIPAMConfig.PodSubnets {
+		subnetID, err := uuid.Parse(subnet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pod subnet UUID %q: %w", subnet, err)
+		}
+		prefix, err := c.getSubnet(ctx, orgName, subnetID)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, nodeipam.Prefix{CIDR: prefix, NodeMaskSize: c.nodeIPAMConfig.NodeMaskSize})
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("instance %s has no pod VPC prefix and nodeIPAM.podSubnets is empty", instanceUUID)
+	}
+	return prefixes, nil
+}
+
+// isPodVPCPrefix reports whether a VPC prefix is listed in nodeIPAM.podVpcPrefixes
+func (c *NvidiaBMMCloud) isPodVPCPrefix(vpcPrefixID uuid.UUID) bool {
+	for _, prefix := range c.nodeIPAMConfig.PodVPCPrefixes {
+		if id, err := uuid.Parse(prefix); err == nil && id == vpcPrefixID {
+			return true
+		}
+	}
+	return false
+}
+
+// getVpcPrefix fetches the prefix of a VPC prefix
+func (c *NvidiaBMMCloud) getVpcPrefix(ctx context.Context, orgName string, vpcPrefixID uuid.UUID) (netip.Prefix, error) {
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetVpcPrefixWithResponse(apiCtx, orgName, vpcPrefixID, nil)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("failed to get VPC prefix: %w", err)
+	}
+	if statusCodeOf(resp) != http.StatusOK || resp.JSON200 == nil {
+		return netip.Prefix{}, fmt.Errorf("failed to get VPC prefix %s, status %d", vpcPrefixID, statusCodeOf(resp))
+	}
+	if resp.JSON200.Prefix == nil {
+		return netip.Prefix{}, fmt.Errorf("VPC prefix %s has no prefix", vpcPrefixID)
+	}
+	return parseBMMPrefix(*resp.JSON200.Prefix, resp.JSON200.PrefixLength)
+}
+
+// getSubnet fetches the IPv4 prefix of a subnet
+func (c *NvidiaBMMCloud) getSubnet(ctx context.Context, orgName string, subnetID uuid.UUID) (netip.Prefix, error) {
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetSubnetWithResponse(apiCtx, orgName, subnetID, nil)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("failed to get subnet: %w", err)
+	}
+	if statusCodeOf(resp) != http.StatusOK || resp.JSON200 == nil {
+		return netip.Prefix{}, fmt.Errorf("failed to get subnet %s, status %d", subnetID, statusCodeOf(resp))
+	}
+	if resp.JSON200.Ipv4Prefix == nil {
+		return netip.Prefix{}, fmt.Errorf("subnet %s has no IPv4 prefix", subnetID)
+	}
+	return parseBMMPrefix(*resp.JSON200.Ipv4Prefix, resp.JSON200.PrefixLength)
+}
+
+// parseBMMPrefix parses a prefix returned by NVIDIA BMM, either in CIDR notation
+// or as an address with a separate prefix length
+func parseBMMPrefix(prefix string, length *int) (netip.Prefix, error) {
+	if strings.Contains(prefix, "/") {
+		parsed, err := netip.ParsePrefix(prefix)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid prefix %q: %w", prefix, err)
+		}
+		return parsed.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(prefix)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %q: %w", prefix, err)
+	}
+	if length == nil {
+		return netip.Prefix{}, fmt.Errorf("prefix %q has no prefix length", prefix)
+	}
+	parsed := netip.PrefixFrom(addr, *length)
+	if !parsed.IsValid() {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix length %d for %q", *length, prefix)
+	}
+	return parsed.Masked(), nil
+}
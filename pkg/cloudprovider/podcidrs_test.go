@@ -0,0 +1,143 @@
+package cloudprovider
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/nodeipam"
+)
+
+func TestNodePrefixes(t *testing.T) {
+	instanceID := uuid.New()
+	vpcPrefixID := uuid.New()
+	subnetID := uuid.New()
+
+	tests := []struct {
+		name           string
+		interfaces     []restclient.Interface
+		podVPCPrefixes []string
+		podSubnets     []string
+		want           []nodeipam.Prefix
+		wantErr        string
+	}{
+		{
+			name:           "pod VPC prefix of the instance interface",
+			interfaces:     []restclient.Interface{{SubnetId: &subnetID}, {VpcPrefixId: &vpcPrefixID}},
+			podVPCPrefixes: []string{vpcPrefixID.String()},
+			podSubnets:     []string{subnetID.String()},
+			want:           []nodeipam.Prefix{{CIDR: netip.MustParsePrefix("10.200.1.0/24")}},
+		},
+		{
+			name:       "VPC prefix the interface takes its IP from",
+			interfaces: []restclient.Interface{{VpcPrefixId: &vpcPrefixID}},
+			podSubnets: []string{subnetID.String()},
+			want:       []nodeipam.Prefix{{CIDR: netip.MustParsePrefix("10.128.0.0/16"), NodeMaskSize: DefaultNodeMaskSize}},
+		},
+		{
+			name:       "shared pod subnet",
+			interfaces: []restclient.Interface{{SubnetId: &subnetID}},
+			podSubnets: []string{subnetID.String()},
+			want:       []nodeipam.Prefix{{CIDR: netip.MustParsePrefix("10.128.0.0/16"), NodeMaskSize: DefaultNodeMaskSize}},
+		},
+		{
+			name:       "no VPC prefix and no pod subnet",
+			interfaces: []restclient.Interface{{SubnetId: &subnetID}},
+			wantErr:    "has no pod VPC prefix and nodeIPAM.podSubnets is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockNvidiaBMMClient{
+				getInstance: func(
+					ctx context.Context, org string, instanceId uuid.UUID,
+					params *restclient.GetInstanceParams,
+					reqEditors ...restclient.RequestEditorFn,
+				) (*restclient.GetInstanceResponse, error) {
+					return &restclient.GetInstanceResponse{
+						HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+						JSON200:      &restclient.Instance{Id: &instanceId, Interfaces: &tt.interfaces},
+					}, nil
+				},
+				getVpcPrefix: func(
+					ctx context.Context, org string, vpcPrefixId uuid.UUID,
+					params *restclient.GetVpcPrefixParams,
+					reqEditors ...restclient.RequestEditorFn,
+				) (*restclient.GetVpcPrefixResponse, error) {
+					return &restclient.GetVpcPrefixResponse{
+						HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+						JSON200:      &restclient.VpcPrefix{Id: &vpcPrefixId, Prefix: ptr("10.200.1.0"), PrefixLength: ptr(24)},
+					}, nil
+				},
+				getSubnet: func(
+					ctx context.Context, org string, subnetId uuid.UUID,
+					params *restclient.GetSubnetParams,
+					reqEditors ...restclient.RequestEditorFn,
+				) (*restclient.GetSubnetResponse, error) {
+					return &restclient.GetSubnetResponse{
+						HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+						JSON200:      &restclient.Subnet{Id: &subnetId, Ipv4Prefix: ptr("10.128.0.0/16")},
+					}, nil
+				},
+			}
+			cloud := NewNvidiaBMMCloudWithClient(client, "test-org", "test-site", "test-tenant").(*NvidiaBMMCloud)
+			cloud.nodeIPAMConfig.PodVPCPrefixes = tt.podVPCPrefixes
+			cloud.nodeIPAMConfig.PodSubnets = tt.podSubnets
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+				Spec:       v1.NodeSpec{ProviderID: "nvidia-bmm://test-org/test-tenant/test-site/" + instanceID.String()},
+			}
+
+			got, err := cloud.NodePrefixes(context.Background(), node)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NodePrefixes() error = %v, expected it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NodePrefixes() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NodePrefixes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBMMPrefix(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		length  *int
+		want    string
+		wantErr bool
+	}{
+		{prefix: "10.0.0.0/16", want: "10.0.0.0/16"},
+		{prefix: "10.0.0.0", length: ptr(16), want: "10.0.0.0/16"},
+		{prefix: "10.0.5.7", length: ptr(24), want: "10.0.5.0/24"},
+		{prefix: "fd00::", length: ptr(64), want: "fd00::/64"},
+		{prefix: "10.0.0.0", wantErr: true},
+		{prefix: "10.0.0.0", length: ptr(33), wantErr: true},
+		{prefix: "not-a-prefix/8", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseBMMPrefix(tt.prefix, tt.length)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseBMMPrefix(%q) error = %v, wantErr %v", tt.prefix, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("parseBMMPrefix(%q) = %s, want %s", tt.prefix, got, tt.want)
+		}
+	}
+}
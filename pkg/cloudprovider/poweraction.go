@@ -0,0 +1,59 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	v1 "k8s.io/api/core/v1"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/poweraction"
+)
+
+// Results recorded by the power action counter
+const (
+	powerActionSucceeded   = "succeeded"
+	powerActionFailed      = "failed"
+	powerActionUnsupported = "unsupported"
+)
+
+// PowerAction implements poweraction.Source. The NVIDIA BMM API reboots instances, it has no
+// operation to power cycle or power off an instance.
+func (c *NvidiaBMMCloud) PowerAction(ctx context.Context, node *v1.Node, action poweraction.Action) error {
+	ctx, span := c.startSpan(ctx, "PowerAction",
+		append(nodeSpanAttributes(node), attribute.String("bmm.power_action", string(action)))...)
+	defer span.End()
+
+	if action != poweraction.ActionReboot {
+		powerActions.WithLabelValues(string(action), powerActionUnsupported).Inc()
+		return fmt.Errorf("%w: the NVIDIA BMM API only supports %s", poweraction.ErrUnsupportedAction, poweraction.ActionReboot)
+	}
+
+	orgName, instanceUUID, err := c.instanceForNode(ctx, node)
+	if err != nil {
+		powerActions.WithLabelValues(string(action), powerActionFailed).Inc()
+		return err
+	}
+	logger := c.nodeLogger(ctx, node).WithValues("instanceID", instanceUUID, "action", action)
+
+	triggerReboot := true
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.UpdateInstanceWithResponse(apiCtx, orgName, instanceUUID,
+		restclient.UpdateInstanceJSONRequestBody{TriggerReboot: &triggerReboot})
+	if err != nil {
+		powerActions.WithLabelValues(string(action), powerActionFailed).Inc()
+		return fmt.Errorf("failed to reboot instance %s: %w", instanceUUID, err)
+	}
+	if statusCodeOf(resp) != http.StatusOK {
+		powerActions.WithLabelValues(string(action), powerActionFailed).Inc()
+		logger.V(2).Info("Failed to reboot instance", responseKeysAndValues(resp.HTTPResponse)...)
+		return fmt.Errorf("failed to reboot instance %s, status %d", instanceUUID, statusCodeOf(resp))
+	}
+
+	powerActions.WithLabelValues(string(action), powerActionSucceeded).Inc()
+	logger.Info("Requested instance reboot", responseKeysAndValues(resp.HTTPResponse)...)
+	return nil
+}
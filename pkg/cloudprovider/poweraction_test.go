@@ -0,0 +1,55 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/poweraction"
+)
+
+func TestPowerAction(t *testing.T) {
+	fake := bmmfake.NewServer("test-org", bmmfake.WithToken("test-token"))
+	defer fake.Close()
+	fake.AddSite(restclient.Site{Id: &testSiteID, Name: ptr("test-site")})
+	instance := fake.AddInstance(restclient.Instance{Name: ptr("test-node"), SiteId: &testSiteID})
+	cloud := newFakeAPICloud(t, fake, "5s")
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Spec:       v1.NodeSpec{ProviderID: "nvidia-bmm://test-org/test-tenant/test-site/" + instance.Id.String()},
+	}
+	ctx := context.Background()
+
+	if err := cloud.PowerAction(ctx, node, poweraction.ActionReboot); err != nil {
+		t.Fatalf("PowerAction(reboot) failed: %v", err)
+	}
+	var updates []bmmfake.Request
+	for _, req := range fake.Requests() {
+		if req.Operation == bmmfake.OpUpdateInstance {
+			updates = append(updates, req)
+		}
+	}
+	if len(updates) != 1 || !strings.Contains(updates[0].Body, `"triggerReboot":true`) {
+		t.Errorf("Expected a single reboot request, got %+v", updates)
+	}
+
+	for _, action := range []poweraction.Action{poweraction.ActionPowerCycle, poweraction.ActionPowerOff} {
+		if err := cloud.PowerAction(ctx, node, action); !errors.Is(err, poweraction.ErrUnsupportedAction) {
+			t.Errorf("PowerAction(%s) = %v, want ErrUnsupportedAction", action, err)
+		}
+	}
+	if count := fake.RequestCount(bmmfake.OpUpdateInstance); count != 1 {
+		t.Errorf("Expected no update request for unsupported actions, got %d", count)
+	}
+
+	fake.DeleteInstance(*instance.Id)
+	if err := cloud.PowerAction(ctx, node, poweraction.ActionReboot); err == nil {
+		t.Error("Expected an error for a deleted instance")
+	}
+}
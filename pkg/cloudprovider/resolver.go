@@ -0,0 +1,237 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+const (
+	// LabelGPUProduct is the instance label carrying the GPU model, as set by GPU feature discovery
+	LabelGPUProduct = "nvidia.com/gpu.product"
+
+	// LabelGPUCount is the instance label carrying the number of GPUs, as set by GPU feature discovery
+	LabelGPUCount = "nvidia.com/gpu.count"
+)
+
+// ErrInstanceNotFound is returned by Resolver.Resolve when NVIDIA BMM has no instance for a provider ID
+var ErrInstanceNotFound = errors.New("instance not found in NVIDIA BMM")
+
+// InstanceView is a typed view of an NVIDIA BMM instance
+type InstanceView struct {
+	// ProviderID is the provider ID the instance was resolved from
+	ProviderID string
+
+	// ID is the NVIDIA BMM instance UUID
+	ID uuid.UUID
+
+	// Name is the instance name
+	Name string
+
+	// Org is the NVIDIA BMM org the instance was looked up under
+	Org string
+
+	// SiteID is the UUID of the site running the instance, or of the provider ID site when
+	// NVIDIA BMM does not report it
+	SiteID uuid.UUID
+
+	// Zone and Region are the topology of the provider ID site, as set on nodes
+	Zone   string
+	Region string
+
+	// Status is the NVIDIA BMM instance status
+	Status string
+
+	// Shutdown is true when the status means the instance is shut down
+	Shutdown bool
+
+	// Addresses are the internal IPs of the instance interfaces
+	Addresses []v1.NodeAddress
+
+	// MachineID is the ID of the machine backing the instance
+	MachineID string
+
+	// InstanceType is the type of the instance, nil when the instance has none
+	InstanceType *InstanceTypeView
+
+	// GPU describes the instance GPUs, nil when the instance labels do not describe them
+	GPU *GPUView
+
+	// Labels are the NVIDIA BMM instance labels
+	Labels map[string]string
+}
+
+// InstanceTypeView is a typed view of an NVIDIA BMM instance type
+type InstanceTypeView struct {
+	ID          uuid.UUID
+	Name        string
+	Description string
+}
+
+// GPUView describes the GPUs of an instance
+type GPUView struct {
+	Product string
+	Count   int
+}
+
+// Resolver looks NVIDIA BMM instances up by provider ID, for controllers that do not work
+// on Node objects. Provider IDs are checked against the configuration like node provider IDs.
+type Resolver struct {
+	cloud *NvidiaBMMCloud
+}
+
+// NewResolver creates a Resolver from a cloud config. Unlike the cloud provider, it does not
+// report its configuration on /configz.
+func NewResolver(config io.Reader) (*Resolver, error) {
+	cfg, _, err := parseConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	cloud, err := newCloudFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cloud.Resolver(), nil
+}
+
+// NewResolverWithClient creates a Resolver with an injected client (for testing)
+func NewResolverWithClient(client NvidiaBMMClientInterface, orgName, siteID, tenantID string) *Resolver {
+	return NewNvidiaBMMCloudWithClient(client, orgName, siteID, tenantID).(*NvidiaBMMCloud).Resolver()
+}
+
+// Resolver returns a Resolver sharing the client, configuration and caches of the cloud provider
+func (c *NvidiaBMMCloud) Resolver() *Resolver {
+	return &Resolver{cloud: c}
+}
+
+// Resolve returns the instance of a provider ID. It returns an error wrapping ErrInstanceNotFound
+// when NVIDIA BMM has no such instance.
+func (r *Resolver) Resolve(ctx context.Context, providerID string) (*InstanceView, error) {
+	c := r.cloud
+	ctx, span := c.startSpan(ctx, "Resolve", attribute.String("providerID", providerID))
+	defer span.End()
+
+	pid, err := providerid.ParseProviderID(providerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse provider ID: %w", err)
+	}
+	orgName, err := c.checkProviderID(ctx, nil, providerID, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := klog.FromContext(ctx).WithValues("providerID", providerID, "instanceID", pid.InstanceID)
+	ctx = klog.NewContext(ctx, logger)
+	instance, err := c.getInstance(ctx, orgName, pid.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &InstanceView{
+		ProviderID: providerID,
+		ID:         pid.InstanceID,
+		Org:        orgName,
+		Addresses:  instanceAddresses(instance),
+	}
+	if instance.Name != nil {
+		view.Name = *instance.Name
+	}
+	if instance.Status != nil {
+		view.Status = string(*instance.Status)
+		view.Shutdown = isShutdownStatus(*instance.Status)
+	}
+	if instance.MachineId != nil {
+		view.MachineID = *instance.MachineId
+	}
+	if instance.Labels != nil {
+		view.Labels = *instance.Labels
+		view.GPU = gpuFromLabels(*instance.Labels)
+	}
+
+	// The zone comes from the provider ID site, like the zone of nodes
+	zone, err := c.zoneForProviderID(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	view.Zone = zone.FailureDomain
+	view.Region = zone.Region
+	if instance.SiteId != nil {
+		view.SiteID = *instance.SiteId
+	} else if view.SiteID, err = c.resolveSite(ctx, pid.SiteName); err != nil {
+		return nil, fmt.Errorf("failed to resolve site %q: %w", pid.SiteName, err)
+	}
+
+	if instance.InstanceTypeId != nil {
+		view.InstanceType, err = c.getInstanceType(ctx, orgName, *instance.InstanceTypeId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return view, nil
+}
+
+// getInstance fetches an instance, wrapping ErrInstanceNotFound when it does not exist
+func (c *NvidiaBMMCloud) getInstance(ctx context.Context, orgName string, instanceID uuid.UUID) (*restclient.Instance, error) {
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetInstanceWithResponse(apiCtx, orgName, instanceID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance: %w", err)
+	}
+	switch {
+	case statusCodeOf(resp) == http.StatusNotFound:
+		return nil, fmt.Errorf("instance %s: %w", instanceID, ErrInstanceNotFound)
+	case statusCodeOf(resp) != http.StatusOK || resp.JSON200 == nil:
+		klog.FromContext(ctx).V(2).Info("Failed to get instance from NVIDIA BMM", responseKeysAndValues(resp.HTTPResponse)...)
+		return nil, fmt.Errorf("failed to get instance, status %d", statusCodeOf(resp))
+	}
+	return resp.JSON200, nil
+}
+
+// getInstanceType fetches an instance type
+func (c *NvidiaBMMCloud) getInstanceType(ctx context.Context, orgName string, instanceTypeID uuid.UUID) (*InstanceTypeView, error) {
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetInstanceTypeWithResponse(apiCtx, orgName, instanceTypeID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance type: %w", err)
+	}
+	if statusCodeOf(resp) != http.StatusOK || resp.JSON200 == nil {
+		return nil, fmt.Errorf("failed to get instance type %s, status %d", instanceTypeID, statusCodeOf(resp))
+	}
+
+	view := &InstanceTypeView{ID: instanceTypeID}
+	if resp.JSON200.Name != nil {
+		view.Name = *resp.JSON200.Name
+	}
+	if resp.JSON200.Description != nil {
+		view.Description = *resp.JSON200.Description
+	}
+	return view, nil
+}
+
+// gpuFromLabels returns the GPUs described by the instance labels, or nil
+func gpuFromLabels(labels map[string]string) *GPUView {
+	product, hasProduct := labels[LabelGPUProduct]
+	count, err := strconv.Atoi(labels[LabelGPUCount])
+	if !hasProduct && err != nil {
+		return nil
+	}
+	return &GPUView{Product: product, Count: count}
+}
@@ -0,0 +1,210 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/component-base/configz"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	instanceID := uuid.New()
+	instanceTypeID := uuid.New()
+	status := restclient.InstanceStatus("Ready")
+	instance := restclient.Instance{
+		Id:             &instanceID,
+		Name:           ptr("worker-1"),
+		SiteId:         &testSiteID,
+		InstanceTypeId: &instanceTypeID,
+		MachineId:      ptr("machine-1"),
+		Status:         &status,
+		Interfaces:     &[]restclient.Interface{{IpAddresses: &[]string{"10.0.0.1"}}},
+		Labels:         &map[string]string{LabelGPUProduct: "NVIDIA-GB200", LabelGPUCount: "4"},
+	}
+	instanceType := restclient.InstanceType{Id: &instanceTypeID, Name: ptr("gb200"), Description: ptr("4x GB200")}
+
+	client := &mockNvidiaBMMClient{
+		getInstance: func(
+			ctx context.Context, org string, instanceId uuid.UUID,
+			params *restclient.GetInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetInstanceResponse, error) {
+			if instanceId != instanceID {
+				return &restclient.GetInstanceResponse{HTTPResponse: &http.Response{StatusCode: http.StatusNotFound}}, nil
+			}
+			return &restclient.GetInstanceResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &instance,
+			}, nil
+		},
+		getInstanceType: func(
+			ctx context.Context, org string, instanceTypeId uuid.UUID,
+			params *restclient.GetInstanceTypeParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetInstanceTypeResponse, error) {
+			return &restclient.GetInstanceTypeResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &instanceType,
+			}, nil
+		},
+	}
+	// The zone comes from the provider ID site, resolved by name
+	var siteCalls int
+	client.getAllSite = listSitesClient(&siteCalls, restclient.Site{Id: &testSiteID, Name: ptr("test-site")}).getAllSite
+	resolver := NewResolverWithClient(client, "test-org", "test-site", "test-tenant")
+
+	view, err := resolver.Resolve(context.Background(), "nvidia-bmm://test-org/test-tenant/test-site/"+instanceID.String())
+	if err != nil {
+		t.Fatalf("Resolve() failed: %v", err)
+	}
+
+	want := &InstanceView{
+		ProviderID:   "nvidia-bmm://test-org/test-tenant/test-site/" + instanceID.String(),
+		ID:           instanceID,
+		Name:         "worker-1",
+		Org:          "test-org",
+		SiteID:       testSiteID,
+		Zone:         "nvidia-bmm-zone-" + testSiteID.String(),
+		Region:       "nvidia-bmm-region-8a880c71",
+		Status:       "Ready",
+		Addresses:    []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}},
+		MachineID:    "machine-1",
+		InstanceType: &InstanceTypeView{ID: instanceTypeID, Name: "gb200", Description: "4x GB200"},
+		GPU:          &GPUView{Product: "NVIDIA-GB200", Count: 4},
+		Labels:       map[string]string{LabelGPUProduct: "NVIDIA-GB200", LabelGPUCount: "4"},
+	}
+	if !reflect.DeepEqual(view, want) {
+		t.Errorf("Resolve() = %+v, want %+v", view, want)
+	}
+
+	_, err = resolver.Resolve(context.Background(), "nvidia-bmm://test-org/test-tenant/test-site/"+uuid.New().String())
+	if !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("Expected ErrInstanceNotFound, got %v", err)
+	}
+
+	if _, err := resolver.Resolve(context.Background(), "aws:///i-123"); err == nil {
+		t.Error("Expected error for an invalid provider ID")
+	}
+}
+
+func TestNewResolver_SkipsConfigz(t *testing.T) {
+	configz.Delete(ProviderName)
+	defer configz.Delete(ProviderName)
+
+	resolver, err := NewResolver(strings.NewReader(`apiVersion: bmm.nvidia.com/v1alpha1
+kind: CloudConfig
+api:
+  endpoint: https://bmm.invalid
+  orgName: test-org
+  token: test-token
+cluster:
+  siteId: test-site
+  tenantId: test-tenant
+`))
+	if err != nil || resolver == nil {
+		t.Fatalf("NewResolver() = %v, %v", resolver, err)
+	}
+	// The configuration of the cloud provider is left to report on /configz
+	if _, err := configz.New(ProviderName); err != nil {
+		t.Errorf("Expected NewResolver not to register configz, got %v", err)
+	}
+}
+
+func TestResolver_SecondarySiteZone(t *testing.T) {
+	instanceID := uuid.New()
+	secondarySiteID := uuid.New()
+	client := &mockNvidiaBMMClient{
+		getInstance: func(
+			ctx context.Context, org string, instanceId uuid.UUID,
+			params *restclient.GetInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetInstanceResponse, error) {
+			return &restclient.GetInstanceResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &restclient.Instance{Id: &instanceID, SiteId: &testSiteID},
+			}, nil
+		},
+	}
+	cloud := NewNvidiaBMMCloudWithClient(client, "test-org", testSiteID.String(), "test-tenant").(*NvidiaBMMCloud)
+	cloud.providerIDConfig.Sites = []string{secondarySiteID.String()}
+	providerID := "nvidia-bmm://test-org/test-tenant/" + secondarySiteID.String() + "/" + instanceID.String()
+
+	view, err := cloud.Resolver().Resolve(context.Background(), providerID)
+	if err != nil {
+		t.Fatalf("Resolve() failed: %v", err)
+	}
+	zone, err := cloud.GetZoneByProviderID(context.Background(), providerID)
+	if err != nil {
+		t.Fatalf("GetZoneByProviderID() failed: %v", err)
+	}
+	if view.Zone != zone.FailureDomain || view.Region != zone.Region {
+		t.Errorf("Resolve() zone %s/%s, want the node zone %s/%s", view.Region, view.Zone, zone.Region, zone.FailureDomain)
+	}
+	if view.SiteID != testSiteID {
+		t.Errorf("Resolve() site %s, want the instance site %s", view.SiteID, testSiteID)
+	}
+}
+
+func TestResolver_RejectsMismatchedProviderID(t *testing.T) {
+	var calls int
+	client := &mockNvidiaBMMClient{
+		getInstance: func(
+			ctx context.Context, org string, instanceId uuid.UUID,
+			params *restclient.GetInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetInstanceResponse, error) {
+			calls++
+			return nil, errors.New("unexpected call")
+		},
+	}
+	cloud := NewNvidiaBMMCloudWithClient(client, "test-org", "test-site", "test-tenant").(*NvidiaBMMCloud)
+	cloud.providerIDConfig.MismatchPolicy = ProviderIDPolicyReject
+
+	_, err := cloud.Resolver().Resolve(context.Background(), "nvidia-bmm://other-org/test-tenant/test-site/"+uuid.New().String())
+	if err == nil || !strings.Contains(err.Error(), `org "other-org" does not match "test-org"`) {
+		t.Errorf("Expected the org mismatch to be rejected, got %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Expected no NVIDIA BMM call for a rejected provider ID, got %d", calls)
+	}
+}
+
+func TestGPUFromLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   *GPUView
+	}{
+		{
+			name:   "no GPU labels",
+			labels: map[string]string{"rack": "a1"},
+			want:   nil,
+		},
+		{
+			name:   "product and count",
+			labels: map[string]string{LabelGPUProduct: "NVIDIA-H100", LabelGPUCount: "8"},
+			want:   &GPUView{Product: "NVIDIA-H100", Count: 8},
+		},
+		{
+			name:   "product only",
+			labels: map[string]string{LabelGPUProduct: "NVIDIA-H100"},
+			want:   &GPUView{Product: "NVIDIA-H100"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gpuFromLabels(tt.labels); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gpuFromLabels() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"k8s.io/klog/v2"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+const (
+	// siteCacheTTL is how long a resolved site name is trusted before it is looked up again
+	siteCacheTTL = 10 * time.Minute
+
+	// siteFailureCacheTTL is how long a site name that failed to resolve, e.g. mistyped or
+	// removed, keeps failing before it is looked up again
+	siteFailureCacheTTL = 30 * time.Second
+
+	// siteListPageSize is the page size used when looking sites up by name
+	siteListPageSize = 100
+
+	// maxSiteListPages bounds the number of pages read when looking a site up by name
+	maxSiteListPages = 10
+
+	// cacheSite labels the site cache in the cache lookup metrics
+	cacheSite = "site"
+)
+
+// siteCache maps NVIDIA BMM site names to site UUIDs, or to the error of their lookup
+type siteCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	failureTTL time.Duration
+	now        func() time.Time
+	entries    map[string]siteCacheEntry
+}
+
+type siteCacheEntry struct {
+	id      uuid.UUID
+	err     error
+	expires time.Time
+}
+
+// newSiteCache creates a site cache whose entries expire after ttl, and after
+// siteFailureCacheTTL for failed lookups
+func newSiteCache(ttl time.Duration) *siteCache {
+	return &siteCache{
+		ttl:        ttl,
+		failureTTL: siteFailureCacheTTL,
+		now:        time.Now,
+		entries:    make(map[string]siteCacheEntry),
+	}
+}
+
+// get returns the cached UUID or lookup error of a site name. A nil cache never hits.
+func (s *siteCache) get(name string) (siteCacheEntry, bool) {
+	if s == nil {
+		return siteCacheEntry{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[strings.ToLower(name)]
+	if !ok || s.now().After(entry.expires) {
+		return siteCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// set caches the UUID of a site name. A nil cache stores nothing.
+func (s *siteCache) set(name string, id uuid.UUID) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[strings.ToLower(name)] = siteCacheEntry{id: id, expires: s.now().Add(s.ttl)}
+}
+
+// setFailed caches the lookup error of a site name, and reports whether the previous lookup
+// of the name did not fail. A nil cache stores nothing and always reports a first failure.
+func (s *siteCache) setFailed(name string, err error) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToLower(name)
+	previous, ok := s.entries[key]
+	s.entries[key] = siteCacheEntry{err: err, expires: s.now().Add(s.failureTTL)}
+	return !ok || previous.err == nil
+}
+
+// resolveSite normalizes a site identifier, as found in cluster.siteId or in the site segment
+// of a provider ID, to the site UUID. Names are looked up through the NVIDIA BMM site API and
+// cached, UUIDs are returned as is. Failed lookups are cached briefly and logged once until the
+// name resolves again.
+func (c *NvidiaBMMCloud) resolveSite(ctx context.Context, site string) (uuid.UUID, error) {
+	if id, err := uuid.Parse(site); err == nil {
+		return id, nil
+	}
+	if site == "" {
+		return uuid.UUID{}, fmt.Errorf("empty site identifier")
+	}
+
+	if entry, ok := c.sites.get(site); ok {
+		cacheLookups.WithLabelValues(cacheSite, "hit").Inc()
+		return entry.id, entry.err
+	}
+	cacheLookups.WithLabelValues(cacheSite, "miss").Inc()
+
+	id, err := c.lookupSite(ctx, site)
+	if err != nil {
+		if c.sites.setFailed(site, err) {
+			klog.FromContext(ctx).Error(err, "Failed to resolve NVIDIA BMM site name, check cluster.siteId and providerID.sites",
+				"siteName", site, "retryAfter", siteFailureCacheTTL)
+		}
+		return uuid.UUID{}, err
+	}
+	klog.FromContext(ctx).V(4).Info("Resolved NVIDIA BMM site name", "siteName", site, "site", id)
+	c.sites.set(site, id)
+	return id, nil
+}
+
+// lookupSite finds the UUID of the site with the given name, ignoring case
+func (c *NvidiaBMMCloud) lookupSite(ctx context.Context, name string) (uuid.UUID, error) {
+	query := name
+	pageSize := siteListPageSize
+	params := &restclient.GetAllSiteParams{Query: &query, PageSize: &pageSize}
+
+	var matched []uuid.UUID
+	for page := 1; page <= maxSiteListPages; page++ {
+		pageNumber := page
+		params.PageNumber = &pageNumber
+
+		sites, err := c.getSitePage(ctx, params)
+		if err != nil {
+			return uuid.UUID{}, err
+		}
+		for _, site := range sites {
+			if site.Id != nil && site.Name != nil && strings.EqualFold(*site.Name, name) {
+				matched = append(matched, *site.Id)
+			}
+		}
+		if len(sites) < siteListPageSize {
+			break
+		}
+	}
+
+	switch len(matched) {
+	case 0:
+		return uuid.UUID{}, fmt.Errorf("no NVIDIA BMM site named %q", name)
+	case 1:
+		return matched[0], nil
+	default:
+		return uuid.UUID{}, fmt.Errorf("%d NVIDIA BMM sites are named %q", len(matched), name)
+	}
+}
+
+// getSitePage fetches a single page of sites
+func (c *NvidiaBMMCloud) getSitePage(ctx context.Context, params *restclient.GetAllSiteParams) ([]restclient.Site, error) {
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	resp, err := c.nvidiaBmmClient.GetAllSiteWithResponse(apiCtx, c.orgName, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sites: %w", err)
+	}
+	if statusCodeOf(resp) != http.StatusOK || resp.JSON200 == nil {
+		return nil, fmt.Errorf("failed to list sites, status %d", statusCodeOf(resp))
+	}
+	return *resp.JSON200, nil
+}
+
+// sameSite reports whether two site identifiers, names or UUIDs, refer to the same site.
+// Identifiers that cannot be resolved only match when they are equal.
+func (c *NvidiaBMMCloud) sameSite(ctx context.Context, a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	idA, err := c.resolveSite(ctx, a)
+	if err != nil {
+		klog.FromContext(ctx).V(2).Info("Failed to resolve site", "siteName", a, "err", err)
+		return false
+	}
+	idB, err := c.resolveSite(ctx, b)
+	if err != nil {
+		klog.FromContext(ctx).V(2).Info("Failed to resolve site", "siteName", b, "err", err)
+		return false
+	}
+	return idA == idB
+}
@@ -0,0 +1,233 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+// listSitesClient returns a mock client listing the given sites and counting the calls
+func listSitesClient(calls *int, sites ...restclient.Site) *mockNvidiaBMMClient {
+	return &mockNvidiaBMMClient{
+		getAllSite: func(
+			ctx context.Context, org string,
+			params *restclient.GetAllSiteParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetAllSiteResponse, error) {
+			*calls++
+			return &restclient.GetAllSiteResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &sites,
+			}, nil
+		},
+	}
+}
+
+func TestResolveSite(t *testing.T) {
+	otherSiteID := uuid.New()
+
+	tests := []struct {
+		name      string
+		site      string
+		sites     []restclient.Site
+		want      uuid.UUID
+		wantCalls int
+		wantErr   string
+	}{
+		{
+			name:      "UUID is not looked up",
+			site:      testSiteID.String(),
+			want:      testSiteID,
+			wantCalls: 0,
+		},
+		{
+			name:      "name is resolved",
+			site:      "test-site",
+			sites:     []restclient.Site{{Id: &otherSiteID, Name: ptr("test-site-2")}, {Id: &testSiteID, Name: ptr("test-site")}},
+			want:      testSiteID,
+			wantCalls: 1,
+		},
+		{
+			name:      "name is matched ignoring case",
+			site:      "Test-Site",
+			sites:     []restclient.Site{{Id: &testSiteID, Name: ptr("test-site")}},
+			want:      testSiteID,
+			wantCalls: 1,
+		},
+		{
+			name:      "unknown name",
+			site:      "missing-site",
+			sites:     []restclient.Site{{Id: &testSiteID, Name: ptr("test-site")}},
+			wantCalls: 1,
+			wantErr:   `no NVIDIA BMM site named "missing-site"`,
+		},
+		{
+			name:      "ambiguous name",
+			site:      "test-site",
+			sites:     []restclient.Site{{Id: &testSiteID, Name: ptr("test-site")}, {Id: &otherSiteID, Name: ptr("TEST-SITE")}},
+			wantCalls: 1,
+			wantErr:   `2 NVIDIA BMM sites are named "test-site"`,
+		},
+		{
+			name:    "empty site",
+			site:    "",
+			wantErr: "empty site identifier",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			cloud := &NvidiaBMMCloud{
+				nvidiaBmmClient: listSitesClient(&calls, tt.sites...),
+				orgName:         "test-org",
+				sites:           newSiteCache(siteCacheTTL),
+			}
+
+			got, err := cloud.resolveSite(context.Background(), tt.site)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveSite() error = %v, expected it to contain %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("resolveSite() failed: %v", err)
+			} else if got != tt.want {
+				t.Errorf("resolveSite() = %s, want %s", got, tt.want)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Expected %d site list calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestResolveSite_Caches(t *testing.T) {
+	cacheLookups.Reset()
+	now := time.Now()
+	var calls int
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient: listSitesClient(&calls, restclient.Site{Id: &testSiteID, Name: ptr("test-site")}),
+		orgName:         "test-org",
+		sites:           newSiteCache(time.Minute),
+	}
+	cloud.sites.now = func() time.Time { return now }
+
+	for _, site := range []string{"test-site", "TEST-SITE", "test-site"} {
+		if _, err := cloud.resolveSite(context.Background(), site); err != nil {
+			t.Fatalf("resolveSite(%q) failed: %v", site, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected a single site list call, got %d", calls)
+	}
+	expectCounter(t, cacheLookups.WithLabelValues(cacheSite, "hit"), 2)
+	expectCounter(t, cacheLookups.WithLabelValues(cacheSite, "miss"), 1)
+
+	// Expired entries are looked up again
+	now = now.Add(2 * time.Minute)
+	if _, err := cloud.resolveSite(context.Background(), "test-site"); err != nil {
+		t.Fatalf("resolveSite() failed: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected the expired entry to be looked up again, got %d calls", calls)
+	}
+}
+
+func TestResolveSite_CachesFailures(t *testing.T) {
+	now := time.Now()
+	var calls int
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient: listSitesClient(&calls, restclient.Site{Id: &testSiteID, Name: ptr("test-site")}),
+		orgName:         "test-org",
+		sites:           newSiteCache(time.Minute),
+	}
+	cloud.sites.now = func() time.Time { return now }
+	resolve := func(site string) error {
+		t.Helper()
+		_, err := cloud.resolveSite(context.Background(), site)
+		return err
+	}
+
+	// A mistyped name fails without listing the sites on every lookup
+	for range 3 {
+		if err := resolve("mistyped-site"); err == nil || !strings.Contains(err.Error(), `no NVIDIA BMM site named "mistyped-site"`) {
+			t.Fatalf("resolveSite() error = %v, want the cached lookup error", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected a single site list call, got %d", calls)
+	}
+
+	// Failures expire sooner than resolved names
+	now = now.Add(siteFailureCacheTTL + time.Second)
+	if err := resolve("mistyped-site"); err == nil {
+		t.Fatal("Expected an error for an unknown site")
+	}
+	if calls != 2 {
+		t.Errorf("Expected the failed lookup to be retried once expired, got %d calls", calls)
+	}
+}
+
+func TestSiteCache_SetFailed(t *testing.T) {
+	cache := newSiteCache(time.Minute)
+	err := errors.New("no NVIDIA BMM site named \"mistyped-site\"")
+
+	// Failures are reported as first failures, to be logged, until the name resolves again
+	if !cache.setFailed("mistyped-site", err) {
+		t.Error("Expected the first failure to be reported")
+	}
+	if cache.setFailed("Mistyped-Site", err) {
+		t.Error("Expected a repeated failure not to be reported")
+	}
+	cache.set("mistyped-site", testSiteID)
+	if !cache.setFailed("mistyped-site", err) {
+		t.Error("Expected a failure after a successful lookup to be reported")
+	}
+}
+
+func TestGetZoneByProviderID_SiteNameOrUUID(t *testing.T) {
+	var calls int
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient: listSitesClient(&calls, restclient.Site{Id: &testSiteID, Name: ptr("test-site")}),
+		orgName:         "test-org",
+		siteID:          "test-site",
+		sites:           newSiteCache(siteCacheTTL),
+	}
+	instanceID := uuid.New().String()
+
+	byName, err := cloud.GetZoneByProviderID(context.Background(),
+		"nvidia-bmm://test-org/test-tenant/test-site/"+instanceID)
+	if err != nil {
+		t.Fatalf("GetZoneByProviderID() failed for a site name: %v", err)
+	}
+	byUUID, err := cloud.GetZoneByProviderID(context.Background(),
+		"nvidia-bmm://test-org/test-tenant/"+testSiteID.String()+"/"+instanceID)
+	if err != nil {
+		t.Fatalf("GetZoneByProviderID() failed for a site UUID: %v", err)
+	}
+	configured, err := cloud.GetZone(context.Background())
+	if err != nil {
+		t.Fatalf("GetZone() failed: %v", err)
+	}
+
+	want := "nvidia-bmm-zone-" + testSiteID.String()
+	for _, zone := range []string{byName.FailureDomain, byUUID.FailureDomain, configured.FailureDomain} {
+		if zone != want {
+			t.Errorf("Expected zone %s, got %s", want, zone)
+		}
+	}
+	if byName.Region != byUUID.Region {
+		t.Errorf("Expected the same region, got %s and %s", byName.Region, byUUID.Region)
+	}
+
+	if _, err := cloud.GetZoneByProviderID(context.Background(), "aws:///i-123"); err == nil {
+		t.Error("Expected error for an invalid provider ID")
+	}
+}
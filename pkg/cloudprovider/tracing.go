@@ -0,0 +1,61 @@
+package cloudprovider
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"k8s.io/component-base/tracing"
+	tracingapi "k8s.io/component-base/tracing/api/v1"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+// tracerName is the instrumentation scope of the provider spans
+const tracerName = "github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/cloudprovider"
+
+// newTracerProvider creates an OTLP tracer provider, or a no-op one when tracing is not configured
+func newTracerProvider(cfg *TracingConfig) (tracing.TracerProvider, error) {
+	if cfg == nil || cfg.Endpoint == "" {
+		return tracing.NewNoopTracerProvider(), nil
+	}
+
+	tracingConfig := &tracingapi.TracingConfiguration{
+		Endpoint:               &cfg.Endpoint,
+		SamplingRatePerMillion: &cfg.SamplingRatePerMillion,
+	}
+	return tracing.NewProvider(context.Background(), tracingConfig, nil, []resource.Option{
+		resource.WithAttributes(semconv.ServiceName(ProviderName + "-cloud-provider")),
+	})
+}
+
+// tracerFrom returns the provider tracer, falling back to a no-op tracer
+func tracerFrom(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// startSpan starts a span for a cloud provider method
+func (c *NvidiaBMMCloud) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracerFrom(c.tracerProvider).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// injectTraceContext propagates the W3C trace context of the request context to the BMM API
+func injectTraceContext(ctx context.Context, req *http.Request) error {
+	tracing.Propagators().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return nil
+}
+
+// withTraceContext appends trace context propagation to the caller's request editors
+func withTraceContext(reqEditors []restclient.RequestEditorFn) []restclient.RequestEditorFn {
+	editors := make([]restclient.RequestEditorFn, 0, len(reqEditors)+1)
+	editors = append(editors, reqEditors...)
+	return append(editors, injectTraceContext)
+}
@@ -0,0 +1,117 @@
+package cloudprovider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+func TestTracing_SpansAndPropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	instanceID := uuid.New()
+	var traceparent string
+	mock := &mockNvidiaBMMClient{
+		getInstance: func(
+			ctx context.Context, org string, instanceId uuid.UUID,
+			params *restclient.GetInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetInstanceResponse, error) {
+			// Apply the request editors the way the generated client does
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.carbide.test", nil)
+			for _, editor := range reqEditors {
+				if err := editor(ctx, req); err != nil {
+					return nil, err
+				}
+			}
+			traceparent = req.Header.Get("traceparent")
+			return &restclient.GetInstanceResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &restclient.Instance{Id: &instanceID},
+			}, nil
+		},
+	}
+
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient: newInstrumentedClient(mock, tp),
+		orgName:         "test-org",
+		siteID:          "test-site",
+		tracerProvider:  tp,
+	}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Spec: v1.NodeSpec{
+			ProviderID: providerid.NewProviderID("test-org", "test-tenant", "test-site", instanceID).String(),
+		},
+	}
+
+	if _, err := cloud.InstanceExists(context.Background(), node); err != nil {
+		t.Fatalf("InstanceExists() failed: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+
+	// Spans are exported in the order they end: the BMM call first, then the provider method
+	apiSpan, methodSpan := spans[0], spans[1]
+	if methodSpan.Name != "InstanceExists" {
+		t.Errorf("Expected provider span InstanceExists, got %s", methodSpan.Name)
+	}
+	if apiSpan.Name != "BMM GetInstance" {
+		t.Errorf("Expected client span BMM GetInstance, got %s", apiSpan.Name)
+	}
+	if apiSpan.Parent.SpanID() != methodSpan.SpanContext.SpanID() {
+		t.Error("Expected BMM span to be a child of the provider span")
+	}
+
+	if traceparent == "" {
+		t.Fatal("Expected W3C traceparent header on the BMM request")
+	}
+	wantPrefix := "00-" + apiSpan.SpanContext.TraceID().String() + "-" + apiSpan.SpanContext.SpanID().String()
+	if len(traceparent) < len(wantPrefix) || traceparent[:len(wantPrefix)] != wantPrefix {
+		t.Errorf("Expected traceparent to start with %s, got %s", wantPrefix, traceparent)
+	}
+}
+
+func TestTracing_ZoneSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	cloud := &NvidiaBMMCloud{siteID: testSiteID.String(), tracerProvider: tp}
+	if _, err := cloud.GetZone(context.Background()); err != nil {
+		t.Fatalf("GetZone() failed: %v", err)
+	}
+	if _, err := cloud.GetZoneByNodeName(context.Background(), "test-node"); err != nil {
+		t.Fatalf("GetZoneByNodeName() failed: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "GetZone" || spans[1].Name != "GetZoneByNodeName" {
+		t.Errorf("Unexpected spans: %v", spans)
+	}
+}
+
+func TestNewTracerProvider_Disabled(t *testing.T) {
+	tp, err := newTracerProvider(nil)
+	if err != nil {
+		t.Fatalf("newTracerProvider() failed: %v", err)
+	}
+	_, span := tp.Tracer(tracerName).Start(context.Background(), "test")
+	if span.SpanContext().IsValid() {
+		t.Error("Expected a no-op tracer when tracing is not configured")
+	}
+}
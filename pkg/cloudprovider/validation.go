@@ -0,0 +1,154 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+// Provider ID segments reported in mismatch metrics
+const (
+	segmentOrg    = "org"
+	segmentTenant = "tenant"
+	segmentSite   = "site"
+	segmentLegacy = "legacy"
+)
+
+// checkProviderID checks a parsed node provider ID against the configured org, tenant and sites,
+// applies the configured policies, and returns the org to look the instance up under.
+// The node is nil when a provider ID is resolved on its own, no events are recorded then.
+func (c *NvidiaBMMCloud) checkProviderID(
+	ctx context.Context, node *v1.Node, providerID string, pid *providerid.ProviderID,
+) (string, error) {
+	logger := klog.FromContext(ctx)
+
+	// Legacy 3-segment provider IDs carry no tenant
+	if pid.TenantName == "" {
+		canonical := providerid.NewProviderID(pid.OrgName, c.tenantID, pid.SiteName, pid.InstanceID).String()
+		switch c.providerIDConfig.LegacyPolicy {
+		case ProviderIDPolicyAccept:
+		case ProviderIDPolicyReject:
+			recordProviderIDMismatch(segmentLegacy, ProviderIDPolicyReject)
+			return "", fmt.Errorf("legacy provider ID %s is rejected, re-register %s with provider ID %s",
+				providerID, describeNode(node), canonical)
+		default:
+			recordProviderIDMismatch(segmentLegacy, ProviderIDPolicyWarn)
+			if c.firstProviderIDWarning(node, providerID, segmentLegacy) {
+				logger.Info("Node has a legacy provider ID without a tenant", "canonicalProviderID", canonical)
+				c.nodeEventf(node, v1.EventTypeWarning, EventReasonLegacyProviderID,
+					"Legacy provider ID %s has no tenant, re-register the node with provider ID %s", providerID, canonical)
+			}
+		}
+	}
+
+	mismatches := c.providerIDMismatches(ctx, pid)
+	if len(mismatches) == 0 {
+		return c.orgName, nil
+	}
+
+	policy := c.providerIDConfig.MismatchPolicy
+	if policy == ProviderIDPolicyReject {
+		messages := make([]string, 0, len(mismatches))
+		for _, m := range mismatches {
+			recordProviderIDMismatch(m.segment, policy)
+			messages = append(messages, m.message)
+		}
+		return "", fmt.Errorf("provider ID %s of %s is rejected: %s", providerID, describeNode(node), strings.Join(messages, "; "))
+	}
+
+	org := c.orgName
+	for _, m := range mismatches {
+		if m.segment == segmentOrg && policy == ProviderIDPolicyUseProviderIDOrg {
+			recordProviderIDMismatch(m.segment, policy)
+			logger.V(2).Info("Using the org of the provider ID", "org", pid.OrgName)
+			org = pid.OrgName
+			continue
+		}
+		recordProviderIDMismatch(m.segment, ProviderIDPolicyWarn)
+		if c.firstProviderIDWarning(node, providerID, m.segment) {
+			logger.Info("Provider ID does not match the configuration", "segment", m.segment, "reason", m.message)
+			c.nodeEventf(node, v1.EventTypeWarning, EventReasonProviderIDMismatch,
+				"Provider ID %s does not match the cloud provider configuration: %s", providerID, m.message)
+		}
+	}
+	return org, nil
+}
+
+// firstProviderIDWarning reports whether a provider ID warning about a node is new. The cloud
+// node controllers check every node on each sync, so warnings are only logged and recorded as
+// events once per node and provider ID, while the metrics count every check.
+func (c *NvidiaBMMCloud) firstProviderIDWarning(node *v1.Node, providerID, segment string) bool {
+	name := ""
+	if node != nil {
+		name = node.Name
+	}
+	_, warned := c.providerIDWarnings.LoadOrStore(name+"/"+providerID+"/"+segment, struct{}{})
+	return !warned
+}
+
+// providerIDMismatch is a provider ID segment not matching the configuration
+type providerIDMismatch struct {
+	segment string
+	message string
+}
+
+// providerIDMismatches returns the segments of a provider ID not matching the configured org,
+// tenants and sites
+func (c *NvidiaBMMCloud) providerIDMismatches(ctx context.Context, pid *providerid.ProviderID) []providerIDMismatch {
+	var mismatches []providerIDMismatch
+	if !strings.EqualFold(pid.OrgName, c.orgName) {
+		mismatches = append(mismatches, providerIDMismatch{segmentOrg,
+			fmt.Sprintf("org %q does not match %q", pid.OrgName, c.orgName)})
+	}
+	if tenants := c.allowedTenants(); pid.TenantName != "" && !containsFold(tenants, pid.TenantName) {
+		mismatches = append(mismatches, providerIDMismatch{segmentTenant,
+			fmt.Sprintf("tenant %q is not one of %s", pid.TenantName, strings.Join(tenants, ", "))})
+	}
+	if sites := c.allowedSites(); !c.allowedSite(ctx, sites, pid.SiteName) {
+		mismatches = append(mismatches, providerIDMismatch{segmentSite,
+			fmt.Sprintf("site %q is not one of %s", pid.SiteName, strings.Join(sites, ", "))})
+	}
+	return mismatches
+}
+
+// describeNode names the node a provider ID belongs to in error messages
+func describeNode(node *v1.Node) string {
+	if node == nil {
+		return "the node"
+	}
+	return "node " + node.Name
+}
+
+// allowedTenants returns the tenants accepted in the tenant segment of provider IDs
+func (c *NvidiaBMMCloud) allowedTenants() []string {
+	return nonEmpty(append([]string{c.tenantID}, c.providerIDConfig.Tenants...))
+}
+
+// allowedSites returns the sites accepted in the site segment of provider IDs
+func (c *NvidiaBMMCloud) allowedSites() []string {
+	return nonEmpty(append([]string{c.siteID}, c.providerIDConfig.Sites...))
+}
+
+// allowedSite reports whether a site, given by name or UUID, is one of the allowed sites
+func (c *NvidiaBMMCloud) allowedSite(ctx context.Context, sites []string, site string) bool {
+	if containsFold(sites, site) {
+		return true
+	}
+	return slices.ContainsFunc(sites, func(allowed string) bool { return c.sameSite(ctx, allowed, site) })
+}
+
+// nonEmpty returns the non-empty values
+func nonEmpty(values []string) []string {
+	return slices.DeleteFunc(values, func(value string) bool { return value == "" })
+}
+
+// containsFold reports whether values contains value, ignoring case as provider ID names do
+func containsFold(values []string, value string) bool {
+	return slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, value) })
+}
@@ -0,0 +1,228 @@
+package cloudprovider
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+)
+
+func TestCheckProviderID(t *testing.T) {
+	instanceID := uuid.New()
+
+	tests := []struct {
+		name       string
+		providerID string
+		config     ProviderIDConfig
+		wantOrg    string
+		wantErr    string
+		wantEvent  string
+	}{
+		{
+			name:       "matching provider ID",
+			providerID: "nvidia-bmm://test-org/test-tenant/test-site/" + instanceID.String(),
+			config:     ProviderIDConfig{MismatchPolicy: ProviderIDPolicyReject},
+			wantOrg:    "test-org",
+		},
+		{
+			name:       "names match case-insensitively",
+			providerID: "nvidia-bmm://Test-Org/TEST-TENANT/Test-Site/" + instanceID.String(),
+			config:     ProviderIDConfig{MismatchPolicy: ProviderIDPolicyReject},
+			wantOrg:    "test-org",
+		},
+		{
+			name:       "site UUID matches the configured site name",
+			providerID: "nvidia-bmm://test-org/test-tenant/" + testSiteID.String() + "/" + instanceID.String(),
+			config:     ProviderIDConfig{MismatchPolicy: ProviderIDPolicyReject},
+			wantOrg:    "test-org",
+		},
+		{
+			name:       "escaped names",
+			providerID: "nvidia-bmm://test-org/test-tenant/site%2Fb/" + instanceID.String(),
+			config: ProviderIDConfig{
+				MismatchPolicy: ProviderIDPolicyReject,
+				Sites:          []string{"site/b"},
+			},
+			wantOrg: "test-org",
+		},
+		{
+			name:       "additional tenant and site",
+			providerID: "nvidia-bmm://test-org/tenant-name/other-site/" + instanceID.String(),
+			config: ProviderIDConfig{
+				MismatchPolicy: ProviderIDPolicyReject,
+				Tenants:        []string{"tenant-name"},
+				Sites:          []string{"other-site"},
+			},
+			wantOrg: "test-org",
+		},
+		{
+			name:       "org mismatch with warn policy",
+			providerID: "nvidia-bmm://other-org/test-tenant/test-site/" + instanceID.String(),
+			config:     ProviderIDConfig{MismatchPolicy: ProviderIDPolicyWarn},
+			wantOrg:    "test-org",
+			wantEvent:  `Warning ProviderIDMismatch Provider ID nvidia-bmm://other-org/test-tenant/test-site/` + instanceID.String() + ` does not match the cloud provider configuration: org "other-org" does not match "test-org"`,
+		},
+		{
+			name:       "org mismatch with useProviderIDOrg policy",
+			providerID: "nvidia-bmm://other-org/test-tenant/test-site/" + instanceID.String(),
+			config:     ProviderIDConfig{MismatchPolicy: ProviderIDPolicyUseProviderIDOrg},
+			wantOrg:    "other-org",
+		},
+		{
+			name:       "site mismatch with useProviderIDOrg policy warns",
+			providerID: "nvidia-bmm://test-org/test-tenant/other-site/" + instanceID.String(),
+			config:     ProviderIDConfig{MismatchPolicy: ProviderIDPolicyUseProviderIDOrg},
+			wantOrg:    "test-org",
+			wantEvent:  "Warning ProviderIDMismatch",
+		},
+		{
+			name:       "tenant and site mismatch with reject policy",
+			providerID: "nvidia-bmm://test-org/other-tenant/other-site/" + instanceID.String(),
+			config:     ProviderIDConfig{MismatchPolicy: ProviderIDPolicyReject},
+			wantErr:    `tenant "other-tenant" is not one of test-tenant; site "other-site" is not one of test-site`,
+		},
+		{
+			name:       "legacy provider ID with warn policy",
+			providerID: "nvidia-bmm://test-org/test-site/" + instanceID.String(),
+			config:     ProviderIDConfig{LegacyPolicy: ProviderIDPolicyWarn},
+			wantOrg:    "test-org",
+			wantEvent:  "Warning LegacyProviderID Legacy provider ID nvidia-bmm://test-org/test-site/" + instanceID.String() + " has no tenant, re-register the node with provider ID nvidia-bmm://test-org/test-tenant/test-site/" + instanceID.String(),
+		},
+		{
+			name:       "legacy provider ID with accept policy",
+			providerID: "nvidia-bmm://test-org/test-site/" + instanceID.String(),
+			config:     ProviderIDConfig{LegacyPolicy: ProviderIDPolicyAccept},
+			wantOrg:    "test-org",
+		},
+		{
+			name:       "legacy provider ID with reject policy",
+			providerID: "nvidia-bmm://test-org/test-site/" + instanceID.String(),
+			config:     ProviderIDConfig{LegacyPolicy: ProviderIDPolicyReject},
+			wantErr:    "re-register node test-node with provider ID nvidia-bmm://test-org/test-tenant/test-site/" + instanceID.String(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			var gotOrg string
+			cloud := &NvidiaBMMCloud{
+				nvidiaBmmClient: &mockNvidiaBMMClient{
+					getInstance: func(
+						ctx context.Context, org string, instanceId uuid.UUID,
+						params *restclient.GetInstanceParams,
+						reqEditors ...restclient.RequestEditorFn,
+					) (*restclient.GetInstanceResponse, error) {
+						gotOrg = org
+						return &restclient.GetInstanceResponse{
+							HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+							JSON200:      &restclient.Instance{Id: &instanceId},
+						}, nil
+					},
+				},
+				orgName:          "test-org",
+				siteID:           "test-site",
+				tenantID:         "test-tenant",
+				providerIDConfig: tt.config,
+				eventRecorder:    recorder,
+			}
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+				Spec:       v1.NodeSpec{ProviderID: tt.providerID},
+			}
+
+			_, err := cloud.InstanceShutdown(context.Background(), node)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if gotOrg != "" {
+					t.Error("Expected no NVIDIA BMM call for a rejected provider ID")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InstanceShutdown() failed: %v", err)
+			}
+			if gotOrg != tt.wantOrg {
+				t.Errorf("Expected instance to be looked up under org %q, got %q", tt.wantOrg, gotOrg)
+			}
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			switch {
+			case tt.wantEvent == "" && len(events) > 0:
+				t.Errorf("Expected no events, got %v", events)
+			case tt.wantEvent != "" && (len(events) != 1 || !strings.HasPrefix(events[0], tt.wantEvent)):
+				t.Errorf("Expected event %q, got %v", tt.wantEvent, events)
+			}
+		})
+	}
+}
+
+func TestCheckProviderID_WarnsOnce(t *testing.T) {
+	registerMetrics()
+	providerIDMismatches.Reset()
+
+	instanceID := uuid.New()
+	recorder := record.NewFakeRecorder(10)
+	cloud := &NvidiaBMMCloud{
+		nvidiaBmmClient: &mockNvidiaBMMClient{
+			getInstance: func(
+				ctx context.Context, org string, instanceId uuid.UUID,
+				params *restclient.GetInstanceParams,
+				reqEditors ...restclient.RequestEditorFn,
+			) (*restclient.GetInstanceResponse, error) {
+				return &restclient.GetInstanceResponse{
+					HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+					JSON200:      &restclient.Instance{Id: &instanceId},
+				}, nil
+			},
+		},
+		orgName:          "test-org",
+		siteID:           "test-site",
+		tenantID:         "test-tenant",
+		providerIDConfig: ProviderIDConfig{MismatchPolicy: ProviderIDPolicyWarn, LegacyPolicy: ProviderIDPolicyWarn},
+		eventRecorder:    recorder,
+	}
+	legacy := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy-node"},
+		Spec:       v1.NodeSpec{ProviderID: "nvidia-bmm://test-org/test-site/" + instanceID.String()},
+	}
+	mismatched := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "mismatched-node"},
+		Spec:       v1.NodeSpec{ProviderID: "nvidia-bmm://other-org/test-tenant/test-site/" + instanceID.String()},
+	}
+
+	// The cloud node controllers check every node on each sync
+	for i := 0; i < 3; i++ {
+		for _, node := range []*v1.Node{legacy, mismatched} {
+			if _, err := cloud.InstanceShutdown(context.Background(), node); err != nil {
+				t.Fatalf("InstanceShutdown() failed: %v", err)
+			}
+		}
+	}
+
+	close(recorder.Events)
+	var events []string
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	if len(events) != 2 ||
+		!strings.HasPrefix(events[0], "Warning "+EventReasonLegacyProviderID) ||
+		!strings.HasPrefix(events[1], "Warning "+EventReasonProviderIDMismatch) {
+		t.Errorf("Expected a single event per node, got %v", events)
+	}
+	expectCounter(t, providerIDMismatches.WithLabelValues(segmentLegacy, string(ProviderIDPolicyWarn)), 3)
+	expectCounter(t, providerIDMismatches.WithLabelValues(segmentOrg, string(ProviderIDPolicyWarn)), 3)
+}
@@ -2,40 +2,61 @@ package cloudprovider
 
 import (
 	"context"
+	"fmt"
 
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/apimachinery/pkg/types"
 	cloudprovider "k8s.io/cloud-provider"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
 )
 
 // GetZone returns the Zone containing the current zone and locality region that the program is running in
 func (c *NvidiaBMMCloud) GetZone(ctx context.Context) (cloudprovider.Zone, error) {
-	zone := cloudprovider.Zone{
-		FailureDomain: c.getZoneFromSiteID(c.siteID),
-		Region:        c.getRegionFromSiteID(c.siteID),
-	}
+	ctx, span := c.startSpan(ctx, "GetZone")
+	defer span.End()
 
-	return zone, nil
+	return c.zoneForSite(ctx, c.siteID)
 }
 
 // GetZoneByProviderID returns the Zone containing the zone and region for a specific provider ID
 func (c *NvidiaBMMCloud) GetZoneByProviderID(ctx context.Context, providerID string) (cloudprovider.Zone, error) {
-	// Parse provider ID to get site ID
-	// For now, use the configured site ID
-	zone := cloudprovider.Zone{
-		FailureDomain: c.getZoneFromSiteID(c.siteID),
-		Region:        c.getRegionFromSiteID(c.siteID),
-	}
+	ctx, span := c.startSpan(ctx, "GetZoneByProviderID", attribute.String("providerID", providerID))
+	defer span.End()
 
-	return zone, nil
+	return c.zoneForProviderID(ctx, providerID)
 }
 
 // GetZoneByNodeName returns the Zone containing the zone and region for a specific node
 func (c *NvidiaBMMCloud) GetZoneByNodeName(ctx context.Context, nodeName types.NodeName) (cloudprovider.Zone, error) {
+	ctx, span := c.startSpan(ctx, "GetZoneByNodeName", attribute.String("node", string(nodeName)))
+	defer span.End()
+
 	// All nodes in an NVIDIA BMM cluster are in the same site/zone
-	zone := cloudprovider.Zone{
-		FailureDomain: c.getZoneFromSiteID(c.siteID),
-		Region:        c.getRegionFromSiteID(c.siteID),
+	return c.zoneForSite(ctx, c.siteID)
+}
+
+// zoneForProviderID returns the zone and region of the site of a provider ID, so that node
+// initialization and zone lookups agree for nodes on any allowed site
+func (c *NvidiaBMMCloud) zoneForProviderID(ctx context.Context, providerID string) (cloudprovider.Zone, error) {
+	pid, err := providerid.ParseProviderID(providerID)
+	if err != nil {
+		return cloudprovider.Zone{}, fmt.Errorf("failed to parse provider ID: %w", err)
+	}
+
+	return c.zoneForSite(ctx, pid.SiteName)
+}
+
+// zoneForSite returns the zone and region of a site. Sites given by name are resolved to their
+// UUID first, so that a site yields the same zone whichever way it is identified.
+func (c *NvidiaBMMCloud) zoneForSite(ctx context.Context, site string) (cloudprovider.Zone, error) {
+	siteID, err := c.resolveSite(ctx, site)
+	if err != nil {
+		return cloudprovider.Zone{}, fmt.Errorf("failed to resolve site %q: %w", site, err)
 	}
 
-	return zone, nil
+	return cloudprovider.Zone{
+		FailureDomain: c.getZoneFromSiteID(siteID.String()),
+		Region:        c.getRegionFromSiteID(siteID.String()),
+	}, nil
 }
@@ -0,0 +1,49 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AnnotateNode sets the canonical provider ID annotation and the legacy label on a node with a
+// legacy provider ID, and removes them from other nodes. It reports whether the node was patched.
+func AnnotateNode(ctx context.Context, client kubernetes.Interface, node *v1.Node, tenant string) (bool, error) {
+	report := ReportNode(node, tenant)
+	legacy := report.Status == StatusLegacy && report.CanonicalProviderID != ""
+
+	annotation, hasAnnotation := node.Annotations[AnnotationCanonicalProviderID]
+	_, hasLabel := node.Labels[LabelLegacyProviderID]
+	if legacy && annotation == report.CanonicalProviderID && hasLabel {
+		return false, nil
+	}
+	if !legacy && !hasAnnotation && !hasLabel {
+		return false, nil
+	}
+
+	// A JSON merge patch removes keys set to null
+	var annotationValue, labelValue interface{}
+	if legacy {
+		annotationValue = report.CanonicalProviderID
+		labelValue = "true"
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{AnnotationCanonicalProviderID: annotationValue},
+			"labels":      map[string]interface{}{LabelLegacyProviderID: labelValue},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := client.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return false, fmt.Errorf("failed to patch node %s: %w", node.Name, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAnnotateNode(t *testing.T) {
+	tests := []struct {
+		name           string
+		providerID     string
+		annotated      bool
+		wantPatched    bool
+		wantAnnotation string
+	}{
+		{name: "legacy node is annotated", providerID: legacyID, wantPatched: true, wantAnnotation: canonicalID},
+		{name: "annotated legacy node is unchanged", providerID: legacyID, annotated: true, wantAnnotation: canonicalID},
+		{name: "canonical node is unchanged", providerID: canonicalID},
+		{name: "re-registered node is cleaned up", providerID: canonicalID, annotated: true, wantPatched: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := testNode("test-node", tt.providerID)
+			if tt.annotated {
+				node.Annotations = map[string]string{AnnotationCanonicalProviderID: canonicalID}
+				node.Labels = map[string]string{LabelLegacyProviderID: "true"}
+			}
+			client := fake.NewClientset(node)
+
+			patched, err := AnnotateNode(context.Background(), client, node, "test-tenant")
+			if err != nil {
+				t.Fatalf("AnnotateNode() failed: %v", err)
+			}
+			if patched != tt.wantPatched {
+				t.Errorf("AnnotateNode() patched = %v, want %v", patched, tt.wantPatched)
+			}
+
+			updated, err := client.CoreV1().Nodes().Get(context.Background(), node.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := updated.Annotations[AnnotationCanonicalProviderID]; got != tt.wantAnnotation {
+				t.Errorf("Expected annotation %q, got %q", tt.wantAnnotation, got)
+			}
+			_, labeled := updated.Labels[LabelLegacyProviderID]
+			if labeled != (tt.wantAnnotation != "") {
+				t.Errorf("Expected legacy label to be set only on legacy nodes, got %v", updated.Labels)
+			}
+		})
+	}
+}
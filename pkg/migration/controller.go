@@ -0,0 +1,129 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// ControllerName is the name of the provider ID migration controller
+const ControllerName = "provider-id-migration-controller"
+
+// Controller keeps the canonical provider ID annotation and the legacy label of nodes up to date
+type Controller struct {
+	client      kubernetes.Interface
+	nodeLister  corelisters.NodeLister
+	nodesSynced cache.InformerSynced
+	queue       workqueue.TypedRateLimitingInterface[string]
+	tenant      string
+}
+
+// NewController creates a provider ID migration controller using the given tenant for canonical provider IDs
+func NewController(nodeInformer coreinformers.NodeInformer, client kubernetes.Interface, tenant string) (*Controller, error) {
+	c := &Controller{
+		client:      client,
+		nodeLister:  nodeInformer.Lister(),
+		nodesSynced: nodeInformer.Informer().HasSynced,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: ControllerName},
+		),
+		tenant: tenant,
+	}
+
+	_, err := nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.enqueue(newObj)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add node event handler: %w", err)
+	}
+	return c, nil
+}
+
+// Run runs the controller until the context is done
+func (c *Controller) Run(ctx context.Context, workers int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	logger := klog.FromContext(ctx).WithValues("controller", ControllerName)
+	ctx = klog.NewContext(ctx, logger)
+	logger.Info("Starting provider ID migration controller")
+	defer logger.Info("Shutting down provider ID migration controller")
+
+	if !cache.WaitForNamedCacheSync(ControllerName, ctx.Done(), c.nodesSynced) {
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+	<-ctx.Done()
+}
+
+// enqueue adds a node to the work queue
+func (c *Controller) enqueue(obj interface{}) {
+	node, ok := obj.(*v1.Node)
+	if !ok {
+		return
+	}
+	c.queue.Add(node.Name)
+}
+
+// runWorker processes work items until the queue is shut down
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+// processNextItem syncs a single node, requeueing it with backoff on error
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	name, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(name)
+
+	if err := c.sync(ctx, name); err != nil {
+		utilruntime.HandleErrorWithContext(ctx, err, "Failed to sync node", "node", name)
+		c.queue.AddRateLimited(name)
+		return true
+	}
+	c.queue.Forget(name)
+	return true
+}
+
+// sync annotates a node with its canonical provider ID if it has a legacy one
+func (c *Controller) sync(ctx context.Context, name string) error {
+	node, err := c.nodeLister.Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	patched, err := AnnotateNode(ctx, c.client, node, c.tenant)
+	if err != nil {
+		return err
+	}
+	if patched {
+		report := ReportNode(node, c.tenant)
+		klog.FromContext(ctx).Info("Updated provider ID migration status", "node", klog.KObj(node),
+			"providerID", node.Spec.ProviderID, "canonicalProviderID", report.CanonicalProviderID, "status", report.Status)
+	}
+	return nil
+}
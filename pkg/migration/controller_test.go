@@ -0,0 +1,45 @@
+package migration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestController(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := fake.NewClientset(testNode("legacy-node", legacyID), testNode("canonical-node", canonicalID))
+	factory := informers.NewSharedInformerFactory(client, 0)
+	c, err := NewController(factory.Core().V1().Nodes(), client, "test-tenant")
+	if err != nil {
+		t.Fatalf("NewController() failed: %v", err)
+	}
+	factory.Start(ctx.Done())
+	go c.Run(ctx, 1)
+
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		node, err := client.CoreV1().Nodes().Get(ctx, "legacy-node", metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return node.Annotations[AnnotationCanonicalProviderID] == canonicalID, nil
+	})
+	if err != nil {
+		t.Fatalf("Legacy node was not annotated: %v", err)
+	}
+
+	node, err := client.CoreV1().Nodes().Get(ctx, "canonical-node", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Annotations) != 0 || len(node.Labels) != 0 {
+		t.Errorf("Expected canonical node to be left alone, got annotations %v and labels %v", node.Annotations, node.Labels)
+	}
+}
@@ -0,0 +1,99 @@
+// Package migration moves nodes registered with legacy 3-segment NVIDIA BMM provider IDs
+// (nvidia-bmm://org/site/instance-id) to the canonical 4-segment format with a tenant.
+//
+// Since spec.providerID is immutable, a node is migrated by re-registering it: the node is
+// cordoned and drained, its kubelet stopped, the node deleted, and the kubelet started again
+// with the canonical provider ID.
+package migration
+
+import (
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+const (
+	// AnnotationCanonicalProviderID holds the canonical provider ID of a node with a legacy provider ID
+	AnnotationCanonicalProviderID = "bmm.nvidia.com/canonical-provider-id"
+
+	// LabelLegacyProviderID marks nodes with a legacy provider ID, so they can be selected
+	LabelLegacyProviderID = "bmm.nvidia.com/legacy-provider-id"
+)
+
+// Status is the migration status of a node
+type Status string
+
+const (
+	// StatusCanonical nodes have a 4-segment provider ID
+	StatusCanonical Status = "Canonical"
+
+	// StatusLegacy nodes have a 3-segment provider ID and must be re-registered
+	StatusLegacy Status = "Legacy"
+
+	// StatusMissing nodes have no provider ID yet
+	StatusMissing Status = "Missing"
+
+	// StatusInvalid nodes have a provider ID that cannot be parsed
+	StatusInvalid Status = "Invalid"
+)
+
+// NodeReport is the migration status of a node
+type NodeReport struct {
+	Node                string
+	ProviderID          string
+	CanonicalProviderID string
+	Status              Status
+}
+
+// CanonicalProviderID returns the canonical 4-segment form of a provider ID, using the given
+// tenant for legacy provider IDs, and whether the provider ID is in the legacy format
+func CanonicalProviderID(providerID, tenant string) (string, bool, error) {
+	pid, err := providerid.ParseProviderID(providerID)
+	if err != nil {
+		return "", false, err
+	}
+	if pid.TenantName != "" {
+		return providerID, false, nil
+	}
+	if tenant == "" {
+		return "", true, fmt.Errorf("a tenant is required to migrate legacy provider ID %s", providerID)
+	}
+	pid.TenantName = tenant
+	return pid.String(), true, nil
+}
+
+// ReportNode returns the migration status of a node
+func ReportNode(node *v1.Node, tenant string) NodeReport {
+	report := NodeReport{Node: node.Name, ProviderID: node.Spec.ProviderID}
+	if node.Spec.ProviderID == "" {
+		report.Status = StatusMissing
+		return report
+	}
+
+	canonical, legacy, err := CanonicalProviderID(node.Spec.ProviderID, tenant)
+	switch {
+	case legacy:
+		// Without a tenant, the canonical provider ID is left empty
+		report.Status = StatusLegacy
+		report.CanonicalProviderID = canonical
+	case err != nil:
+		report.Status = StatusInvalid
+	default:
+		report.Status = StatusCanonical
+		report.CanonicalProviderID = canonical
+	}
+	return report
+}
+
+// Report returns the migration status of the given nodes, sorted by node name
+func Report(nodes []v1.Node, tenant string) []NodeReport {
+	reports := make([]NodeReport, 0, len(nodes))
+	for i := range nodes {
+		reports = append(reports, ReportNode(&nodes[i], tenant))
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Node < reports[j].Node })
+	return reports
+}
@@ -0,0 +1,75 @@
+package migration
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	testInstanceID = "12345678-1234-1234-1234-123456789abc"
+	legacyID       = "nvidia-bmm://test-org/test-site/" + testInstanceID
+	canonicalID    = "nvidia-bmm://test-org/test-tenant/test-site/" + testInstanceID
+)
+
+func testNode(name, providerID string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1.NodeSpec{ProviderID: providerID},
+	}
+}
+
+func TestCanonicalProviderID(t *testing.T) {
+	tests := []struct {
+		name       string
+		providerID string
+		tenant     string
+		want       string
+		wantLegacy bool
+		wantErr    bool
+	}{
+		{name: "legacy", providerID: legacyID, tenant: "test-tenant", want: canonicalID, wantLegacy: true},
+		{name: "canonical", providerID: canonicalID, tenant: "other-tenant", want: canonicalID},
+		{name: "legacy without tenant", providerID: legacyID, wantLegacy: true, wantErr: true},
+		{name: "invalid", providerID: "aws:///i-123", tenant: "test-tenant", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, legacy, err := CanonicalProviderID(tt.providerID, tt.tenant)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CanonicalProviderID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || legacy != tt.wantLegacy {
+				t.Errorf("CanonicalProviderID() = %q, %v, want %q, %v", got, legacy, tt.want, tt.wantLegacy)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	nodes := []v1.Node{
+		*testNode("node-d", "invalid"),
+		*testNode("node-c", ""),
+		*testNode("node-b", canonicalID),
+		*testNode("node-a", legacyID),
+	}
+
+	want := []NodeReport{
+		{Node: "node-a", ProviderID: legacyID, CanonicalProviderID: canonicalID, Status: StatusLegacy},
+		{Node: "node-b", ProviderID: canonicalID, CanonicalProviderID: canonicalID, Status: StatusCanonical},
+		{Node: "node-c", Status: StatusMissing},
+		{Node: "node-d", ProviderID: "invalid", Status: StatusInvalid},
+	}
+
+	got := Report(nodes, "test-tenant")
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d reports, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Report()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultDrainTimeout bounds evicting the pods of a node and waiting for them to terminate
+	DefaultDrainTimeout = 5 * time.Minute
+
+	// DefaultKubeletStopTimeout bounds waiting for the kubelet of a node to be stopped
+	DefaultKubeletStopTimeout = 10 * time.Minute
+
+	// defaultPollInterval is the interval between eviction retries and termination checks
+	defaultPollInterval = 2 * time.Second
+
+	// mirrorPodAnnotation marks static pods, which cannot be evicted through the API
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+)
+
+// Reregisterer runs the re-registration workflow of a node with a legacy provider ID:
+// cordon, drain, wait for the kubelet to be stopped and delete. The kubelet then re-registers
+// the node with the canonical provider ID once it is started with it. The node is only deleted
+// once its kubelet is stopped, or the kubelet would re-register it with the legacy provider ID.
+type Reregisterer struct {
+	// Client is the Kubernetes client
+	Client kubernetes.Interface
+
+	// Tenant is the tenant of the canonical provider IDs
+	Tenant string
+
+	// DrainTimeout bounds the drain
+	DrainTimeout time.Duration
+
+	// KubeletStopTimeout bounds waiting for the kubelet to be stopped
+	KubeletStopTimeout time.Duration
+
+	// PollInterval is the interval between eviction retries and termination checks
+	PollInterval time.Duration
+
+	// Out receives progress messages
+	Out io.Writer
+}
+
+// Reregister cordons and drains a node with a legacy provider ID, waits for its kubelet to be
+// stopped, deletes it and returns the canonical provider ID the kubelet must be started with
+func (r *Reregisterer) Reregister(ctx context.Context, nodeName string) (string, error) {
+	node, err := r.Client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+
+	report := ReportNode(node, r.Tenant)
+	if report.Status != StatusLegacy {
+		return "", fmt.Errorf("node %s does not have a legacy provider ID (status %s)", nodeName, report.Status)
+	}
+	if report.CanonicalProviderID == "" {
+		return "", fmt.Errorf("a tenant is required to migrate node %s", nodeName)
+	}
+
+	r.printf("Cordoning node %s\n", nodeName)
+	if err := r.cordon(ctx, node); err != nil {
+		return "", err
+	}
+
+	r.printf("Draining node %s\n", nodeName)
+	if err := r.drain(ctx, nodeName); err != nil {
+		return "", err
+	}
+
+	r.printf("Stop the kubelet on node %s, waiting for the node to stop reporting its status\n", nodeName)
+	if err := r.waitKubeletStopped(ctx, nodeName); err != nil {
+		return "", err
+	}
+
+	r.printf("Deleting node %s\n", nodeName)
+	if err := r.Client.CoreV1().Nodes().Delete(ctx, nodeName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("failed to delete node %s: %w", nodeName, err)
+	}
+
+	return report.CanonicalProviderID, nil
+}
+
+// waitKubeletStopped waits until the kubelet of a node no longer reports its status, which the
+// node lifecycle controller shows with an Unknown Ready condition
+func (r *Reregisterer) waitKubeletStopped(ctx context.Context, nodeName string) error {
+	timeout := r.KubeletStopTimeout
+	if timeout <= 0 {
+		timeout = DefaultKubeletStopTimeout
+	}
+	interval := r.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+		node, err := r.Client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == v1.NodeReady {
+				return condition.Status == v1.ConditionUnknown, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("kubelet of node %s is still running, stop it before the node is deleted: %w", nodeName, err)
+	}
+	return nil
+}
+
+// cordon marks a node unschedulable
+func (r *Reregisterer) cordon(ctx context.Context, node *v1.Node) error {
+	if node.Spec.Unschedulable {
+		return nil
+	}
+	patch := []byte(`{"spec":{"unschedulable":true}}`)
+	if _, err := r.Client.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to cordon node %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// drain evicts the pods of a node, honoring PodDisruptionBudgets, and waits for them to terminate
+func (r *Reregisterer) drain(ctx context.Context, nodeName string) error {
+	timeout := r.DrainTimeout
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	interval := r.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pods, err := r.podsToEvict(ctx, nodeName)
+	if err != nil {
+		return err
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		r.printf("Evicting pod %s/%s\n", pod.Namespace, pod.Name)
+		err := wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+			err := r.Client.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+				ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name},
+			})
+			switch {
+			case err == nil, apierrors.IsNotFound(err):
+				return true, nil
+			case apierrors.IsTooManyRequests(err):
+				// Blocked by a PodDisruptionBudget, retry
+				return false, nil
+			default:
+				return false, err
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to evict pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		err := wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+			current, err := r.Client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return true, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			// A pod recreated with the same name is a different pod
+			return current.UID != pod.UID, nil
+		})
+		if err != nil {
+			return fmt.Errorf("pod %s/%s did not terminate: %w", pod.Namespace, pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// podsToEvict returns the pods of a node that must be evicted. DaemonSet pods, which would
+// be recreated on the node, static pods and terminated pods are skipped.
+func (r *Reregisterer) podsToEvict(ctx context.Context, nodeName string) ([]v1.Pod, error) {
+	list, err := r.Client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods on node %s: %w", nodeName, err)
+	}
+
+	var pods []v1.Pod
+	for _, pod := range list.Items {
+		if pod.Spec.NodeName != nodeName {
+			continue
+		}
+		if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+			continue
+		}
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// printf writes a progress message
+func (r *Reregisterer) printf(format string, args ...interface{}) {
+	if r.Out != nil {
+		fmt.Fprintf(r.Out, format, args...)
+	}
+}
@@ -0,0 +1,170 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+)
+
+func testPod(name, nodeName string, mutate func(pod *v1.Pod)) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID("uid-" + name)},
+		Spec:       v1.PodSpec{NodeName: nodeName},
+		Status:     v1.PodStatus{Phase: v1.PodRunning},
+	}
+	if mutate != nil {
+		mutate(pod)
+	}
+	return pod
+}
+
+// evictionReactor deletes evicted pods, rejecting the first eviction of blocked pods as a
+// PodDisruptionBudget would, and records the evicted pods
+func evictionReactor(client *fake.Clientset, blocked map[string]bool, evicted *[]string) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+		if blocked[eviction.Name] {
+			blocked[eviction.Name] = false
+			return true, nil, apierrors.NewTooManyRequests("disruption budget", 0)
+		}
+		*evicted = append(*evicted, eviction.Name)
+		err := client.Tracker().Delete(schema.GroupVersionResource{Version: "v1", Resource: "pods"}, eviction.Namespace, eviction.Name)
+		return true, nil, err
+	}
+}
+
+func TestReregister(t *testing.T) {
+	node := testNode("legacy-node", legacyID)
+	client := fake.NewClientset(
+		node,
+		testPod("app", "legacy-node", nil),
+		testPod("guarded", "legacy-node", nil),
+		testPod("daemon", "legacy-node", func(pod *v1.Pod) {
+			pod.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "ds", Controller: ptr.To(true)}}
+		}),
+		testPod("static", "legacy-node", func(pod *v1.Pod) {
+			pod.Annotations = map[string]string{mirrorPodAnnotation: "hash"}
+		}),
+		testPod("done", "legacy-node", func(pod *v1.Pod) { pod.Status.Phase = v1.PodSucceeded }),
+		testPod("elsewhere", "other-node", nil),
+	)
+	var evicted []string
+	client.PrependReactor("create", "pods", evictionReactor(client, map[string]bool{"guarded": true}, &evicted))
+
+	var out bytes.Buffer
+	r := &Reregisterer{
+		Client:       client,
+		Tenant:       "test-tenant",
+		PollInterval: time.Millisecond,
+		Out:          &out,
+	}
+
+	canonical, err := r.Reregister(context.Background(), "legacy-node")
+	if err != nil {
+		t.Fatalf("Reregister() failed: %v", err)
+	}
+	if canonical != canonicalID {
+		t.Errorf("Expected canonical provider ID %s, got %s", canonicalID, canonical)
+	}
+	if strings.Join(evicted, ",") != "app,guarded" {
+		t.Errorf("Expected app and guarded pods to be evicted, got %v", evicted)
+	}
+
+	var cordoned bool
+	for _, action := range client.Actions() {
+		if patch, ok := action.(k8stesting.PatchAction); ok && action.GetResource().Resource == "nodes" {
+			cordoned = strings.Contains(string(patch.GetPatch()), `"unschedulable":true`)
+		}
+	}
+	if !cordoned {
+		t.Error("Expected node to be cordoned")
+	}
+	if _, err := client.CoreV1().Nodes().Get(context.Background(), "legacy-node", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Expected node to be deleted, got %v", err)
+	}
+	if !strings.Contains(out.String(), "Evicting pod default/guarded") {
+		t.Errorf("Expected progress output, got:\n%s", out.String())
+	}
+}
+
+func TestReregister_RefusesCanonicalNode(t *testing.T) {
+	client := fake.NewClientset(testNode("canonical-node", canonicalID))
+	r := &Reregisterer{Client: client, Tenant: "test-tenant"}
+
+	if _, err := r.Reregister(context.Background(), "canonical-node"); err == nil {
+		t.Fatal("Expected an error for a node without a legacy provider ID")
+	}
+	if _, err := client.CoreV1().Nodes().Get(context.Background(), "canonical-node", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected node to be kept, got %v", err)
+	}
+}
+
+func TestReregister_WaitsForKubeletStopped(t *testing.T) {
+	node := testNode("legacy-node", legacyID)
+	node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+	client := fake.NewClientset(node)
+
+	// The node lifecycle controller marks the node Unknown once the kubelet stops reporting
+	gets := 0
+	client.PrependReactor("get", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets == 3 {
+			stopped := node.DeepCopy()
+			stopped.Status.Conditions[0].Status = v1.ConditionUnknown
+			if err := client.Tracker().Update(schema.GroupVersionResource{Version: "v1", Resource: "nodes"}, stopped, ""); err != nil {
+				return true, nil, err
+			}
+		}
+		return false, nil, nil
+	})
+
+	var out bytes.Buffer
+	r := &Reregisterer{Client: client, Tenant: "test-tenant", PollInterval: time.Millisecond, Out: &out}
+	if _, err := r.Reregister(context.Background(), "legacy-node"); err != nil {
+		t.Fatalf("Reregister() failed: %v", err)
+	}
+	if gets < 3 {
+		t.Errorf("Expected Reregister to wait for the kubelet to stop, got %d node lookups", gets)
+	}
+	if _, err := client.CoreV1().Nodes().Get(context.Background(), "legacy-node", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Expected node to be deleted, got %v", err)
+	}
+	if !strings.Contains(out.String(), "Stop the kubelet on node legacy-node") {
+		t.Errorf("Expected instructions to stop the kubelet, got:\n%s", out.String())
+	}
+}
+
+func TestReregister_KeepsNodeWithRunningKubelet(t *testing.T) {
+	node := testNode("legacy-node", legacyID)
+	node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+	client := fake.NewClientset(node)
+	r := &Reregisterer{
+		Client:             client,
+		Tenant:             "test-tenant",
+		PollInterval:       time.Millisecond,
+		KubeletStopTimeout: 20 * time.Millisecond,
+	}
+
+	if _, err := r.Reregister(context.Background(), "legacy-node"); err == nil {
+		t.Fatal("Expected an error while the kubelet is running")
+	}
+	if _, err := client.CoreV1().Nodes().Get(context.Background(), "legacy-node", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected node to be kept while its kubelet is running, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package nodeipam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// ControllerName is the name of the node IPAM controller
+const ControllerName = "node-ipam-controller"
+
+// Controller sets the pod CIDRs of nodes from the prefixes NVIDIA BMM routes to their instances
+type Controller struct {
+	client      kubernetes.Interface
+	nodeLister  corelisters.NodeLister
+	nodesSynced cache.InformerSynced
+	queue       workqueue.TypedRateLimitingInterface[string]
+	source      Source
+
+	// reserved holds the pod CIDRs allocated to nodes until the node lister sees them
+	mu       sync.Mutex
+	reserved map[string][]netip.Prefix
+}
+
+// NewController creates a node IPAM controller allocating pod CIDRs from the prefixes of source
+func NewController(nodeInformer coreinformers.NodeInformer, client kubernetes.Interface, source Source) (*Controller, error) {
+	c := &Controller{
+		client:      client,
+		nodeLister:  nodeInformer.Lister(),
+		nodesSynced: nodeInformer.Informer().HasSynced,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: ControllerName},
+		),
+		source:   source,
+		reserved: make(map[string][]netip.Prefix),
+	}
+
+	_, err := nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.enqueue(newObj)
+		},
+		DeleteFunc: c.enqueue,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add node event handler: %w", err)
+	}
+	return c, nil
+}
+
+// Run runs the controller until the context is done
+func (c *Controller) Run(ctx context.Context, workers int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	logger := klog.FromContext(ctx).WithValues("controller", ControllerName)
+	ctx = klog.NewContext(ctx, logger)
+	logger.Info("Starting node IPAM controller")
+	defer logger.Info("Shutting down node IPAM controller")
+
+	if !cache.WaitForNamedCacheSync(ControllerName, ctx.Done(), c.nodesSynced) {
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+	<-ctx.Done()
+}
+
+// enqueue adds a node to the work queue
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// runWorker processes work items until the queue is shut down
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+// processNextItem syncs a single node, requeueing it with backoff on error
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	name, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(name)
+
+	if err := c.sync(ctx, name); err != nil {
+		utilruntime.HandleErrorWithContext(ctx, err, "Failed to allocate pod CIDRs", "node", name)
+		c.queue.AddRateLimited(name)
+		return true
+	}
+	c.queue.Forget(name)
+	return true
+}
+
+// sync allocates the pod CIDRs of a node that has a provider ID and no pod CIDRs yet
+func (c *Controller) sync(ctx context.Context, name string) error {
+	node, err := c.nodeLister.Get(name)
+	if apierrors.IsNotFound(err) {
+		c.release(name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(node.Spec.PodCIDRs) > 0 {
+		// Pod CIDRs cannot change once set, and the lister now accounts for them
+		c.release(name)
+		return nil
+	}
+	if node.Spec.ProviderID == "" {
+		// The node is synced again once the cloud node controller sets its provider ID
+		return nil
+	}
+
+	prefixes, err := c.source.NodePrefixes(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to get the prefixes of node %s: %w", name, err)
+	}
+	cidrs, err := c.reserve(name, prefixes)
+	if err != nil {
+		return fmt.Errorf("failed to allocate pod CIDRs for node %s: %w", name, err)
+	}
+
+	if err := c.setPodCIDRs(ctx, name, cidrs); err != nil {
+		c.release(name)
+		return err
+	}
+	klog.FromContext(ctx).Info("Allocated pod CIDRs", "node", klog.KObj(node), "podCIDRs", cidrs)
+	return nil
+}
+
+// reserve allocates pod CIDRs for a node, avoiding those of the other nodes and the ones
+// reserved for nodes the lister does not show with pod CIDRs yet
+func (c *Controller) reserve(name string, prefixes []Prefix) ([]netip.Prefix, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cidrs, ok := c.reserved[name]; ok {
+		return cidrs, nil
+	}
+
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var used []netip.Prefix
+	for _, node := range nodes {
+		used = append(used, parsePodCIDRs(node)...)
+	}
+	for _, cidrs := range c.reserved {
+		used = append(used, cidrs...)
+	}
+
+	cidrs, err := allocate(prefixes, used)
+	if err != nil {
+		return nil, err
+	}
+	c.reserved[name] = cidrs
+	return cidrs, nil
+}
+
+// release forgets the pod CIDRs reserved for a node
+func (c *Controller) release(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.reserved, name)
+}
+
+// setPodCIDRs writes the pod CIDRs to the node spec
+func (c *Controller) setPodCIDRs(ctx context.Context, name string, cidrs []netip.Prefix) error {
+	podCIDRs := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		podCIDRs = append(podCIDRs, cidr.String())
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"podCIDR":  podCIDRs[0],
+			"podCIDRs": podCIDRs,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build patch: %w", err)
+	}
+
+	if _, err := c.client.CoreV1().Nodes().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to set pod CIDRs of node %s: %w", name, err)
+	}
+	return nil
+}
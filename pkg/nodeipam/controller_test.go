@@ -0,0 +1,158 @@
+package nodeipam
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeSource returns the prefixes configured for each node
+type fakeSource struct {
+	mu       sync.Mutex
+	prefixes map[string][]Prefix
+	calls    map[string]int
+}
+
+func (s *fakeSource) NodePrefixes(ctx context.Context, node *v1.Node) ([]Prefix, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[node.Name]++
+	prefixes, ok := s.prefixes[node.Name]
+	if !ok {
+		return nil, errors.New("no prefixes")
+	}
+	return prefixes, nil
+}
+
+func testNode(name, providerID string, podCIDRs ...string) *v1.Node {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1.NodeSpec{ProviderID: providerID, PodCIDRs: podCIDRs},
+	}
+	if len(podCIDRs) > 0 {
+		node.Spec.PodCIDR = podCIDRs[0]
+	}
+	return node
+}
+
+func TestController(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shared := Prefix{CIDR: netip.MustParsePrefix("10.128.0.0/16"), NodeMaskSize: 24}
+	source := &fakeSource{
+		prefixes: map[string][]Prefix{
+			"reserved-node": {{CIDR: netip.MustParsePrefix("10.1.2.0/24")}, {CIDR: netip.MustParsePrefix("fd00:1::/64")}},
+			"shared-node-1": {shared},
+			"shared-node-2": {shared},
+		},
+		calls: map[string]int{},
+	}
+	client := fake.NewClientset(
+		testNode("existing-node", "nvidia-bmm://org/tenant/site/1", "10.128.0.0/24"),
+		testNode("reserved-node", "nvidia-bmm://org/tenant/site/2"),
+		testNode("shared-node-1", "nvidia-bmm://org/tenant/site/3"),
+		testNode("shared-node-2", "nvidia-bmm://org/tenant/site/4"),
+		testNode("uninitialized-node", ""),
+	)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	c, err := NewController(factory.Core().V1().Nodes(), client, source)
+	if err != nil {
+		t.Fatalf("NewController() failed: %v", err)
+	}
+	factory.Start(ctx.Done())
+	go c.Run(ctx, 2)
+
+	podCIDRs := map[string][]string{}
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		for _, name := range []string{"reserved-node", "shared-node-1", "shared-node-2"} {
+			node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			if len(node.Spec.PodCIDRs) == 0 {
+				return false, nil
+			}
+			if node.Spec.PodCIDR != node.Spec.PodCIDRs[0] {
+				t.Errorf("Expected podCIDR of %s to be the first of podCIDRs, got %s", name, node.Spec.PodCIDR)
+			}
+			podCIDRs[name] = node.Spec.PodCIDRs
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("Pod CIDRs were not allocated: %v", err)
+	}
+
+	if want := []string{"10.1.2.0/24", "fd00:1::/64"}; !reflect.DeepEqual(podCIDRs["reserved-node"], want) {
+		t.Errorf("Expected reserved node pod CIDRs %v, got %v", want, podCIDRs["reserved-node"])
+	}
+	shared1, shared2 := podCIDRs["shared-node-1"][0], podCIDRs["shared-node-2"][0]
+	if shared1 == shared2 {
+		t.Errorf("Expected shared nodes to get distinct pod CIDRs, both got %s", shared1)
+	}
+	for _, cidr := range []string{shared1, shared2} {
+		if cidr != "10.128.1.0/24" && cidr != "10.128.2.0/24" {
+			t.Errorf("Expected a free block after the existing node's, got %s", cidr)
+		}
+	}
+
+	node, err := client.CoreV1().Nodes().Get(ctx, "uninitialized-node", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Spec.PodCIDRs) != 0 {
+		t.Errorf("Expected a node without provider ID to be left alone, got %v", node.Spec.PodCIDRs)
+	}
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	if source.calls["existing-node"] != 0 || source.calls["uninitialized-node"] != 0 {
+		t.Errorf("Expected no prefix lookups for nodes with pod CIDRs or without provider ID, got %v", source.calls)
+	}
+}
+
+func TestController_SharedReservedPrefix(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reserved := []Prefix{{CIDR: netip.MustParsePrefix("10.1.2.0/24")}}
+	source := &fakeSource{
+		prefixes: map[string][]Prefix{"node-1": reserved, "node-2": reserved},
+		calls:    map[string]int{},
+	}
+	client := fake.NewClientset(
+		testNode("node-1", "nvidia-bmm://org/tenant/site/1"),
+		testNode("node-2", "nvidia-bmm://org/tenant/site/2"),
+	)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	c, err := NewController(factory.Core().V1().Nodes(), client, source)
+	if err != nil {
+		t.Fatalf("NewController() failed: %v", err)
+	}
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	if err := c.sync(ctx, "node-1"); err != nil {
+		t.Fatalf("sync(node-1) failed: %v", err)
+	}
+	if err := c.sync(ctx, "node-2"); err == nil {
+		t.Error("Expected node-2 not to get the prefix allocated to node-1")
+	}
+	node, err := client.CoreV1().Nodes().Get(ctx, "node-2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Spec.PodCIDRs) != 0 {
+		t.Errorf("Expected node-2 to have no pod CIDRs, got %v", node.Spec.PodCIDRs)
+	}
+}
@@ -0,0 +1,128 @@
+package nodeipam
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/netip"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AllocatorType is the --cidr-allocator-type value selecting the NVIDIA BMM node IPAM controller
+	AllocatorType = "NvidiaBMM"
+
+	// maxBlocksScanned bounds the number of node blocks scanned in a shared prefix
+	maxBlocksScanned = 1 << 16
+)
+
+// Prefix is a prefix pod CIDRs are allocated from
+type Prefix struct {
+	// CIDR is the prefix
+	CIDR netip.Prefix
+
+	// NodeMaskSize is the prefix length of the pod CIDRs carved out of a shared prefix,
+	// zero when the whole prefix is reserved for the node
+	NodeMaskSize int
+}
+
+// Source returns the prefixes the pod CIDRs of a node are allocated from, in order of preference
+type Source interface {
+	NodePrefixes(ctx context.Context, node *v1.Node) ([]Prefix, error)
+}
+
+// allocate picks at most one pod CIDR per IP family out of the prefixes, in order. Reserved
+// prefixes are used as is unless they overlap a used CIDR, shared prefixes yield their first
+// block not overlapping a used CIDR.
+func allocate(prefixes []Prefix, used []netip.Prefix) ([]netip.Prefix, error) {
+	var cidrs []netip.Prefix
+	var errs []error
+	for _, prefix := range prefixes {
+		if hasFamily(cidrs, prefix.CIDR) {
+			continue
+		}
+		if prefix.NodeMaskSize == 0 {
+			if overlapsAny(prefix.CIDR.Masked(), used) {
+				errs = append(errs, fmt.Errorf("prefix %s overlaps the pod CIDRs of another node", prefix.CIDR.Masked()))
+				continue
+			}
+			cidrs = append(cidrs, prefix.CIDR.Masked())
+			continue
+		}
+		block, err := freeBlock(prefix, used)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		cidrs = append(cidrs, block)
+	}
+	if len(cidrs) == 0 {
+		if len(errs) > 0 {
+			return nil, errs[0]
+		}
+		return nil, fmt.Errorf("no prefix to allocate pod CIDRs from")
+	}
+	return cidrs, nil
+}
+
+// freeBlock returns the first block of a shared prefix not overlapping a used CIDR
+func freeBlock(prefix Prefix, used []netip.Prefix) (netip.Prefix, error) {
+	cidr := prefix.CIDR.Masked()
+	if prefix.NodeMaskSize < cidr.Bits() || prefix.NodeMaskSize > cidr.Addr().BitLen() {
+		return netip.Prefix{}, fmt.Errorf("node mask size %d does not fit in prefix %s", prefix.NodeMaskSize, cidr)
+	}
+
+	blocks := uint64(maxBlocksScanned)
+	if bits := prefix.NodeMaskSize - cidr.Bits(); bits < 16 {
+		blocks = 1 << bits
+	}
+	for n := uint64(0); n < blocks; n++ {
+		block := nthBlock(cidr, prefix.NodeMaskSize, n)
+		if !overlapsAny(block, used) {
+			return block, nil
+		}
+	}
+	return netip.Prefix{}, fmt.Errorf("prefix %s has no free /%d block", cidr, prefix.NodeMaskSize)
+}
+
+// nthBlock returns the n-th block of the given size in a prefix
+func nthBlock(prefix netip.Prefix, maskSize int, n uint64) netip.Prefix {
+	addr := prefix.Addr()
+	offset := new(big.Int).Lsh(new(big.Int).SetUint64(n), uint(addr.BitLen()-maskSize))
+	sum := new(big.Int).SetBytes(addr.AsSlice())
+	sum.Add(sum, offset)
+	next, _ := netip.AddrFromSlice(sum.FillBytes(make([]byte, addr.BitLen()/8)))
+	return netip.PrefixFrom(next, maskSize)
+}
+
+// overlapsAny reports whether a prefix overlaps one of the given prefixes
+func overlapsAny(prefix netip.Prefix, others []netip.Prefix) bool {
+	for _, other := range others {
+		if prefix.Overlaps(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFamily reports whether the prefixes include one of the same IP family as prefix
+func hasFamily(prefixes []netip.Prefix, prefix netip.Prefix) bool {
+	for _, p := range prefixes {
+		if p.Addr().Is4() == prefix.Addr().Is4() {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePodCIDRs parses the pod CIDRs of a node, ignoring invalid ones
+func parsePodCIDRs(node *v1.Node) []netip.Prefix {
+	var cidrs []netip.Prefix
+	for _, cidr := range node.Spec.PodCIDRs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			cidrs = append(cidrs, prefix.Masked())
+		}
+	}
+	return cidrs
+}
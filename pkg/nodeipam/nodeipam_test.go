@@ -0,0 +1,131 @@
+package nodeipam
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func prefixes(cidrs ...string) []netip.Prefix {
+	var parsed []netip.Prefix
+	for _, cidr := range cidrs {
+		parsed = append(parsed, netip.MustParsePrefix(cidr))
+	}
+	return parsed
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []Prefix
+		used     []netip.Prefix
+		want     []netip.Prefix
+		wantErr  string
+	}{
+		{
+			name:     "reserved prefix is used as is",
+			prefixes: []Prefix{{CIDR: netip.MustParsePrefix("10.1.2.0/24")}},
+			want:     prefixes("10.1.2.0/24"),
+		},
+		{
+			name:     "reserved prefix is masked",
+			prefixes: []Prefix{{CIDR: netip.MustParsePrefix("10.1.2.7/24")}},
+			want:     prefixes("10.1.2.0/24"),
+		},
+		{
+			name:     "used reserved prefix",
+			prefixes: []Prefix{{CIDR: netip.MustParsePrefix("10.1.2.0/24")}},
+			used:     prefixes("10.1.2.0/25"),
+			wantErr:  "overlaps the pod CIDRs of another node",
+		},
+		{
+			name:     "falls back from a used reserved prefix",
+			prefixes: []Prefix{{CIDR: netip.MustParsePrefix("10.1.2.0/24")}, {CIDR: netip.MustParsePrefix("10.128.0.0/16"), NodeMaskSize: 24}},
+			used:     prefixes("10.1.2.0/24"),
+			want:     prefixes("10.128.0.0/24"),
+		},
+		{
+			name:     "first block of a shared prefix",
+			prefixes: []Prefix{{CIDR: netip.MustParsePrefix("10.128.0.0/16"), NodeMaskSize: 24}},
+			want:     prefixes("10.128.0.0/24"),
+		},
+		{
+			name:     "used blocks are skipped",
+			prefixes: []Prefix{{CIDR: netip.MustParsePrefix("10.128.0.0/16"), NodeMaskSize: 24}},
+			used:     prefixes("10.128.0.0/24", "10.128.1.0/25", "192.168.0.0/24"),
+			want:     prefixes("10.128.2.0/24"),
+		},
+		{
+			name:     "one CIDR per family",
+			prefixes: []Prefix{{CIDR: netip.MustParsePrefix("10.1.2.0/24")}, {CIDR: netip.MustParsePrefix("10.1.3.0/24")}, {CIDR: netip.MustParsePrefix("fd00:1::/64")}},
+			want:     prefixes("10.1.2.0/24", "fd00:1::/64"),
+		},
+		{
+			name:     "IPv6 shared prefix",
+			prefixes: []Prefix{{CIDR: netip.MustParsePrefix("fd00::/48"), NodeMaskSize: 64}},
+			used:     prefixes("fd00::/64"),
+			want:     prefixes("fd00:0:0:1::/64"),
+		},
+		{
+			name:     "falls back to the next prefix when one is full",
+			prefixes: []Prefix{{CIDR: netip.MustParsePrefix("10.128.0.0/23"), NodeMaskSize: 24}, {CIDR: netip.MustParsePrefix("10.129.0.0/16"), NodeMaskSize: 24}},
+			used:     prefixes("10.128.0.0/24", "10.128.1.0/24"),
+			want:     prefixes("10.129.0.0/24"),
+		},
+		{
+			name:     "full shared prefix",
+			prefixes: []Prefix{{CIDR: netip.MustParsePrefix("10.128.0.0/23"), NodeMaskSize: 24}},
+			used:     prefixes("10.128.0.0/23"),
+			wantErr:  "has no free /24 block",
+		},
+		{
+			name:     "node mask size larger than the prefix",
+			prefixes: []Prefix{{CIDR: netip.MustParsePrefix("10.128.0.0/24"), NodeMaskSize: 16}},
+			wantErr:  "does not fit",
+		},
+		{
+			name:    "no prefixes",
+			wantErr: "no prefix",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := allocate(tt.prefixes, tt.used)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("allocate() error = %v, expected it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("allocate() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNthBlock(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		maskSize int
+		n        uint64
+		want     string
+	}{
+		{"10.0.0.0/8", 24, 0, "10.0.0.0/24"},
+		{"10.0.0.0/8", 24, 257, "10.1.1.0/24"},
+		{"10.0.0.0/8", 26, 5, "10.0.1.64/26"},
+		{"fd00::/48", 64, 65535, "fd00:0:0:ffff::/64"},
+	}
+
+	for _, tt := range tests {
+		got := nthBlock(netip.MustParsePrefix(tt.prefix), tt.maskSize, tt.n)
+		if got.String() != tt.want {
+			t.Errorf("nthBlock(%s, %d, %d) = %s, want %s", tt.prefix, tt.maskSize, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package outofservice
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ControllerName is the name of the out-of-service controller
+	ControllerName = "out-of-service-controller"
+
+	// resyncPeriod is how often the power state of the instance of every node is checked
+	resyncPeriod = 30 * time.Second
+)
+
+// Controller taints the NotReady nodes of instances that stayed shut down with
+// node.kubernetes.io/out-of-service, so that their volumes are detached and their pods fail
+// over, and removes the taint once the instances run again
+type Controller struct {
+	client      kubernetes.Interface
+	nodeLister  corelisters.NodeLister
+	nodesSynced cache.InformerSynced
+	queue       workqueue.TypedRateLimitingInterface[string]
+	source      Source
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	after       time.Duration
+	resync      time.Duration
+	now         func() time.Time
+
+	// offSince holds when the instance of each node was first seen shut down
+	mu       sync.Mutex
+	offSince map[string]time.Time
+}
+
+// NewController creates an out-of-service controller tainting the nodes of instances that
+// source reports shut down for longer than after
+func NewController(
+	nodeInformer coreinformers.NodeInformer, client kubernetes.Interface, source Source, after time.Duration,
+) (*Controller, error) {
+	broadcaster := record.NewBroadcaster()
+	c := &Controller{
+		client:      client,
+		nodeLister:  nodeInformer.Lister(),
+		nodesSynced: nodeInformer.Informer().HasSynced,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: ControllerName},
+		),
+		source:      source,
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: ControllerName}),
+		after:       after,
+		resync:      resyncPeriod,
+		now:         time.Now,
+		offSince:    make(map[string]time.Time),
+	}
+
+	_, err := nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// Nodes are checked periodically, and again as soon as they become NotReady
+			oldNode, oldOK := oldObj.(*v1.Node)
+			newNode, newOK := newObj.(*v1.Node)
+			if oldOK && newOK && isNodeReady(oldNode) != isNodeReady(newNode) {
+				c.enqueue(newObj)
+			}
+		},
+		DeleteFunc: c.enqueue,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add node event handler: %w", err)
+	}
+	return c, nil
+}
+
+// Run runs the controller until the context is done
+func (c *Controller) Run(ctx context.Context, workers int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	logger := klog.FromContext(ctx).WithValues("controller", ControllerName)
+	ctx = klog.NewContext(ctx, logger)
+	logger.Info("Starting out-of-service controller", "after", c.after)
+	defer logger.Info("Shutting down out-of-service controller")
+
+	c.broadcaster.StartStructuredLogging(4)
+	c.broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.client.CoreV1().Events("")})
+	defer c.broadcaster.Shutdown()
+
+	if !cache.WaitForNamedCacheSync(ControllerName, ctx.Done(), c.nodesSynced) {
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+	go wait.UntilWithContext(ctx, c.enqueueAll, c.resync)
+	<-ctx.Done()
+}
+
+// enqueue adds a node to the work queue
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// enqueueAll adds the nodes that have a provider ID to the work queue
+func (c *Controller) enqueueAll(ctx context.Context) {
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleErrorWithContext(ctx, err, "Failed to list nodes")
+		return
+	}
+	for _, node := range nodes {
+		if node.Spec.ProviderID != "" {
+			c.queue.Add(node.Name)
+		}
+	}
+}
+
+// runWorker processes work items until the queue is shut down
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+// processNextItem syncs a single node, requeueing it with backoff on error
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	name, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(name)
+
+	if err := c.sync(ctx, name); err != nil {
+		utilruntime.HandleErrorWithContext(ctx, err, "Failed to sync the out-of-service taint", "node", name)
+		c.queue.AddRateLimited(name)
+		return true
+	}
+	c.queue.Forget(name)
+	return true
+}
+
+// sync taints a NotReady node whose instance stayed shut down for long enough, and untaints
+// a node whose instance runs again
+func (c *Controller) sync(ctx context.Context, name string) error {
+	node, err := c.nodeLister.Get(name)
+	if apierrors.IsNotFound(err) {
+		c.forget(name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if node.Spec.ProviderID == "" {
+		return nil
+	}
+
+	state, status, err := c.source.InstancePowerState(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to get the power state of the instance of node %s: %w", name, err)
+	}
+	logger := klog.FromContext(ctx).WithValues("node", klog.KObj(node), "status", status)
+	tainted, owned := hasOutOfServiceTaint(node)
+
+	switch state {
+	case PowerStateRunning:
+		c.forget(name)
+		if owned {
+			return c.removeTaint(ctx, node, status)
+		}
+	case PowerStateOff:
+		since := c.observeOff(name)
+		if tainted {
+			return nil
+		}
+		if isNodeReady(node) {
+			// The kubelet still runs, volumes must not be force detached
+			logger.V(2).Info("Instance is shut down but the node is ready, not tainting it")
+			return nil
+		}
+		if remaining := c.after - c.now().Sub(since); remaining > 0 {
+			c.queue.AddAfter(name, remaining)
+			return nil
+		}
+		return c.addTaint(ctx, node, status, since)
+	default:
+		// The instance must stay shut down for the whole delay
+		c.forget(name)
+	}
+	return nil
+}
+
+// observeOff returns when the instance of a node was first seen shut down
+func (c *Controller) observeOff(name string) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	since, ok := c.offSince[name]
+	if !ok {
+		since = c.now()
+		c.offSince[name] = since
+	}
+	return since
+}
+
+// forget forgets when the instance of a node was first seen shut down
+func (c *Controller) forget(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.offSince, name)
+}
+
+// addTaint adds the out-of-service taint to a node
+func (c *Controller) addTaint(ctx context.Context, node *v1.Node, status string, since time.Time) error {
+	taint := outOfServiceTaint()
+	taint.TimeAdded = &metav1.Time{Time: c.now()}
+	updated := node.DeepCopy()
+	updated.Spec.Taints = append(updated.Spec.Taints, taint)
+	if _, err := c.client.CoreV1().Nodes().Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to add the out-of-service taint to node %s: %w", node.Name, err)
+	}
+
+	klog.FromContext(ctx).Info("Added the out-of-service taint", "node", klog.KObj(node), "status", status, "since", since)
+	c.recorder.Eventf(node, v1.EventTypeWarning, EventReasonOutOfServiceTaintAdded,
+		"Instance has been %s since %s, added the %s taint", status, since.UTC().Format(time.RFC3339), v1.TaintNodeOutOfService)
+	return nil
+}
+
+// removeTaint removes the out-of-service taint added by the controller from a node
+func (c *Controller) removeTaint(ctx context.Context, node *v1.Node, status string) error {
+	updated := node.DeepCopy()
+	updated.Spec.Taints = withoutOwnedTaint(updated.Spec.Taints)
+	if _, err := c.client.CoreV1().Nodes().Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to remove the out-of-service taint from node %s: %w", node.Name, err)
+	}
+
+	klog.FromContext(ctx).Info("Removed the out-of-service taint", "node", klog.KObj(node), "status", status)
+	c.recorder.Eventf(node, v1.EventTypeNormal, EventReasonOutOfServiceTaintRemoved,
+		"Instance is %s again, removed the %s taint", status, v1.TaintNodeOutOfService)
+	return nil
+}
@@ -0,0 +1,208 @@
+package outofservice
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// fakeSource returns the power state configured for each node
+type fakeSource struct {
+	mu     sync.Mutex
+	states map[string]PowerState
+	calls  map[string]int
+}
+
+func (s *fakeSource) InstancePowerState(ctx context.Context, node *v1.Node) (PowerState, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[node.Name]++
+	state, ok := s.states[node.Name]
+	if !ok {
+		return "", "", errors.New("no power state")
+	}
+	return state, string(state), nil
+}
+
+func (s *fakeSource) set(name string, state PowerState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[name] = state
+}
+
+func testNode(name, providerID string, ready bool, taints ...v1.Taint) *v1.Node {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1.NodeSpec{ProviderID: providerID, Taints: taints},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}},
+		},
+	}
+}
+
+// testController is a controller whose node lister is fed from the fake client by sync
+type testController struct {
+	*Controller
+	t        *testing.T
+	client   *fake.Clientset
+	indexer  interface{ Update(obj interface{}) error }
+	source   *fakeSource
+	recorder *record.FakeRecorder
+	clock    time.Time
+}
+
+func newTestController(t *testing.T, nodes ...*v1.Node) *testController {
+	t.Helper()
+	client := fake.NewClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	nodeInformer := factory.Core().V1().Nodes()
+	for _, node := range nodes {
+		if _, err := client.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := nodeInformer.Informer().GetIndexer().Add(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := &fakeSource{states: map[string]PowerState{}, calls: map[string]int{}}
+	c, err := NewController(nodeInformer, client, source, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("NewController() failed: %v", err)
+	}
+	tc := &testController{
+		Controller: c,
+		t:          t,
+		client:     client,
+		indexer:    nodeInformer.Informer().GetIndexer(),
+		source:     source,
+		recorder:   record.NewFakeRecorder(10),
+		clock:      time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	c.recorder = tc.recorder
+	c.now = func() time.Time { return tc.clock }
+	return tc
+}
+
+// syncNode syncs a node and returns it as updated by the controller
+func (tc *testController) syncNode(name string) *v1.Node {
+	tc.t.Helper()
+	ctx := context.Background()
+	if err := tc.sync(ctx, name); err != nil {
+		tc.t.Fatalf("sync(%s) failed: %v", name, err)
+	}
+	node, err := tc.client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	if err := tc.indexer.Update(node); err != nil {
+		tc.t.Fatal(err)
+	}
+	return node
+}
+
+func tainted(node *v1.Node) bool {
+	_, owned := hasOutOfServiceTaint(node)
+	return owned
+}
+
+func TestController_TaintsShutDownNodes(t *testing.T) {
+	tc := newTestController(t, testNode("node", "nvidia-bmm://org/tenant/site/1", false))
+
+	tc.source.set("node", PowerStateOff)
+	if node := tc.syncNode("node"); tainted(node) {
+		t.Fatal("Expected the node not to be tainted before the delay")
+	}
+	tc.clock = tc.clock.Add(4 * time.Minute)
+	if node := tc.syncNode("node"); tainted(node) {
+		t.Fatal("Expected the node not to be tainted before the delay")
+	}
+	tc.clock = tc.clock.Add(time.Minute)
+	node := tc.syncNode("node")
+	if !tainted(node) {
+		t.Fatalf("Expected the node to be tainted after the delay, got %v", node.Spec.Taints)
+	}
+	if taint := node.Spec.Taints[0]; taint.TimeAdded == nil || !taint.TimeAdded.Time.Equal(tc.clock) {
+		t.Errorf("Expected the taint to be added at %s, got %v", tc.clock, taint.TimeAdded)
+	}
+
+	// The taint is kept while the instance reboots, and removed once it runs again
+	tc.source.set("node", PowerStateTransitioning)
+	if node := tc.syncNode("node"); !tainted(node) {
+		t.Fatal("Expected the taint to be kept while the instance is transitioning")
+	}
+	tc.source.set("node", PowerStateRunning)
+	if node := tc.syncNode("node"); tainted(node) || len(node.Spec.Taints) != 0 {
+		t.Fatalf("Expected the taint to be removed, got %v", node.Spec.Taints)
+	}
+
+	close(tc.recorder.Events)
+	var events []string
+	for event := range tc.recorder.Events {
+		events = append(events, event)
+	}
+	if len(events) != 2 ||
+		!strings.HasPrefix(events[0], "Warning "+EventReasonOutOfServiceTaintAdded) ||
+		!strings.HasPrefix(events[1], "Normal "+EventReasonOutOfServiceTaintRemoved) {
+		t.Errorf("Expected taint added and removed events, got %v", events)
+	}
+}
+
+func TestController_DelayRestarts(t *testing.T) {
+	tc := newTestController(t, testNode("node", "nvidia-bmm://org/tenant/site/1", false))
+
+	tc.source.set("node", PowerStateOff)
+	tc.syncNode("node")
+	tc.clock = tc.clock.Add(3 * time.Minute)
+	tc.source.set("node", PowerStateTransitioning)
+	tc.syncNode("node")
+
+	// The instance must stay shut down for the whole delay again
+	tc.source.set("node", PowerStateOff)
+	tc.syncNode("node")
+	tc.clock = tc.clock.Add(3 * time.Minute)
+	if node := tc.syncNode("node"); tainted(node) {
+		t.Fatal("Expected the delay to restart after the instance left the shutdown state")
+	}
+	tc.clock = tc.clock.Add(2 * time.Minute)
+	if node := tc.syncNode("node"); !tainted(node) {
+		t.Fatal("Expected the node to be tainted after the delay")
+	}
+}
+
+func TestController_LeavesNodesAlone(t *testing.T) {
+	byHand := v1.Taint{Key: v1.TaintNodeOutOfService, Value: "nodeshutdown", Effect: v1.TaintEffectNoExecute}
+	tc := newTestController(t,
+		testNode("ready-node", "nvidia-bmm://org/tenant/site/1", true),
+		testNode("tainted-node", "nvidia-bmm://org/tenant/site/2", false, byHand),
+		testNode("uninitialized-node", "", false),
+	)
+	tc.source.set("ready-node", PowerStateOff)
+	tc.source.set("tainted-node", PowerStateRunning)
+
+	tc.syncNode("ready-node")
+	tc.clock = tc.clock.Add(time.Hour)
+	if node := tc.syncNode("ready-node"); tainted(node) {
+		t.Error("Expected a ready node not to be tainted")
+	}
+	if node := tc.syncNode("tainted-node"); len(node.Spec.Taints) != 1 {
+		t.Errorf("Expected a taint applied by hand to be kept, got %v", node.Spec.Taints)
+	}
+	tc.syncNode("uninitialized-node")
+	if calls := tc.source.calls["uninitialized-node"]; calls != 0 {
+		t.Errorf("Expected no power state lookup for a node without provider ID, got %d", calls)
+	}
+}
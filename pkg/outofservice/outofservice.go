@@ -0,0 +1,82 @@
+package outofservice
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// TaintValue is the value of the out-of-service taints applied by the controller. Taints with
+// another value, e.g. applied by hand, are never removed.
+const TaintValue = "nvidia-bmm-shutdown"
+
+// Event reasons emitted on Node objects
+const (
+	EventReasonOutOfServiceTaintAdded   = "OutOfServiceTaintAdded"
+	EventReasonOutOfServiceTaintRemoved = "OutOfServiceTaintRemoved"
+)
+
+// PowerState is the power state of the instance of a node
+type PowerState string
+
+const (
+	// PowerStateRunning is an instance that is up, its node is taken back into service
+	PowerStateRunning PowerState = "Running"
+
+	// PowerStateOff is an instance that is powered off or shut down
+	PowerStateOff PowerState = "Off"
+
+	// PowerStateTransitioning is an instance that is neither running nor shut down, e.g.
+	// rebooting or provisioning. The taint of its node is left as is.
+	PowerStateTransitioning PowerState = "Transitioning"
+)
+
+// Source returns the power state of the instance of a node, with the instance status it was
+// computed from
+type Source interface {
+	InstancePowerState(ctx context.Context, node *v1.Node) (PowerState, string, error)
+}
+
+// outOfServiceTaint returns the out-of-service taint applied by the controller
+func outOfServiceTaint() v1.Taint {
+	return v1.Taint{
+		Key:    v1.TaintNodeOutOfService,
+		Value:  TaintValue,
+		Effect: v1.TaintEffectNoExecute,
+	}
+}
+
+// hasOutOfServiceTaint reports whether a node has an out-of-service taint, and whether it was
+// applied by the controller
+func hasOutOfServiceTaint(node *v1.Node) (tainted, owned bool) {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == v1.TaintNodeOutOfService {
+			tainted = true
+			owned = owned || (taint.Value == TaintValue && taint.Effect == v1.TaintEffectNoExecute)
+		}
+	}
+	return tainted, owned
+}
+
+// withoutOwnedTaint returns the taints of a node without the out-of-service taint applied by
+// the controller
+func withoutOwnedTaint(taints []v1.Taint) []v1.Taint {
+	var kept []v1.Taint
+	for _, taint := range taints {
+		if taint.Key == v1.TaintNodeOutOfService && taint.Value == TaintValue && taint.Effect == v1.TaintEffectNoExecute {
+			continue
+		}
+		kept = append(kept, taint)
+	}
+	return kept
+}
+
+// isNodeReady reports whether the kubelet of a node reports it ready
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
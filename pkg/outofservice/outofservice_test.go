@@ -0,0 +1,50 @@
+package outofservice
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestHasOutOfServiceTaint(t *testing.T) {
+	byHand := v1.Taint{Key: v1.TaintNodeOutOfService, Value: "nodeshutdown", Effect: v1.TaintEffectNoExecute}
+	other := v1.Taint{Key: "example.com/maintenance", Effect: v1.TaintEffectNoSchedule}
+
+	tests := []struct {
+		name        string
+		taints      []v1.Taint
+		wantTainted bool
+		wantOwned   bool
+		wantKept    []v1.Taint
+	}{
+		{
+			name: "no taint",
+		},
+		{
+			name:        "applied by the controller",
+			taints:      []v1.Taint{other, outOfServiceTaint()},
+			wantTainted: true,
+			wantOwned:   true,
+			wantKept:    []v1.Taint{other},
+		},
+		{
+			name:        "applied by hand",
+			taints:      []v1.Taint{byHand},
+			wantTainted: true,
+			wantKept:    []v1.Taint{byHand},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &v1.Node{Spec: v1.NodeSpec{Taints: tt.taints}}
+			tainted, owned := hasOutOfServiceTaint(node)
+			if tainted != tt.wantTainted || owned != tt.wantOwned {
+				t.Errorf("hasOutOfServiceTaint() = %v, %v, want %v, %v", tainted, owned, tt.wantTainted, tt.wantOwned)
+			}
+			if kept := withoutOwnedTaint(tt.taints); !reflect.DeepEqual(kept, tt.wantKept) {
+				t.Errorf("withoutOwnedTaint() = %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package poweraction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// ControllerName is the name of the power action controller
+const ControllerName = "power-action-controller"
+
+// Controller performs the power actions requested with the power action annotation of nodes,
+// and records their result in the power action condition and in events
+type Controller struct {
+	client      kubernetes.Interface
+	nodeLister  corelisters.NodeLister
+	nodesSynced cache.InformerSynced
+	queue       workqueue.TypedRateLimitingInterface[string]
+	source      Source
+	limiter     *rateLimiter
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+}
+
+// NewController creates a power action controller performing power actions through source
+// within limits
+func NewController(
+	nodeInformer coreinformers.NodeInformer, client kubernetes.Interface, source Source, limits Limits,
+) (*Controller, error) {
+	broadcaster := record.NewBroadcaster()
+	c := &Controller{
+		client:      client,
+		nodeLister:  nodeInformer.Lister(),
+		nodesSynced: nodeInformer.Informer().HasSynced,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: ControllerName},
+		),
+		source:      source,
+		limiter:     newRateLimiter(limits),
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: ControllerName}),
+	}
+
+	_, err := nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.enqueue(newObj)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add node event handler: %w", err)
+	}
+	return c, nil
+}
+
+// Run runs the controller until the context is done
+func (c *Controller) Run(ctx context.Context, workers int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	logger := klog.FromContext(ctx).WithValues("controller", ControllerName)
+	ctx = klog.NewContext(ctx, logger)
+	logger.Info("Starting power action controller",
+		"minInterval", c.limiter.limits.MinInterval, "maxPerHour", c.limiter.limits.MaxPerHour)
+	defer logger.Info("Shutting down power action controller")
+
+	c.broadcaster.StartStructuredLogging(4)
+	c.broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.client.CoreV1().Events("")})
+	defer c.broadcaster.Shutdown()
+
+	if !cache.WaitForNamedCacheSync(ControllerName, ctx.Done(), c.nodesSynced) {
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+	<-ctx.Done()
+}
+
+// enqueue adds a node requesting a power action to the work queue
+func (c *Controller) enqueue(obj interface{}) {
+	node, ok := obj.(*v1.Node)
+	if !ok {
+		return
+	}
+	if _, ok := node.Annotations[AnnotationPowerAction]; ok {
+		c.queue.Add(node.Name)
+	}
+}
+
+// runWorker processes work items until the queue is shut down
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+// processNextItem syncs a single node, requeueing it with backoff on error
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	name, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(name)
+
+	if err := c.sync(ctx, name); err != nil {
+		utilruntime.HandleErrorWithContext(ctx, err, "Failed to perform power action", "node", name)
+		c.queue.AddRateLimited(name)
+		return true
+	}
+	c.queue.Forget(name)
+	return true
+}
+
+// sync performs the power action requested on a node
+func (c *Controller) sync(ctx context.Context, name string) error {
+	node, err := c.nodeLister.Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	value, ok := node.Annotations[AnnotationPowerAction]
+	if !ok {
+		return nil
+	}
+	action := Action(value)
+	logger := klog.FromContext(ctx).WithValues("node", klog.KObj(node), "action", action)
+
+	if !validAction(action) {
+		if err := c.removeAnnotation(ctx, node); err != nil {
+			return err
+		}
+		c.report(ctx, node, v1.EventTypeWarning, EventReasonPowerActionFailed, v1.ConditionFalse, ReasonInvalidAction,
+			fmt.Sprintf("Unknown power action %q, expected one of %v", value, Actions))
+		return nil
+	}
+
+	if remaining := c.limiter.reserve(name, lastActionTime(node)); remaining > 0 {
+		// The annotation is kept, and the action performed once allowed
+		c.queue.AddAfter(name, remaining)
+		if condition := powerActionCondition(node); condition != nil && condition.Reason == ReasonRateLimited {
+			return nil
+		}
+		logger.Info("Power action rate limited", "remaining", remaining)
+		c.report(ctx, node, v1.EventTypeWarning, EventReasonPowerActionRateLimited, v1.ConditionFalse, ReasonRateLimited,
+			fmt.Sprintf("Power action %s is rate limited, retrying in %s", action, remaining.Round(time.Second)))
+		return nil
+	}
+
+	// The request is consumed before acting, so that failing to record the result never
+	// repeats the action
+	if err := c.removeAnnotation(ctx, node); err != nil {
+		c.limiter.release(name)
+		return err
+	}
+
+	err = c.source.PowerAction(ctx, node, action)
+	if !errors.Is(err, ErrUnsupportedAction) {
+		// A failed call may still have reached the instance, so it counts as performed too
+		if err := c.recordLastAction(ctx, name, c.limiter.now()); err != nil {
+			logger.Error(err, "Failed to record the last power action time")
+		}
+	}
+	switch {
+	case err == nil:
+		logger.Info("Performed power action")
+		c.report(ctx, node, v1.EventTypeNormal, EventReasonPowerActionSucceeded, v1.ConditionTrue, ReasonSucceeded,
+			fmt.Sprintf("Power action %s requested from NVIDIA BMM", action))
+	case errors.Is(err, ErrUnsupportedAction):
+		c.limiter.release(name)
+		c.report(ctx, node, v1.EventTypeWarning, EventReasonPowerActionFailed, v1.ConditionFalse, ReasonUnsupported,
+			fmt.Sprintf("Power action %s failed: %v", action, err))
+	default:
+		logger.Error(err, "Power action failed")
+		c.report(ctx, node, v1.EventTypeWarning, EventReasonPowerActionFailed, v1.ConditionFalse, ReasonFailed,
+			fmt.Sprintf("Power action %s failed: %v", action, err))
+	}
+	return nil
+}
+
+// report records the result of a power action request in an event and in the power action
+// condition of a node. Failing to set the condition is only logged, as the request is consumed.
+func (c *Controller) report(
+	ctx context.Context, node *v1.Node, eventType, eventReason string, status v1.ConditionStatus, reason, message string,
+) {
+	c.recorder.Event(node, eventType, eventReason, message)
+	if err := c.setCondition(ctx, node.Name, status, reason, message); err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to record the power action result", "node", klog.KObj(node))
+	}
+}
+
+// removeAnnotation removes the power action annotation of a node. The update fails when the
+// node changed since it was listed, so that a new request is not removed unseen.
+func (c *Controller) removeAnnotation(ctx context.Context, node *v1.Node) error {
+	updated := node.DeepCopy()
+	delete(updated.Annotations, AnnotationPowerAction)
+	if _, err := c.client.CoreV1().Nodes().Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to remove the power action annotation of node %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// recordLastAction sets the last power action annotation of a node
+func (c *Controller) recordLastAction(ctx context.Context, name string, performed time.Time) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := c.client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		updated := node.DeepCopy()
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		updated.Annotations[AnnotationLastPowerAction] = performed.UTC().Format(time.RFC3339)
+		_, err = c.client.CoreV1().Nodes().Update(ctx, updated, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set the last power action annotation of node %s: %w", name, err)
+	}
+	return nil
+}
+
+// setCondition sets the power action condition of a node
+func (c *Controller) setCondition(
+	ctx context.Context, name string, status v1.ConditionStatus, reason, message string,
+) error {
+	now := metav1.Now()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := c.client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		updated := node.DeepCopy()
+		condition := powerActionCondition(updated)
+		if condition == nil {
+			updated.Status.Conditions = append(updated.Status.Conditions, v1.NodeCondition{Type: ConditionPowerAction})
+			condition = &updated.Status.Conditions[len(updated.Status.Conditions)-1]
+		}
+		if condition.Status != status {
+			condition.LastTransitionTime = now
+		}
+		condition.Status = status
+		condition.Reason = reason
+		condition.Message = message
+		condition.LastHeartbeatTime = now
+		_, err = c.client.CoreV1().Nodes().UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set the power action condition of node %s: %w", name, err)
+	}
+	return nil
+}
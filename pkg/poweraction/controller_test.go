@@ -0,0 +1,273 @@
+package poweraction
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// fakeSource records the power actions performed and returns the error configured for each node
+type fakeSource struct {
+	mu      sync.Mutex
+	errs    map[string]error
+	actions []string
+}
+
+func (s *fakeSource) PowerAction(ctx context.Context, node *v1.Node, action Action) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if action != ActionReboot {
+		return ErrUnsupportedAction
+	}
+	s.actions = append(s.actions, node.Name+"/"+string(action))
+	return s.errs[node.Name]
+}
+
+func testNode(name string, action Action) *v1.Node {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if action != "" {
+		node.Annotations = map[string]string{AnnotationPowerAction: string(action)}
+	}
+	return node
+}
+
+// testController is a controller whose node lister is fed from the fake client by sync
+type testController struct {
+	*Controller
+	t        *testing.T
+	client   *fake.Clientset
+	indexer  interface{ Update(obj interface{}) error }
+	source   *fakeSource
+	recorder *record.FakeRecorder
+	clock    time.Time
+}
+
+func newTestController(t *testing.T, limits Limits, nodes ...*v1.Node) *testController {
+	t.Helper()
+	client := fake.NewClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	nodeInformer := factory.Core().V1().Nodes()
+	for _, node := range nodes {
+		if _, err := client.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := nodeInformer.Informer().GetIndexer().Add(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := &fakeSource{errs: map[string]error{}}
+	c, err := NewController(nodeInformer, client, source, limits)
+	if err != nil {
+		t.Fatalf("NewController() failed: %v", err)
+	}
+	tc := &testController{
+		Controller: c,
+		t:          t,
+		client:     client,
+		indexer:    nodeInformer.Informer().GetIndexer(),
+		source:     source,
+		recorder:   record.NewFakeRecorder(10),
+		clock:      time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	c.recorder = tc.recorder
+	c.limiter.now = func() time.Time { return tc.clock }
+	return tc
+}
+
+// syncNode syncs a node and returns it as updated by the controller
+func (tc *testController) syncNode(name string) *v1.Node {
+	tc.t.Helper()
+	ctx := context.Background()
+	if err := tc.sync(ctx, name); err != nil {
+		tc.t.Fatalf("sync(%s) failed: %v", name, err)
+	}
+	return tc.refresh(name)
+}
+
+// refresh feeds the lister with the node stored in the fake client
+func (tc *testController) refresh(name string) *v1.Node {
+	tc.t.Helper()
+	node, err := tc.client.CoreV1().Nodes().Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	if err := tc.indexer.Update(node); err != nil {
+		tc.t.Fatal(err)
+	}
+	return node
+}
+
+// request sets the power action annotation of a node
+func (tc *testController) request(name string, action Action) {
+	tc.t.Helper()
+	node := tc.refresh(name)
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[AnnotationPowerAction] = string(action)
+	if _, err := tc.client.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{}); err != nil {
+		tc.t.Fatal(err)
+	}
+	tc.refresh(name)
+}
+
+// events returns the events recorded so far
+func (tc *testController) events() []string {
+	var events []string
+	for {
+		select {
+		case event := <-tc.recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestController_PerformsPowerActions(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     Action
+		err        error
+		wantAction bool
+		wantStatus v1.ConditionStatus
+		wantReason string
+		wantEvent  string
+	}{
+		{
+			name:       "reboot",
+			action:     ActionReboot,
+			wantAction: true,
+			wantStatus: v1.ConditionTrue,
+			wantReason: ReasonSucceeded,
+			wantEvent:  "Normal " + EventReasonPowerActionSucceeded,
+		},
+		{
+			name:       "failed reboot",
+			action:     ActionReboot,
+			err:        errors.New("instance is busy"),
+			wantAction: true,
+			wantStatus: v1.ConditionFalse,
+			wantReason: ReasonFailed,
+			wantEvent:  "Warning " + EventReasonPowerActionFailed,
+		},
+		{
+			name:       "unsupported action",
+			action:     ActionPowerOff,
+			wantStatus: v1.ConditionFalse,
+			wantReason: ReasonUnsupported,
+			wantEvent:  "Warning " + EventReasonPowerActionFailed,
+		},
+		{
+			name:       "invalid action",
+			action:     "shutdown",
+			wantStatus: v1.ConditionFalse,
+			wantReason: ReasonInvalidAction,
+			wantEvent:  "Warning " + EventReasonPowerActionFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTestController(t, Limits{}, testNode("node", tt.action))
+			tc.source.errs["node"] = tt.err
+
+			node := tc.syncNode("node")
+			if _, ok := node.Annotations[AnnotationPowerAction]; ok {
+				t.Error("Expected the power action annotation to be removed")
+			}
+			if performed := len(tc.source.actions) == 1; performed != tt.wantAction {
+				t.Errorf("Expected the action to be performed: %v, got %v", tt.wantAction, tc.source.actions)
+			}
+			condition := powerActionCondition(node)
+			if condition == nil || condition.Status != tt.wantStatus || condition.Reason != tt.wantReason {
+				t.Fatalf("Expected a %s condition with reason %s, got %+v", tt.wantStatus, tt.wantReason, condition)
+			}
+			if events := tc.events(); len(events) != 1 || !strings.HasPrefix(events[0], tt.wantEvent) {
+				t.Errorf("Expected a %s event, got %v", tt.wantEvent, events)
+			}
+
+			// The request is consumed, syncing again does nothing
+			tc.syncNode("node")
+			if len(tc.source.actions) > 1 {
+				t.Errorf("Expected the action to be performed at most once, got %v", tc.source.actions)
+			}
+		})
+	}
+}
+
+func TestController_RateLimitsPowerActions(t *testing.T) {
+	tc := newTestController(t, Limits{MinInterval: 30 * time.Minute},
+		testNode("node", ActionReboot), testNode("other-node", ""))
+
+	tc.syncNode("node")
+	tc.events()
+
+	// A second request within the interval is kept until it is allowed
+	tc.clock = tc.clock.Add(10 * time.Minute)
+	tc.request("node", ActionReboot)
+	node := tc.syncNode("node")
+	if node.Annotations[AnnotationPowerAction] != string(ActionReboot) {
+		t.Fatal("Expected the power action annotation to be kept while rate limited")
+	}
+	if condition := powerActionCondition(node); condition == nil || condition.Reason != ReasonRateLimited {
+		t.Fatalf("Expected a rate limited condition, got %+v", condition)
+	}
+	tc.syncNode("node")
+	if events := tc.events(); len(events) != 1 || !strings.HasPrefix(events[0], "Warning "+EventReasonPowerActionRateLimited) {
+		t.Errorf("Expected a single rate limited event, got %v", events)
+	}
+
+	// Other nodes are not limited by the per node interval
+	tc.request("other-node", ActionReboot)
+	tc.syncNode("other-node")
+
+	tc.clock = tc.clock.Add(20 * time.Minute)
+	node = tc.syncNode("node")
+	if _, ok := node.Annotations[AnnotationPowerAction]; ok {
+		t.Error("Expected the power action annotation to be removed once allowed")
+	}
+	if condition := powerActionCondition(node); condition == nil || condition.Reason != ReasonSucceeded {
+		t.Errorf("Expected a succeeded condition, got %+v", condition)
+	}
+	want := []string{"node/reboot", "other-node/reboot", "node/reboot"}
+	if strings.Join(tc.source.actions, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected actions %v, got %v", want, tc.source.actions)
+	}
+}
+
+func TestController_IntervalSurvivesRestarts(t *testing.T) {
+	tc := newTestController(t, Limits{MinInterval: 30 * time.Minute}, testNode("node", ActionReboot))
+	node := tc.syncNode("node")
+	if node.Annotations[AnnotationLastPowerAction] != tc.clock.Format(time.RFC3339) {
+		t.Fatalf("Expected the last power action to be recorded at %s, got %v", tc.clock, node.Annotations)
+	}
+
+	// Reports of actions not performed do not reset the last power action
+	tc.request("node", "shutdown")
+	tc.syncNode("node")
+	tc.request("node", ActionPowerOff)
+	tc.syncNode("node")
+
+	// A restarted controller still enforces the interval
+	tc.request("node", ActionReboot)
+	node = tc.refresh("node")
+	restarted := newTestController(t, Limits{MinInterval: 30 * time.Minute}, node)
+	restarted.clock = tc.clock.Add(10 * time.Minute)
+	node = restarted.syncNode("node")
+	if condition := powerActionCondition(node); condition == nil || condition.Reason != ReasonRateLimited {
+		t.Fatalf("Expected a rate limited condition after a restart, got %+v", condition)
+	}
+	if len(restarted.source.actions) != 0 {
+		t.Errorf("Expected no power action within the interval, got %v", restarted.source.actions)
+	}
+}
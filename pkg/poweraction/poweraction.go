@@ -0,0 +1,167 @@
+package poweraction
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// AnnotationPowerAction requests a power action on the instance of a node. The controller
+// removes it before acting, so that each request is acted on at most once.
+const AnnotationPowerAction = "bmm.nvidia.com/power-action"
+
+// AnnotationLastPowerAction records when the last power action on the instance of a node was
+// performed, so that the per node interval survives restarts and later reports
+const AnnotationLastPowerAction = "bmm.nvidia.com/last-power-action"
+
+// ConditionPowerAction is the node condition recording the result of the last power action
+const ConditionPowerAction v1.NodeConditionType = "NvidiaBMMPowerAction"
+
+// Reasons of the power action condition
+const (
+	ReasonSucceeded     = "Succeeded"
+	ReasonFailed        = "Failed"
+	ReasonUnsupported   = "Unsupported"
+	ReasonInvalidAction = "InvalidAction"
+	ReasonRateLimited   = "RateLimited"
+)
+
+// Event reasons emitted on Node objects
+const (
+	EventReasonPowerActionSucceeded   = "PowerActionSucceeded"
+	EventReasonPowerActionFailed      = "PowerActionFailed"
+	EventReasonPowerActionRateLimited = "PowerActionRateLimited"
+)
+
+// Action is a power action on the instance of a node
+type Action string
+
+const (
+	ActionReboot     Action = "reboot"
+	ActionPowerCycle Action = "power-cycle"
+	ActionPowerOff   Action = "power-off"
+)
+
+// Actions are the power actions that can be requested, in the order they are documented
+var Actions = []Action{ActionReboot, ActionPowerCycle, ActionPowerOff}
+
+// ErrUnsupportedAction is returned by a Source that cannot perform a power action
+var ErrUnsupportedAction = errors.New("power action not supported")
+
+// Source performs power actions on the instances of nodes
+type Source interface {
+	PowerAction(ctx context.Context, node *v1.Node, action Action) error
+}
+
+// Limits bound how often power actions are performed
+type Limits struct {
+	// MinInterval is the minimum time between two power actions on the same node
+	MinInterval time.Duration
+
+	// MaxPerHour is the number of power actions allowed on all nodes within an hour,
+	// no limit when zero
+	MaxPerHour int
+}
+
+// validAction reports whether a power action can be requested
+func validAction(action Action) bool {
+	for _, valid := range Actions {
+		if action == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimiter enforces the power action limits. Actions are tracked in memory, and the last
+// action on a node is also taken from its last power action annotation, so that a restart does
+// not reset the per node interval.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limits  Limits
+	now     func() time.Time
+	last    map[string]time.Time
+	actions []time.Time
+}
+
+// newRateLimiter creates a rate limiter enforcing limits
+func newRateLimiter(limits Limits) *rateLimiter {
+	return &rateLimiter{
+		limits: limits,
+		now:    time.Now,
+		last:   make(map[string]time.Time),
+	}
+}
+
+// reserve returns how long to wait before a power action on a node is allowed. When it is
+// allowed right away, the action is recorded and zero is returned.
+func (r *rateLimiter) reserve(node string, lastAction time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if last, ok := r.last[node]; ok && last.After(lastAction) {
+		lastAction = last
+	}
+	if !lastAction.IsZero() {
+		if wait := r.limits.MinInterval - now.Sub(lastAction); wait > 0 {
+			return wait
+		}
+	}
+
+	// Forget the actions older than an hour
+	kept := r.actions[:0]
+	for _, action := range r.actions {
+		if now.Sub(action) < time.Hour {
+			kept = append(kept, action)
+		}
+	}
+	r.actions = kept
+	if r.limits.MaxPerHour > 0 && len(r.actions) >= r.limits.MaxPerHour {
+		return r.actions[0].Add(time.Hour).Sub(now)
+	}
+
+	r.last[node] = now
+	r.actions = append(r.actions, now)
+	return 0
+}
+
+// release forgets the last action reserved for a node, when it was not performed
+func (r *rateLimiter) release(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last, ok := r.last[node]
+	if !ok {
+		return
+	}
+	delete(r.last, node)
+	for i := len(r.actions) - 1; i >= 0; i-- {
+		if r.actions[i].Equal(last) {
+			r.actions = append(r.actions[:i], r.actions[i+1:]...)
+			break
+		}
+	}
+}
+
+// powerActionCondition returns the power action condition of a node, or nil
+func powerActionCondition(node *v1.Node) *v1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == ConditionPowerAction {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// lastActionTime returns when the last power action on a node was performed according to its
+// last power action annotation, or the zero time
+func lastActionTime(node *v1.Node) time.Time {
+	last, err := time.Parse(time.RFC3339, node.Annotations[AnnotationLastPowerAction])
+	if err != nil {
+		return time.Time{}
+	}
+	return last
+}
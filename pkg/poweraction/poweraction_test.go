@@ -0,0 +1,113 @@
+package poweraction
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type step struct {
+		after      time.Duration
+		node       string
+		lastAction time.Time
+		release    bool
+		want       time.Duration
+	}
+	tests := []struct {
+		name   string
+		limits Limits
+		steps  []step
+	}{
+		{
+			name:   "per node interval",
+			limits: Limits{MinInterval: 30 * time.Minute},
+			steps: []step{
+				{node: "a"},
+				{after: 10 * time.Minute, node: "a", want: 20 * time.Minute},
+				{node: "b"},
+				{after: 20 * time.Minute, node: "a"},
+			},
+		},
+		{
+			name:   "interval from the node condition",
+			limits: Limits{MinInterval: 30 * time.Minute},
+			steps: []step{
+				{node: "a", lastAction: start.Add(-10 * time.Minute), want: 20 * time.Minute},
+				{after: 20 * time.Minute, node: "a", lastAction: start.Add(-10 * time.Minute)},
+			},
+		},
+		{
+			name:   "hourly cap",
+			limits: Limits{MaxPerHour: 2},
+			steps: []step{
+				{node: "a"},
+				{after: 10 * time.Minute, node: "b"},
+				{after: 10 * time.Minute, node: "c", want: 40 * time.Minute},
+				{after: 40 * time.Minute, node: "c"},
+				{node: "d", want: 10 * time.Minute},
+			},
+		},
+		{
+			name:   "released actions are not counted",
+			limits: Limits{MinInterval: 30 * time.Minute, MaxPerHour: 1},
+			steps: []step{
+				{node: "a", release: true},
+				{node: "a"},
+				{node: "b", want: time.Hour},
+			},
+		},
+		{
+			name: "no limits",
+			steps: []step{
+				{node: "a"},
+				{node: "a"},
+				{node: "a"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			r := newRateLimiter(tt.limits)
+			r.now = func() time.Time { return now }
+			for i, s := range tt.steps {
+				now = now.Add(s.after)
+				if got := r.reserve(s.node, s.lastAction); got != s.want {
+					t.Fatalf("step %d: reserve(%s) = %s, want %s", i, s.node, got, s.want)
+				}
+				if s.release {
+					r.release(s.node)
+				}
+			}
+		})
+	}
+}
+
+func TestLastActionTime(t *testing.T) {
+	performed := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		annotation string
+		want       time.Time
+	}{
+		{name: "recorded action", annotation: performed.Format(time.RFC3339), want: performed},
+		{name: "invalid time", annotation: "yesterday"},
+		{name: "no annotation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &v1.Node{}
+			if tt.annotation != "" {
+				node.Annotations = map[string]string{AnnotationLastPowerAction: tt.annotation}
+			}
+			if got := lastActionTime(node); !got.Equal(tt.want) {
+				t.Errorf("lastActionTime() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
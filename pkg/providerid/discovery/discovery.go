@@ -0,0 +1,206 @@
+// Package discovery finds the NVIDIA BMM instance ID of the host it runs on, so that the
+// kubelet can be started with the right provider ID without per-node configuration.
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+// Source is a place the instance ID of the host can be read from
+type Source string
+
+const (
+	// SourceMetadata reads the instance ID from the BMM machine metadata service
+	SourceMetadata Source = "metadata"
+
+	// SourceDMI reads the instance ID from the DMI system UUID
+	SourceDMI Source = "dmi"
+
+	// SourceCloudInit reads the instance ID from the cloud-init instance data
+	SourceCloudInit Source = "cloud-init"
+)
+
+const (
+	// DefaultMetadataURL is the base URL of the BMM machine metadata service
+	DefaultMetadataURL = "http://169.254.169.254/latest/meta-data"
+
+	// Paths relative to the filesystem root
+	dmiProductUUIDPath        = "sys/class/dmi/id/product_uuid"
+	cloudInitInstanceDataPath = "run/cloud-init/instance-data.json"
+	cloudInitInstanceIDPath   = "var/lib/cloud/data/instance-id"
+
+	// metadataTimeout bounds a metadata service request, which must not stall the boot
+	metadataTimeout = 2 * time.Second
+
+	// maxMetadataSize bounds the size of a metadata service response
+	maxMetadataSize = 4096
+)
+
+// DefaultSources is the order in which sources are tried
+var DefaultSources = []Source{SourceMetadata, SourceDMI, SourceCloudInit}
+
+// Discoverer finds the instance ID of the host
+type Discoverer struct {
+	// Root is the filesystem root sysfs and cloud-init files are read from, "/" on a host
+	Root string
+
+	// MetadataURL is the base URL of the BMM machine metadata service
+	MetadataURL string
+
+	// HTTPClient is used for metadata service requests
+	HTTPClient *http.Client
+
+	// Sources are tried in order until one returns an instance ID
+	Sources []Source
+}
+
+// NewDiscoverer creates a Discoverer for the local host with the default sources
+func NewDiscoverer() *Discoverer {
+	return &Discoverer{
+		Root:        "/",
+		MetadataURL: DefaultMetadataURL,
+		HTTPClient:  &http.Client{Timeout: metadataTimeout},
+		Sources:     DefaultSources,
+	}
+}
+
+// InstanceID returns the instance ID from the first source that provides one, and that source
+func (d *Discoverer) InstanceID(ctx context.Context) (uuid.UUID, Source, error) {
+	var errs []error
+	for _, source := range d.Sources {
+		var id uuid.UUID
+		var err error
+		switch source {
+		case SourceMetadata:
+			id, err = d.fromMetadata(ctx)
+		case SourceDMI:
+			id, err = d.fromDMI()
+		case SourceCloudInit:
+			id, err = d.fromCloudInit()
+		default:
+			err = errors.New("unknown source")
+		}
+		if err == nil {
+			return id, source, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", source, err))
+	}
+	return uuid.UUID{}, "", fmt.Errorf("no source provided an instance ID: %w", errors.Join(errs...))
+}
+
+// ProviderID returns the provider ID of the host for the given org, tenant and site
+func (d *Discoverer) ProviderID(ctx context.Context, orgName, tenantName, siteName string) (*providerid.ProviderID, Source, error) {
+	id, source, err := d.InstanceID(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return providerid.NewProviderID(orgName, tenantName, siteName, id), source, nil
+}
+
+// fromMetadata reads the instance ID from the instance-id key of the metadata service
+func (d *Discoverer) fromMetadata(ctx context.Context) (uuid.UUID, error) {
+	if d.MetadataURL == "" {
+		return uuid.UUID{}, errors.New("metadata service URL not set")
+	}
+	client := d.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: metadataTimeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(d.MetadataURL, "/")+"/instance-id", nil)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return uuid.UUID{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	return parseInstanceID(string(body))
+}
+
+// fromDMI reads the instance ID from the DMI system UUID, which requires root privileges
+func (d *Discoverer) fromDMI() (uuid.UUID, error) {
+	data, err := os.ReadFile(d.path(dmiProductUUIDPath))
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	id, err := parseInstanceID(string(data))
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	// Firmware without a system UUID reports all zeros or all ones
+	if id == uuid.Nil || id == uuid.Max {
+		return uuid.UUID{}, fmt.Errorf("system UUID %s is not set", id)
+	}
+	return id, nil
+}
+
+// fromCloudInit reads the instance ID from the cloud-init instance data, falling back
+// to the instance-id file cloud-init keeps for older releases
+func (d *Discoverer) fromCloudInit() (uuid.UUID, error) {
+	data, err := os.ReadFile(d.path(cloudInitInstanceDataPath))
+	if err == nil {
+		var instanceData struct {
+			V1 struct {
+				InstanceID string `json:"instance_id"`
+			} `json:"v1"`
+		}
+		if err := json.Unmarshal(data, &instanceData); err != nil {
+			return uuid.UUID{}, fmt.Errorf("failed to parse %s: %w", cloudInitInstanceDataPath, err)
+		}
+		return parseInstanceID(instanceData.V1.InstanceID)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return uuid.UUID{}, err
+	}
+
+	data, err = os.ReadFile(d.path(cloudInitInstanceIDPath))
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	return parseInstanceID(string(data))
+}
+
+// path returns the path of a file relative to the filesystem root
+func (d *Discoverer) path(rel string) string {
+	root := d.Root
+	if root == "" {
+		root = "/"
+	}
+	return filepath.Join(root, rel)
+}
+
+// parseInstanceID parses an instance ID, ignoring surrounding whitespace
+func parseInstanceID(value string) (uuid.UUID, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return uuid.UUID{}, errors.New("empty instance ID")
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("invalid instance ID %q: %w", value, err)
+	}
+	return id, nil
+}
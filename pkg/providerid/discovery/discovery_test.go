@@ -0,0 +1,152 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// writeFile writes a file below the fake filesystem root
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInstanceID(t *testing.T) {
+	metadataID := uuid.New()
+	dmiID := uuid.New()
+	cloudInitID := uuid.New()
+
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/latest/meta-data/instance-id" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(metadataID.String() + "\n"))
+	}))
+	defer metadata.Close()
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	tests := []struct {
+		name        string
+		files       map[string]string
+		metadataURL string
+		sources     []Source
+		want        uuid.UUID
+		wantSource  Source
+		wantErr     string
+	}{
+		{
+			name:        "metadata service",
+			metadataURL: metadata.URL + "/latest/meta-data",
+			files:       map[string]string{dmiProductUUIDPath: dmiID.String()},
+			sources:     DefaultSources,
+			want:        metadataID,
+			wantSource:  SourceMetadata,
+		},
+		{
+			name:        "falls back to DMI when the metadata service is unavailable",
+			metadataURL: unavailable.URL,
+			files:       map[string]string{dmiProductUUIDPath: strings.ToUpper(dmiID.String()) + "\n"},
+			sources:     DefaultSources,
+			want:        dmiID,
+			wantSource:  SourceDMI,
+		},
+		{
+			name: "skips an unset DMI system UUID",
+			files: map[string]string{
+				dmiProductUUIDPath:        uuid.Nil.String(),
+				cloudInitInstanceDataPath: `{"v1": {"instance_id": "` + cloudInitID.String() + `"}}`,
+			},
+			sources:    []Source{SourceDMI, SourceCloudInit},
+			want:       cloudInitID,
+			wantSource: SourceCloudInit,
+		},
+		{
+			name:       "cloud-init instance-id file",
+			files:      map[string]string{cloudInitInstanceIDPath: cloudInitID.String() + "\n"},
+			sources:    []Source{SourceCloudInit},
+			want:       cloudInitID,
+			wantSource: SourceCloudInit,
+		},
+		{
+			name:    "cloud-init instance ID is not a UUID",
+			files:   map[string]string{cloudInitInstanceDataPath: `{"v1": {"instance_id": "iid-datasource-none"}}`},
+			sources: []Source{SourceCloudInit},
+			wantErr: `invalid instance ID "iid-datasource-none"`,
+		},
+		{
+			name:    "no source",
+			sources: []Source{SourceDMI, SourceCloudInit},
+			wantErr: "no source provided an instance ID",
+		},
+		{
+			name:    "unknown source",
+			sources: []Source{"bios"},
+			wantErr: "bios: unknown source",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for rel, content := range tt.files {
+				writeFile(t, root, rel, content)
+			}
+
+			d := NewDiscoverer()
+			d.Root = root
+			d.MetadataURL = tt.metadataURL
+			d.Sources = tt.sources
+
+			got, source, err := d.InstanceID(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InstanceID() failed: %v", err)
+			}
+			if got != tt.want || source != tt.wantSource {
+				t.Errorf("InstanceID() = %s from %s, want %s from %s", got, source, tt.want, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestProviderID(t *testing.T) {
+	id := uuid.New()
+	root := t.TempDir()
+	writeFile(t, root, dmiProductUUIDPath, id.String())
+
+	d := NewDiscoverer()
+	d.Root = root
+	d.Sources = []Source{SourceDMI}
+
+	providerID, _, err := d.ProviderID(context.Background(), "test-org", "test-tenant", "test-site")
+	if err != nil {
+		t.Fatalf("ProviderID() failed: %v", err)
+	}
+	want := "nvidia-bmm://test-org/test-tenant/test-site/" + id.String()
+	if providerID.String() != want {
+		t.Errorf("Expected %s, got %s", want, providerID)
+	}
+}
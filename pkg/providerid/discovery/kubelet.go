@@ -0,0 +1,59 @@
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+const (
+	// DefaultKubeletConfigDir is the kubelet configuration drop-in directory passed with --config-dir
+	DefaultKubeletConfigDir = "/etc/kubernetes/kubelet.conf.d"
+
+	// DropInFileName is the name of the drop-in written to the kubelet configuration directory.
+	// The kubelet only reads drop-ins with the .conf extension.
+	DropInFileName = "10-nvidia-bmm-provider-id.conf"
+)
+
+// KubeletDropIn returns a KubeletConfiguration drop-in setting the provider ID
+func KubeletDropIn(providerID *providerid.ProviderID) []byte {
+	return []byte(fmt.Sprintf(`# Generated by nvidia-bmm-cloud-controller-manager providerid
+apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+providerID: %q
+`, providerID.String()))
+}
+
+// WriteKubeletDropIn atomically writes the provider ID drop-in to the kubelet configuration
+// directory and returns its path
+func WriteKubeletDropIn(dir string, providerID *providerid.ProviderID) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+DropInFileName+".*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create drop-in: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(KubeletDropIn(providerID)); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("failed to write drop-in: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("failed to write drop-in: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write drop-in: %w", err)
+	}
+
+	path := filepath.Join(dir, DropInFileName)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to install drop-in: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,49 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+func TestWriteKubeletDropIn(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "kubelet.conf.d")
+	id := uuid.MustParse("12345678-1234-1234-1234-123456789abc")
+	providerID := providerid.NewProviderID("test-org", "test-tenant", "test-site", id)
+
+	// Writing twice replaces the drop-in rather than failing or leaving temporary files
+	for i := 0; i < 2; i++ {
+		path, err := WriteKubeletDropIn(dir, providerID)
+		if err != nil {
+			t.Fatalf("WriteKubeletDropIn() failed: %v", err)
+		}
+		if path != filepath.Join(dir, DropInFileName) {
+			t.Errorf("Unexpected drop-in path %s", path)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, DropInFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Generated by nvidia-bmm-cloud-controller-manager providerid
+apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+providerID: "nvidia-bmm://test-org/test-tenant/test-site/12345678-1234-1234-1234-123456789abc"
+`
+	if string(data) != want {
+		t.Errorf("Unexpected drop-in:\n%s\nwant:\n%s", data, want)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the drop-in in %s, got %d entries", dir, len(entries))
+	}
+}
@@ -2,6 +2,7 @@ package providerid
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/google/uuid"
@@ -9,11 +10,29 @@ import (
 
 const ProviderPrefix = "nvidia-bmm://"
 
+// ParseMode selects how strictly a provider ID string is parsed.
+type ParseMode int
+
+const (
+	// ParseLenient accepts the legacy 3-segment format, surrounding whitespace,
+	// non-canonical escaping and any instance ID format accepted by uuid.Parse.
+	ParseLenient ParseMode = iota
+
+	// ParseStrict only accepts the 4-segment format with non-empty segments, exactly
+	// as produced by String: canonical escaping and a lowercase hyphenated instance ID.
+	ParseStrict
+)
+
 // ProviderID represents a parsed NVIDIA BMM provider ID.
 // Format: nvidia-bmm://org/tenant/site/instance-id
+//
+// Segments are percent-escaped in the string form, so names containing "/", spaces
+// or other reserved characters round-trip. A ProviderID without a tenant is written
+// in the legacy 3-segment format.
 type ProviderID struct {
 	OrgName    string
 	TenantName string
+	// SiteName is the site name or UUID, as written by kubelet
 	SiteName   string
 	InstanceID uuid.UUID
 }
@@ -30,46 +49,121 @@ func NewProviderID(orgName, tenantName, siteName string, instanceID uuid.UUID) *
 
 // String returns the provider ID string representation.
 func (p *ProviderID) String() string {
-	return fmt.Sprintf("%s%s/%s/%s/%s", ProviderPrefix, p.OrgName, p.TenantName, p.SiteName, p.InstanceID.String())
+	segments := []string{url.PathEscape(p.OrgName)}
+	if p.TenantName != "" {
+		segments = append(segments, url.PathEscape(p.TenantName))
+	}
+	segments = append(segments, url.PathEscape(p.SiteName), p.InstanceID.String())
+	return ProviderPrefix + strings.Join(segments, "/")
+}
+
+// IsLegacy reports whether the provider ID has no tenant, as in the legacy 3-segment format.
+func (p *ProviderID) IsLegacy() bool {
+	return p.TenantName == ""
+}
+
+// Canonical returns a copy of the provider ID with lowercase org, tenant and site names.
+// NVIDIA BMM names are matched case-insensitively, so two provider IDs refer to the same
+// instance when their canonical forms are identical.
+func (p *ProviderID) Canonical() *ProviderID {
+	return &ProviderID{
+		OrgName:    strings.ToLower(p.OrgName),
+		TenantName: strings.ToLower(p.TenantName),
+		SiteName:   strings.ToLower(p.SiteName),
+		InstanceID: p.InstanceID,
+	}
+}
+
+// Equal reports whether two provider IDs have the same canonical form.
+func (p *ProviderID) Equal(other *ProviderID) bool {
+	if p == nil || other == nil {
+		return p == other
+	}
+	return *p.Canonical() == *other.Canonical()
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p ProviderID) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, parsing leniently.
+func (p *ProviderID) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text), ParseLenient)
+	if err != nil {
+		return err
+	}
+	*p = *parsed
+	return nil
 }
 
-// ParseProviderID parses a provider ID string.
+// ParseProviderID parses a provider ID string leniently.
 // Supports both legacy 3-segment format (nvidia-bmm://org/site/id) and
 // new 4-segment format (nvidia-bmm://org/tenant/site/id).
 func ParseProviderID(providerIDStr string) (*ProviderID, error) {
-	if !strings.HasPrefix(providerIDStr, ProviderPrefix) {
+	return Parse(providerIDStr, ParseLenient)
+}
+
+// Parse parses a provider ID string in the given mode.
+func Parse(providerIDStr string, mode ParseMode) (*ProviderID, error) {
+	value := providerIDStr
+	if mode == ParseLenient {
+		value = strings.TrimSpace(value)
+	}
+	if !strings.HasPrefix(value, ProviderPrefix) {
 		return nil, fmt.Errorf("invalid provider ID prefix, expected %q: %s", ProviderPrefix, providerIDStr)
 	}
 
-	trimmed := strings.TrimPrefix(providerIDStr, ProviderPrefix)
+	trimmed := strings.TrimPrefix(value, ProviderPrefix)
 	parts := strings.Split(trimmed, "/")
 
+	var org, tenant, site, id string
 	switch len(parts) {
 	case 3:
 		// Legacy format: nvidia-bmm://org/site/instance-id
-		instanceID, err := uuid.Parse(parts[2])
-		if err != nil {
-			return nil, fmt.Errorf("invalid instance ID %q: %w", parts[2], err)
+		if mode == ParseStrict {
+			return nil, fmt.Errorf("legacy 3-segment provider ID is not accepted in strict mode: %s", providerIDStr)
 		}
-		return &ProviderID{
-			OrgName:    parts[0],
-			TenantName: "",
-			SiteName:   parts[1],
-			InstanceID: instanceID,
-		}, nil
+		org, site, id = parts[0], parts[1], parts[2]
 	case 4:
 		// New format: nvidia-bmm://org/tenant/site/instance-id
-		instanceID, err := uuid.Parse(parts[3])
-		if err != nil {
-			return nil, fmt.Errorf("invalid instance ID %q: %w", parts[3], err)
-		}
-		return &ProviderID{
-			OrgName:    parts[0],
-			TenantName: parts[1],
-			SiteName:   parts[2],
-			InstanceID: instanceID,
-		}, nil
+		org, tenant, site, id = parts[0], parts[1], parts[2], parts[3]
 	default:
 		return nil, fmt.Errorf("invalid provider ID format, expected 3 or 4 segments: %s", providerIDStr)
 	}
+
+	instanceID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance ID %q: %w", id, err)
+	}
+	if mode == ParseStrict && instanceID.String() != id {
+		return nil, fmt.Errorf("instance ID %q is not in canonical form %q", id, instanceID.String())
+	}
+
+	p := &ProviderID{InstanceID: instanceID}
+	for _, segment := range []struct {
+		name  string
+		raw   string
+		value *string
+	}{
+		{"org", org, &p.OrgName},
+		{"tenant", tenant, &p.TenantName},
+		{"site", site, &p.SiteName},
+	} {
+		unescaped, err := url.PathUnescape(segment.raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s segment %q: %w", segment.name, segment.raw, err)
+		}
+		if mode == ParseStrict {
+			if unescaped == "" {
+				return nil, fmt.Errorf("empty %s segment in provider ID: %s", segment.name, providerIDStr)
+			}
+			if url.PathEscape(unescaped) != segment.raw {
+				return nil, fmt.Errorf("%s segment %q is not in canonical form %q", segment.name, segment.raw, url.PathEscape(unescaped))
+			}
+		}
+		*segment.value = unescaped
+	}
+
+	return p, nil
 }
@@ -0,0 +1,295 @@
+package providerid
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const testInstanceID = "8b1f7a4e-3c2d-4e5f-9a6b-1c2d3e4f5a6b"
+
+func TestString(t *testing.T) {
+	id := uuid.MustParse(testInstanceID)
+
+	tests := []struct {
+		name string
+		pid  *ProviderID
+		want string
+	}{
+		{
+			name: "plain segments",
+			pid:  NewProviderID("org", "tenant", "site", id),
+			want: "nvidia-bmm://org/tenant/site/" + testInstanceID,
+		},
+		{
+			name: "legacy without tenant",
+			pid:  NewProviderID("org", "", "site", id),
+			want: "nvidia-bmm://org/site/" + testInstanceID,
+		},
+		{
+			name: "reserved characters are escaped",
+			pid:  NewProviderID("my org", "a/b", "site?1", id),
+			want: "nvidia-bmm://my%20org/a%2Fb/site%3F1/" + testInstanceID,
+		},
+		{
+			name: "case is preserved",
+			pid:  NewProviderID("Org", "Tenant", "SITE", id),
+			want: "nvidia-bmm://Org/Tenant/SITE/" + testInstanceID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pid.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	id := uuid.MustParse(testInstanceID)
+
+	tests := []struct {
+		name      string
+		input     string
+		mode      ParseMode
+		want      *ProviderID
+		wantErr   bool
+		wantError string
+	}{
+		{
+			name:  "new format",
+			input: "nvidia-bmm://org/tenant/site/" + testInstanceID,
+			mode:  ParseStrict,
+			want:  NewProviderID("org", "tenant", "site", id),
+		},
+		{
+			name:  "escaped segments",
+			input: "nvidia-bmm://my%20org/a%2Fb/site/" + testInstanceID,
+			mode:  ParseStrict,
+			want:  NewProviderID("my org", "a/b", "site", id),
+		},
+		{
+			name:  "legacy format lenient",
+			input: "nvidia-bmm://org/site/" + testInstanceID,
+			mode:  ParseLenient,
+			want:  NewProviderID("org", "", "site", id),
+		},
+		{
+			name:      "legacy format strict",
+			input:     "nvidia-bmm://org/site/" + testInstanceID,
+			mode:      ParseStrict,
+			wantError: "legacy 3-segment",
+		},
+		{
+			name:  "uppercase instance ID lenient",
+			input: "nvidia-bmm://org/tenant/site/" + strings.ToUpper(testInstanceID),
+			mode:  ParseLenient,
+			want:  NewProviderID("org", "tenant", "site", id),
+		},
+		{
+			name:      "uppercase instance ID strict",
+			input:     "nvidia-bmm://org/tenant/site/" + strings.ToUpper(testInstanceID),
+			mode:      ParseStrict,
+			wantError: "canonical form",
+		},
+		{
+			name:  "surrounding whitespace lenient",
+			input: "  nvidia-bmm://org/tenant/site/" + testInstanceID + "\n",
+			mode:  ParseLenient,
+			want:  NewProviderID("org", "tenant", "site", id),
+		},
+		{
+			name:      "surrounding whitespace strict",
+			input:     " nvidia-bmm://org/tenant/site/" + testInstanceID,
+			mode:      ParseStrict,
+			wantError: "invalid provider ID prefix",
+		},
+		{
+			name:  "non-canonical escaping lenient",
+			input: "nvidia-bmm://%6Frg/tenant/site/" + testInstanceID,
+			mode:  ParseLenient,
+			want:  NewProviderID("org", "tenant", "site", id),
+		},
+		{
+			name:      "non-canonical escaping strict",
+			input:     "nvidia-bmm://%6Frg/tenant/site/" + testInstanceID,
+			mode:      ParseStrict,
+			wantError: "org segment",
+		},
+		{
+			name:  "empty tenant lenient",
+			input: "nvidia-bmm://org//site/" + testInstanceID,
+			mode:  ParseLenient,
+			want:  NewProviderID("org", "", "site", id),
+		},
+		{
+			name:      "empty tenant strict",
+			input:     "nvidia-bmm://org//site/" + testInstanceID,
+			mode:      ParseStrict,
+			wantError: "empty tenant segment",
+		},
+		{
+			name:      "invalid escape",
+			input:     "nvidia-bmm://org%zz/tenant/site/" + testInstanceID,
+			mode:      ParseLenient,
+			wantError: "invalid org segment",
+		},
+		{
+			name:      "wrong prefix",
+			input:     "aws://org/tenant/site/" + testInstanceID,
+			mode:      ParseLenient,
+			wantError: "invalid provider ID prefix",
+		},
+		{
+			name:      "too many segments",
+			input:     "nvidia-bmm://org/tenant/site/extra/" + testInstanceID,
+			mode:      ParseLenient,
+			wantError: "expected 3 or 4 segments",
+		},
+		{
+			name:      "invalid instance ID",
+			input:     "nvidia-bmm://org/tenant/site/not-a-uuid",
+			mode:      ParseLenient,
+			wantError: "invalid instance ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input, tt.mode)
+			if tt.wantError != "" {
+				if err == nil {
+					t.Fatalf("Parse() = %v, expected error containing %q", got, tt.wantError)
+				}
+				if !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("Parse() error = %v, expected it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if *got != *tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalAndEqual(t *testing.T) {
+	id := uuid.MustParse(testInstanceID)
+	a := NewProviderID("My-Org", "Tenant", "SITE", id)
+	b := NewProviderID("my-org", "tenant", "site", id)
+
+	if got := a.Canonical(); *got != *b {
+		t.Errorf("Canonical() = %+v, want %+v", got, b)
+	}
+	if a.OrgName != "My-Org" {
+		t.Error("Canonical() must not modify the receiver")
+	}
+	if !a.Equal(b) {
+		t.Error("Expected provider IDs differing only by case to be equal")
+	}
+	if a.Equal(NewProviderID("my-org", "tenant", "site", uuid.New())) {
+		t.Error("Expected provider IDs with different instance IDs to differ")
+	}
+	if a.Equal(NewProviderID("my-org", "", "site", id)) {
+		t.Error("Expected a legacy provider ID to differ from a 4-segment one")
+	}
+	if a.Equal(nil) {
+		t.Error("Expected a provider ID to differ from nil")
+	}
+	var nilPID *ProviderID
+	if !nilPID.Equal(nil) {
+		t.Error("Expected nil provider IDs to be equal")
+	}
+}
+
+func TestTextMarshaling(t *testing.T) {
+	type nodeRecord struct {
+		ProviderID ProviderID `json:"providerID"`
+	}
+
+	pid := NewProviderID("my org", "tenant", "site", uuid.MustParse(testInstanceID))
+	data, err := json.Marshal(nodeRecord{ProviderID: *pid})
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	want := `{"providerID":"nvidia-bmm://my%20org/tenant/site/` + testInstanceID + `"}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+
+	var decoded nodeRecord
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	if decoded.ProviderID != *pid {
+		t.Errorf("Unmarshal() = %+v, want %+v", decoded.ProviderID, pid)
+	}
+
+	if err := json.Unmarshal([]byte(`{"providerID":"aws://i-123"}`), &decoded); err == nil {
+		t.Error("Expected error unmarshaling an invalid provider ID")
+	}
+}
+
+func FuzzParseStringRoundTrip(f *testing.F) {
+	id := uuid.MustParse(testInstanceID)
+	f.Add("org", "tenant", "site", id[:])
+	f.Add("org", "", "site", id[:])
+	f.Add("My Org", "a/b", "site%20", id[:])
+	f.Add("", "", "", make([]byte, 16))
+	f.Add("ünïcode", "t?x=1#frag", "..", id[:])
+
+	f.Fuzz(func(t *testing.T, org, tenant, site string, instanceID []byte) {
+		id, err := uuid.FromBytes(instanceID)
+		if err != nil {
+			t.Skip()
+		}
+		pid := NewProviderID(org, tenant, site, id)
+		s := pid.String()
+
+		got, err := ParseProviderID(s)
+		if err != nil {
+			t.Fatalf("ParseProviderID(%q) failed: %v", s, err)
+		}
+		if *got != *pid {
+			t.Fatalf("ParseProviderID(%q) = %+v, want %+v", s, got, pid)
+		}
+
+		if org == "" || tenant == "" || site == "" {
+			return
+		}
+		strict, err := Parse(s, ParseStrict)
+		if err != nil {
+			t.Fatalf("Parse(%q, ParseStrict) failed: %v", s, err)
+		}
+		if *strict != *pid {
+			t.Fatalf("Parse(%q, ParseStrict) = %+v, want %+v", s, strict, pid)
+		}
+	})
+}
+
+func FuzzParseStrictIsCanonical(f *testing.F) {
+	f.Add("nvidia-bmm://org/tenant/site/" + testInstanceID)
+	f.Add("nvidia-bmm://my%20org/a%2Fb/site/" + testInstanceID)
+	f.Add("nvidia-bmm://%6Frg/tenant/site/" + testInstanceID)
+	f.Add("nvidia-bmm://org/site/" + testInstanceID)
+
+	f.Fuzz(func(t *testing.T, s string) {
+		pid, err := Parse(s, ParseStrict)
+		if err != nil {
+			return
+		}
+		if got := pid.String(); got != s {
+			t.Fatalf("Parse(%q, ParseStrict).String() = %q, strict parsing must only accept canonical strings", s, got)
+		}
+		if _, err := ParseProviderID(s); err != nil {
+			t.Fatalf("ParseProviderID(%q) failed for a strictly valid provider ID: %v", s, err)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package envtest
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	nodelifecyclecontroller "k8s.io/cloud-provider/controllers/nodelifecycle"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	nvidiabmmprovider "github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/cloudprovider"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/providerid"
+)
+
+const (
+	timeout  = 30 * time.Second
+	interval = 250 * time.Millisecond
+)
+
+// addInstance adds a ready instance of the test site and tenant to the fake API
+func addInstance(name, address string) restclient.Instance {
+	return fake.AddInstance(restclient.Instance{
+		Name:     ptr(name),
+		SiteId:   &testSiteID,
+		TenantId: &testTenantID,
+		Status:   ptr(restclient.InstanceStatus("Ready")),
+		Interfaces: &[]restclient.Interface{{
+			IpAddresses: &[]string{address},
+		}},
+	})
+}
+
+// createNode registers a node for an instance, as the kubelet does
+func createNode(name string, instanceID uuid.UUID, taints ...corev1.Taint) *corev1.Node {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.NodeSpec{
+			ProviderID: providerid.NewProviderID(testOrg, testTenantID.String(), testSiteName, instanceID).String(),
+			Taints:     taints,
+		},
+	}
+	created, err := kubeClient.CoreV1().Nodes().Create(ctx, node, metav1.CreateOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(func() {
+		err := kubeClient.CoreV1().Nodes().Delete(ctx, name, metav1.DeleteOptions{})
+		if !apierrors.IsNotFound(err) {
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+	return created
+}
+
+// getNode returns the current state of a node
+func getNode(name string) (*corev1.Node, error) {
+	return kubeClient.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+}
+
+// hasTaint reports whether a node has a taint with the given key
+func hasTaint(node *corev1.Node, key string) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+var _ = Describe("Cloud node controller", func() {
+	It("initializes nodes from their NVIDIA BMM instances", func() {
+		instance := addInstance("init-node", "10.0.0.10")
+		createNode("init-node", *instance.Id, corev1.Taint{
+			Key:    cloudproviderapi.TaintExternalCloudProvider,
+			Value:  "true",
+			Effect: corev1.TaintEffectNoSchedule,
+		})
+
+		zone := "nvidia-bmm-zone-" + testSiteID.String()
+		Eventually(func(g Gomega) {
+			node, err := getNode("init-node")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(hasTaint(node, cloudproviderapi.TaintExternalCloudProvider)).To(BeFalse())
+			g.Expect(node.Labels).To(HaveKeyWithValue(corev1.LabelTopologyZone, zone))
+			g.Expect(node.Labels).To(HaveKey(corev1.LabelTopologyRegion))
+			g.Expect(node.Labels).To(HaveKeyWithValue(corev1.LabelInstanceTypeStable, "nvidia-bmm-instance"))
+			g.Expect(node.Status.Addresses).To(ContainElements(
+				corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.10"},
+				corev1.NodeAddress{Type: corev1.NodeHostName, Address: "init-node"},
+			))
+		}, timeout, interval).Should(Succeed())
+	})
+
+	It("updates the addresses of initialized nodes", func() {
+		instance := addInstance("address-node", "10.0.0.20")
+		createNode("address-node", *instance.Id, corev1.Taint{
+			Key:    cloudproviderapi.TaintExternalCloudProvider,
+			Value:  "true",
+			Effect: corev1.TaintEffectNoSchedule,
+		})
+		Eventually(func(g Gomega) {
+			node, err := getNode("address-node")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(hasTaint(node, cloudproviderapi.TaintExternalCloudProvider)).To(BeFalse())
+		}, timeout, interval).Should(Succeed())
+
+		fake.UpdateInstance(*instance.Id, func(instance *restclient.Instance) {
+			instance.Interfaces = &[]restclient.Interface{{IpAddresses: &[]string{"10.0.0.21"}}}
+		})
+		Eventually(func(g Gomega) {
+			node, err := getNode("address-node")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(node.Status.Addresses).To(ContainElement(
+				corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.21"}))
+		}, timeout, interval).Should(Succeed())
+	})
+})
+
+var _ = Describe("Cloud node lifecycle controller", func() {
+	It("taints nodes whose instance is shut down and untaints them once ready", func() {
+		instance := addInstance("shutdown-node", "10.0.0.30")
+		createNode("shutdown-node", *instance.Id)
+
+		fake.SetInstanceStatus(*instance.Id, "Terminating")
+		Eventually(func(g Gomega) {
+			node, err := getNode("shutdown-node")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(hasTaint(node, nodelifecyclecontroller.ShutdownTaint.Key)).To(BeTrue())
+		}, timeout, interval).Should(Succeed())
+
+		// The shutdown taint is removed once the kubelet reports the node ready again
+		fake.SetInstanceStatus(*instance.Id, "Ready")
+		node, err := getNode("shutdown-node")
+		Expect(err).NotTo(HaveOccurred())
+		node.Status.Conditions = []corev1.NodeCondition{{
+			Type:               corev1.NodeReady,
+			Status:             corev1.ConditionTrue,
+			LastHeartbeatTime:  metav1.Now(),
+			LastTransitionTime: metav1.Now(),
+		}}
+		_, err = kubeClient.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func(g Gomega) {
+			node, err := getNode("shutdown-node")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(hasTaint(node, nodelifecyclecontroller.ShutdownTaint.Key)).To(BeFalse())
+		}, timeout, interval).Should(Succeed())
+	})
+
+	It("taints nodes whose machine was reprovisioned", func() {
+		instance := addInstance("reprovisioned-node", "10.0.0.50")
+		fake.UpdateInstance(*instance.Id, func(instance *restclient.Instance) {
+			instance.MachineId = ptr("machine-1")
+		})
+		createNode("reprovisioned-node", *instance.Id, corev1.Taint{
+			Key:    cloudproviderapi.TaintExternalCloudProvider,
+			Value:  "true",
+			Effect: corev1.TaintEffectNoSchedule,
+		})
+		Eventually(func(g Gomega) {
+			node, err := getNode("reprovisioned-node")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(node.Annotations).To(HaveKeyWithValue(nvidiabmmprovider.AnnotationMachineID, "machine-1"))
+		}, timeout, interval).Should(Succeed())
+
+		// The node has no ready condition, so the lifecycle controller checks whether it is shut down
+		fake.UpdateInstance(*instance.Id, func(instance *restclient.Instance) {
+			instance.MachineId = ptr("machine-2")
+		})
+		Eventually(func(g Gomega) {
+			node, err := getNode("reprovisioned-node")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(hasTaint(node, nodelifecyclecontroller.ShutdownTaint.Key)).To(BeTrue())
+		}, timeout, interval).Should(Succeed())
+	})
+
+	It("deletes nodes whose instance was removed", func() {
+		instance := addInstance("deleted-node", "10.0.0.40")
+		createNode("deleted-node", *instance.Id)
+
+		// The node is kept while its instance exists
+		Consistently(func() error {
+			_, err := getNode("deleted-node")
+			return err
+		}, 3*nodeMonitorPeriod, interval).Should(Succeed())
+
+		fake.DeleteInstance(*instance.Id)
+		Eventually(func() bool {
+			_, err := getNode("deleted-node")
+			return apierrors.IsNotFound(err)
+		}, timeout, interval).Should(BeTrue())
+	})
+})
@@ -0,0 +1,126 @@
+package envtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	cloudprovider "k8s.io/cloud-provider"
+	nodecontroller "k8s.io/cloud-provider/controllers/node"
+	nodelifecyclecontroller "k8s.io/cloud-provider/controllers/nodelifecycle"
+	controllersmetrics "k8s.io/component-base/metrics/prometheus/controllers"
+	"k8s.io/controller-manager/pkg/clientbuilder"
+	crenvtest "sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	restclient "github.com/NVIDIA/carbide-rest/client"
+	"github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/bmmfake"
+	nvidiabmmprovider "github.com/fabiendupont/cloud-provider-nvidia-bmm/pkg/cloudprovider"
+)
+
+const (
+	testOrg      = "test-org"
+	testSiteName = "envtest-site"
+
+	// Short controller periods keep the specs fast
+	nodeStatusUpdateFrequency = time.Second
+	nodeMonitorPeriod         = time.Second
+)
+
+var (
+	ctx        context.Context
+	cancel     context.CancelFunc
+	testEnv    *crenvtest.Environment
+	kubeClient kubernetes.Interface
+	fake       *bmmfake.Server
+	cloud      cloudprovider.Interface
+
+	testSiteID   = uuid.MustParse("8a880c71-fe4b-4e43-9e24-ebfcb8a84c5f")
+	testTenantID = uuid.MustParse("b013708a-99f0-47b2-a630-cabb4ae1d3df")
+)
+
+// TestEnvtest runs the cloud-node and cloud-node-lifecycle controllers against a real
+// kube-apiserver and the fake NVIDIA BMM API. It needs the kube-apiserver and etcd
+// binaries in KUBEBUILDER_ASSETS, see make test-envtest. It is skipped without them, unless
+// the CI environment variable is set.
+func TestEnvtest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cloud Controller Envtest Suite")
+}
+
+var _ = BeforeSuite(func() {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		// CI must run the suite rather than report it as skipped
+		if os.Getenv("CI") != "" {
+			Fail("KUBEBUILDER_ASSETS is not set in CI, run make test-envtest")
+		}
+		Skip("KUBEBUILDER_ASSETS is not set, run make test-envtest")
+	}
+	ctx, cancel = context.WithCancel(context.TODO())
+
+	testEnv = &crenvtest.Environment{}
+	cfg, err := testEnv.Start()
+	Expect(err).NotTo(HaveOccurred())
+	kubeClient, err = kubernetes.NewForConfig(cfg)
+	Expect(err).NotTo(HaveOccurred())
+
+	fake = bmmfake.NewServer(testOrg, bmmfake.WithToken("test-token"))
+	fake.AddSite(restclient.Site{Id: &testSiteID, Name: ptr(testSiteName)})
+
+	cloud, err = nvidiabmmprovider.NewNvidiaBMMCloud(strings.NewReader(fmt.Sprintf(`apiVersion: bmm.nvidia.com/v1alpha1
+kind: CloudConfig
+api:
+  endpoint: %q
+  orgName: %s
+  token: test-token
+  requestTimeout: 5s
+cluster:
+  siteId: %s
+  tenantId: %s
+`, fake.URL(), testOrg, testSiteName, testTenantID)))
+	Expect(err).NotTo(HaveOccurred())
+	cloud.Initialize(clientbuilder.SimpleControllerClientBuilder{ClientConfig: rest.CopyConfig(cfg)}, ctx.Done())
+
+	startControllers()
+})
+
+var _ = AfterSuite(func() {
+	if cancel != nil {
+		cancel()
+	}
+	if fake != nil {
+		fake.Close()
+	}
+	if testEnv != nil {
+		Expect(testEnv.Stop()).To(Succeed())
+	}
+})
+
+// startControllers runs the cloud controllers the way the cloud controller manager does
+func startControllers() {
+	factory := informers.NewSharedInformerFactory(kubeClient, 0)
+	metrics := controllersmetrics.NewControllerManagerMetrics("envtest")
+
+	nodeController, err := nodecontroller.NewCloudNodeController(
+		factory.Core().V1().Nodes(), kubeClient, cloud, nodeStatusUpdateFrequency, 2)
+	Expect(err).NotTo(HaveOccurred())
+	lifecycleController, err := nodelifecyclecontroller.NewCloudNodeLifecycleController(
+		factory.Core().V1().Nodes(), kubeClient, cloud, nodeMonitorPeriod)
+	Expect(err).NotTo(HaveOccurred())
+
+	factory.Start(ctx.Done())
+	go nodeController.RunWithContext(ctx, metrics)
+	go lifecycleController.Run(ctx, metrics)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
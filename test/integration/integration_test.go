@@ -66,6 +66,45 @@ type mockNvidiaBMMClient struct {
 		params *restclient.GetInstanceParams,
 		reqEditors ...restclient.RequestEditorFn,
 	) (*restclient.GetInstanceResponse, error)
+	getAllInstanceFunc func(
+		ctx context.Context, org string,
+		params *restclient.GetAllInstanceParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetAllInstanceResponse, error)
+	getAllSiteFunc func(
+		ctx context.Context, org string,
+		params *restclient.GetAllSiteParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetAllSiteResponse, error)
+	getInstanceTypeFunc func(
+		ctx context.Context, org string, instanceTypeId uuid.UUID,
+		params *restclient.GetInstanceTypeParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetInstanceTypeResponse, error)
+	getSubnetFunc func(
+		ctx context.Context, org string, subnetId uuid.UUID,
+		params *restclient.GetSubnetParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetSubnetResponse, error)
+	getVpcPrefixFunc func(
+		ctx context.Context, org string, vpcPrefixId uuid.UUID,
+		params *restclient.GetVpcPrefixParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetVpcPrefixResponse, error)
+	getSiteFunc func(
+		ctx context.Context, org string, siteId uuid.UUID,
+		params *restclient.GetSiteParams,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetSiteResponse, error)
+	getCurrentTenantFunc func(
+		ctx context.Context, org string,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.GetCurrentTenantResponse, error)
+	updateInstanceFunc func(
+		ctx context.Context, org string, instanceId uuid.UUID,
+		body restclient.UpdateInstanceJSONRequestBody,
+		reqEditors ...restclient.RequestEditorFn,
+	) (*restclient.UpdateInstanceResponse, error)
 }
 
 func (m *mockNvidiaBMMClient) GetInstanceWithResponse(
@@ -96,6 +135,171 @@ func (m *mockNvidiaBMMClient) GetInstanceWithResponse(
 	}, nil
 }
 
+func (m *mockNvidiaBMMClient) GetAllInstanceWithResponse(
+	ctx context.Context, org string,
+	params *restclient.GetAllInstanceParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetAllInstanceResponse, error) {
+	if m.getAllInstanceFunc != nil {
+		return m.getAllInstanceFunc(ctx, org, params, reqEditors...)
+	}
+
+	// Default: return a single instance named after the test node
+	instanceID := uuid.MustParse("12345678-1234-1234-1234-123456789abc")
+	ipAddresses := []string{"10.100.1.10"}
+
+	return &restclient.GetAllInstanceResponse{
+		HTTPResponse: mockHTTPResponse(200),
+		JSON200: &[]restclient.Instance{
+			{
+				Id:   &instanceID,
+				Name: ptr("test-node"),
+				Interfaces: &[]restclient.Interface{
+					{
+						IpAddresses: &ipAddresses,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (m *mockNvidiaBMMClient) GetAllSiteWithResponse(
+	ctx context.Context, org string,
+	params *restclient.GetAllSiteParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetAllSiteResponse, error) {
+	if m.getAllSiteFunc != nil {
+		return m.getAllSiteFunc(ctx, org, params, reqEditors...)
+	}
+
+	// Default: return the site of the test cluster
+	siteID := uuid.MustParse("8a880c71-fe4b-4e43-9e24-ebfcb8a84c5f")
+
+	return &restclient.GetAllSiteResponse{
+		HTTPResponse: mockHTTPResponse(200),
+		JSON200: &[]restclient.Site{
+			{
+				Id:   &siteID,
+				Name: ptr("test-site"),
+			},
+		},
+	}, nil
+}
+
+func (m *mockNvidiaBMMClient) GetSiteWithResponse(
+	ctx context.Context, org string, siteId uuid.UUID,
+	params *restclient.GetSiteParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetSiteResponse, error) {
+	if m.getSiteFunc != nil {
+		return m.getSiteFunc(ctx, org, siteId, params, reqEditors...)
+	}
+
+	// Default: return the site of the test cluster
+	return &restclient.GetSiteResponse{
+		HTTPResponse: mockHTTPResponse(200),
+		JSON200: &restclient.Site{
+			Id:   &siteId,
+			Name: ptr("test-site"),
+		},
+	}, nil
+}
+
+func (m *mockNvidiaBMMClient) GetCurrentTenantWithResponse(
+	ctx context.Context, org string,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetCurrentTenantResponse, error) {
+	if m.getCurrentTenantFunc != nil {
+		return m.getCurrentTenantFunc(ctx, org, reqEditors...)
+	}
+
+	// Default: return the tenant of the test cluster
+	return &restclient.GetCurrentTenantResponse{
+		HTTPResponse: mockHTTPResponse(200),
+		JSON200: &restclient.Tenant{
+			Id:  ptr(uuid.MustParse("b013708a-99f0-47b2-a630-cabb4ae1d3df")),
+			Org: ptr(org),
+		},
+	}, nil
+}
+
+func (m *mockNvidiaBMMClient) UpdateInstanceWithResponse(
+	ctx context.Context, org string, instanceId uuid.UUID,
+	body restclient.UpdateInstanceJSONRequestBody,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.UpdateInstanceResponse, error) {
+	if m.updateInstanceFunc != nil {
+		return m.updateInstanceFunc(ctx, org, instanceId, body, reqEditors...)
+	}
+
+	// Default: return the updated instance
+	return &restclient.UpdateInstanceResponse{
+		HTTPResponse: mockHTTPResponse(200),
+		JSON200:      &restclient.Instance{Id: &instanceId},
+	}, nil
+}
+
+func (m *mockNvidiaBMMClient) GetInstanceTypeWithResponse(
+	ctx context.Context, org string, instanceTypeId uuid.UUID,
+	params *restclient.GetInstanceTypeParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetInstanceTypeResponse, error) {
+	if m.getInstanceTypeFunc != nil {
+		return m.getInstanceTypeFunc(ctx, org, instanceTypeId, params, reqEditors...)
+	}
+
+	// Default: return a GPU instance type
+	return &restclient.GetInstanceTypeResponse{
+		HTTPResponse: mockHTTPResponse(200),
+		JSON200: &restclient.InstanceType{
+			Id:          &instanceTypeId,
+			Name:        ptr("gb200-nvl"),
+			Description: ptr("4x NVIDIA GB200"),
+		},
+	}, nil
+}
+
+func (m *mockNvidiaBMMClient) GetSubnetWithResponse(
+	ctx context.Context, org string, subnetId uuid.UUID,
+	params *restclient.GetSubnetParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetSubnetResponse, error) {
+	if m.getSubnetFunc != nil {
+		return m.getSubnetFunc(ctx, org, subnetId, params, reqEditors...)
+	}
+
+	// Default: return a pod subnet
+	return &restclient.GetSubnetResponse{
+		HTTPResponse: mockHTTPResponse(200),
+		JSON200: &restclient.Subnet{
+			Id:           &subnetId,
+			Ipv4Prefix:   ptr("10.128.0.0"),
+			PrefixLength: ptr(16),
+		},
+	}, nil
+}
+
+func (m *mockNvidiaBMMClient) GetVpcPrefixWithResponse(
+	ctx context.Context, org string, vpcPrefixId uuid.UUID,
+	params *restclient.GetVpcPrefixParams,
+	reqEditors ...restclient.RequestEditorFn,
+) (*restclient.GetVpcPrefixResponse, error) {
+	if m.getVpcPrefixFunc != nil {
+		return m.getVpcPrefixFunc(ctx, org, vpcPrefixId, params, reqEditors...)
+	}
+
+	// Default: return a prefix routed to the instance
+	return &restclient.GetVpcPrefixResponse{
+		HTTPResponse: mockHTTPResponse(200),
+		JSON200: &restclient.VpcPrefix{
+			Id:           &vpcPrefixId,
+			Prefix:       ptr("10.200.1.0"),
+			PrefixLength: ptr(24),
+		},
+	}, nil
+}
+
 var _ = Describe("InstancesV2 Interface", func() {
 	var (
 		node       *corev1.Node
@@ -196,6 +400,17 @@ var _ = Describe("InstancesV2 Interface", func() {
 			Expect(metadata.Zone).To(ContainSubstring("nvidia-bmm-zone"))
 			Expect(metadata.Region).To(ContainSubstring("nvidia-bmm-region"))
 		})
+
+		It("should discover the provider ID of a node registered without one", func() {
+			node.Spec.ProviderID = ""
+
+			instancesV2, _ := cloud.InstancesV2()
+			metadata, err := instancesV2.InstanceMetadata(ctx, node)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.ProviderID).To(Equal(
+				"nvidia-bmm://test-org/b013708a-99f0-47b2-a630-cabb4ae1d3df/" +
+					"8a880c71-fe4b-4e43-9e24-ebfcb8a84c5f/" + instanceID.String()))
+		})
 	})
 })
 
@@ -224,6 +439,18 @@ var _ = Describe("Zones Interface", func() {
 			Expect(zone.FailureDomain).To(ContainSubstring("nvidia-bmm-zone"))
 			Expect(zone.Region).To(ContainSubstring("nvidia-bmm-region"))
 		})
+
+		It("should return the same zone for a site name", func() {
+			zones, _ := cloud.Zones()
+			byUUID, err := zones.GetZoneByProviderID(ctx, "nvidia-bmm://test-org/test-tenant/"+
+				"8a880c71-fe4b-4e43-9e24-ebfcb8a84c5f/12345678-1234-1234-1234-123456789abc")
+			Expect(err).NotTo(HaveOccurred())
+
+			byName, err := zones.GetZoneByProviderID(ctx,
+				"nvidia-bmm://test-org/test-tenant/test-site/12345678-1234-1234-1234-123456789abc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(byName).To(Equal(byUUID))
+		})
 	})
 
 	Describe("GetZoneByNodeName", func() {
@@ -242,3 +469,35 @@ var _ = Describe("Zones Interface", func() {
 func ptr[T any](v T) *T {
 	return &v
 }
+
+var _ = Describe("Resolver", func() {
+	It("should resolve a provider ID without a node", func() {
+		resolver := cloud.(*nvidiabmmprovider.NvidiaBMMCloud).Resolver()
+		providerID := "nvidia-bmm://test-org/b013708a-99f0-47b2-a630-cabb4ae1d3df/" +
+			"8a880c71-fe4b-4e43-9e24-ebfcb8a84c5f/12345678-1234-1234-1234-123456789abc"
+
+		view, err := resolver.Resolve(ctx, providerID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(view.Name).To(Equal("test-instance"))
+		Expect(view.Status).To(Equal("Running"))
+		Expect(view.Shutdown).To(BeFalse())
+		Expect(view.Zone).To(Equal("nvidia-bmm-zone-8a880c71-fe4b-4e43-9e24-ebfcb8a84c5f"))
+		Expect(view.Addresses).To(ContainElement(corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.100.1.10"}))
+	})
+
+	It("should report missing instances", func() {
+		mockClient.getInstanceFunc = func(
+			ctx context.Context, org string, instanceId uuid.UUID,
+			params *restclient.GetInstanceParams,
+			reqEditors ...restclient.RequestEditorFn,
+		) (*restclient.GetInstanceResponse, error) {
+			return &restclient.GetInstanceResponse{HTTPResponse: mockHTTPResponse(404)}, nil
+		}
+		defer func() { mockClient.getInstanceFunc = nil }()
+
+		resolver := cloud.(*nvidiabmmprovider.NvidiaBMMCloud).Resolver()
+		_, err := resolver.Resolve(ctx, "nvidia-bmm://test-org/b013708a-99f0-47b2-a630-cabb4ae1d3df/"+
+			"8a880c71-fe4b-4e43-9e24-ebfcb8a84c5f/12345678-1234-1234-1234-123456789abc")
+		Expect(err).To(MatchError(nvidiabmmprovider.ErrInstanceNotFound))
+	})
+})